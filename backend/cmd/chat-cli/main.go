@@ -0,0 +1,389 @@
+// Command chat-cli is an interactive terminal client for the chat server. It
+// logs in over the REST API, joins rooms over WebSocket and reconnects on its
+// own when the connection drops.
+package main
+
+import (
+	"backend/internal/models"
+	"backend/pkg/chatclient"
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const usage = `Usage: chat-cli [flags] -user <username>
+
+Reads the password from CHAT_PASSWORD, or asks for it.
+
+Flags:
+`
+
+const help = `Commands:
+  /rooms           List the rooms you can join
+  /join <room>     Join a room by name or ID, leaving the current one
+  /create <name>   Create a public room and join it
+  /help            Show this help
+  /quit            Leave and exit (also Ctrl-D or Ctrl-C)
+Anything else is sent to the current room.`
+
+// historyOnJoin is how many earlier messages are shown when joining a room.
+const historyOnJoin = 20
+
+// sendQueueSize is how many typed messages may wait to be sent.
+const sendQueueSize = 16
+
+func main() {
+	server := flag.String("server", "http://localhost:8082", "server `URL`; https:// connects over TLS")
+	username := flag.String("user", os.Getenv("CHAT_USER"), "`username` to log in as (CHAT_USER)")
+	register := flag.Bool("register", false, "create the account before logging in")
+	room := flag.String("room", "", "`room` to join on start, by name or ID")
+	caFile := flag.String("ca", "", "PEM `file` of a certificate authority to trust, such as a self-signed server certificate")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *username == "" || flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*server, *username, *register, *room, *caFile); err != nil {
+		fmt.Fprintf(os.Stderr, "chat-cli: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run logs in and reads commands until the user quits.
+func run(server, username string, register bool, room, caFile string) error {
+	tlsConfig, err := loadCA(caFile)
+	if err != nil {
+		return err
+	}
+	httpClient := &http.Client{
+		Timeout:   15 * time.Second,
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+	}
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 15 * time.Second,
+		TLSClientConfig:  tlsConfig,
+	}
+	client, err := chatclient.New(server, httpClient)
+	if err != nil {
+		return err
+	}
+
+	lines := readLines(os.Stdin)
+	password := os.Getenv("CHAT_PASSWORD")
+	if password == "" {
+		fmt.Fprintf(os.Stderr, "Password for %s (shown as typed): ", username)
+		line, ok := <-lines
+		if !ok || line == "" {
+			return errors.New("no password given")
+		}
+		password = line
+	}
+
+	ctx := context.Background()
+	if register {
+		if _, err := client.Register(ctx, username, password); err != nil {
+			return fmt.Errorf("registering: %w", err)
+		}
+	}
+	if _, err := client.Login(ctx, username, password); err != nil {
+		return fmt.Errorf("logging in: %w", err)
+	}
+
+	c := &chat{client: client, dialer: dialer, out: &printer{w: os.Stdout}}
+	c.out.info("logged in as %s; type /help for commands", username)
+	if room != "" {
+		c.join(room)
+	} else {
+		c.listRooms()
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	defer c.leave()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case line, ok := <-lines:
+			if !ok || !c.handle(line) {
+				return nil
+			}
+		}
+	}
+}
+
+// loadCA returns the TLS settings that trust caFile as well as the system's
+// authorities, or nil when caFile is empty.
+func loadCA(caFile string) (*tls.Config, error) {
+	if caFile == "" {
+		return nil, nil
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s holds no PEM certificates", caFile)
+	}
+	return &tls.Config{RootCAs: roots}, nil
+}
+
+// readLines sends each line of r on the returned channel, and closes it at
+// the end of input.
+func readLines(r io.Reader) <-chan string {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines <- strings.TrimRight(scanner.Text(), "\r")
+		}
+	}()
+	return lines
+}
+
+// chat holds the state of the client: who is logged in and which room's
+// session is open.
+type chat struct {
+	client *chatclient.Client
+	dialer *websocket.Dialer
+	out    *printer
+
+	// The current room and its session. Typed messages wait in queue while
+	// the session reconnects; sent is closed once the sender has stopped.
+	room    models.ChatRoom
+	session *chatclient.Session
+	queue   chan string
+	sent    chan struct{}
+}
+
+// handle runs one line of input and reports false when the user quits.
+func (c *chat) handle(line string) bool {
+	if strings.TrimSpace(line) == "" {
+		return true
+	}
+	if !strings.HasPrefix(line, "/") {
+		if c.session == nil || c.session.Err() != nil {
+			c.out.info("join a room first; /rooms lists them")
+			return true
+		}
+		select {
+		case c.queue <- line:
+		default:
+			c.out.info("too many messages are waiting to be sent; try again once reconnected")
+		}
+		return true
+	}
+
+	command, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+	arg = strings.TrimSpace(arg)
+	switch command {
+	case "/quit", "/exit":
+		return false
+	case "/help":
+		c.out.info("%s", help)
+	case "/rooms":
+		c.listRooms()
+	case "/join":
+		if arg == "" {
+			c.out.info("usage: /join <room>")
+			break
+		}
+		c.join(arg)
+	case "/create":
+		if arg == "" {
+			c.out.info("usage: /create <name>")
+			break
+		}
+		room, err := c.client.CreateRoom(context.Background(), arg)
+		if err != nil {
+			c.out.info("could not create %s: %v", arg, err)
+			break
+		}
+		c.connect(*room)
+	default:
+		c.out.info("unknown command %s; /help lists them", command)
+	}
+	return true
+}
+
+// listRooms prints the rooms the user can see.
+func (c *chat) listRooms() {
+	rooms, err := c.client.Rooms(context.Background())
+	if err != nil {
+		c.out.info("could not list rooms: %v", err)
+		return
+	}
+	if len(rooms) == 0 {
+		c.out.info("there are no rooms yet; /create one")
+		return
+	}
+	var list strings.Builder
+	list.WriteString("rooms:")
+	for _, room := range rooms {
+		list.WriteString("\n  " + room.Name)
+		if room.RoomType != "public" {
+			list.WriteString(" (" + room.RoomType + ")")
+		}
+		if c.session != nil && c.room.ID == room.ID {
+			list.WriteString(" *")
+		}
+	}
+	c.out.info("%s", list.String())
+}
+
+// join looks a room up by name or ID, becomes a member and connects to it.
+func (c *chat) join(ref string) {
+	ctx := context.Background()
+	rooms, err := c.client.Rooms(ctx)
+	if err != nil {
+		c.out.info("could not list rooms: %v", err)
+		return
+	}
+	var room *models.ChatRoom
+	for i := range rooms {
+		if rooms[i].ID == ref || rooms[i].Name == ref {
+			room = &rooms[i]
+			break
+		}
+	}
+	if room == nil {
+		c.out.info("no room called %s; /rooms lists them", ref)
+		return
+	}
+
+	member, err := c.client.JoinRoom(ctx, room.ID)
+	if err != nil {
+		c.out.info("could not join %s: %v", room.Name, err)
+		return
+	}
+	if member.Status != "member" {
+		c.out.info("asked to join %s; a member has to accept the request", room.Name)
+		return
+	}
+	c.connect(*room)
+}
+
+// connect leaves the current room and opens a session to room.
+func (c *chat) connect(room models.ChatRoom) {
+	c.leave()
+	reconnecting := false
+	handlers := chatclient.Handlers{
+		Message: c.out.message,
+		MessageDeleted: func(models.MessageDeletedEvent) {
+			c.out.info("a message was deleted by a moderator")
+		},
+		Error: func(event models.ErrorEvent) {
+			c.out.info("%s", event.Message)
+		},
+		StateChange: func(state chatclient.State, err error) {
+			switch {
+			case state == chatclient.StateConnected && err != nil:
+				c.out.info("connected to %s, but could not load missed messages: %v", room.Name, err)
+			case state == chatclient.StateConnected && reconnecting:
+				c.out.info("reconnected to %s", room.Name)
+			case state == chatclient.StateReconnecting:
+				c.out.info("connection lost (%v); reconnecting", err)
+			case state == chatclient.StateClosed && !errors.Is(err, chatclient.ErrClosed):
+				c.out.info("left %s: %v", room.Name, closeReason(err))
+			}
+			reconnecting = state == chatclient.StateReconnecting
+		},
+	}
+	session, err := c.client.Connect(context.Background(), room.ID, handlers,
+		&chatclient.SessionOptions{Dialer: c.dialer, History: historyOnJoin})
+	if err != nil {
+		c.out.info("could not connect to %s: %v", room.Name, err)
+		return
+	}
+	c.out.info("joined %s; type a message, or /help", room.Name)
+
+	c.room, c.session = room, session
+	c.queue, c.sent = make(chan string, sendQueueSize), make(chan struct{})
+	go c.sendQueued(session, c.queue, c.sent)
+}
+
+// sendQueued sends typed messages one at a time, so that they arrive in
+// order, until queue is closed or the session ends.
+func (c *chat) sendQueued(session *chatclient.Session, queue <-chan string, sent chan<- struct{}) {
+	defer close(sent)
+	for content := range queue {
+		_, err := session.Send(context.Background(), content)
+		var sendErr *chatclient.SendError
+		switch {
+		case err == nil:
+		case errors.As(err, &sendErr):
+			c.out.info("%s", sendErr.Event.Message)
+		case errors.Is(err, chatclient.ErrConnectionLost):
+			c.out.info("the connection dropped while sending %q; it may not have arrived", content)
+		case errors.Is(err, chatclient.ErrClosed):
+			return
+		default:
+			c.out.info("message not sent: %v", err)
+		}
+	}
+}
+
+// leave closes the current room's session, if any.
+func (c *chat) leave() {
+	if c.session == nil {
+		return
+	}
+	c.session.Close()
+	close(c.queue)
+	<-c.sent
+	c.session, c.queue, c.sent = nil, nil, nil
+}
+
+// closeReason describes why the server ended a session.
+func closeReason(err error) string {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) && closeErr.Text != "" {
+		return closeErr.Text
+	}
+	return err.Error()
+}
+
+// printer writes to the terminal from several goroutines.
+type printer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// message prints a chat message with its time and sender.
+func (p *printer) message(message models.MessageDTO) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.w, "[%s] %s: %s\n", message.Timestamp.Local().Format("15:04"), message.Sender, message.Content)
+}
+
+// info prints a notice from the client.
+func (p *printer) info(format string, args ...interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.w, "-- "+format+"\n", args...)
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"backend/internal/models"
+	"backend/internal/services"
+	"backend/internal/store"
+	"errors"
+	"flag"
+	"fmt"
+	"text/tabwriter"
+)
+
+// userCommand runs the "user" subcommands.
+func (a *app) userCommand(sub string, args []string) error {
+	fs := flag.NewFlagSet("user "+sub, flag.ContinueOnError)
+	switch sub {
+	case "list":
+		if _, err := parse(fs, args); err != nil {
+			return err
+		}
+		users, err := a.admin.ListUsers()
+		if err != nil {
+			return err
+		}
+		w := a.table("USERNAME", "ID", "ADMIN", "DISABLED")
+		for _, u := range users {
+			fmt.Fprintf(w, "%s\t%s\t%t\t%t\n", u.Username, u.ID, u.IsAdmin, u.Disabled)
+		}
+		return w.Flush()
+
+	case "create":
+		admin := fs.Bool("admin", false, "make the user an administrator")
+		rest, err := parse(fs, args, "username")
+		if err != nil {
+			return err
+		}
+		password, err := a.readPassword(rest[0])
+		if err != nil {
+			return err
+		}
+		user, err := a.admin.CreateUser(rest[0], password, *admin)
+		if errors.Is(err, store.ErrConflict) {
+			return fmt.Errorf("user %q already exists", rest[0])
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(a.out, "Created user %s (%s)\n", user.Username, user.ID)
+		return nil
+
+	case "disable", "enable":
+		rest, err := parse(fs, args, "username")
+		if err != nil {
+			return err
+		}
+		user, err := a.user(rest[0])
+		if err != nil {
+			return err
+		}
+		if _, err := a.admin.SetUserDisabled("", user.ID, sub == "disable"); err != nil {
+			return err
+		}
+		fmt.Fprintf(a.out, "%s user %s\n", pastTense(sub), user.Username)
+		return nil
+
+	case "reset-password":
+		rest, err := parse(fs, args, "username")
+		if err != nil {
+			return err
+		}
+		user, err := a.user(rest[0])
+		if err != nil {
+			return err
+		}
+		password, err := a.readPassword(user.Username)
+		if err != nil {
+			return err
+		}
+		if err := a.admin.ResetPassword(user.ID, password); err != nil {
+			return err
+		}
+		fmt.Fprintf(a.out, "Reset the password of %s\n", user.Username)
+		return nil
+
+	case "promote", "demote":
+		rest, err := parse(fs, args, "username")
+		if err != nil {
+			return err
+		}
+		user, err := a.user(rest[0])
+		if err != nil {
+			return err
+		}
+		if _, err := a.admin.SetUserAdmin("", user.ID, sub == "promote"); err != nil {
+			return err
+		}
+		fmt.Fprintf(a.out, "%s user %s\n", pastTense(sub), user.Username)
+		return nil
+
+	case "delete":
+		yes := fs.Bool("yes", false, "confirm the deletion")
+		rest, err := parse(fs, args, "username")
+		if err != nil {
+			return err
+		}
+		if !*yes {
+			return usageError("deleting a user also deletes their messages and the rooms they own; pass -yes to confirm")
+		}
+		user, err := a.user(rest[0])
+		if err != nil {
+			return err
+		}
+		if err := a.admin.DeleteUser("", user.ID); err != nil {
+			return err
+		}
+		fmt.Fprintf(a.out, "Deleted user %s\n", user.Username)
+		return nil
+	}
+	return usageError(fmt.Sprintf("unknown command \"user %s\"; run chatctl -h for the list", sub))
+}
+
+// roomCommand runs the "room" subcommands.
+func (a *app) roomCommand(sub string, args []string) error {
+	fs := flag.NewFlagSet("room "+sub, flag.ContinueOnError)
+	switch sub {
+	case "list":
+		if _, err := parse(fs, args); err != nil {
+			return err
+		}
+		rooms, err := a.admin.ListRooms()
+		if err != nil {
+			return err
+		}
+		w := a.table("NAME", "ID", "TYPE", "OWNER", "ARCHIVED")
+		for _, r := range rooms {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\n", r.Name, r.ID, r.RoomType, a.username(r.OwnerID), r.Archived)
+		}
+		return w.Flush()
+
+	case "create":
+		private := fs.Bool("private", false, "create a private room")
+		owner := fs.String("owner", "", "`username` of the room owner")
+		rest, err := parse(fs, args, "name")
+		if err != nil {
+			return err
+		}
+		if *owner == "" {
+			return usageError("room create: -owner is required")
+		}
+		user, err := a.user(*owner)
+		if err != nil {
+			return err
+		}
+		roomType := "public"
+		if *private {
+			roomType = "private"
+		}
+		room, err := a.rooms.CreateRoom(rest[0], user.ID, roomType)
+		if errors.Is(err, store.ErrConflict) {
+			return fmt.Errorf("room %q already exists", rest[0])
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(a.out, "Created %s room %s (%s)\n", room.RoomType, room.Name, room.ID)
+		return nil
+
+	case "archive", "unarchive":
+		rest, err := parse(fs, args, "room")
+		if err != nil {
+			return err
+		}
+		room, err := a.room(rest[0])
+		if err != nil {
+			return err
+		}
+		if _, err := a.admin.SetRoomArchived(room.ID, sub == "archive"); err != nil {
+			return err
+		}
+		fmt.Fprintf(a.out, "%s room %s\n", pastTense(sub), room.Name)
+		return nil
+
+	case "delete":
+		yes := fs.Bool("yes", false, "confirm the deletion")
+		rest, err := parse(fs, args, "room")
+		if err != nil {
+			return err
+		}
+		if !*yes {
+			return usageError("deleting a room also deletes its messages; pass -yes to confirm")
+		}
+		room, err := a.room(rest[0])
+		if err != nil {
+			return err
+		}
+		if err := a.admin.DeleteRoom(room.ID); err != nil {
+			return err
+		}
+		fmt.Fprintf(a.out, "Deleted room %s\n", room.Name)
+		return nil
+	}
+	return usageError(fmt.Sprintf("unknown command \"room %s\"; run chatctl -h for the list", sub))
+}
+
+// memberCommand runs the "member" subcommands.
+func (a *app) memberCommand(sub string, args []string) error {
+	fs := flag.NewFlagSet("member "+sub, flag.ContinueOnError)
+	switch sub {
+	case "list":
+		rest, err := parse(fs, args, "room")
+		if err != nil {
+			return err
+		}
+		room, err := a.room(rest[0])
+		if err != nil {
+			return err
+		}
+		members, err := a.admin.Members(room.ID)
+		if err != nil {
+			return err
+		}
+		w := a.table("USERNAME", "ROLE", "STATUS", "MUTED UNTIL")
+		for _, m := range members {
+			muted := ""
+			if m.MutedUntil != nil {
+				muted = m.MutedUntil.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", a.username(m.UserID), m.Role, m.Status, muted)
+		}
+		return w.Flush()
+
+	case "add":
+		role := fs.String("role", services.RoleMember, "member or moderator")
+		rest, err := parse(fs, args, "room", "username")
+		if err != nil {
+			return err
+		}
+		room, user, err := a.roomAndUser(rest[0], rest[1])
+		if err != nil {
+			return err
+		}
+		member, err := a.admin.AddMember(room.ID, user.ID, *role)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(a.out, "Added %s to %s as %s\n", user.Username, room.Name, member.Role)
+		return nil
+
+	case "remove":
+		rest, err := parse(fs, args, "room", "username")
+		if err != nil {
+			return err
+		}
+		room, user, err := a.roomAndUser(rest[0], rest[1])
+		if err != nil {
+			return err
+		}
+		if err := a.admin.RemoveMember(room.ID, user.ID); err != nil {
+			return err
+		}
+		fmt.Fprintf(a.out, "Removed %s from %s\n", user.Username, room.Name)
+		return nil
+	}
+	return usageError(fmt.Sprintf("unknown command \"member %s\"; run chatctl -h for the list", sub))
+}
+
+// stats prints site-wide counts and the busiest rooms.
+func (a *app) stats(args []string) error {
+	if _, err := parse(flag.NewFlagSet("stats", flag.ContinueOnError), args); err != nil {
+		return err
+	}
+	stats, err := a.admin.Stats()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(a.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Users\t%d\t(%d administrators, %d disabled)\n", stats.Users, stats.Admins, stats.DisabledUsers)
+	fmt.Fprintf(w, "Rooms\t%d\t(%d public, %d private, %d archived)\n", stats.Rooms, stats.PublicRooms, stats.PrivateRooms, stats.ArchivedRooms)
+	fmt.Fprintf(w, "Members\t%d\t\n", stats.Members)
+	fmt.Fprintf(w, "Messages\t%d\t\n", stats.Messages)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(stats.RoomStats) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(a.out)
+	w = a.table("ROOM", "MEMBERS", "MESSAGES")
+	for _, r := range stats.RoomStats {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", r.Name, r.Members, r.Messages)
+	}
+	return w.Flush()
+}
+
+// table starts a table with the given column headings.
+func (a *app) table(headings ...string) *tabwriter.Writer {
+	w := tabwriter.NewWriter(a.out, 0, 4, 2, ' ', 0)
+	for i, h := range headings {
+		if i > 0 {
+			fmt.Fprint(w, "\t")
+		}
+		fmt.Fprint(w, h)
+	}
+	fmt.Fprintln(w)
+	return w
+}
+
+// user looks a user up by username.
+func (a *app) user(username string) (*models.User, error) {
+	user, err := a.store.GetUserByUsername(username)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("no user named %q", username)
+	}
+	return user, err
+}
+
+// username returns the name of a user, or their ID if they cannot be found.
+func (a *app) username(userID string) string {
+	if user, err := a.store.GetUserByID(userID); err == nil {
+		return user.Username
+	}
+	return userID
+}
+
+// room looks a room up by ID, then by name.
+func (a *app) room(ref string) (*models.ChatRoom, error) {
+	room, err := a.store.GetRoomByID(ref)
+	if err == nil || !errors.Is(err, store.ErrNotFound) {
+		return room, err
+	}
+	rooms, err := a.store.ListRooms()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rooms {
+		if r.Name == ref {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("no room with the name or ID %q", ref)
+}
+
+// roomAndUser looks up a room and a user for the member commands.
+func (a *app) roomAndUser(roomRef, username string) (*models.ChatRoom, *models.User, error) {
+	room, err := a.room(roomRef)
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err := a.user(username)
+	if err != nil {
+		return nil, nil, err
+	}
+	return room, user, nil
+}
+
+// pastTense turns a command name into the start of its confirmation message.
+func pastTense(command string) string {
+	switch command {
+	case "disable", "enable", "promote", "demote", "archive", "unarchive":
+		return string(command[0]-'a'+'A') + command[1:] + "d"
+	}
+	return command
+}
@@ -0,0 +1,257 @@
+// Command chatctl administers the chat server's database: users, rooms,
+// memberships, migrations and statistics. It reads the same configuration
+// as the server and works on the database directly, so the server does not
+// have to be running.
+package main
+
+import (
+	"backend/internal/cli"
+	"backend/internal/config"
+	"backend/internal/logging"
+	"backend/internal/models"
+	"backend/internal/services"
+	"backend/internal/store"
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"golang.org/x/term"
+)
+
+const usage = `Usage: chatctl [-config file] <command> [arguments]
+
+Users:
+  user list
+  user create [-admin] <username>       Reads the password from standard input
+  user disable <username>
+  user enable <username>
+  user reset-password <username>       Reads the password from standard input
+  user promote <username>               Grant administrator rights
+  user demote <username>                Revoke administrator rights
+  user delete -yes <username>           Also deletes their messages and the rooms they own
+
+Rooms (by name or ID):
+  room list
+  room create [-private] -owner <username> <name>
+  room archive <room>
+  room unarchive <room>
+  room delete -yes <room>               Also deletes its messages
+
+Memberships:
+  member list <room>
+  member add [-role member|moderator] <room> <username>
+  member remove <room> <username>
+
+Other:
+  migrate status|up|down [n]            Manage database migrations
+  stats                                 Count users, rooms and messages
+
+Flags:
+`
+
+// usageError is a mistake in the command line, reported with exit status 2.
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+func main() {
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML configuration `file`; environment variables override it")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// Only problems are logged, so that output stays readable
+	logger, err := logging.New(os.Stderr, "warn", cfg.Logging.Format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	if flag.Arg(0) == "migrate" {
+		os.Exit(cli.Migrate("chatctl", &cfg.Database, flag.Args()[1:]))
+	}
+	os.Exit(run(&cfg.Database, flag.Args()))
+}
+
+// run opens the database, runs one command and returns the exit status.
+func run(dbConfig *config.DatabaseConfig, args []string) int {
+	if dbConfig.IsMemory() {
+		fmt.Fprintln(os.Stderr, "chatctl: DB_TYPE=memory keeps its data inside the server process; there is no database to administer")
+		return 1
+	}
+	dbStore, err := store.NewDBStore(dbConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "chatctl: %v\n", err)
+		return 1
+	}
+	defer dbStore.Close()
+
+	// Commands assume the current schema, which only the server or "migrate up"
+	// creates. Status also works on a database that has never been migrated.
+	pending, err := pendingMigrations(dbStore)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "chatctl: %v\n", err)
+		return 1
+	}
+	if pending > 0 {
+		fmt.Fprintf(os.Stderr, "chatctl: the database has %d pending migration(s); run \"chatctl migrate up\" first\n", pending)
+		return 1
+	}
+
+	a := newApp(dbStore, os.Stdin, os.Stdout)
+	if err := a.run(args); err != nil {
+		fmt.Fprintf(os.Stderr, "chatctl: %v\n", err)
+		var usageErr usageError
+		if errors.As(err, &usageErr) {
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+// pendingMigrations counts the migrations that have not been applied.
+func pendingMigrations(dbStore *store.DBStore) (int, error) {
+	migrator, err := dbStore.Migrator()
+	if err != nil {
+		return 0, err
+	}
+	statuses, err := migrator.Status()
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, status := range statuses {
+		if !status.Applied {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// app runs commands against a store.
+type app struct {
+	store store.StoreInterface
+	admin *services.AdminService
+	rooms *services.RoomService
+	in    *bufio.Reader
+	out   io.Writer
+
+	// terminal is in when it is a terminal, so that passwords are asked for
+	// and read without echo
+	terminal *os.File
+}
+
+// newApp creates an app that reads passwords from in and writes to out.
+func newApp(s store.StoreInterface, in io.Reader, out io.Writer) *app {
+	a := &app{
+		store: s,
+		admin: services.NewAdminService(s, offlineSessions{}),
+		rooms: services.NewRoomService(s),
+		in:    bufio.NewReader(in),
+		out:   out,
+	}
+	if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		a.terminal = f
+	}
+	return a
+}
+
+// run dispatches one command.
+func (a *app) run(args []string) error {
+	if len(args) < 2 && (len(args) == 0 || args[0] != "stats") {
+		return usageError("missing command; run chatctl -h for the list")
+	}
+	switch args[0] {
+	case "user":
+		return a.userCommand(args[1], args[2:])
+	case "room":
+		return a.roomCommand(args[1], args[2:])
+	case "member":
+		return a.memberCommand(args[1], args[2:])
+	case "stats":
+		return a.stats(args[1:])
+	}
+	return usageError(fmt.Sprintf("unknown command %q; run chatctl -h for the list", args[0]))
+}
+
+// parse parses a subcommand's flags and checks its number of arguments.
+func parse(fs *flag.FlagSet, args []string, want ...string) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return nil, usageError(fmt.Sprintf("%s: %v", fs.Name(), err))
+	}
+	if fs.NArg() != len(want) {
+		line := fs.Name()
+		fs.VisitAll(func(f *flag.Flag) { line += " [-" + f.Name + "]" })
+		for _, arg := range want {
+			line += " <" + arg + ">"
+		}
+		return nil, usageError("usage: chatctl " + line)
+	}
+	return fs.Args(), nil
+}
+
+// readPassword reads a password from the first line of standard input. On a
+// terminal it asks for it and turns off echo while it is typed.
+func (a *app) readPassword(username string) (string, error) {
+	var password string
+	if a.terminal != nil {
+		fmt.Fprintf(os.Stderr, "Password for %s: ", username)
+		typed, err := term.ReadPassword(int(a.terminal.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("reading the password from the terminal: %w", err)
+		}
+		password = string(typed)
+	} else {
+		line, err := a.in.ReadString('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+			return "", fmt.Errorf("reading the password from standard input: %w", err)
+		}
+		password = trimNewline(line)
+	}
+	if password == "" {
+		return "", errors.New("the password must not be empty")
+	}
+	return password, nil
+}
+
+// trimNewline removes a trailing "\n" or "\r\n".
+func trimNewline(s string) string {
+	if n := len(s); n > 0 && s[n-1] == '\n' {
+		s = s[:n-1]
+	}
+	if n := len(s); n > 0 && s[n-1] == '\r' {
+		s = s[:n-1]
+	}
+	return s
+}
+
+// offlineSessions stands in for the hub of a running server, which chatctl
+// cannot reach. Connections already open to the server are not closed by
+// chatctl; the server refuses them when they reconnect.
+type offlineSessions struct{}
+
+func (offlineSessions) DisconnectUser(roomID, userID, reason string)    {}
+func (offlineSessions) DisconnectUserEverywhere(userID, reason string)  {}
+func (offlineSessions) DisconnectRoom(roomID, reason string)            {}
+func (offlineSessions) DisconnectSession(sessionID, reason string) bool { return false }
+func (offlineSessions) Sessions() []models.Session                      { return nil }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"backend/internal/store"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCommands(t *testing.T) {
+	mem := store.NewMemoryStore()
+
+	// exec runs one command line with the given standard input
+	exec := func(stdin, line string) (string, error) {
+		var out bytes.Buffer
+		err := newApp(mem, strings.NewReader(stdin), &out).run(strings.Fields(line))
+		return out.String(), err
+	}
+	mustExec := func(stdin, line string) string {
+		out, err := exec(stdin, line)
+		if err != nil {
+			t.Fatalf("chatctl %s: %v", line, err)
+		}
+		return out
+	}
+
+	mustExec("secret1\n", "user create -admin root")
+	mustExec("secret2", "user create bob")
+	mustExec("", "room create -private -owner root ops")
+	mustExec("", "member add -role moderator ops bob")
+	mustExec("", "user disable bob")
+
+	bob, err := mem.GetUserByUsername("bob")
+	if err != nil || !bob.Disabled || bob.IsAdmin {
+		t.Fatalf("bob = %+v, %v; want a disabled non-admin", bob, err)
+	}
+	if out := mustExec("", "member list ops"); !strings.Contains(out, "bob       moderator") {
+		t.Errorf("member list:\n%s\nwant bob as a moderator", out)
+	}
+	if out := mustExec("", "stats"); !strings.Contains(out, "(1 administrators, 1 disabled)") {
+		t.Errorf("stats:\n%s", out)
+	}
+
+	mustExec("", "member remove ops bob")
+	mustExec("", "room archive ops")
+	rooms, err := mem.ListRooms()
+	if err != nil || len(rooms) != 1 || !rooms[0].Archived {
+		t.Fatalf("rooms = %+v, %v; want ops archived", rooms, err)
+	}
+
+	failures := []struct {
+		stdin, line string
+		usage       bool
+	}{
+		{"", "user create alice", false},      // no password
+		{"again\n", "user create bob", false}, // duplicate
+		{"", "user delete bob", true},         // unconfirmed
+		{"", "user frobnicate bob", true},     // unknown subcommand
+		{"", "room create ops2", true},        // missing owner
+		{"", "member add ops nobody", false},  // unknown user
+		{"", "member remove ops root", false}, // owner
+		{"", "room archive", true},            // missing argument
+		{"", "member add -role owner ops bob", false},
+	}
+	for _, tc := range failures {
+		_, err := exec(tc.stdin, tc.line)
+		var usageErr usageError
+		if err == nil || errors.As(err, &usageErr) != tc.usage {
+			t.Errorf("chatctl %s = %v; want a failure (usage error: %t)", tc.line, err, tc.usage)
+		}
+	}
+
+	mustExec("", "user delete -yes bob")
+	if _, err := mem.GetUserByUsername("bob"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("bob after delete: %v; want not found", err)
+	}
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"backend/internal/models"
+	"backend/pkg/chatclient"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// contentPrefix starts every message loadgen sends. It is followed by the
+// message's key, which is the sender's name and a sequence number.
+const contentPrefix = "loadgen "
+
+// options configures a run.
+type options struct {
+	server      string
+	users       int
+	rooms       int
+	rate        float64 // messages per second from all users together
+	duration    time.Duration
+	drain       time.Duration
+	interval    time.Duration
+	size        int
+	prefix      string
+	password    string
+	concurrency int
+	subprotocol string
+	http        *http.Client
+	dialer      *websocket.Dialer
+}
+
+// user is a synthetic user.
+type user struct {
+	name    string
+	client  *chatclient.Client
+	room    *room
+	session *chatclient.Session
+}
+
+// room is a room the synthetic users are spread across.
+type room struct {
+	name  string
+	id    string
+	users []*user
+	// live counts the users whose session is running
+	live atomic.Int32
+}
+
+// loadTest is one run against a server.
+type loadTest struct {
+	opts    options
+	log     io.Writer
+	users   []*user
+	rooms   []*room
+	stats   *stats
+	tracker *tracker
+}
+
+// run sets up the users and rooms, puts load on the server for the
+// configured duration and returns the report. Progress is written to log.
+// Cancelling ctx ends the load early; the report covers what was done.
+func run(ctx context.Context, opts options, log io.Writer) (*report, error) {
+	t := &loadTest{opts: opts, log: log, stats: newStats(), tracker: newTracker()}
+	for i := 0; i < opts.rooms; i++ {
+		t.rooms = append(t.rooms, &room{name: fmt.Sprintf("%s-room-%d", opts.prefix, i+1)})
+	}
+	for i := 0; i < opts.users; i++ {
+		u := &user{name: fmt.Sprintf("%s-user-%d", opts.prefix, i+1), room: t.rooms[i%opts.rooms]}
+		u.room.users = append(u.room.users, u)
+		t.users = append(t.users, u)
+	}
+
+	start := time.Now()
+	fmt.Fprintf(log, "setting up %d users in %d rooms\n", opts.users, opts.rooms)
+	if err := t.setUp(ctx); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(log, "set up in %s; connecting\n", time.Since(start).Round(time.Millisecond))
+	t.connect(ctx)
+	defer t.disconnect()
+	if t.stats.connected == 0 {
+		return nil, errors.New("no user could connect")
+	}
+
+	fmt.Fprintf(log, "%d users connected; sending %.1f messages per second for %s\n", t.stats.connected, opts.rate, opts.duration)
+	elapsed := t.load(ctx)
+	return t.report(elapsed), nil
+}
+
+// setUp registers and logs in every user, creates the rooms and makes each
+// user a member of its room. Users and rooms left by an earlier run with
+// the same prefix are reused.
+func (t *loadTest) setUp(ctx context.Context) error {
+	err := forEach(ctx, len(t.users), t.opts.concurrency, func(ctx context.Context, i int) error {
+		u := t.users[i]
+		client, err := chatclient.New(t.opts.server, t.opts.http)
+		if err != nil {
+			return err
+		}
+		err = throttled(ctx, func() error {
+			_, err := client.Register(ctx, u.name, t.opts.password)
+			return err
+		})
+		if err != nil && !chatclient.IsStatus(err, http.StatusConflict) {
+			return fmt.Errorf("registering %s: %w", u.name, err)
+		}
+		err = throttled(ctx, func() error {
+			_, err := client.Login(ctx, u.name, t.opts.password)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("logging in %s: %w", u.name, err)
+		}
+		u.client = client
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = forEach(ctx, len(t.rooms), t.opts.concurrency, func(ctx context.Context, i int) error {
+		r := t.rooms[i]
+		owner := r.users[0].client
+		var rooms []models.ChatRoom
+		err := throttled(ctx, func() (err error) {
+			rooms, err = owner.Rooms(ctx)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("listing rooms: %w", err)
+		}
+		for _, existing := range rooms {
+			if existing.Name == r.name {
+				r.id = existing.ID
+				return nil
+			}
+		}
+		return throttled(ctx, func() error {
+			created, err := owner.CreateRoom(ctx, r.name)
+			if err != nil {
+				return fmt.Errorf("creating room %s: %w", r.name, err)
+			}
+			r.id = created.ID
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return forEach(ctx, len(t.users), t.opts.concurrency, func(ctx context.Context, i int) error {
+		u := t.users[i]
+		return throttled(ctx, func() error {
+			if _, err := u.client.JoinRoom(ctx, u.room.id); err != nil {
+				return fmt.Errorf("joining %s to %s: %w", u.name, u.room.name, err)
+			}
+			return nil
+		})
+	})
+}
+
+// connect opens a session for every user. Users that cannot connect are
+// counted and left out of the run.
+func (t *loadTest) connect(ctx context.Context) {
+	forEach(ctx, len(t.users), t.opts.concurrency, func(ctx context.Context, i int) error {
+		u := t.users[i]
+		start := time.Now()
+		var session *chatclient.Session
+		err := throttled(ctx, func() (err error) {
+			session, err = u.client.Connect(ctx, u.room.id, t.handlers(u), &chatclient.SessionOptions{Dialer: t.opts.dialer, Subprotocol: t.opts.subprotocol})
+			return err
+		})
+		if err != nil {
+			fmt.Fprintf(t.log, "%s could not connect: %v\n", u.name, err)
+			t.stats.update(func(s *stats) { s.connectFailures++ })
+			return nil
+		}
+		took := time.Since(start)
+		u.session = session
+		u.room.live.Add(1)
+		t.stats.update(func(s *stats) {
+			s.connected++
+			s.connect.record(took)
+		})
+		return nil
+	})
+}
+
+// handlers returns the session handlers for u, which record deliveries and
+// dropped connections.
+func (t *loadTest) handlers(u *user) chatclient.Handlers {
+	return chatclient.Handlers{
+		Message: func(message models.MessageDTO) {
+			if message.Sender == u.name {
+				return
+			}
+			key, ok := messageKey(message.Content)
+			var took time.Duration
+			if ok {
+				took, ok = t.tracker.received(key)
+			}
+			t.stats.update(func(s *stats) {
+				if !ok {
+					s.unexpected++
+					return
+				}
+				s.delivered++
+				s.delivery.record(took)
+				s.recent.record(took)
+			})
+		},
+		StateChange: func(state chatclient.State, err error) {
+			switch {
+			case state == chatclient.StateReconnecting:
+				t.stats.update(func(s *stats) { s.disconnects++ })
+			case state == chatclient.StateClosed && !errors.Is(err, chatclient.ErrClosed):
+				u.room.live.Add(-1)
+				t.stats.update(func(s *stats) { s.sessionsLost++ })
+				fmt.Fprintf(t.log, "%s was disconnected for good: %v\n", u.name, err)
+			}
+		},
+	}
+}
+
+// load sends messages from every connected user until the duration is up
+// or ctx is cancelled, waits for the last deliveries and returns how long
+// messages were sent for.
+func (t *loadTest) load(ctx context.Context) time.Duration {
+	// Each user sends at the same rate, so that together they send opts.rate.
+	every := time.Duration(float64(t.opts.users) / t.opts.rate * float64(time.Second))
+	stop := make(chan struct{})
+	var senders sync.WaitGroup
+	for _, u := range t.users {
+		if u.session == nil {
+			continue
+		}
+		senders.Add(1)
+		go func(u *user) {
+			defer senders.Done()
+			t.send(ctx, u, every, stop)
+		}(u)
+	}
+
+	start := time.Now()
+	deadline := time.NewTimer(t.opts.duration)
+	defer deadline.Stop()
+	var progress <-chan time.Time
+	if t.opts.interval > 0 {
+		ticker := time.NewTicker(t.opts.interval)
+		defer ticker.Stop()
+		progress = ticker.C
+	}
+	for running := true; running; {
+		select {
+		case <-progress:
+			t.progress(time.Since(start))
+		case <-deadline.C:
+			running = false
+		case <-ctx.Done():
+			fmt.Fprintln(t.log, "interrupted; stopping")
+			running = false
+		}
+	}
+	close(stop)
+	senders.Wait()
+	elapsed := time.Since(start)
+
+	// Wait for messages still on their way.
+	drain := time.NewTimer(t.opts.drain)
+	defer drain.Stop()
+	poll := time.NewTicker(50 * time.Millisecond)
+	defer poll.Stop()
+	for t.tracker.missing() > 0 {
+		select {
+		case <-poll.C:
+		case <-drain.C:
+			return elapsed
+		case <-ctx.Done():
+			return elapsed
+		}
+	}
+	return elapsed
+}
+
+// send sends u's messages every interval, starting at a random point in the
+// first one so that users do not send in step, until stop is closed. A send
+// that takes longer than the interval delays the next one.
+func (t *loadTest) send(ctx context.Context, u *user, every time.Duration, stop <-chan struct{}) {
+	next := time.Now().Add(time.Duration(rand.Int63n(int64(every) + 1)))
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+	for seq := 1; ; seq++ {
+		select {
+		case <-timer.C:
+		case <-stop:
+			return
+		}
+
+		key := fmt.Sprintf("%s/%d", u.name, seq)
+		start := t.tracker.add(key)
+		_, err := u.session.Send(ctx, content(key, t.opts.size))
+		took := time.Since(start)
+		var sendErr *chatclient.SendError
+		switch {
+		case err == nil:
+			// Everyone else in the room with a running session should get it.
+			others := max(int(u.room.live.Load())-1, 0)
+			t.tracker.acked(key, others)
+			t.stats.update(func(s *stats) {
+				s.sent++
+				s.acked++
+				s.expected += uint64(others)
+				s.ack.record(took)
+			})
+		case errors.As(err, &sendErr):
+			t.tracker.failed(key)
+			t.stats.update(func(s *stats) {
+				s.sent++
+				s.refused[sendErr.Event.Code]++
+			})
+		case errors.Is(err, chatclient.ErrConnectionLost):
+			t.tracker.unconfirmed(key)
+			t.stats.update(func(s *stats) {
+				s.sent++
+				s.unconfirmed++
+			})
+		case errors.Is(err, chatclient.ErrClosed), ctx.Err() != nil:
+			t.tracker.failed(key)
+			return
+		default:
+			t.tracker.failed(key)
+			t.stats.update(func(s *stats) {
+				s.sent++
+				s.sendErrors++
+			})
+		}
+
+		next = next.Add(every)
+		if now := time.Now(); now.After(next) {
+			t.stats.update(func(s *stats) { s.late++ })
+			next = now
+		}
+		timer.Reset(time.Until(next))
+	}
+}
+
+// progress writes a line about the run so far, with the latency of the
+// deliveries since the last line.
+func (t *loadTest) progress(elapsed time.Duration) {
+	t.stats.update(func(s *stats) {
+		live := 0
+		for _, r := range t.rooms {
+			live += int(r.live.Load())
+		}
+		fmt.Fprintf(t.log, "%6s  connected %d  sent %d (%.1f/s)  delivered %d  p50 %s  p99 %s  refused %d  disconnects %d\n",
+			elapsed.Round(time.Second), live, s.sent, float64(s.sent)/elapsed.Seconds(), s.delivered,
+			round(s.recent.percentile(0.5)), round(s.recent.percentile(0.99)), sum(s.refused), s.disconnects)
+		s.recent = histogram{}
+	})
+}
+
+// disconnect closes every session.
+func (t *loadTest) disconnect() {
+	var wg sync.WaitGroup
+	for _, u := range t.users {
+		if u.session != nil {
+			wg.Add(1)
+			go func(session *chatclient.Session) {
+				defer wg.Done()
+				session.Close()
+			}(u.session)
+		}
+	}
+	wg.Wait()
+}
+
+// content returns the text of the message with key, padded to size bytes.
+func content(key string, size int) string {
+	text := contentPrefix + key
+	if len(text) < size {
+		text += " " + strings.Repeat("x", size-len(text)-1)
+	}
+	return text
+}
+
+// messageKey returns the key of a message sent by loadgen.
+func messageKey(content string) (string, bool) {
+	rest, ok := strings.CutPrefix(content, contentPrefix)
+	if !ok {
+		return "", false
+	}
+	key, _, _ := strings.Cut(rest, " ")
+	return key, true
+}
+
+// forEach calls fn for each index below n, running up to workers calls at
+// once. It stops at the first error and returns it.
+func forEach(ctx context.Context, n, workers int, fn func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	indexes := make(chan int)
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for w := 0; w < min(workers, n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := fn(ctx, i); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return firstErr
+}
+
+// throttled calls fn again, after a growing pause, while the server answers
+// that too many requests are being made.
+func throttled(ctx context.Context, fn func() error) error {
+	wait := 250 * time.Millisecond
+	for {
+		err := fn()
+		if !chatclient.IsStatus(err, http.StatusTooManyRequests) {
+			return err
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+		wait = min(2*wait, 5*time.Second)
+	}
+}
@@ -0,0 +1,298 @@
+// Command loadgen puts synthetic load on a chat server to find out how many
+// users it can take. It registers users, spreads them across rooms, holds a
+// WebSocket session for each and sends messages at a fixed rate, then
+// reports delivery latency, drops and disconnects.
+package main
+
+import (
+	"backend/internal/protocol"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const usage = `Usage: loadgen [flags]
+
+Registers -users synthetic users, spreads them across -rooms rooms, connects
+each over WebSocket and sends -rate messages per second in total for
+-duration. Progress goes to standard error and the report to standard output.
+
+The server's rate limits apply to loadgen like to anyone else; raise or
+disable them on the target to measure the hub itself.
+
+Flags:
+`
+
+func main() {
+	var opts options
+	var caFile, jsonFile string
+	flag.StringVar(&opts.server, "server", "http://localhost:8082", "server `URL`")
+	flag.IntVar(&opts.users, "users", 50, "`number` of synthetic users")
+	flag.IntVar(&opts.rooms, "rooms", 5, "`number` of rooms to spread the users across")
+	flag.Float64Var(&opts.rate, "rate", 10, "messages per `second` sent by all users together")
+	flag.DurationVar(&opts.duration, "duration", time.Minute, "how long to send messages for")
+	flag.DurationVar(&opts.drain, "drain", 5*time.Second, "how long to wait for deliveries after the last message is sent")
+	flag.DurationVar(&opts.interval, "interval", 10*time.Second, "how often to print progress; 0 turns it off")
+	flag.IntVar(&opts.size, "size", 64, "message size in `bytes`")
+	flag.StringVar(&opts.prefix, "prefix", "", "`prefix` of user and room names; random by default. Reusing one reuses its users and rooms")
+	flag.StringVar(&opts.password, "password", "loadgen-password", "`password` of the synthetic users")
+	flag.StringVar(&opts.subprotocol, "subprotocol", "", "WebSocket `subprotocol`, "+strings.Join(protocol.Subprotocols(), " or ")+"; none by default, which is JSON")
+	flag.IntVar(&opts.concurrency, "concurrency", 16, "how many users are set up and connected at once")
+	flag.StringVar(&caFile, "ca", "", "PEM `file` of a certificate authority to trust, such as a self-signed server certificate")
+	flag.StringVar(&jsonFile, "json", "", "write the report as JSON to `file`; - writes it to standard output instead of the text report")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := check(&opts); err != nil {
+		fmt.Fprintf(os.Stderr, "loadgen: %v\n", err)
+		os.Exit(2)
+	}
+
+	tlsConfig, err := loadCA(caFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "loadgen: %v\n", err)
+		os.Exit(1)
+	}
+	opts.http = &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig:     tlsConfig,
+			MaxIdleConnsPerHost: opts.concurrency,
+		},
+	}
+	opts.dialer = &websocket.Dialer{HandshakeTimeout: 30 * time.Second, TLSClientConfig: tlsConfig}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	report, err := run(ctx, opts, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "loadgen: %v\n", err)
+		os.Exit(1)
+	}
+
+	if jsonFile != "-" {
+		report.write(os.Stdout)
+	}
+	if jsonFile != "" {
+		if err := writeJSON(jsonFile, report); err != nil {
+			fmt.Fprintf(os.Stderr, "loadgen: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// check validates the options and fills in a random prefix.
+func check(opts *options) error {
+	switch {
+	case opts.users < 1:
+		return fmt.Errorf("-users must be at least 1")
+	case opts.rooms < 1 || opts.rooms > opts.users:
+		return fmt.Errorf("-rooms must be between 1 and -users")
+	case opts.rate <= 0:
+		return fmt.Errorf("-rate must be positive")
+	case opts.duration <= 0:
+		return fmt.Errorf("-duration must be positive")
+	case opts.concurrency < 1:
+		return fmt.Errorf("-concurrency must be at least 1")
+	}
+	if _, ok := protocol.Lookup(opts.subprotocol); !ok {
+		return fmt.Errorf("-subprotocol must be one of %s", strings.Join(protocol.Subprotocols(), ", "))
+	}
+	if opts.prefix == "" {
+		random := make([]byte, 3)
+		rand.Read(random)
+		opts.prefix = "lg" + hex.EncodeToString(random)
+	}
+	return nil
+}
+
+// loadCA returns the TLS settings that trust caFile as well as the system's
+// authorities, or nil when caFile is empty.
+func loadCA(caFile string) (*tls.Config, error) {
+	if caFile == "" {
+		return nil, nil
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s holds no PEM certificates", caFile)
+	}
+	return &tls.Config{RootCAs: roots}, nil
+}
+
+// report is the outcome of a run.
+type report struct {
+	Server     string  `json:"server"`
+	Prefix     string  `json:"prefix"`
+	Users      int     `json:"users"`
+	Rooms      int     `json:"rooms"`
+	TargetRate float64 `json:"target_rate"`
+	Elapsed    float64 `json:"elapsed_seconds"`
+
+	Connected       int    `json:"connected"`
+	ConnectFailures int    `json:"connect_failures"`
+	Disconnects     uint64 `json:"disconnects"`
+	SessionsLost    uint64 `json:"sessions_lost"`
+
+	Sent        uint64            `json:"sent"`
+	Acked       uint64            `json:"acked"`
+	Refused     map[string]uint64 `json:"refused"`
+	Unconfirmed uint64            `json:"unconfirmed"`
+	SendErrors  uint64            `json:"send_errors"`
+	LateSends   uint64            `json:"late_sends"`
+
+	Expected   uint64 `json:"deliveries_expected"`
+	Delivered  uint64 `json:"deliveries_received"`
+	Dropped    uint64 `json:"deliveries_dropped"`
+	Unexpected uint64 `json:"unexpected_messages"`
+
+	ConnectLatency  latency `json:"connect_latency"`
+	AckLatency      latency `json:"ack_latency"`
+	DeliveryLatency latency `json:"delivery_latency"`
+}
+
+// report builds the report once the load has stopped.
+func (t *loadTest) report(elapsed time.Duration) *report {
+	dropped := t.tracker.missing()
+	r := &report{
+		Server:     t.opts.server,
+		Prefix:     t.opts.prefix,
+		Users:      t.opts.users,
+		Rooms:      t.opts.rooms,
+		TargetRate: t.opts.rate,
+		Elapsed:    elapsed.Seconds(),
+		Dropped:    dropped,
+	}
+	t.stats.update(func(s *stats) {
+		r.Connected, r.ConnectFailures = s.connected, s.connectFailures
+		r.Disconnects, r.SessionsLost = s.disconnects, s.sessionsLost
+		r.Sent, r.Acked, r.Unconfirmed, r.SendErrors, r.LateSends = s.sent, s.acked, s.unconfirmed, s.sendErrors, s.late
+		r.Refused = make(map[string]uint64, len(s.refused))
+		for code, n := range s.refused {
+			r.Refused[code] = n
+		}
+		r.Expected, r.Delivered, r.Unexpected = s.expected, s.delivered, s.unexpected
+		r.ConnectLatency, r.AckLatency, r.DeliveryLatency = s.connect.summary(), s.ack.summary(), s.delivery.summary()
+	})
+	return r
+}
+
+// write prints the report as text.
+func (r *report) write(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "server\t%s (prefix %s)\n", r.Server, r.Prefix)
+	fmt.Fprintf(tw, "load\t%d users in %d rooms, %.1f messages/s for %s\n", r.Users, r.Rooms, r.TargetRate, round(time.Duration(r.Elapsed*float64(time.Second))))
+	fmt.Fprintf(tw, "connections\t%d connected, %d failed, %d dropped and reconnected, %d lost for good\n", r.Connected, r.ConnectFailures, r.Disconnects, r.SessionsLost)
+	fmt.Fprintf(tw, "sent\t%d (%.1f/s), %d acked, %d refused%s, %d unconfirmed, %d failed, %d behind schedule\n",
+		r.Sent, float64(r.Sent)/r.Elapsed, r.Acked, sum(r.Refused), byCode(r.Refused), r.Unconfirmed, r.SendErrors, r.LateSends)
+	fmt.Fprintf(tw, "deliveries\t%d expected, %d received, %d dropped (%.2f%%)", r.Expected, r.Delivered, r.Dropped, percent(r.Dropped, r.Expected))
+	if r.Unexpected > 0 {
+		fmt.Fprintf(tw, ", %d unexpected", r.Unexpected)
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "latency\tcount\tp50\tp90\tp99\tp99.9\tmax")
+	for _, row := range []struct {
+		name string
+		l    latency
+	}{{"connect", r.ConnectLatency}, {"ack", r.AckLatency}, {"delivery", r.DeliveryLatency}} {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\n", row.name, row.l.Count,
+			ms(row.l.P50), ms(row.l.P90), ms(row.l.P99), ms(row.l.P999), ms(row.l.Max))
+	}
+	tw.Flush()
+}
+
+// writeJSON writes the report as JSON to file, or to standard output for "-".
+func writeJSON(file string, r *report) error {
+	out := os.Stdout
+	if file != "-" {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// byCode formats counts by error code, such as " (rate_limited 3)", or
+// returns "" if there are none.
+func byCode(counts map[string]uint64) string {
+	if len(counts) == 0 {
+		return ""
+	}
+	codes := make([]string, 0, len(counts))
+	for code := range counts {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for i, code := range codes {
+		codes[i] = fmt.Sprintf("%s %d", code, counts[code])
+	}
+	return " (" + strings.Join(codes, ", ") + ")"
+}
+
+// sum adds up counts.
+func sum(counts map[string]uint64) uint64 {
+	var n uint64
+	for _, c := range counts {
+		n += c
+	}
+	return n
+}
+
+// percent returns n as a percentage of total.
+func percent(n, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
+
+// ms formats milliseconds as a rounded duration.
+func ms(v float64) string {
+	return round(time.Duration(v * float64(time.Millisecond))).String()
+}
+
+// round shortens a duration for display.
+func round(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
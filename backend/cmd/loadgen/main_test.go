@@ -0,0 +1,134 @@
+package main
+
+import (
+	"backend/internal/config"
+	"backend/internal/server"
+	"backend/internal/store"
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer starts the whole server in-process on a memory store, built
+// the same way as cmd/server.
+func newTestServer(t *testing.T) string {
+	t.Helper()
+	app, err := server.New(config.Default(), store.NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(app.Handler)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestRun(t *testing.T) {
+	opts := options{
+		server:      newTestServer(t),
+		users:       6,
+		rooms:       2,
+		rate:        12,
+		duration:    time.Second,
+		drain:       5 * time.Second,
+		size:        64,
+		prefix:      "lgtest",
+		password:    "loadgen-password",
+		concurrency: 4,
+	}
+	var log bytes.Buffer
+	r, err := run(context.Background(), opts, &log)
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, log.String())
+	}
+
+	if r.Connected != 6 || r.ConnectFailures != 0 || r.SessionsLost != 0 {
+		t.Errorf("connected %d, failed %d, lost %d; want 6, 0, 0", r.Connected, r.ConnectFailures, r.SessionsLost)
+	}
+	if r.Acked == 0 || r.Acked != r.Sent {
+		t.Errorf("acked %d of %d sent; want all of them", r.Acked, r.Sent)
+	}
+	// Each room has three users, so every message goes to two others.
+	if r.Expected != 2*r.Acked || r.Delivered != r.Expected || r.Dropped != 0 {
+		t.Errorf("deliveries: %d expected, %d received, %d dropped; want %d, %d, 0", r.Expected, r.Delivered, r.Dropped, 2*r.Acked, 2*r.Acked)
+	}
+	if r.DeliveryLatency.Count != r.Delivered || r.DeliveryLatency.Max <= 0 {
+		t.Errorf("delivery latency %+v", r.DeliveryLatency)
+	}
+
+	var text bytes.Buffer
+	r.write(&text)
+	if !strings.Contains(text.String(), "0 dropped (0.00%)") {
+		t.Errorf("report:\n%s", text.String())
+	}
+
+	// A second run with the same prefix reuses the users and rooms.
+	opts.duration = 200 * time.Millisecond
+	if _, err := run(context.Background(), opts, &log); err != nil {
+		t.Fatalf("second run: %v\n%s", err, log.String())
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	var h histogram
+	if h.percentile(0.5) != 0 {
+		t.Fatal("empty histogram has a median")
+	}
+	for i := 1; i <= 1000; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+	for _, tc := range []struct {
+		q    float64
+		want time.Duration
+	}{{0.5, 500 * time.Millisecond}, {0.9, 900 * time.Millisecond}, {0.99, 990 * time.Millisecond}, {1, time.Second}} {
+		got := h.percentile(tc.q)
+		if diff := got - tc.want; diff < -tc.want/30 || diff > tc.want/30 {
+			t.Errorf("percentile(%v) = %s, want about %s", tc.q, got, tc.want)
+		}
+	}
+	if h.max != time.Second || h.total != 1000 {
+		t.Errorf("max %s, total %d", h.max, h.total)
+	}
+
+	// Small values are exact.
+	h = histogram{}
+	h.record(7 * time.Microsecond)
+	if got := h.percentile(0.5); got != 7*time.Microsecond {
+		t.Errorf("percentile of 7µs = %s", got)
+	}
+}
+
+func TestTracker(t *testing.T) {
+	tr := newTracker()
+	tr.add("a/1")
+	tr.add("a/2")
+	tr.add("a/3")
+
+	// A delivery may arrive before the ack.
+	if _, ok := tr.received("a/1"); !ok {
+		t.Fatal("a/1 not tracked")
+	}
+	tr.acked("a/1", 2)
+	tr.acked("a/2", 2)
+	tr.received("a/2")
+	tr.received("a/2")
+	tr.unconfirmed("a/3")
+	if got := tr.missing(); got != 1 {
+		t.Errorf("missing = %d, want 1", got)
+	}
+	if _, ok := tr.received("a/2"); ok {
+		t.Error("a/2 still tracked after all its deliveries")
+	}
+	if _, ok := tr.received("b/1"); ok {
+		t.Error("unknown key matched")
+	}
+
+	if key, ok := messageKey(content("a/12", 64)); !ok || key != "a/12" {
+		t.Errorf("messageKey = %q, %v", key, ok)
+	}
+	if got := len(content("a/12", 64)); got != 64 {
+		t.Errorf("content is %d bytes, want 64", got)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// subBucketBits sets the histogram's precision: each power of two is split
+// into 2^subBucketBits buckets, so a bucket is at most about 3% wide.
+const subBucketBits = 5
+
+// histogram counts durations, with microsecond resolution, in buckets whose
+// width grows with their value. It takes constant memory however long a
+// soak test runs. The zero value is empty and ready to use.
+type histogram struct {
+	counts []uint64
+	total  uint64
+	max    time.Duration
+}
+
+// bucket returns the index of the bucket holding v microseconds.
+func bucket(v uint64) int {
+	if v < 1<<subBucketBits {
+		return int(v)
+	}
+	shift := bits.Len64(v) - subBucketBits - 1
+	return shift<<subBucketBits + int(v>>shift)
+}
+
+// bucketMiddle returns the value in the middle of bucket i, in microseconds.
+func bucketMiddle(i int) float64 {
+	if i < 1<<subBucketBits {
+		return float64(i)
+	}
+	shift := i>>subBucketBits - 1
+	low := uint64(i-shift<<subBucketBits) << shift
+	return float64(low) + float64(uint64(1)<<shift)/2
+}
+
+// record adds one duration.
+func (h *histogram) record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	i := bucket(uint64(d / time.Microsecond))
+	if i >= len(h.counts) {
+		h.counts = append(h.counts, make([]uint64, i+1-len(h.counts))...)
+	}
+	h.counts[i]++
+	h.total++
+	h.max = max(h.max, d)
+}
+
+// percentile returns the duration below which q (0 to 1) of the recorded
+// durations fall, or zero if none were recorded.
+func (h *histogram) percentile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(h.total)))
+	rank = max(rank, 1)
+	var seen uint64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			d := time.Duration(bucketMiddle(i) * float64(time.Microsecond))
+			return min(d, h.max)
+		}
+	}
+	return h.max
+}
+
+// latency summarizes a histogram for the report.
+type latency struct {
+	Count uint64  `json:"count"`
+	P50   float64 `json:"p50_ms"`
+	P90   float64 `json:"p90_ms"`
+	P99   float64 `json:"p99_ms"`
+	P999  float64 `json:"p999_ms"`
+	Max   float64 `json:"max_ms"`
+}
+
+// summary returns the histogram's percentiles in milliseconds.
+func (h *histogram) summary() latency {
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	return latency{
+		Count: h.total,
+		P50:   ms(h.percentile(0.5)),
+		P90:   ms(h.percentile(0.9)),
+		P99:   ms(h.percentile(0.99)),
+		P999:  ms(h.percentile(0.999)),
+		Max:   ms(h.max),
+	}
+}
+
+// stats collects what happens during a run. Its methods are safe for
+// concurrent use.
+type stats struct {
+	mu sync.Mutex
+
+	connect  histogram
+	ack      histogram
+	delivery histogram
+	// recent holds the deliveries since the last progress line
+	recent histogram
+
+	connected       int
+	connectFailures int
+	disconnects     uint64 // connections that dropped and were reopened
+	sessionsLost    uint64 // sessions the server ended for good
+
+	sent        uint64
+	acked       uint64
+	refused     map[string]uint64 // by error code
+	unconfirmed uint64            // the connection dropped before the ack
+	sendErrors  uint64
+	late        uint64 // sends that started behind schedule
+
+	expected   uint64 // deliveries of acknowledged messages
+	delivered  uint64
+	unexpected uint64 // messages that were not sent by this run
+}
+
+// newStats creates empty stats.
+func newStats() *stats {
+	return &stats{refused: make(map[string]uint64)}
+}
+
+// update runs fn with the stats locked.
+func (s *stats) update(fn func(s *stats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s)
+}
+
+// sentMessage is a message waiting for its deliveries.
+type sentMessage struct {
+	at          time.Time
+	expected    int // other users in the room; -1 until the message is acknowledged
+	received    int
+	unconfirmed bool
+}
+
+// tracker matches the messages users receive to the ones they sent, to
+// measure delivery latency and find drops. Messages are forgotten once
+// every delivery has arrived. Its methods are safe for concurrent use.
+type tracker struct {
+	mu   sync.Mutex
+	sent map[string]*sentMessage // by key
+}
+
+// newTracker creates an empty tracker.
+func newTracker() *tracker {
+	return &tracker{sent: make(map[string]*sentMessage)}
+}
+
+// add records that the message with key is being sent now.
+func (t *tracker) add(key string) time.Time {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sent[key] = &sentMessage{at: now, expected: -1}
+	return now
+}
+
+// acked records that the server saved the message, and that expected other
+// users should receive it.
+func (t *tracker) acked(key string, expected int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if m := t.sent[key]; m != nil {
+		m.expected = expected
+		if m.received >= expected {
+			delete(t.sent, key)
+		}
+	}
+}
+
+// failed forgets a message that the server refused.
+func (t *tracker) failed(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.sent, key)
+}
+
+// unconfirmed records that the connection dropped before the message was
+// acknowledged. It may still be delivered, but it is not counted as dropped.
+func (t *tracker) unconfirmed(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if m := t.sent[key]; m != nil {
+		m.unconfirmed = true
+	}
+}
+
+// received records a delivery of the message with key and returns how long
+// it took since the message was sent. It reports false for a key it does
+// not know.
+func (t *tracker) received(key string) (time.Duration, bool) {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	m := t.sent[key]
+	if m == nil {
+		return 0, false
+	}
+	m.received++
+	if m.expected >= 0 && m.received >= m.expected {
+		delete(t.sent, key)
+	}
+	return now.Sub(m.at), true
+}
+
+// missing returns how many deliveries of acknowledged messages have not
+// arrived yet.
+func (t *tracker) missing() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var n uint64
+	for _, m := range t.sent {
+		if m.expected > m.received && !m.unconfirmed {
+			n += uint64(m.expected - m.received)
+		}
+	}
+	return n
+}
@@ -2,59 +2,183 @@ package main
 
 import (
 	"backend/internal/api"
+	"backend/internal/cli"
 	"backend/internal/config"
 	"backend/internal/handlers"
-	"backend/internal/services"
+	"backend/internal/logging"
+	"backend/internal/metrics"
+	"backend/internal/server"
 	"backend/internal/store"
-	"log"
+	"backend/internal/tracing"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+const usage = `Usage: chatapp [-config file] [command]
+
+Without a command, the server is started. Commands:
+  config        Check the configuration and print it with secrets masked
+  migrate       Manage database migrations (see "chatapp migrate")
+
+Flags:
+`
+
 func main() {
-	log.Println("Starting Chat Application Server...")
+	// The configuration file may also be named by CONFIG_FILE
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML configuration `file`; environment variables override it")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// Every setting is checked before anything starts
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// Subcommands run instead of the server
+	switch flag.Arg(0) {
+	case "":
+	case "config":
+		fmt.Print(cfg)
+		return
+	case "migrate":
+		os.Exit(cli.Migrate("chatapp", &cfg.Database, flag.Args()[1:]))
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Set up structured logging before anything else logs
+	logger, err := logging.New(os.Stderr, cfg.Logging.Level, cfg.Logging.Format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging configuration: %v\n", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	slog.Info("starting chat application server", "config_file", *configPath)
+	if err := run(cfg); err != nil {
+		slog.Error("server stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run starts the server and serves until it fails or is stopped by SIGINT or
+// SIGTERM. Resources it opens are released on return, so callers must not
+// exit before it does.
+func run(cfg *config.Config) error {
+	if cfg.Auth.UsesDefaultSecret() {
+		slog.Warn("tokens are signed with the default JWT secret; set JWT_SECRET before exposing the server")
+	}
+
+	// Export traces if an exporter is configured
+	shutdownTracing, err := tracing.Setup(context.Background(), &cfg.Tracing)
+	if err != nil {
+		return fmt.Errorf("failed to configure tracing: %w", err)
+	}
+	defer shutdownTracing(context.Background())
+	if cfg.Tracing.Exporter != "none" {
+		slog.Info("tracing enabled", "exporter", cfg.Tracing.Exporter, "sample_ratio", cfg.Tracing.SampleRatio)
+	}
 
-	// Initialize database configuration
-	dbConfig := config.NewDatabaseConfig()
-	
 	// Initialize store
-	dbStore, err := store.NewDBStore(dbConfig)
+	dbStore, err := store.Open(&cfg.Database)
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		return fmt.Errorf("failed to initialize database: %w", err)
 	}
 	defer dbStore.Close()
 
 	// Run database migrations
 	if err := dbStore.Migrate(); err != nil {
-		log.Fatalf("Failed to migrate database: %v", err)
+		return fmt.Errorf("failed to migrate database: %w", err)
 	}
 
-	// Initialize services
-	userService := services.NewUserService(dbStore)
-	roomService := services.NewRoomService(dbStore)
-	messageService := services.NewMessageService(dbStore)
+	// Export connection pool statistics with the other metrics
+	if db, ok := dbStore.(*store.DBStore); ok {
+		metrics.RegisterDBStats(db.Stats)
+	}
 
-	// Initialize handlers
-	userHandler := handlers.NewUserHandler(userService)
-	roomHandler := handlers.NewRoomHandler(roomService)
-	wsHandler := handlers.NewWebSocketHandler(messageService)
+	// Build the application and start its hub
+	app, err := server.New(cfg, dbStore)
+	if err != nil {
+		return err
+	}
 
-	// Start WebSocket hub in a goroutine
-	go wsHandler.Run()
-	log.Println("WebSocket hub started")
+	// Serve pprof on its own listener, away from the public API
+	if cfg.Debug.Enabled() {
+		go func() {
+			slog.Info("diagnostics listener starting", "addr", cfg.Debug.Addr)
+			if err := http.ListenAndServe(cfg.Debug.Addr, api.NewDebugRouter()); err != nil {
+				slog.Error("diagnostics listener failed", "addr", cfg.Debug.Addr, "error", err)
+			}
+		}()
+	}
 
-	// Initialize router
-	router := api.NewRouter(userHandler, roomHandler, wsHandler, dbStore)
+	// Serve until the listener fails or a signal asks the server to stop.
+	// Sessions are ended once the listener has closed.
+	httpServer := &http.Server{Addr: cfg.Server.Addr(), Handler: app.Handler}
+	httpServer.RegisterOnShutdown(func() {
+		slog.Info("ending sessions", "sessions", app.Hub.DisconnectAll())
+	})
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serveErr := make(chan error, 1)
+	if !cfg.TLS.Enabled() {
+		slog.Info("server starting", "port", cfg.Server.Port)
+		go func() { serveErr <- httpServer.ListenAndServe() }()
+	} else {
+		// Serve HTTPS, with the certificate reloaded as it is renewed
+		httpServer.TLSConfig, err = setupTLS(ctx, &cfg.TLS)
+		if err != nil {
+			return fmt.Errorf("failed to configure TLS: %w", err)
+		}
+		if cfg.TLS.RedirectPort != "" {
+			go func() {
+				slog.Info("redirect listener starting", "port", cfg.TLS.RedirectPort)
+				if err := http.ListenAndServe(":"+cfg.TLS.RedirectPort, api.NewRedirectRouter(cfg.Server.Port)); err != nil {
+					slog.Error("redirect listener failed", "port", cfg.TLS.RedirectPort, "error", err)
+				}
+			}()
+		}
+		slog.Info("server starting", "port", cfg.Server.Port, "tls", true)
+		go func() { serveErr <- httpServer.ListenAndServeTLS("", "") }()
+	}
 
-	// Get port from environment variable or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8082"
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
 	}
+	// A second signal stops the process at once
+	stop()
+	return shutdown(httpServer, app.Health, &cfg.Server)
+}
+
+// shutdown stops the server gracefully. Readiness fails at once so that load
+// balancers stop sending requests, then after the drain delay the listener
+// closes and requests in flight get the shutdown timeout to finish.
+func shutdown(httpServer *http.Server, health *handlers.HealthHandler, cfg *config.ServerConfig) error {
+	slog.Info("draining before shutdown", "drain_delay", cfg.DrainDelay)
+	health.Drain()
+	time.Sleep(cfg.DrainDelay)
 
-	// Start the server
-	log.Printf("Server starting on port %s...", port)
-	if err := http.ListenAndServe(":"+port, router); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to finish requests in flight: %w", err)
 	}
+	slog.Info("server stopped")
+	return nil
 }
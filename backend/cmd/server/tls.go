@@ -0,0 +1,66 @@
+package main
+
+import (
+	"backend/internal/certs"
+	"backend/internal/config"
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// tlsVersions maps the configured minimum version to its constant.
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// setupTLS prepares HTTPS serving: it generates the self-signed certificate
+// if asked to, loads the certificate, and reloads it when the files change
+// or the process receives SIGHUP. Reloading stops when ctx is done.
+func setupTLS(ctx context.Context, tlsConfig *config.TLSConfig) (*tls.Config, error) {
+	certFile, keyFile := tlsConfig.Files()
+	if tlsConfig.SelfSigned {
+		generated, err := certs.EnsureSelfSigned(certFile, keyFile, tlsConfig.SelfSignedHosts)
+		if err != nil {
+			return nil, err
+		}
+		if generated {
+			slog.Warn("generated a self-signed certificate; browsers will not trust it until it is added to their trust store",
+				"cert_file", certFile, "hosts", tlsConfig.SelfSignedHosts)
+		}
+	}
+
+	reloader, err := certs.NewReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig.ReloadInterval > 0 {
+		go reloader.Watch(ctx, tlsConfig.ReloadInterval)
+	}
+
+	// SIGHUP reloads at once, for renewal hooks that can signal the server
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				slog.Info("SIGHUP received; reloading the TLS certificate")
+				if err := reloader.Reload(); err != nil {
+					slog.Error("tls certificate reload failed; keeping the current certificate", "error", err)
+				}
+			}
+		}
+	}()
+
+	return &tls.Config{
+		MinVersion:     tlsVersions[tlsConfig.MinVersion],
+		GetCertificate: reloader.GetCertificate,
+	}, nil
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"backend/internal/metrics"
+	"net/http"
+	"net/http/pprof"
+)
+
+// NewDebugRouter creates the router of the diagnostics listener, which serves
+// the runtime profiles of net/http/pprof under /debug/pprof/ and the
+// Prometheus metrics at /metrics. It has no authentication and must only be
+// reachable from trusted networks.
+func NewDebugRouter() http.Handler {
+	router := http.NewServeMux()
+	router.Handle("GET /metrics", metrics.Handler())
+	router.HandleFunc("/debug/pprof/", pprof.Index)
+	router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	router.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	router.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return router
+}
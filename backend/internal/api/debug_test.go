@@ -0,0 +1,16 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugRouterServesMetrics(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewDebugRouter().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "chat_subscribers") {
+		t.Fatalf("GET /metrics: %d %q", rec.Code, rec.Body.String())
+	}
+}
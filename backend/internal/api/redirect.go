@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// NewRedirectRouter creates the router of the plain HTTP listener that runs
+// next to HTTPS. It sends every request to the same host and path over
+// HTTPS on httpsPort.
+func NewRedirectRouter(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if host == "" {
+			http.Error(w, "Host header required", http.StatusBadRequest)
+			return
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]" // IPv6
+		}
+
+		// 308 keeps the method and body of requests other than GET and HEAD
+		status := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			status = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectRouter(t *testing.T) {
+	tests := []struct {
+		method, host, target, port string
+		status                     int
+		location                   string
+	}{
+		{"GET", "chat.example.com", "/api/rooms?x=1", "443", http.StatusMovedPermanently, "https://chat.example.com/api/rooms?x=1"},
+		{"GET", "chat.example.com:80", "/", "443", http.StatusMovedPermanently, "https://chat.example.com/"},
+		{"GET", "localhost:8080", "/readyz", "8443", http.StatusMovedPermanently, "https://localhost:8443/readyz"},
+		{"POST", "localhost:8080", "/api/login", "8443", http.StatusPermanentRedirect, "https://localhost:8443/api/login"},
+		{"GET", "[::1]:8080", "/", "8443", http.StatusMovedPermanently, "https://[::1]:8443/"},
+		{"GET", "[::1]", "/", "443", http.StatusMovedPermanently, "https://[::1]/"},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest(tc.method, tc.target, nil)
+		req.Host = tc.host
+		rec := httptest.NewRecorder()
+		NewRedirectRouter(tc.port).ServeHTTP(rec, req)
+
+		if rec.Code != tc.status || rec.Header().Get("Location") != tc.location {
+			t.Errorf("%s http://%s%s: %d %q, want %d %q", tc.method, tc.host, tc.target,
+				rec.Code, rec.Header().Get("Location"), tc.status, tc.location)
+		}
+	}
+}
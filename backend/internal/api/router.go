@@ -1,31 +1,128 @@
 package api
 
 import (
+	"backend/internal/clientip"
+	"backend/internal/config"
 	"backend/internal/handlers"
 	"backend/internal/middleware"
+	"backend/internal/origin"
+	"backend/internal/ratelimit"
 	"backend/internal/store"
 	"net/http"
 )
 
-// NewRouter creates the main API router and registers all the application's routes.
-func NewRouter(userHandler *handlers.UserHandler, roomHandler *handlers.RoomHandler, wsHandler *handlers.WebSocketHandler, dbStore store.StoreInterface) http.Handler {
+// Dependencies holds what the router's routes are served by.
+type Dependencies struct {
+	Users      *handlers.UserHandler
+	Rooms      *handlers.RoomHandler
+	Messages   *handlers.MessageHandler
+	Blocks     *handlers.BlockHandler
+	Moderation *handlers.ModerationHandler
+	Reports    *handlers.ReportHandler
+	Admin      *handlers.AdminHandler
+	Health     *handlers.HealthHandler
+	WebSocket  *handlers.WebSocketHandler
+	Events     *handlers.EventsHandler
+	Hub        *handlers.HubHandler
+
+	// Store loads the accounts of authenticated users
+	Store store.StoreInterface
+
+	// HTTPLimiter limits requests per client, ClientIPs tells clients apart
+	// behind proxies, and Origins says which cross-origin requests are
+	// answered
+	HTTPLimiter *ratelimit.Limiter
+	ClientIPs   *clientip.Resolver
+	Origins     *origin.Policy
+}
+
+// NewRouter creates the main API router and registers all the application's
+// routes. Tokens are checked as cfg says.
+func NewRouter(cfg *config.Config, deps Dependencies) http.Handler {
 	// Create test handler for debugging
-	testHandler := handlers.NewTestHandler(dbStore)
+	testHandler := handlers.NewTestHandler(deps.Store)
 	router := http.NewServeMux()
 
+	// Protected routes check the token and then load the account, so that
+	// disabled users are refused and admin rights come from the store
+	authenticate := middleware.AuthMiddleware(cfg.Auth.JWTSecret)
+	activeUser := middleware.ActiveUser(deps.Store)
+	requireAuth := func(handler http.HandlerFunc) http.Handler {
+		return authenticate(activeUser(handler))
+	}
+	requireAdmin := func(handler http.HandlerFunc) http.Handler {
+		return authenticate(activeUser(middleware.RequireAdmin(handler)))
+	}
+
 	// Public routes - no authentication required
-	router.HandleFunc("/api/register", userHandler.Register)
-	router.HandleFunc("/api/login", userHandler.Login)
-	router.Handle("/api/rooms", middleware.RequireAuth(roomHandler.GetRooms)) // Protected endpoint to list rooms
-	
+	router.HandleFunc("/api/register", deps.Users.Register)
+	router.HandleFunc("/api/login", deps.Users.Login)
+	router.Handle("/api/rooms", requireAuth(deps.Rooms.GetRooms)) // Protected endpoint to list rooms
+
 	// Test endpoint for debugging registration issues
 	router.HandleFunc("/api/test/register", testHandler.TestRegister)
 
 	// Protected routes - require authentication
-	router.Handle("/api/rooms/create", middleware.RequireAuth(roomHandler.CreateRoom))
-		// The WebSocket handler performs its own authentication, so we don't need the RequireAuth middleware here.
-	router.HandleFunc("/api/ws", wsHandler.ServeWs)
+	router.Handle("/api/rooms/create", requireAuth(deps.Rooms.CreateRoom))
+	router.Handle("POST /api/rooms/{id}/join", requireAuth(deps.Rooms.JoinRoom))
+	router.Handle("POST /api/rooms/{id}/invite", requireAuth(deps.Rooms.InviteMember))
+	router.Handle("POST /api/rooms/{id}/leave", requireAuth(deps.Rooms.LeaveRoom))
+	router.Handle("GET /api/rooms/{id}/messages", requireAuth(deps.Messages.GetHistory))
+	router.Handle("POST /api/rooms/{id}/messages", requireAuth(deps.Messages.PostMessage))
+
+	// Block list - blocked users' messages are hidden and their invitations refused
+	router.Handle("GET /api/blocks", requireAuth(deps.Blocks.ListBlocks))
+	router.Handle("POST /api/blocks/{username}", requireAuth(deps.Blocks.Block))
+	router.Handle("DELETE /api/blocks/{username}", requireAuth(deps.Blocks.Unblock))
+
+	// Moderation routes - the service checks the caller's role in the room
+	router.Handle("POST /api/rooms/{id}/mute", requireAuth(deps.Moderation.Mute))
+	router.Handle("POST /api/rooms/{id}/unmute", requireAuth(deps.Moderation.Unmute))
+	router.Handle("POST /api/rooms/{id}/kick", requireAuth(deps.Moderation.Kick))
+	router.Handle("POST /api/rooms/{id}/ban", requireAuth(deps.Moderation.Ban))
+	router.Handle("POST /api/rooms/{id}/unban", requireAuth(deps.Moderation.Unban))
+	router.Handle("POST /api/rooms/{id}/role", requireAuth(deps.Moderation.SetRole))
+	router.Handle("GET /api/rooms/{id}/moderation-log", requireAuth(deps.Moderation.GetLog))
+
+	// Review queue of messages held by content filters
+	router.Handle("GET /api/rooms/{id}/held-messages", requireAuth(deps.Moderation.GetHeldMessages))
+	router.Handle("POST /api/rooms/{id}/held-messages/{messageId}/approve", requireAuth(deps.Moderation.ApproveHeldMessage))
+	router.Handle("POST /api/rooms/{id}/held-messages/{messageId}/discard", requireAuth(deps.Moderation.DiscardHeldMessage))
+
+	// Message reports and the moderators' report queue
+	router.Handle("POST /api/messages/{id}/report", requireAuth(deps.Reports.ReportMessage))
+	router.Handle("GET /api/rooms/{id}/reports", requireAuth(deps.Reports.ListRoomReports))
+	router.Handle("POST /api/reports/{id}/resolve", requireAuth(deps.Reports.ResolveReport))
+
+	// Admin routes - require an administrator account
+	router.Handle("GET /api/admin/users", requireAdmin(deps.Admin.ListUsers))
+	router.Handle("POST /api/admin/users/{id}/disable", requireAdmin(deps.Admin.DisableUser))
+	router.Handle("POST /api/admin/users/{id}/enable", requireAdmin(deps.Admin.EnableUser))
+	router.Handle("DELETE /api/admin/users/{id}", requireAdmin(deps.Admin.DeleteUser))
+	router.Handle("GET /api/admin/rooms", requireAdmin(deps.Admin.ListRooms))
+	router.Handle("POST /api/admin/rooms/{id}/archive", requireAdmin(deps.Admin.ArchiveRoom))
+	router.Handle("POST /api/admin/rooms/{id}/unarchive", requireAdmin(deps.Admin.UnarchiveRoom))
+	router.Handle("DELETE /api/admin/rooms/{id}", requireAdmin(deps.Admin.DeleteRoom))
+	router.Handle("GET /api/admin/sessions", requireAdmin(deps.Admin.ListSessions))
+	router.Handle("DELETE /api/admin/sessions/{id}", requireAdmin(deps.Admin.DisconnectSession))
+	router.Handle("GET /api/admin/reports", requireAdmin(deps.Reports.ListAllReports))
+
+	// The WebSocket handler performs its own authentication, so we don't need the requireAuth middleware here.
+	router.HandleFunc("/api/ws", deps.WebSocket.ServeWs)
+
+	// Fallbacks for clients whose proxies block WebSockets. Browsers cannot
+	// set headers on event streams, so these also take the token as a query
+	// parameter and authenticate themselves.
+	router.HandleFunc("GET /api/rooms/{id}/events", deps.Events.ServeEvents)
+	router.HandleFunc("GET /api/rooms/{id}/poll", deps.Events.Poll)
+
+	// Probes for orchestrators, and the hub's state for administrators
+	router.HandleFunc("GET /healthz", deps.Health.Live)
+	router.HandleFunc("GET /readyz", deps.Health.Ready)
+	router.Handle("GET /debug/hub", requireAdmin(deps.Hub.DebugHub))
 
-	// Apply CORS middleware to all routes
-	return middleware.CORS(router)
+	// Tag every request with an ID, trace and log it, record metrics, then apply rate limiting and CORS middleware to all routes.
+	// Probes are not rate limited, so a busy client cannot make the server look unhealthy.
+	limit := middleware.RateLimit(deps.HTTPLimiter, deps.ClientIPs, "/healthz", "/readyz")
+	return middleware.RequestID(middleware.Tracing(middleware.AccessLog(middleware.Metrics(middleware.CORS(deps.Origins)(limit(router))))))
 }
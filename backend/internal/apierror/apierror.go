@@ -0,0 +1,77 @@
+// Package apierror writes the JSON error bodies returned by every HTTP endpoint
+// and maps store errors onto HTTP status codes.
+package apierror
+
+import (
+	"backend/internal/store"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Response is the JSON body of every error response.
+type Response struct {
+	Error   string `json:"error"`           // machine readable code, e.g. "conflict"
+	Message string `json:"message"`         // human readable description
+	Field   string `json:"field,omitempty"` // the offending field, when known
+}
+
+// codes maps HTTP statuses to the machine readable error codes.
+var codes = map[int]string{
+	http.StatusBadRequest:          "bad_request",
+	http.StatusUnauthorized:        "unauthorized",
+	http.StatusForbidden:           "forbidden",
+	http.StatusNotFound:            "not_found",
+	http.StatusMethodNotAllowed:    "method_not_allowed",
+	http.StatusConflict:            "conflict",
+	http.StatusTooManyRequests:     "rate_limited",
+	http.StatusInternalServerError: "internal_error",
+	http.StatusServiceUnavailable:  "unavailable",
+}
+
+// Write sends a JSON error response with the given status and message.
+func Write(w http.ResponseWriter, status int, message string) {
+	writeResponse(w, status, Response{Message: message})
+}
+
+// WriteField sends a JSON error response that names the offending field.
+func WriteField(w http.ResponseWriter, status int, field, message string) {
+	writeResponse(w, status, Response{Message: message, Field: field})
+}
+
+// WriteStore maps a store error to its HTTP status and sends it. The message
+// is used for errors that are not one of the store's typed errors.
+func WriteStore(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		Write(w, http.StatusNotFound, "Not found")
+	case errors.Is(err, store.ErrConflict):
+		field := store.ConflictField(err)
+		WriteField(w, http.StatusConflict, field, (&store.ConflictError{Field: field}).Error())
+	case errors.Is(err, store.ErrInUse):
+		Write(w, http.StatusConflict, "This record is still in use")
+	case errors.Is(err, store.ErrUnavailable):
+		w.Header().Set("Retry-After", "5")
+		Write(w, http.StatusServiceUnavailable, "Service temporarily unavailable, please retry")
+	default:
+		Write(w, http.StatusInternalServerError, message)
+	}
+}
+
+// MethodNotAllowed sends a 405 response listing the allowed method.
+func MethodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	Write(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+}
+
+func writeResponse(w http.ResponseWriter, status int, body Response) {
+	body.Error = codes[status]
+	if body.Error == "" {
+		body.Error = "error"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
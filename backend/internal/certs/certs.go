@@ -0,0 +1,132 @@
+// Package certs serves TLS certificates from files and swaps them in when the
+// files change, so renewed certificates are used without a restart.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader holds the certificate loaded from a certificate and key file.
+// New handshakes use the latest certificate; connections that are already
+// open keep the one they started with.
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mu    sync.RWMutex
+	cert  *tls.Certificate
+	stamp fileStamp // of the files when they were last read
+}
+
+// fileStamp identifies a version of the certificate and key files.
+type fileStamp struct {
+	certMod, keyMod   time.Time
+	certSize, keySize int64
+}
+
+// NewReloader loads the certificate and key, and fails if they cannot be used.
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the files again. If they cannot be used, for example because
+// only one of them has been replaced so far, the current certificate is
+// kept and the error returned.
+func (r *Reloader) Reload() error {
+	stamp, _ := r.stat()
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		r.mu.Lock()
+		r.stamp = stamp // wait for the next change before trying again
+		r.mu.Unlock()
+		return fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("parsing TLS certificate: %w", err)
+	}
+	cert.Leaf = leaf
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.stamp = stamp
+	r.mu.Unlock()
+
+	slog.Info("tls certificate loaded", "file", r.certFile, "subject", leaf.Subject.String(),
+		"dns_names", leaf.DNSNames, "not_after", leaf.NotAfter)
+	if time.Until(leaf.NotAfter) < 7*24*time.Hour {
+		slog.Warn("tls certificate expires soon", "file", r.certFile, "not_after", leaf.NotAfter)
+	}
+	return nil
+}
+
+// Certificate returns the current certificate.
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// GetCertificate returns the current certificate for a handshake. It suits
+// tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+// Watch checks the files every interval and reloads them when they have
+// changed, until ctx is done. Failed reloads are logged and the previous
+// certificate stays in use.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if r.changed() {
+				if err := r.Reload(); err != nil {
+					slog.Error("tls certificate reload failed; keeping the current certificate", "error", err)
+				}
+			}
+		}
+	}
+}
+
+// changed reports whether either file differs from when it was last read.
+func (r *Reloader) changed() bool {
+	stamp, err := r.stat()
+	if err != nil {
+		return false // probably being replaced; look again next time
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return stamp != r.stamp
+}
+
+// stat returns the files' current modification times and sizes.
+func (r *Reloader) stat() (fileStamp, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{
+		certMod: certInfo.ModTime(), certSize: certInfo.Size(),
+		keyMod: keyInfo.ModTime(), keySize: keyInfo.Size(),
+	}, nil
+}
@@ -0,0 +1,159 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// paths returns certificate and key paths in a fresh directory.
+func paths(t *testing.T) (certFile, keyFile string) {
+	dir := filepath.Join(t.TempDir(), "certs")
+	return filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+}
+
+func TestEnsureSelfSigned(t *testing.T) {
+	certFile, keyFile := paths(t)
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+
+	generated, err := EnsureSelfSigned(certFile, keyFile, hosts)
+	if err != nil || !generated {
+		t.Fatalf("EnsureSelfSigned = %t, %v; want a new certificate", generated, err)
+	}
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("key file mode = %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+	leaf := r.Certificate().Leaf
+	for _, host := range hosts {
+		if err := leaf.VerifyHostname(host); err != nil {
+			t.Errorf("certificate does not cover %s: %v", host, err)
+		}
+	}
+
+	// A usable pair is kept, and one missing a host is replaced
+	if generated, err := EnsureSelfSigned(certFile, keyFile, hosts); err != nil || generated {
+		t.Errorf("second EnsureSelfSigned = %t, %v; want the existing certificate kept", generated, err)
+	}
+	if generated, err := EnsureSelfSigned(certFile, keyFile, []string{"chat.test"}); err != nil || !generated {
+		t.Errorf("EnsureSelfSigned for a new host = %t, %v; want a new certificate", generated, err)
+	}
+}
+
+func TestReloadKeepsCertificateOnError(t *testing.T) {
+	certFile, keyFile := paths(t)
+	if err := GenerateSelfSigned(certFile, keyFile, []string{"localhost"}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+	before := r.Certificate()
+
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Fatal("Reload accepted a broken key")
+	}
+	if r.Certificate() != before {
+		t.Error("a failed reload replaced the certificate")
+	}
+
+	if _, err := NewReloader(certFile, keyFile); err == nil {
+		t.Error("NewReloader accepted a broken key")
+	}
+}
+
+func TestWatchReloadsChangedFiles(t *testing.T) {
+	certFile, keyFile := paths(t)
+	if err := GenerateSelfSigned(certFile, keyFile, []string{"localhost"}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+	before := r.Certificate().Leaf.SerialNumber
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, 10*time.Millisecond)
+
+	if err := GenerateSelfSigned(certFile, keyFile, []string{"localhost"}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for r.Certificate().Leaf.SerialNumber.Cmp(before) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the replaced certificate was not loaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReloadKeepsOpenConnections(t *testing.T) {
+	certFile, keyFile := paths(t)
+	if err := GenerateSelfSigned(certFile, keyFile, []string{"127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{GetCertificate: r.GetCertificate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	// dial connects trusting only the certificate currently on disk
+	dial := func() *tls.Conn {
+		roots := x509.NewCertPool()
+		roots.AddCert(r.Certificate().Leaf)
+		conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{RootCAs: roots})
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		return conn
+	}
+
+	first := dial()
+	defer first.Close()
+	oldSerial := first.ConnectionState().PeerCertificates[0].SerialNumber
+
+	if err := GenerateSelfSigned(certFile, keyFile, []string{"127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	second := dial()
+	defer second.Close()
+	if second.ConnectionState().PeerCertificates[0].SerialNumber.Cmp(oldSerial) == 0 {
+		t.Error("a new connection was served the old certificate")
+	}
+
+	// The connection made before the reload still works
+	if _, err := first.Write([]byte("GET / HTTP/1.1\r\nHost: test\r\n\r\n")); err != nil {
+		t.Fatalf("write on the old connection: %v", err)
+	}
+	buf := make([]byte, 12)
+	if _, err := first.Read(buf); err != nil || string(buf) != "HTTP/1.1 200" {
+		t.Errorf("old connection read %q, %v; want a response", buf, err)
+	}
+}
@@ -0,0 +1,93 @@
+// Package cli holds the subcommands shared by the server binary and chatctl.
+package cli
+
+import (
+	"backend/internal/config"
+	"backend/internal/store"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = `Usage: %s migrate <command>
+
+Commands:
+  status        Show applied and pending migrations
+  up            Apply all pending migrations
+  down [n]      Roll back the last n migrations (default 1)
+`
+
+// Migrate implements the "migrate" subcommand of the program named prog
+// against the configured database and returns the process exit code.
+func Migrate(prog string, dbConfig *config.DatabaseConfig, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, migrateUsage, prog)
+		return 2
+	}
+	switch args[0] {
+	case "status", "up", "down":
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown migrate command %q\n\n"+migrateUsage, args[0], prog)
+		return 2
+	}
+
+	dbStore, err := store.NewDBStore(dbConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize database: %v\n", err)
+		return 1
+	}
+	defer dbStore.Close()
+
+	migrator, err := dbStore.Migrator()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load migrations: %v\n", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read migration status: %v\n", err)
+			return 1
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, s := range statuses {
+			state, appliedAt := "pending", ""
+			if s.Applied {
+				state, appliedAt = "applied", s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+		}
+		tw.Flush()
+
+	case "up":
+		applied, err := migrator.Up()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Migration failed after %d applied: %v\n", applied, err)
+			return 1
+		}
+		fmt.Printf("Applied %d migration(s)\n", applied)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				fmt.Fprintf(os.Stderr, "Invalid step count %q\n", args[1])
+				return 2
+			}
+		}
+		rolledBack, err := migrator.Down(steps)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Rollback failed after %d rolled back: %v\n", rolledBack, err)
+			return 1
+		}
+		fmt.Printf("Rolled back %d migration(s)\n", rolledBack)
+	}
+
+	return 0
+}
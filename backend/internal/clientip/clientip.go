@@ -0,0 +1,106 @@
+// Package clientip finds the address of the client behind a request,
+// believing X-Forwarded-For only when it was set by a trusted proxy.
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Resolver knows which reverse proxies are trusted. A proxy is given as an
+// address such as "10.0.0.5" or a network such as "10.0.0.0/8".
+//
+// A request from a trusted proxy comes from the last address in its
+// X-Forwarded-For header that is not itself a trusted proxy. Entries further
+// left were written by the client and are ignored, so a client cannot choose
+// the address it is known by.
+type Resolver struct {
+	proxies []netip.Prefix
+}
+
+// New parses the trusted proxies into a Resolver. It reports the first
+// invalid entry. With no proxies, every request comes from its connection's
+// address.
+func New(proxies []string) (*Resolver, error) {
+	r := &Resolver{}
+	for _, proxy := range proxies {
+		prefix, err := parse(proxy)
+		if err != nil {
+			return nil, err
+		}
+		r.proxies = append(r.proxies, prefix)
+	}
+	return r, nil
+}
+
+// Validate reports whether proxy is a valid address or network.
+func Validate(proxy string) error {
+	_, err := parse(proxy)
+	return err
+}
+
+// parse reads an address as a network of one address.
+func parse(proxy string) (netip.Prefix, error) {
+	if strings.Contains(proxy, "/") {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid proxy network %q: use a CIDR such as \"10.0.0.0/8\"", proxy)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(proxy)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid proxy address %q: use an IP such as \"10.0.0.5\"", proxy)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// IP returns the address of the client that sent r.
+func (res *Resolver) IP(r *http.Request) string {
+	client := remoteIP(r)
+	if !res.trusted(client) {
+		return client
+	}
+
+	// Walk back through the proxies that added themselves to the header
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			break
+		}
+		client = hop
+		if !res.trusted(hop) {
+			break
+		}
+	}
+	return client
+}
+
+// trusted reports whether ip belongs to a trusted proxy.
+func (res *Resolver) trusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, proxy := range res.proxies {
+		if proxy.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP returns the IP address of the connection the request came from.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,61 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIP(t *testing.T) {
+	resolver, err := New([]string{"10.0.0.0/8", "192.168.1.1", "fd00::/8"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		// Direct clients cannot claim another address
+		{"203.0.113.7:1234", nil, "203.0.113.7"},
+		{"203.0.113.7:1234", []string{"198.51.100.1"}, "203.0.113.7"},
+		// A trusted proxy passes on the address it saw
+		{"10.1.2.3:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"192.168.1.1:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"[fd00::1]:1234", []string{"2001:db8::5"}, "2001:db8::5"},
+		// Addresses the client sent before the proxies are ignored
+		{"10.1.2.3:1234", []string{"1.1.1.1, 198.51.100.1, 10.9.9.9"}, "198.51.100.1"},
+		{"10.1.2.3:1234", []string{"1.1.1.1", "198.51.100.1, 10.9.9.9"}, "198.51.100.1"},
+		// A proxy that forwarded nothing usable is the client
+		{"10.1.2.3:1234", nil, "10.1.2.3"},
+		{"10.1.2.3:1234", []string{"unknown"}, "10.1.2.3"},
+		// Only trusted proxies all the way
+		{"10.1.2.3:1234", []string{"10.4.4.4"}, "10.4.4.4"},
+		// An untrusted address is not a proxy, even in the same /24
+		{"192.168.1.2:1234", []string{"198.51.100.1"}, "192.168.1.2"},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tc.remoteAddr
+		for _, value := range tc.forwarded {
+			req.Header.Add("X-Forwarded-For", value)
+		}
+		if got := resolver.IP(req); got != tc.want {
+			t.Errorf("%s with X-Forwarded-For %q = %q, want %q", tc.remoteAddr, tc.forwarded, got, tc.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, proxy := range []string{"10.0.0.1", "10.0.0.0/8", "::1", "fd00::/8"} {
+		if err := Validate(proxy); err != nil {
+			t.Errorf("Validate(%q): %v", proxy, err)
+		}
+	}
+	for _, proxy := range []string{"", "proxy.example.com", "10.0.0.0/33", "10.0.0.1:80"} {
+		if err := Validate(proxy); err == nil {
+			t.Errorf("Validate(%q) succeeded", proxy)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package config
+
+// AdminConfig names the account that is made an administrator at startup.
+type AdminConfig struct {
+	// Username is promoted to administrator, or created if it does not exist.
+	// Leave it empty to skip bootstrapping.
+	Username string `config:"username" env:"ADMIN_USERNAME"`
+	// Password is only used when the account has to be created.
+	Password string `config:"password" env:"ADMIN_PASSWORD" secret:"true"`
+}
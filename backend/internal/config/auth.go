@@ -0,0 +1,42 @@
+package config
+
+import "time"
+
+// insecureJWTSecret is the signing key used when none is configured. It is
+// public, so anyone can forge tokens for a server that still uses it.
+const insecureJWTSecret = "your-256-bit-secret-key-change-this-in-production"
+
+// minJWTSecretLength is the shortest accepted signing key: HS256 keys should
+// have at least 256 bits.
+const minJWTSecretLength = 32
+
+// AuthConfig controls the tokens issued at login.
+type AuthConfig struct {
+	// JWTSecret signs and verifies tokens. Changing it logs everyone out.
+	JWTSecret string `config:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+	// TokenTTL is how long a token stays valid after login
+	TokenTTL time.Duration `config:"token_ttl" env:"JWT_TOKEN_TTL"`
+}
+
+// defaultAuthConfig keeps the historical development key, so that existing
+// setups keep working; the server warns about it at startup.
+func defaultAuthConfig() AuthConfig {
+	return AuthConfig{
+		JWTSecret: insecureJWTSecret,
+		TokenTTL:  24 * time.Hour,
+	}
+}
+
+// UsesDefaultSecret reports whether tokens are signed with the well-known
+// development key.
+func (c *AuthConfig) UsesDefaultSecret() bool {
+	return c.JWTSecret == insecureJWTSecret
+}
+
+// validate checks the signing key and token lifetime.
+func (c *AuthConfig) validate(v *validator) {
+	if len(c.JWTSecret) < minJWTSecretLength {
+		v.fail("auth.jwt_secret", "must be at least %d characters long", minJWTSecretLength)
+	}
+	v.positive("auth.token_ttl", c.TokenTTL)
+}
@@ -0,0 +1,198 @@
+// Package config holds the server's settings. They are read from an optional
+// YAML or TOML file, overridden by environment variables, and validated as a
+// whole before anything starts, so that every mistake is reported at once.
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is the complete server configuration. The `config` tags are the keys
+// of the configuration file, the `env` tags the environment variables that
+// override them, and `secret` marks values that are masked when printed.
+type Config struct {
+	Server        ServerConfig        `config:"server"`
+	TLS           TLSConfig           `config:"tls"`
+	Database      DatabaseConfig      `config:"database"`
+	Auth          AuthConfig          `config:"auth"`
+	Admin         AdminConfig         `config:"admin"`
+	CORS          CORSConfig          `config:"cors"`
+	WebSocket     WebSocketConfig     `config:"websocket"`
+	RateLimit     RateLimitConfig     `config:"rate_limit"`
+	ContentFilter ContentFilterConfig `config:"content_filter"`
+	Logging       LoggingConfig       `config:"logging"`
+	Tracing       TracingConfig       `config:"tracing"`
+	Debug         DebugConfig         `config:"debug"`
+}
+
+// Default returns the configuration used when nothing is set.
+func Default() *Config {
+	return &Config{
+		Server:        defaultServerConfig(),
+		TLS:           defaultTLSConfig(),
+		Database:      defaultDatabaseConfig(),
+		Auth:          defaultAuthConfig(),
+		CORS:          defaultCORSConfig(),
+		WebSocket:     defaultWebSocketConfig(),
+		RateLimit:     defaultRateLimitConfig(),
+		ContentFilter: defaultContentFilterConfig(),
+		Logging:       defaultLoggingConfig(),
+		Tracing:       defaultTracingConfig(),
+		Debug:         defaultDebugConfig(),
+	}
+}
+
+// Load builds the configuration from the defaults, the file at path if path
+// is not empty, and then the environment. The file's format is chosen by its
+// extension: .yaml, .yml or .toml. Unknown keys, values of the wrong type and
+// invalid settings are all reported in one *Error.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	var problems []string
+
+	if path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, decode(cfg, values)...)
+	}
+	problems = append(problems, applyEnv(cfg, lookupEnv)...)
+	if len(problems) > 0 {
+		return nil, &Error{Problems: problems}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// lookupEnv returns the value of an environment variable, treating an empty
+// value as unset.
+func lookupEnv(key string) (string, bool) {
+	value := os.Getenv(key)
+	return value, value != ""
+}
+
+// readFile parses a configuration file according to its extension.
+func readFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading configuration: %w", err)
+	}
+
+	var values map[string]any
+	switch ext := strings.ToLower(path[strings.LastIndex(path, ".")+1:]); ext {
+	case "yaml", "yml":
+		values, err = parseYAML(data)
+	case "toml":
+		values, err = parseTOML(data)
+	default:
+		return nil, fmt.Errorf("configuration file %s: unknown format, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("configuration file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// Validate checks every setting and reports all the problems found in one
+// *Error, or returns nil.
+func (c *Config) Validate() error {
+	v := &validator{env: envNames(c)}
+	c.Server.validate(v)
+	c.TLS.validate(v, c.Server.Port)
+	c.Database.validate(v)
+	c.Auth.validate(v)
+	c.CORS.validate(v)
+	c.WebSocket.validate(v)
+	c.RateLimit.validate(v)
+	c.ContentFilter.validate(v)
+	c.Logging.validate(v)
+	c.Tracing.validate(v)
+	c.Debug.validate(v)
+	if len(v.problems) > 0 {
+		return &Error{Problems: v.problems}
+	}
+	return nil
+}
+
+// Error lists every problem found while loading the configuration.
+type Error struct {
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+// validator collects problems, naming each setting by its file key and
+// environment variable.
+type validator struct {
+	env      map[string]string
+	problems []string
+}
+
+// fail records a problem with the setting at key.
+func (v *validator) fail(key, format string, args ...any) {
+	name := key
+	if env, ok := v.env[key]; ok {
+		name += " (" + env + ")"
+	}
+	v.problems = append(v.problems, name+": "+fmt.Sprintf(format, args...))
+}
+
+// require checks that a string setting is not empty.
+func (v *validator) require(key, value string) {
+	if value == "" {
+		v.fail(key, "must be set")
+	}
+}
+
+// positive checks that a duration is greater than zero.
+func (v *validator) positive(key string, d time.Duration) {
+	if d <= 0 {
+		v.fail(key, "must be a positive duration such as \"30s\", got %s", d)
+	}
+}
+
+// oneOf checks that value is one of the allowed choices.
+func (v *validator) oneOf(key, value string, choices ...string) {
+	for _, choice := range choices {
+		if value == choice {
+			return
+		}
+	}
+	v.fail(key, "unknown value %q: use %s", value, strings.Join(choices, ", "))
+}
+
+// port checks that value is a TCP port number.
+func (v *validator) port(key, value string) {
+	if n, err := strconv.Atoi(value); err != nil || n < 1 || n > 65535 {
+		v.fail(key, "must be a port number from 1 to 65535, got %q", value)
+	}
+}
+
+// listenAddr checks that value is a host:port listen address.
+func (v *validator) listenAddr(key, value string) {
+	if _, port, err := net.SplitHostPort(value); err != nil {
+		v.fail(key, "must be a host:port address such as \"localhost:6060\", got %q", value)
+	} else {
+		v.port(key, port)
+	}
+}
+
+// url checks that value is an absolute http or https URL.
+func (v *validator) url(key, value string) {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.fail(key, "must be an http or https URL, got %q", value)
+	}
+}
@@ -0,0 +1,314 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testYAML = `
+# Chat server settings
+server:
+  port: 9090
+database:
+  type: postgres
+  host: db.internal
+  password: "p@ss # not a comment"
+auth:
+  jwt_secret: 'a-secret-that-is-long-enough-for-hs256'
+  token_ttl: 2h
+cors:
+  allowed_origins:
+    - https://chat.example.com
+    - "http://localhost:3000"
+websocket:
+  ping_period: 20s
+rate_limit:
+  user_messages_per_sec: 2.5
+content_filter:
+  words: [spam, "eggs"]
+tracing:
+  exporter: otlp
+  otlp_headers: {api-key: abc123}
+`
+
+const testTOML = `
+# Chat server settings
+[server]
+port = 9090
+
+[database]
+type = "postgres"
+host = "db.internal"
+password = "p@ss # not a comment"
+
+[auth]
+jwt_secret = 'a-secret-that-is-long-enough-for-hs256'
+token_ttl = "2h"
+
+[cors]
+allowed_origins = [
+  "https://chat.example.com",
+  "http://localhost:3000",  # the development frontend
+]
+
+[websocket]
+ping_period = "20s"
+
+[rate_limit]
+user_messages_per_sec = 2.5
+
+[content_filter]
+words = ["spam", "eggs"]
+
+[tracing]
+exporter = "otlp"
+otlp_headers = { api-key = "abc123" }
+`
+
+// writeFile writes a configuration file into a temporary directory.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// clearEnv unsets every variable that overrides a setting, for the test's duration.
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, env := range envNames(Default()) {
+		t.Setenv(env, "")
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	clearEnv(t)
+	want := Default()
+	want.Server.Port = "9090"
+	want.Database.Type = "postgres"
+	want.Database.Host = "db.internal"
+	want.Database.Password = "p@ss # not a comment"
+	want.Auth.JWTSecret = "a-secret-that-is-long-enough-for-hs256"
+	want.Auth.TokenTTL = 2 * time.Hour
+	want.CORS.AllowedOrigins = []string{"https://chat.example.com", "http://localhost:3000"}
+	want.WebSocket.PingPeriod = 20 * time.Second
+	want.RateLimit.UserMessageRate = 2.5
+	want.ContentFilter.Words = []string{"spam", "eggs"}
+	want.Tracing.Exporter = "otlp"
+	want.Tracing.OTLPHeaders = map[string]string{"api-key": "abc123"}
+
+	for name, content := range map[string]string{"chat.yaml": testYAML, "chat.toml": testTOML} {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := Load(writeFile(t, name, content))
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if !reflect.DeepEqual(cfg, want) {
+				t.Errorf("Load =\n%s\nwant\n%s", cfg, want)
+			}
+		})
+	}
+}
+
+func TestEnvOverridesFile(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("PORT", "7070")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example.com, https://b.example.com")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "api-key=xyz")
+
+	cfg, err := Load(writeFile(t, "chat.yaml", testYAML))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Server.Port != "7070" {
+		t.Errorf("port = %q, want the environment's 7070", cfg.Server.Port)
+	}
+	if want := []string{"https://a.example.com", "https://b.example.com"}; !reflect.DeepEqual(cfg.CORS.AllowedOrigins, want) {
+		t.Errorf("origins = %q, want %q", cfg.CORS.AllowedOrigins, want)
+	}
+	if cfg.Tracing.OTLPHeaders["api-key"] != "xyz" {
+		t.Errorf("headers = %v", cfg.Tracing.OTLPHeaders)
+	}
+	if cfg.Database.Host != "db.internal" {
+		t.Errorf("host = %q, want the file's value where the environment is silent", cfg.Database.Host)
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("RATE_LIMIT_MAX_VIOLATIONS", "many")
+	path := writeFile(t, "chat.yaml", `
+server:
+  prot: 8080
+database:
+  type: oracle
+websocket:
+  ping_period: 90s
+  pong_wait: soon
+`)
+
+	_, err := Load(path)
+	var cfgErr *Error
+	if !errors.As(err, &cfgErr) {
+		t.Fatalf("Load error = %v, want *Error", err)
+	}
+	for _, want := range []string{"server.prot: unknown setting", "websocket.pong_wait: invalid duration", "RATE_LIMIT_MAX_VIOLATIONS: invalid integer"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error lacks %q:\n%v", want, err)
+		}
+	}
+
+	// Once the values fit, validation reports the rest together
+	path = writeFile(t, "chat.yaml", `
+database:
+  type: oracle
+websocket:
+  ping_period: 90s
+auth:
+  jwt_secret: short
+cors:
+  allowed_origins: ["https://*.example.com", "https://app.*.example.com"]
+tls:
+  cert_file: server.pem
+  redirect_port: "8082"
+`)
+	t.Setenv("RATE_LIMIT_MAX_VIOLATIONS", "")
+	_, err = Load(path)
+	for _, want := range []string{
+		`database.type (DB_TYPE): unknown database type "oracle"`,
+		"websocket.ping_period (WS_PING_PERIOD): must be shorter than websocket.pong_wait (1m0s)",
+		"auth.jwt_secret (JWT_SECRET): must be at least 32 characters long",
+		`cors.allowed_origins (CORS_ALLOWED_ORIGINS): origin pattern "https://app.*.example.com"`,
+		"tls.key_file (TLS_KEY_FILE): must be set with tls.cert_file",
+		"tls.redirect_port (TLS_REDIRECT_PORT): must differ from server.port (8082)",
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error lacks %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestDefaultIsValid(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("default configuration is invalid: %v", err)
+	}
+}
+
+func TestStringMasksSecretsAndRoundTrips(t *testing.T) {
+	clearEnv(t)
+	cfg, err := Load(writeFile(t, "chat.toml", testTOML))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	cfg.Admin.Username = "root"
+	cfg.Admin.Password = "hunter2"
+
+	printed := cfg.String()
+	for _, secret := range []string{"p@ss", "a-secret-that", "abc123", "hunter2"} {
+		if strings.Contains(printed, secret) {
+			t.Errorf("printed configuration reveals %q:\n%s", secret, printed)
+		}
+	}
+
+	// The printed form is a valid file that differs only in the secrets
+	values, err := parseYAML([]byte(printed))
+	if err != nil {
+		t.Fatalf("printed configuration does not parse: %v\n%s", err, printed)
+	}
+	reloaded := Default()
+	if problems := decode(reloaded, values); len(problems) > 0 {
+		t.Fatalf("printed configuration does not load: %v", problems)
+	}
+	reloaded.Database.Password = cfg.Database.Password
+	reloaded.Auth.JWTSecret = cfg.Auth.JWTSecret
+	reloaded.Admin.Password = cfg.Admin.Password
+	reloaded.Tracing.OTLPHeaders = cfg.Tracing.OTLPHeaders
+	if !reflect.DeepEqual(reloaded, cfg) {
+		t.Errorf("reloaded =\n%s\nwant\n%s", reloaded, cfg)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name, format, content, want string
+	}{
+		{"yaml tab", "yaml", "server:\n\tport: 1", "line 2"},
+		{"yaml duplicate", "yaml", "server:\n  port: 1\n  port: 2", `line 3: mapping key "port" already defined`},
+		{"yaml bad indent", "yaml", "server:\n  port: 1\n    extra: 2", "line 3"},
+		{"yaml not a mapping", "yaml", "- port: 1", "cannot unmarshal"},
+		{"yaml documents", "yaml", "a: 1\n---\nb: 2", "only one document"},
+		{"toml no equals", "toml", "[server]\nport 1", "line 2"},
+		{"toml duplicate", "toml", "[server]\nport = 1\nport = 2", "line 3"},
+		{"toml table twice", "toml", "[server]\n[server]", "line 2"},
+		{"toml unterminated", "toml", `name = "abc`, "line 1"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var err error
+			if tc.format == "yaml" {
+				_, err = parseYAML([]byte(tc.content))
+			} else {
+				_, err = parseTOML([]byte(tc.content))
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("error = %v, want it to contain %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsValuesThatFitNoSetting(t *testing.T) {
+	clearEnv(t)
+	tests := []struct {
+		name, file, content, want string
+	}{
+		{"yaml list of maps", "chat.yaml", "cors:\n  allowed_origins:\n    - origin: x", "cors.allowed_origins: list entries must be single values"},
+		{"yaml section as value", "chat.yaml", "server:\n  port:\n    number: 1", "server.port: must be a single value, not a section"},
+		{"toml date", "chat.toml", "[auth]\ntoken_ttl = 1979-05-27", "auth.token_ttl: unsupported value"},
+		{"toml array of tables", "chat.toml", "[[server]]\nport = 1", "server: must be a section of settings"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Load(writeFile(t, tc.file, tc.content))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("error = %v, want it to contain %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadStandardYAML(t *testing.T) {
+	clearEnv(t)
+	// Block scalars, anchors and empty sections are all plain YAML
+	content := `
+auth:
+  jwt_secret: &secret >-
+    a-secret-that-is-long-enough-for-hs256
+admin:
+  password: *secret
+logging:
+`
+	cfg, err := Load(writeFile(t, "chat.yaml", content))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Auth.JWTSecret != "a-secret-that-is-long-enough-for-hs256" || cfg.Admin.Password != cfg.Auth.JWTSecret {
+		t.Errorf("jwt_secret = %q, admin password = %q", cfg.Auth.JWTSecret, cfg.Admin.Password)
+	}
+	if cfg.Logging != Default().Logging {
+		t.Errorf("empty logging section changed the defaults: %+v", cfg.Logging)
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := Load(writeFile(t, "chat.json", "{}")); err == nil || !strings.Contains(err.Error(), "unknown format") {
+		t.Fatalf("Load(.json) error = %v, want unknown format", err)
+	}
+}
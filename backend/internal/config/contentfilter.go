@@ -0,0 +1,45 @@
+package config
+
+import (
+	"time"
+)
+
+// ContentFilterConfig configures the filters that screen messages before they are saved.
+// Actions are "allow", "redact", "hold" or "reject".
+type ContentFilterConfig struct {
+	// Words that trigger WordsAction when they appear as whole words
+	Words       []string `config:"words" env:"CONTENT_FILTER_WORDS"`
+	WordsAction string   `config:"words_action" env:"CONTENT_FILTER_WORDS_ACTION"`
+
+	// Domains (and their subdomains) that trigger DomainsAction when linked to
+	BlockedDomains []string `config:"blocked_domains" env:"CONTENT_FILTER_BLOCKED_DOMAINS"`
+	DomainsAction  string   `config:"domains_action" env:"CONTENT_FILTER_DOMAINS_ACTION"`
+
+	// RulesFile is a JSON file of regular expression rules, each of the form
+	// {"pattern": "...", "action": "hold", "reason": "..."}
+	RulesFile string `config:"rules_file" env:"CONTENT_FILTER_RULES_FILE"`
+
+	// ClassifierURL is an external classification service that is asked about every message
+	ClassifierURL     string        `config:"classifier_url" env:"CONTENT_FILTER_CLASSIFIER_URL"`
+	ClassifierTimeout time.Duration `config:"classifier_timeout" env:"CONTENT_FILTER_CLASSIFIER_TIMEOUT"`
+}
+
+// defaultContentFilterConfig has no filters; the actions apply once words or
+// domains are listed.
+func defaultContentFilterConfig() ContentFilterConfig {
+	return ContentFilterConfig{
+		WordsAction:       "redact",
+		DomainsAction:     "reject",
+		ClassifierTimeout: 2 * time.Second,
+	}
+}
+
+// validate checks the actions and the classifier settings.
+func (c *ContentFilterConfig) validate(v *validator) {
+	v.oneOf("content_filter.words_action", c.WordsAction, "allow", "redact", "hold", "reject")
+	v.oneOf("content_filter.domains_action", c.DomainsAction, "allow", "redact", "hold", "reject")
+	if c.ClassifierURL != "" {
+		v.url("content_filter.classifier_url", c.ClassifierURL)
+		v.positive("content_filter.classifier_timeout", c.ClassifierTimeout)
+	}
+}
@@ -0,0 +1,26 @@
+package config
+
+import "backend/internal/origin"
+
+// CORSConfig lists the browser origins allowed to call the API and to open
+// WebSocket connections.
+type CORSConfig struct {
+	// AllowedOrigins are exact origins such as "https://chat.example.com",
+	// wildcard subdomains such as "https://*.example.com", or regular
+	// expressions prefixed with "regex:". See origin.Policy.
+	AllowedOrigins []string `config:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+}
+
+// defaultCORSConfig allows the development frontend.
+func defaultCORSConfig() CORSConfig {
+	return CORSConfig{AllowedOrigins: []string{"http://localhost:3000"}}
+}
+
+// validate checks that every pattern parses.
+func (c *CORSConfig) validate(v *validator) {
+	for _, pattern := range c.AllowedOrigins {
+		if err := origin.Validate(pattern); err != nil {
+			v.fail("cors.allowed_origins", "%v", err)
+		}
+	}
+}
@@ -2,28 +2,31 @@ package config
 
 import (
 	"fmt"
-	"os"
 )
 
 // DatabaseConfig holds the database connection parameters
 type DatabaseConfig struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
-	DBName   string
-	SSLMode  string
+	Type       string `config:"type" env:"DB_TYPE"` // "sqlite", "postgres" or "memory"
+	SQLitePath string `config:"sqlite_path" env:"DB_SQLITE_PATH"`
+	Host       string `config:"host" env:"DB_HOST"`
+	Port       string `config:"port" env:"DB_PORT"`
+	User       string `config:"user" env:"DB_USER"`
+	Password   string `config:"password" env:"DB_PASSWORD" secret:"true"`
+	DBName     string `config:"name" env:"DB_NAME"`
+	SSLMode    string `config:"sslmode" env:"DB_SSLMODE"`
 }
 
-// NewDatabaseConfig creates a new database configuration from environment variables
-func NewDatabaseConfig() *DatabaseConfig {
-	return &DatabaseConfig{
-		Host:     getEnv("DB_HOST", "localhost"),
-		Port:     getEnv("DB_PORT", "5432"),
-		User:     getEnv("DB_USER", "postgres"),
-		Password: getEnv("DB_PASSWORD", "postgres"),
-		DBName:   getEnv("DB_NAME", "chatapp"),
-		SSLMode:  getEnv("DB_SSLMODE", "disable"),
+// defaultDatabaseConfig uses a SQLite file in the working directory.
+func defaultDatabaseConfig() DatabaseConfig {
+	return DatabaseConfig{
+		Type:       "sqlite",
+		SQLitePath: "./chatapp.db",
+		Host:       "localhost",
+		Port:       "5432",
+		User:       "postgres",
+		Password:   "postgres",
+		DBName:     "chatapp",
+		SSLMode:    "disable",
 	}
 }
 
@@ -33,22 +36,35 @@ func (c *DatabaseConfig) ConnectionString() string {
 		c.Host, c.Port, c.User, c.Password, c.DBName, c.SSLMode)
 }
 
-// SQLiteConnectionString returns the SQLite connection string for local development
+// SQLiteConnectionString returns the SQLite connection string for local development.
+// Transactions take the write lock immediately so concurrent migrations serialise,
+// a busy timeout makes competing writers wait instead of failing, and foreign keys
+// are enforced as they are on PostgreSQL.
 func (c *DatabaseConfig) SQLiteConnectionString() string {
-	return "./chatapp.db"
+	return c.SQLitePath + "?_txlock=immediate&_busy_timeout=5000&_foreign_keys=on"
 }
 
 // IsSQLite returns true if the database is SQLite
 func (c *DatabaseConfig) IsSQLite() bool {
-	// Check if DB_TYPE environment variable is set to sqlite
-	return getEnv("DB_TYPE", "sqlite") == "sqlite"
+	return c.Type == "sqlite"
 }
 
-// Helper function to get environment variables with default values
-func getEnv(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+// IsMemory returns true if data should only be kept in memory (demo mode)
+func (c *DatabaseConfig) IsMemory() bool {
+	return c.Type == "memory"
+}
+
+// validate checks the settings needed by the chosen database.
+func (c *DatabaseConfig) validate(v *validator) {
+	switch c.Type {
+	case "sqlite":
+		v.require("database.sqlite_path", c.SQLitePath)
+	case "postgres":
+		v.require("database.host", c.Host)
+		v.require("database.name", c.DBName)
+		v.port("database.port", c.Port)
+	case "memory":
+	default:
+		v.fail("database.type", "unknown database type %q: use sqlite, postgres or memory", c.Type)
 	}
-	return value
 }
@@ -0,0 +1,27 @@
+package config
+
+// DebugConfig controls the diagnostics listener, which serves pprof and the
+// metrics apart from the public API.
+type DebugConfig struct {
+	// Addr is the listen address, such as "localhost:6060", or "off" to
+	// disable the listener. Bind it to a private interface: pprof and the
+	// metrics are not authenticated.
+	Addr string `config:"addr" env:"DEBUG_ADDR"`
+}
+
+// defaultDebugConfig only listens on the loopback interface.
+func defaultDebugConfig() DebugConfig {
+	return DebugConfig{Addr: "localhost:6060"}
+}
+
+// Enabled reports whether the diagnostics listener should be started.
+func (c *DebugConfig) Enabled() bool {
+	return c.Addr != "" && c.Addr != "off"
+}
+
+// validate checks the listen address.
+func (c *DebugConfig) validate(v *validator) {
+	if c.Enabled() {
+		v.listenAddr("debug.addr", c.Addr)
+	}
+}
@@ -0,0 +1,251 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// decode copies the values parsed from a configuration file into cfg and
+// returns a problem for every unknown key and every value that does not fit
+// its setting.
+func decode(cfg *Config, values map[string]any) []string {
+	var problems []string
+	decodeStruct(reflect.ValueOf(cfg).Elem(), values, "", &problems)
+	return problems
+}
+
+func decodeStruct(v reflect.Value, values map[string]any, prefix string, problems *[]string) {
+	fields := make(map[string]reflect.Value)
+	for i := 0; i < v.NumField(); i++ {
+		if key := v.Type().Field(i).Tag.Get("config"); key != "" {
+			fields[key] = v.Field(i)
+		}
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		path := prefix + key
+		field, ok := fields[key]
+		if !ok {
+			*problems = append(*problems, path+": unknown setting")
+			continue
+		}
+		if field.Kind() == reflect.Struct && field.Type() != reflect.TypeOf(time.Duration(0)) {
+			if values[key] == nil {
+				// A section whose settings are all left out
+				continue
+			}
+			section, ok := values[key].(map[string]any)
+			if !ok {
+				*problems = append(*problems, path+": must be a section of settings")
+				continue
+			}
+			decodeStruct(field, section, path+".", problems)
+			continue
+		}
+		if err := setValue(field, values[key]); err != nil {
+			*problems = append(*problems, path+": "+err.Error())
+		}
+	}
+}
+
+// applyEnv overrides the settings whose environment variables are set, and
+// returns a problem for every value that does not fit its setting.
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) []string {
+	var problems []string
+	walk(reflect.ValueOf(cfg).Elem(), "", func(path string, field reflect.StructField, v reflect.Value) {
+		env := field.Tag.Get("env")
+		if env == "" {
+			return
+		}
+		if value, ok := lookup(env); ok {
+			if err := setValue(v, value); err != nil {
+				problems = append(problems, env+": "+err.Error())
+			}
+		}
+	})
+	return problems
+}
+
+// envNames maps the file key of every setting to its environment variable.
+func envNames(cfg *Config) map[string]string {
+	names := make(map[string]string)
+	walk(reflect.ValueOf(cfg).Elem(), "", func(path string, field reflect.StructField, v reflect.Value) {
+		if env := field.Tag.Get("env"); env != "" {
+			names[path] = env
+		}
+	})
+	return names
+}
+
+// walk calls fn for every setting below v, in declaration order, with its
+// dotted file key.
+func walk(v reflect.Value, prefix string, fn func(path string, field reflect.StructField, v reflect.Value)) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key := field.Tag.Get("config")
+		if key == "" {
+			continue
+		}
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Duration(0)) {
+			walk(v.Field(i), prefix+key+".", fn)
+			continue
+		}
+		fn(prefix+key, field, v.Field(i))
+	}
+}
+
+// setValue stores raw, a value from a file or an environment variable, in v.
+// Files and the environment share one text form for scalars, so that
+// "port: 8082" and PORT=8082 mean the same. Lists may also be given as
+// comma-separated text and maps as comma-separated key=value pairs.
+func setValue(v reflect.Value, raw any) error {
+	switch v.Interface().(type) {
+	case time.Duration:
+		s, err := scalar(raw)
+		if err != nil {
+			return err
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: use a value such as \"30s\" or \"5m\"", s)
+		}
+		v.SetInt(int64(d))
+		return nil
+	case []string:
+		list, err := stringList(raw)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(list))
+		return nil
+	case map[string]string:
+		m, err := stringMap(raw)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(m))
+		return nil
+	}
+
+	s, err := scalar(raw)
+	if err != nil {
+		return err
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q: use true or false", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// scalar returns the text form of a single parsed value. An empty value,
+// such as "key:" in YAML, is empty text.
+func scalar(raw any) (string, error) {
+	switch value := raw.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case int:
+		return strconv.Itoa(value), nil
+	case int64:
+		return strconv.FormatInt(value, 10), nil
+	case uint64:
+		return strconv.FormatUint(value, 10), nil
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64), nil
+	case []any, []map[string]any:
+		return "", fmt.Errorf("must be a single value, not a list")
+	case map[string]any:
+		return "", fmt.Errorf("must be a single value, not a section")
+	}
+	return "", fmt.Errorf("unsupported value %v", raw)
+}
+
+// stringList converts a parsed list, or comma-separated text, into strings.
+// Empty entries are dropped.
+func stringList(raw any) ([]string, error) {
+	var items []any
+	switch value := raw.(type) {
+	case nil:
+	case []any:
+		items = value
+	case string:
+		for _, item := range strings.Split(value, ",") {
+			items = append(items, item)
+		}
+	default:
+		return nil, fmt.Errorf("must be a list")
+	}
+
+	var list []string
+	for _, item := range items {
+		s, err := scalar(item)
+		if err != nil {
+			return nil, fmt.Errorf("list entries must be single values")
+		}
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list, nil
+}
+
+// stringMap converts a parsed section, or comma-separated key=value text,
+// into a map of strings. Entries without a key are dropped.
+func stringMap(raw any) (map[string]string, error) {
+	m := make(map[string]string)
+	switch value := raw.(type) {
+	case nil:
+	case map[string]any:
+		for key, item := range value {
+			s, err := scalar(item)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			m[key] = s
+		}
+	case string:
+		for _, entry := range strings.Split(value, ",") {
+			key, item, _ := strings.Cut(entry, "=")
+			if key = strings.TrimSpace(key); key != "" {
+				m[key] = strings.TrimSpace(item)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("must be a section of key: value pairs")
+	}
+	return m, nil
+}
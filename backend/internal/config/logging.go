@@ -0,0 +1,22 @@
+package config
+
+import "strings"
+
+// LoggingConfig controls what the server logs and how.
+type LoggingConfig struct {
+	// Level is the lowest level logged: "debug", "info", "warn" or "error"
+	Level string `config:"level" env:"LOG_LEVEL"`
+	// Format is "text" for key=value lines or "json" for one object per line
+	Format string `config:"format" env:"LOG_FORMAT"`
+}
+
+// defaultLoggingConfig logs text lines at info level.
+func defaultLoggingConfig() LoggingConfig {
+	return LoggingConfig{Level: "info", Format: "text"}
+}
+
+// validate checks the level and format names.
+func (c *LoggingConfig) validate(v *validator) {
+	v.oneOf("logging.level", strings.ToLower(c.Level), "debug", "info", "warn", "error")
+	v.oneOf("logging.format", strings.ToLower(c.Format), "text", "json")
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// masked replaces the value of a secret setting when it is printed.
+const masked = "********"
+
+// String returns the configuration in the YAML file format, with secrets
+// masked, so that it can be logged or shown by "chatapp config".
+func (c *Config) String() string {
+	var b strings.Builder
+	printStruct(&b, reflect.ValueOf(c).Elem(), 0)
+	return b.String()
+}
+
+func printStruct(b *strings.Builder, v reflect.Value, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key := field.Tag.Get("config")
+		if key == "" {
+			continue
+		}
+		value := v.Field(i)
+		secret := field.Tag.Get("secret") == "true"
+
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Duration(0)) {
+			b.WriteString(indent + key + ":\n")
+			printStruct(b, value, depth+1)
+			continue
+		}
+		if m, ok := value.Interface().(map[string]string); ok && len(m) > 0 {
+			b.WriteString(indent + key + ":\n")
+			names := make([]string, 0, len(m))
+			for name := range m {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				b.WriteString(indent + "  " + strconv.Quote(name) + ": " + printString(m[name], secret) + "\n")
+			}
+			continue
+		}
+		b.WriteString(indent + key + ": " + printValue(value, secret) + "\n")
+	}
+}
+
+// printValue formats a single setting in YAML, quoting every string.
+func printValue(v reflect.Value, secret bool) string {
+	switch value := v.Interface().(type) {
+	case time.Duration:
+		return value.String()
+	case []string:
+		items := make([]string, len(value))
+		for i, item := range value {
+			items[i] = printString(item, secret)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]string:
+		return "{}"
+	case string:
+		return printString(value, secret)
+	case bool:
+		return strconv.FormatBool(value)
+	case int, int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+	return strconv.Quote(v.String())
+}
+
+// printString quotes s, or masks it if it is a secret that has been set.
+func printString(s string, secret bool) string {
+	if secret && s != "" {
+		s = masked
+	}
+	return strconv.Quote(s)
+}
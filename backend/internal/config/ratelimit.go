@@ -0,0 +1,74 @@
+package config
+
+import (
+	"backend/internal/clientip"
+	"time"
+)
+
+// RateLimitConfig holds the message and request rate limits.
+// A rate of zero disables the corresponding limit.
+type RateLimitConfig struct {
+	// WebSocket messages per second each user may send, and the burst allowed
+	UserMessageRate  float64 `config:"user_messages_per_sec" env:"RATE_LIMIT_USER_MESSAGES_PER_SEC"`
+	UserMessageBurst int     `config:"user_messages_burst" env:"RATE_LIMIT_USER_MESSAGES_BURST"`
+
+	// WebSocket messages per second accepted into each room from all users
+	RoomMessageRate  float64 `config:"room_messages_per_sec" env:"RATE_LIMIT_ROOM_MESSAGES_PER_SEC"`
+	RoomMessageBurst int     `config:"room_messages_burst" env:"RATE_LIMIT_ROOM_MESSAGES_BURST"`
+
+	// A client exceeding a limit this many times within ViolationWindow is disconnected
+	MaxViolations   int           `config:"max_violations" env:"RATE_LIMIT_MAX_VIOLATIONS"`
+	ViolationWindow time.Duration `config:"violation_window" env:"RATE_LIMIT_VIOLATION_WINDOW"`
+
+	// REST requests per second per client IP, and the burst allowed
+	HTTPRequestRate  float64 `config:"http_requests_per_sec" env:"RATE_LIMIT_HTTP_REQUESTS_PER_SEC"`
+	HTTPRequestBurst int     `config:"http_requests_burst" env:"RATE_LIMIT_HTTP_REQUESTS_BURST"`
+
+	// TrustedProxies are the addresses or CIDR networks of reverse proxies
+	// whose X-Forwarded-For header names the client. See clientip.Resolver.
+	TrustedProxies []string `config:"trusted_proxies" env:"RATE_LIMIT_TRUSTED_PROXIES"`
+}
+
+// defaultRateLimitConfig allows short bursts well above normal chat use.
+func defaultRateLimitConfig() RateLimitConfig {
+	return RateLimitConfig{
+		UserMessageRate:  5,
+		UserMessageBurst: 10,
+		RoomMessageRate:  50,
+		RoomMessageBurst: 100,
+		MaxViolations:    10,
+		ViolationWindow:  time.Minute,
+		HTTPRequestRate:  10,
+		HTTPRequestBurst: 30,
+	}
+}
+
+// validate checks that every enabled limit lets at least one event through.
+func (c *RateLimitConfig) validate(v *validator) {
+	limits := []struct {
+		name  string
+		rate  float64
+		burst int
+	}{
+		{"user_messages", c.UserMessageRate, c.UserMessageBurst},
+		{"room_messages", c.RoomMessageRate, c.RoomMessageBurst},
+		{"http_requests", c.HTTPRequestRate, c.HTTPRequestBurst},
+	}
+	for _, limit := range limits {
+		if limit.rate < 0 {
+			v.fail("rate_limit."+limit.name+"_per_sec", "must not be negative; use 0 to disable the limit")
+		}
+		if limit.rate > 0 && limit.burst < 1 {
+			v.fail("rate_limit."+limit.name+"_burst", "must be at least 1 while the limit is enabled")
+		}
+	}
+	if c.MaxViolations < 0 {
+		v.fail("rate_limit.max_violations", "must not be negative; use 0 to never disconnect")
+	}
+	v.positive("rate_limit.violation_window", c.ViolationWindow)
+	for _, proxy := range c.TrustedProxies {
+		if err := clientip.Validate(proxy); err != nil {
+			v.fail("rate_limit.trusted_proxies", "%v", err)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package config
+
+import "time"
+
+// ServerConfig controls the public HTTP listener.
+type ServerConfig struct {
+	// Port is the TCP port the API and WebSocket endpoint are served on
+	Port string `config:"port" env:"PORT"`
+
+	// On SIGINT or SIGTERM, the readiness probe fails for DrainDelay before
+	// the listener closes, and requests in flight then have ShutdownTimeout
+	// to finish
+	DrainDelay      time.Duration `config:"drain_delay" env:"SHUTDOWN_DRAIN_DELAY"`
+	ShutdownTimeout time.Duration `config:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+}
+
+// defaultServerConfig listens on the port the frontend expects, and drains
+// for longer than a load balancer polling readiness every few seconds needs.
+func defaultServerConfig() ServerConfig {
+	return ServerConfig{Port: "8082", DrainDelay: 5 * time.Second, ShutdownTimeout: 20 * time.Second}
+}
+
+// Addr returns the listen address for Port on every interface.
+func (c *ServerConfig) Addr() string {
+	return ":" + c.Port
+}
+
+// validate checks the port and the shutdown timings.
+func (c *ServerConfig) validate(v *validator) {
+	v.port("server.port", c.Port)
+	if c.DrainDelay < 0 {
+		v.fail("server.drain_delay", "must not be negative; use 0 to close the listener at once")
+	}
+	v.positive("server.shutdown_timeout", c.ShutdownTimeout)
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"path/filepath"
+	"time"
+)
+
+// TLSConfig controls HTTPS serving. TLS is off unless a certificate is
+// configured or self-signed mode is on.
+type TLSConfig struct {
+	// CertFile and KeyFile are PEM files. The certificate file may hold the
+	// whole chain, leaf first.
+	CertFile string `config:"cert_file" env:"TLS_CERT_FILE"`
+	KeyFile  string `config:"key_file" env:"TLS_KEY_FILE"`
+
+	// SelfSigned generates a certificate for SelfSignedHosts on first start,
+	// for development. It is written to CertFile and KeyFile, or to the
+	// certs directory when they are not set, and renewed when it expires.
+	SelfSigned      bool     `config:"self_signed" env:"TLS_SELF_SIGNED"`
+	SelfSignedHosts []string `config:"self_signed_hosts" env:"TLS_SELF_SIGNED_HOSTS"`
+
+	// ReloadInterval is how often the files are checked for changes; zero
+	// leaves reloading to SIGHUP.
+	ReloadInterval time.Duration `config:"reload_interval" env:"TLS_RELOAD_INTERVAL"`
+
+	// RedirectPort, if set, serves plain HTTP on that port and redirects
+	// every request to HTTPS.
+	RedirectPort string `config:"redirect_port" env:"TLS_REDIRECT_PORT"`
+
+	// MinVersion is the oldest protocol version accepted, "1.2" or "1.3".
+	MinVersion string `config:"min_version" env:"TLS_MIN_VERSION"`
+}
+
+// selfSignedDir holds generated certificates when no paths are configured.
+const selfSignedDir = "certs"
+
+// defaultTLSConfig serves plain HTTP.
+func defaultTLSConfig() TLSConfig {
+	return TLSConfig{
+		SelfSignedHosts: []string{"localhost", "127.0.0.1", "::1"},
+		ReloadInterval:  10 * time.Second,
+		MinVersion:      "1.2",
+	}
+}
+
+// Enabled reports whether the server should serve HTTPS.
+func (c *TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != "" || c.SelfSigned
+}
+
+// Files returns the certificate and key paths, filling in the generated
+// certificate's location in self-signed mode.
+func (c *TLSConfig) Files() (certFile, keyFile string) {
+	certFile, keyFile = c.CertFile, c.KeyFile
+	if c.SelfSigned && certFile == "" {
+		certFile = filepath.Join(selfSignedDir, "selfsigned-cert.pem")
+	}
+	if c.SelfSigned && keyFile == "" {
+		keyFile = filepath.Join(selfSignedDir, "selfsigned-key.pem")
+	}
+	return certFile, keyFile
+}
+
+// validate checks that the certificate and key are configured together and
+// that the redirect listener does not take the HTTPS port.
+func (c *TLSConfig) validate(v *validator, serverPort string) {
+	if !c.SelfSigned && (c.CertFile == "") != (c.KeyFile == "") {
+		if c.CertFile == "" {
+			v.fail("tls.cert_file", "must be set with tls.key_file")
+		} else {
+			v.fail("tls.key_file", "must be set with tls.cert_file")
+		}
+	}
+	if c.SelfSigned && len(c.SelfSignedHosts) == 0 {
+		v.fail("tls.self_signed_hosts", "must name at least one host for the self-signed certificate")
+	}
+	if c.ReloadInterval < 0 {
+		v.fail("tls.reload_interval", "must not be negative, got %s", c.ReloadInterval)
+	}
+	v.oneOf("tls.min_version", c.MinVersion, "1.2", "1.3")
+
+	if c.RedirectPort != "" {
+		v.port("tls.redirect_port", c.RedirectPort)
+		switch {
+		case !c.Enabled():
+			v.fail("tls.redirect_port", "needs TLS: set tls.cert_file and tls.key_file, or tls.self_signed")
+		case c.RedirectPort == serverPort:
+			v.fail("tls.redirect_port", "must differ from server.port (%s), which serves HTTPS", serverPort)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package config
+
+import "github.com/BurntSushi/toml"
+
+// parseTOML parses a TOML configuration file with github.com/BurntSushi/toml,
+// which rejects keys and tables that are defined twice.
+func parseTOML(data []byte) (map[string]any, error) {
+	values := map[string]any{}
+	if err := toml.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
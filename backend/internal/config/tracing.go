@@ -0,0 +1,37 @@
+package config
+
+// TracingConfig controls where spans are sent. The variables are the
+// standard OpenTelemetry ones, so the usual collector settings carry over.
+type TracingConfig struct {
+	// Exporter is "none" (tracing off), "otlp" or "stdout"
+	Exporter string `config:"exporter" env:"OTEL_TRACES_EXPORTER"`
+	// OTLPEndpoint is the collector's base URL; spans are posted to /v1/traces
+	OTLPEndpoint string `config:"otlp_endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	// OTLPHeaders are added to every export request, e.g. an API key
+	OTLPHeaders map[string]string `config:"otlp_headers" env:"OTEL_EXPORTER_OTLP_HEADERS" secret:"true"`
+	// ServiceName identifies this server in traces
+	ServiceName string `config:"service_name" env:"OTEL_SERVICE_NAME"`
+	// SampleRatio is the fraction of new traces that are recorded, from 0 to 1
+	SampleRatio float64 `config:"sample_ratio" env:"OTEL_TRACES_SAMPLER_ARG"`
+}
+
+// defaultTracingConfig has tracing off.
+func defaultTracingConfig() TracingConfig {
+	return TracingConfig{
+		Exporter:     "none",
+		OTLPEndpoint: "http://localhost:4318",
+		ServiceName:  "chatapp-backend",
+		SampleRatio:  1,
+	}
+}
+
+// validate checks the exporter and sampling settings.
+func (c *TracingConfig) validate(v *validator) {
+	v.oneOf("tracing.exporter", c.Exporter, "none", "otlp", "stdout", "console")
+	if c.Exporter == "otlp" {
+		v.url("tracing.otlp_endpoint", c.OTLPEndpoint)
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		v.fail("tracing.sample_ratio", "must be between 0 and 1, got %g", c.SampleRatio)
+	}
+}
@@ -0,0 +1,69 @@
+package config
+
+import "time"
+
+// WebSocketConfig holds the limits and timeouts of WebSocket connections.
+type WebSocketConfig struct {
+	// MaxMessageSize is the largest frame, in bytes, accepted from a client
+	MaxMessageSize int64 `config:"max_message_size" env:"WS_MAX_MESSAGE_SIZE"`
+	// ReadBufferSize and WriteBufferSize size the connection's I/O buffers
+	ReadBufferSize  int `config:"read_buffer_size" env:"WS_READ_BUFFER_SIZE"`
+	WriteBufferSize int `config:"write_buffer_size" env:"WS_WRITE_BUFFER_SIZE"`
+	// SendQueueSize is how many outgoing messages may wait for a slow
+	// client before it is dropped
+	SendQueueSize int `config:"send_queue_size" env:"WS_SEND_QUEUE_SIZE"`
+	// MaxRooms is how many rooms one connection may subscribe to
+	MaxRooms int `config:"max_rooms" env:"WS_MAX_ROOMS"`
+
+	// PingPeriod is how often the server pings; a client that does not
+	// answer within PongWait is disconnected
+	PingPeriod time.Duration `config:"ping_period" env:"WS_PING_PERIOD"`
+	PongWait   time.Duration `config:"pong_wait" env:"WS_PONG_WAIT"`
+	// WriteWait bounds each write to the client
+	WriteWait time.Duration `config:"write_wait" env:"WS_WRITE_WAIT"`
+	// CloseGracePeriod is how long a client has to answer a close frame
+	// before the connection is dropped
+	CloseGracePeriod time.Duration `config:"close_grace_period" env:"WS_CLOSE_GRACE_PERIOD"`
+}
+
+// defaultWebSocketConfig suits browsers behind typical proxies, which close
+// connections that are idle for a minute or more.
+func defaultWebSocketConfig() WebSocketConfig {
+	return WebSocketConfig{
+		MaxMessageSize:   4096,
+		ReadBufferSize:   1024,
+		WriteBufferSize:  1024,
+		SendQueueSize:    256,
+		MaxRooms:         50,
+		PingPeriod:       30 * time.Second,
+		PongWait:         60 * time.Second,
+		WriteWait:        10 * time.Second,
+		CloseGracePeriod: 5 * time.Second,
+	}
+}
+
+// validate checks the sizes and that pings are sent before the pong wait runs out.
+func (c *WebSocketConfig) validate(v *validator) {
+	if c.MaxMessageSize < 1 {
+		v.fail("websocket.max_message_size", "must be at least 1 byte")
+	}
+	if c.ReadBufferSize < 1 {
+		v.fail("websocket.read_buffer_size", "must be at least 1 byte")
+	}
+	if c.WriteBufferSize < 1 {
+		v.fail("websocket.write_buffer_size", "must be at least 1 byte")
+	}
+	if c.SendQueueSize < 1 {
+		v.fail("websocket.send_queue_size", "must be at least 1")
+	}
+	if c.MaxRooms < 1 {
+		v.fail("websocket.max_rooms", "must be at least 1")
+	}
+	v.positive("websocket.ping_period", c.PingPeriod)
+	v.positive("websocket.pong_wait", c.PongWait)
+	v.positive("websocket.write_wait", c.WriteWait)
+	v.positive("websocket.close_grace_period", c.CloseGracePeriod)
+	if c.PingPeriod > 0 && c.PingPeriod >= c.PongWait {
+		v.fail("websocket.ping_period", "must be shorter than websocket.pong_wait (%s), or clients are dropped between pings", c.PongWait)
+	}
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseYAML parses a YAML configuration file with gopkg.in/yaml.v3. The
+// file must hold one document whose top level is a mapping of settings;
+// keys set twice are rejected by the parser.
+func parseYAML(data []byte) (map[string]any, error) {
+	values := map[string]any{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&values); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	var next any
+	if err := decoder.Decode(&next); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("only one document is supported")
+	}
+	if values == nil {
+		values = map[string]any{}
+	}
+	return values, nil
+}
@@ -0,0 +1,60 @@
+package contentfilter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HTTPClassifier asks an external service to classify each message. It sends
+// a POST request with the body {"content": "..."} and expects a response of
+// the form {"verdict": "hold", "content": "...", "reason": "..."}, where
+// content is only needed for the redact verdict.
+type HTTPClassifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPClassifier creates a classifier that calls url, giving up after timeout.
+func NewHTTPClassifier(url string, timeout time.Duration) *HTTPClassifier {
+	return &HTTPClassifier{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+// classifierResponse is the JSON body returned by the classification service.
+type classifierResponse struct {
+	Verdict string `json:"verdict"`
+	Content string `json:"content"`
+	Reason  string `json:"reason"`
+}
+
+// Check implements Filter.
+func (c *HTTPClassifier) Check(content string) (Result, error) {
+	body, err := json.Marshal(map[string]string{"content": content})
+	if err != nil {
+		return Result{}, err
+	}
+
+	resp, err := c.client.Post(c.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return Result{}, fmt.Errorf("calling classifier: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, fmt.Errorf("classifier returned status %d", resp.StatusCode)
+	}
+
+	var decoded classifierResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return Result{}, fmt.Errorf("decoding classifier response: %w", err)
+	}
+	verdict, err := ParseVerdict(decoded.Verdict)
+	if err != nil {
+		return Result{}, err
+	}
+	if verdict == Redact && decoded.Content == "" {
+		return Result{}, fmt.Errorf("classifier redacted the message without returning content")
+	}
+	return Result{Verdict: verdict, Content: decoded.Content, Reason: decoded.Reason}, nil
+}
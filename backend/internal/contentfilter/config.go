@@ -0,0 +1,78 @@
+package contentfilter
+
+import (
+	"backend/internal/config"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// rule is one entry of the regular expression rules file.
+type rule struct {
+	Pattern string `json:"pattern"`
+	Action  string `json:"action"`
+	Reason  string `json:"reason"`
+}
+
+// FromConfig builds the chain described by the configuration. Filters run in
+// the order word list, domain blocklist, regular expression rules, classifier;
+// those that are not configured are left out.
+func FromConfig(cfg *config.ContentFilterConfig) (*Chain, error) {
+	var filters []Filter
+
+	if len(cfg.Words) > 0 {
+		verdict, err := ParseVerdict(cfg.WordsAction)
+		if err != nil {
+			return nil, fmt.Errorf("word list: %w", err)
+		}
+		filters = append(filters, NewWordList(cfg.Words, verdict))
+	}
+
+	if len(cfg.BlockedDomains) > 0 {
+		verdict, err := ParseVerdict(cfg.DomainsAction)
+		if err != nil {
+			return nil, fmt.Errorf("domain blocklist: %w", err)
+		}
+		filters = append(filters, NewDomainBlocklist(cfg.BlockedDomains, verdict))
+	}
+
+	if cfg.RulesFile != "" {
+		rules, err := loadRules(cfg.RulesFile)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, rules...)
+	}
+
+	if cfg.ClassifierURL != "" {
+		filters = append(filters, NewHTTPClassifier(cfg.ClassifierURL, cfg.ClassifierTimeout))
+	}
+
+	return NewChain(filters...), nil
+}
+
+// loadRules reads a JSON array of regular expression rules.
+func loadRules(path string) ([]Filter, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading rules file: %w", err)
+	}
+	var rules []rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parsing rules file %s: %w", path, err)
+	}
+
+	filters := make([]Filter, 0, len(rules))
+	for i, r := range rules {
+		verdict, err := ParseVerdict(r.Action)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d in %s: %w", i+1, path, err)
+		}
+		f, err := NewRegexRule(r.Pattern, verdict, r.Reason)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d in %s: %w", i+1, path, err)
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
@@ -0,0 +1,124 @@
+// Package contentfilter screens chat messages before they are stored. A Chain
+// runs an ordered list of filters, each of which can allow, redact, hold for
+// review or reject the message.
+package contentfilter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Verdict is a filter's decision about a message. Verdicts are ordered: when
+// filters disagree, the highest one wins.
+type Verdict int
+
+const (
+	// Allow lets the message through unchanged.
+	Allow Verdict = iota
+	// Redact lets the message through with the offending parts masked.
+	Redact
+	// Hold keeps the message back until a moderator approves or discards it.
+	Hold
+	// Reject refuses the message outright.
+	Reject
+)
+
+var verdictNames = map[Verdict]string{
+	Allow:  "allow",
+	Redact: "redact",
+	Hold:   "hold",
+	Reject: "reject",
+}
+
+func (v Verdict) String() string {
+	if name, ok := verdictNames[v]; ok {
+		return name
+	}
+	return fmt.Sprintf("Verdict(%d)", int(v))
+}
+
+// ParseVerdict converts "allow", "redact", "hold" or "reject" into a Verdict.
+func ParseVerdict(s string) (Verdict, error) {
+	for v, name := range verdictNames {
+		if strings.EqualFold(strings.TrimSpace(s), name) {
+			return v, nil
+		}
+	}
+	return Allow, fmt.Errorf("unknown content filter action %q", s)
+}
+
+// Result is the outcome of screening a message.
+type Result struct {
+	Verdict Verdict
+	// Content is the message to deliver, with any redactions applied.
+	Content string
+	// Reason explains a verdict other than Allow, for the sender and moderators.
+	Reason string
+}
+
+// Filter screens one message. It is also the hook for custom classifiers:
+// anything that implements Check can be added to a Chain.
+//
+// A filter that redacts returns the redacted text in Result.Content; for
+// other verdicts Content is ignored.
+type Filter interface {
+	Check(content string) (Result, error)
+}
+
+// FilterFunc adapts an ordinary function to the Filter interface.
+type FilterFunc func(content string) (Result, error)
+
+// Check calls f(content).
+func (f FilterFunc) Check(content string) (Result, error) {
+	return f(content)
+}
+
+// Chain runs filters in order. Redactions are applied as they happen, so later
+// filters see the redacted text. A rejection stops the chain at once; a hold
+// does not, so that a later filter can still reject the message.
+type Chain struct {
+	filters []Filter
+}
+
+// NewChain creates a Chain that runs filters in the given order.
+func NewChain(filters ...Filter) *Chain {
+	return &Chain{filters: filters}
+}
+
+// Len returns the number of filters in the chain.
+func (c *Chain) Len() int {
+	if c == nil {
+		return 0
+	}
+	return len(c.filters)
+}
+
+// Check screens content with every filter. A nil Chain allows everything.
+// If a filter fails, Check stops and returns its error.
+func (c *Chain) Check(content string) (Result, error) {
+	result := Result{Verdict: Allow, Content: content}
+	if c == nil {
+		return result, nil
+	}
+
+	for _, f := range c.filters {
+		r, err := f.Check(result.Content)
+		if err != nil {
+			return Result{}, err
+		}
+
+		switch r.Verdict {
+		case Allow:
+			continue
+		case Redact:
+			result.Content = r.Content
+		case Reject:
+			return Result{Verdict: Reject, Content: result.Content, Reason: r.Reason}, nil
+		}
+		if r.Verdict > result.Verdict {
+			result.Verdict = r.Verdict
+			result.Reason = r.Reason
+		}
+	}
+	return result, nil
+}
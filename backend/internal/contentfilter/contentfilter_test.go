@@ -0,0 +1,146 @@
+package contentfilter
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWordList(t *testing.T) {
+	f := NewWordList([]string{"darn", " heck "}, Redact)
+
+	tests := []struct {
+		in      string
+		verdict Verdict
+		out     string
+	}{
+		{"hello there", Allow, ""},
+		{"well DARN it", Redact, "well **** it"},
+		{"heck, darn!", Redact, "****, ****!"},
+		{"darning socks", Allow, ""}, // whole words only
+	}
+	for _, tc := range tests {
+		r, err := f.Check(tc.in)
+		if err != nil {
+			t.Fatalf("Check(%q): %v", tc.in, err)
+		}
+		if r.Verdict != tc.verdict || (tc.verdict == Redact && r.Content != tc.out) {
+			t.Errorf("Check(%q) = %v %q, want %v %q", tc.in, r.Verdict, r.Content, tc.verdict, tc.out)
+		}
+	}
+
+	if r, _ := NewWordList(nil, Reject).Check("anything"); r.Verdict != Allow {
+		t.Errorf("empty word list gave %v, want allow", r.Verdict)
+	}
+}
+
+func TestDomainBlocklist(t *testing.T) {
+	f := NewDomainBlocklist([]string{"Spam.example", "bad.test"}, Redact)
+
+	tests := []struct {
+		in      string
+		verdict Verdict
+		out     string
+	}{
+		{"see https://good.example/page", Allow, ""},
+		{"buy at https://www.spam.example/deal?id=1 now", Redact, "buy at [link removed] now"},
+		{"bad.test and notbad.test", Redact, "[link removed] and notbad.test"},
+		{"visit spam.example.org", Allow, ""}, // a different domain
+	}
+	for _, tc := range tests {
+		r, err := f.Check(tc.in)
+		if err != nil {
+			t.Fatalf("Check(%q): %v", tc.in, err)
+		}
+		if r.Verdict != tc.verdict || (tc.verdict == Redact && r.Content != tc.out) {
+			t.Errorf("Check(%q) = %v %q, want %v %q", tc.in, r.Verdict, r.Content, tc.verdict, tc.out)
+		}
+	}
+}
+
+func TestRegexRule(t *testing.T) {
+	if _, err := NewRegexRule("(", Reject, ""); err == nil {
+		t.Fatal("NewRegexRule accepted an invalid pattern")
+	}
+
+	f, err := NewRegexRule(`\b\d{4}-\d{4}-\d{4}-\d{4}\b`, Redact, "card number")
+	if err != nil {
+		t.Fatalf("NewRegexRule: %v", err)
+	}
+	r, _ := f.Check("my card is 1234-5678-9012-3456")
+	if r.Verdict != Redact || r.Content != "my card is *******************" || r.Reason != "card number" {
+		t.Fatalf("Check = %+v", r)
+	}
+}
+
+func TestChainOrdering(t *testing.T) {
+	redact := NewWordList([]string{"darn"}, Redact)
+	hold := FilterFunc(func(content string) (Result, error) {
+		if content == "**** spam" {
+			return Result{Verdict: Hold, Reason: "looks like spam"}, nil
+		}
+		return Result{Verdict: Allow}, nil
+	})
+	reject := NewWordList([]string{"scam"}, Reject)
+	chain := NewChain(redact, hold, reject)
+
+	// Later filters see the redacted text, and a hold is kept unless something rejects
+	r, err := chain.Check("darn spam")
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if r.Verdict != Hold || r.Content != "**** spam" || r.Reason != "looks like spam" {
+		t.Fatalf("Check = %+v, want held redacted message", r)
+	}
+
+	r, _ = chain.Check("darn scam")
+	if r.Verdict != Reject {
+		t.Fatalf("Check = %+v, want reject", r)
+	}
+
+	r, _ = chain.Check("hello")
+	if r.Verdict != Allow || r.Content != "hello" {
+		t.Fatalf("Check = %+v, want allowed message", r)
+	}
+
+	failing := NewChain(FilterFunc(func(string) (Result, error) { return Result{}, errors.New("down") }))
+	if _, err := failing.Check("hello"); err == nil {
+		t.Fatal("Check ignored a failing filter")
+	}
+
+	var none *Chain
+	if r, _ := none.Check("hello"); r.Verdict != Allow {
+		t.Fatalf("nil chain gave %v, want allow", r.Verdict)
+	}
+}
+
+func TestHTTPClassifier(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Content string `json:"content"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Content == "suspicious" {
+			json.NewEncoder(w).Encode(map[string]string{"verdict": "hold", "reason": "classifier"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"verdict": "allow"})
+	}))
+	defer server.Close()
+
+	c := NewHTTPClassifier(server.URL, time.Second)
+	if r, err := c.Check("suspicious"); err != nil || r.Verdict != Hold || r.Reason != "classifier" {
+		t.Fatalf("Check = %+v, %v; want hold", r, err)
+	}
+	if r, err := c.Check("fine"); err != nil || r.Verdict != Allow {
+		t.Fatalf("Check = %+v, %v; want allow", r, err)
+	}
+
+	server.Close()
+	if _, err := c.Check("fine"); err == nil {
+		t.Fatal("Check succeeded with the classifier down")
+	}
+}
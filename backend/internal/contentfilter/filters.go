@@ -0,0 +1,129 @@
+package contentfilter
+
+import (
+	"regexp"
+	"strings"
+)
+
+// mask replaces every character of s with an asterisk.
+func mask(s string) string {
+	return strings.Repeat("*", len([]rune(s)))
+}
+
+// WordList matches whole words from a list, ignoring case.
+type WordList struct {
+	pattern *regexp.Regexp // nil when the list is empty
+	verdict Verdict
+}
+
+// NewWordList creates a filter that gives verdict to messages containing any of
+// words. With Redact, each matching word is replaced by asterisks.
+func NewWordList(words []string, verdict Verdict) *WordList {
+	var quoted []string
+	for _, word := range words {
+		if word = strings.TrimSpace(word); word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+
+	f := &WordList{verdict: verdict}
+	if len(quoted) > 0 {
+		f.pattern = regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	}
+	return f
+}
+
+// Check implements Filter.
+func (f *WordList) Check(content string) (Result, error) {
+	if f.pattern == nil || !f.pattern.MatchString(content) {
+		return Result{Verdict: Allow}, nil
+	}
+	result := Result{Verdict: f.verdict, Reason: "message contains a blocked word"}
+	if f.verdict == Redact {
+		result.Content = f.pattern.ReplaceAllStringFunc(content, mask)
+	}
+	return result, nil
+}
+
+// linkPattern matches URLs and bare host names such as "example.com/page".
+// The first submatch is the host.
+var linkPattern = regexp.MustCompile(`(?i)\b(?:[a-z][a-z0-9+.-]*://)?((?:[a-z0-9-]+\.)+[a-z]{2,})(?::\d+)?(?:[/?#]\S*)?`)
+
+// DomainBlocklist matches links to blocked domains and their subdomains.
+type DomainBlocklist struct {
+	domains []string
+	verdict Verdict
+}
+
+// NewDomainBlocklist creates a filter that gives verdict to messages linking to
+// any of domains. With Redact, each blocked link is replaced by "[link removed]".
+func NewDomainBlocklist(domains []string, verdict Verdict) *DomainBlocklist {
+	f := &DomainBlocklist{verdict: verdict}
+	for _, domain := range domains {
+		domain = strings.Trim(strings.ToLower(strings.TrimSpace(domain)), ".")
+		if domain != "" {
+			f.domains = append(f.domains, domain)
+		}
+	}
+	return f
+}
+
+// blocked reports whether host is a blocked domain or one of its subdomains.
+func (f *DomainBlocklist) blocked(host string) bool {
+	host = strings.ToLower(host)
+	for _, domain := range f.domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check implements Filter.
+func (f *DomainBlocklist) Check(content string) (Result, error) {
+	found := false
+	redacted := linkPattern.ReplaceAllStringFunc(content, func(link string) string {
+		if !f.blocked(linkPattern.FindStringSubmatch(link)[1]) {
+			return link
+		}
+		found = true
+		return "[link removed]"
+	})
+	if !found {
+		return Result{Verdict: Allow}, nil
+	}
+	return Result{Verdict: f.verdict, Content: redacted, Reason: "message links to a blocked domain"}, nil
+}
+
+// RegexRule matches a regular expression.
+type RegexRule struct {
+	pattern *regexp.Regexp
+	verdict Verdict
+	reason  string
+}
+
+// NewRegexRule creates a filter that gives verdict to messages matching pattern.
+// With Redact, each match is replaced by asterisks. If reason is empty a
+// generic one is used.
+func NewRegexRule(pattern string, verdict Verdict, reason string) (*RegexRule, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if reason == "" {
+		reason = "message matches a blocked pattern"
+	}
+	return &RegexRule{pattern: re, verdict: verdict, reason: reason}, nil
+}
+
+// Check implements Filter.
+func (f *RegexRule) Check(content string) (Result, error) {
+	if !f.pattern.MatchString(content) {
+		return Result{Verdict: Allow}, nil
+	}
+	result := Result{Verdict: f.verdict, Reason: f.reason}
+	if f.verdict == Redact {
+		result.Content = f.pattern.ReplaceAllStringFunc(content, mask)
+	}
+	return result, nil
+}
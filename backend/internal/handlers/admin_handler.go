@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/middleware"
+	"backend/internal/models"
+	"backend/internal/services"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// AdminHandler handles HTTP requests for site administration. Every route is
+// wrapped in middleware.RequireAdmin.
+type AdminHandler struct {
+	adminService *services.AdminService
+}
+
+// NewAdminHandler creates a new AdminHandler.
+func NewAdminHandler(adminService *services.AdminService) *AdminHandler {
+	return &AdminHandler{adminService: adminService}
+}
+
+// ListUsersResponse defines the JSON response for listing users.
+type ListUsersResponse struct {
+	Users []*models.User `json:"users"`
+}
+
+// ListSessionsResponse defines the JSON response for listing live sessions.
+type ListSessionsResponse struct {
+	Sessions []models.Session `json:"sessions"`
+}
+
+// ListUsers handles listing every user account.
+func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.adminService.WithContext(r.Context()).ListUsers()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list users", "error", err)
+		apierror.WriteStore(w, err, "Failed to retrieve users")
+		return
+	}
+	if users == nil {
+		users = []*models.User{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ListUsersResponse{Users: users})
+}
+
+// DisableUser handles disabling a user account.
+func (h *AdminHandler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	h.setUserDisabled(w, r, true)
+}
+
+// EnableUser handles re-enabling a disabled user account.
+func (h *AdminHandler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	h.setUserDisabled(w, r, false)
+}
+
+// setUserDisabled changes whether the user named in the path is disabled.
+func (h *AdminHandler) setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	admin, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	user, err := h.adminService.WithContext(r.Context()).SetUserDisabled(admin.ID, r.PathValue("id"), disabled)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to set user disabled", "user_id", r.PathValue("id"), "disabled", disabled, "error", err)
+		writeAdminError(w, err, "Failed to update user")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// DeleteUser handles deleting a user account with their messages and rooms.
+func (h *AdminHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	admin, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.adminService.WithContext(r.Context()).DeleteUser(admin.ID, r.PathValue("id")); err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete user", "user_id", r.PathValue("id"), "error", err)
+		writeAdminError(w, err, "Failed to delete user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListRooms handles listing every room, including private and archived ones.
+func (h *AdminHandler) ListRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := h.adminService.WithContext(r.Context()).ListRooms()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list rooms", "error", err)
+		apierror.WriteStore(w, err, "Failed to retrieve rooms")
+		return
+	}
+
+	// Reuse the shape of the regular room list
+	response := GetRoomsResponse{Rooms: make([]models.ChatRoom, len(rooms))}
+	for i, room := range rooms {
+		response.Rooms[i] = *room
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ArchiveRoom handles archiving a room.
+func (h *AdminHandler) ArchiveRoom(w http.ResponseWriter, r *http.Request) {
+	h.setRoomArchived(w, r, true)
+}
+
+// UnarchiveRoom handles restoring an archived room.
+func (h *AdminHandler) UnarchiveRoom(w http.ResponseWriter, r *http.Request) {
+	h.setRoomArchived(w, r, false)
+}
+
+// setRoomArchived changes whether the room named in the path is archived.
+func (h *AdminHandler) setRoomArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	room, err := h.adminService.WithContext(r.Context()).SetRoomArchived(r.PathValue("id"), archived)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to set room archived", "room", r.PathValue("id"), "archived", archived, "error", err)
+		writeAdminError(w, err, "Failed to update room")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(room)
+}
+
+// DeleteRoom handles deleting a room with all of its messages.
+func (h *AdminHandler) DeleteRoom(w http.ResponseWriter, r *http.Request) {
+	if err := h.adminService.WithContext(r.Context()).DeleteRoom(r.PathValue("id")); err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete room", "room", r.PathValue("id"), "error", err)
+		writeAdminError(w, err, "Failed to delete room")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListSessions handles listing the open WebSocket connections.
+func (h *AdminHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ListSessionsResponse{Sessions: h.adminService.Sessions()})
+}
+
+// DisconnectSession handles force-closing a WebSocket connection.
+func (h *AdminHandler) DisconnectSession(w http.ResponseWriter, r *http.Request) {
+	if err := h.adminService.WithContext(r.Context()).DisconnectSession(r.PathValue("id")); err != nil {
+		slog.ErrorContext(r.Context(), "failed to disconnect session", "session", r.PathValue("id"), "error", err)
+		writeAdminError(w, err, "Failed to disconnect session")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeAdminError maps admin service errors to HTTP responses.
+func writeAdminError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrCannotModifySelf):
+		apierror.Write(w, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrSessionNotFound):
+		apierror.Write(w, http.StatusNotFound, err.Error())
+	default:
+		apierror.WriteStore(w, err, message)
+	}
+}
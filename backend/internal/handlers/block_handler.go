@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/middleware"
+	"backend/internal/models"
+	"backend/internal/services"
+	"backend/internal/store"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// BlockHandler handles HTTP requests for a user's block list.
+type BlockHandler struct {
+	blockService *services.BlockService
+}
+
+// NewBlockHandler creates a new BlockHandler.
+func NewBlockHandler(blockService *services.BlockService) *BlockHandler {
+	return &BlockHandler{blockService: blockService}
+}
+
+// ListBlocksResponse defines the JSON response for a user's block list.
+type ListBlocksResponse struct {
+	Blocks []*models.UserBlock `json:"blocks"`
+}
+
+// ListBlocks handles listing the users the caller has blocked.
+func (h *BlockHandler) ListBlocks(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	blocks, err := h.blockService.WithContext(r.Context()).ListBlocks(user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list blocks", "user_id", user.ID, "error", err)
+		apierror.WriteStore(w, err, "Failed to retrieve blocked users")
+		return
+	}
+	if blocks == nil {
+		blocks = []*models.UserBlock{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ListBlocksResponse{Blocks: blocks})
+}
+
+// Block handles blocking the user named in the path.
+func (h *BlockHandler) Block(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	block, err := h.blockService.WithContext(r.Context()).Block(user.ID, r.PathValue("username"))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to block user", "user_id", user.ID, "blocked", r.PathValue("username"), "error", err)
+		switch {
+		case errors.Is(err, services.ErrCannotBlockSelf):
+			apierror.WriteField(w, http.StatusBadRequest, "username", err.Error())
+		case errors.Is(err, store.ErrConflict):
+			apierror.WriteField(w, http.StatusConflict, "username", "You have already blocked this user")
+		default:
+			apierror.WriteStore(w, err, "Failed to block user")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(block)
+}
+
+// Unblock handles lifting the caller's block of the user named in the path.
+func (h *BlockHandler) Unblock(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.blockService.WithContext(r.Context()).Unblock(user.ID, r.PathValue("username")); err != nil {
+		slog.ErrorContext(r.Context(), "failed to unblock user", "user_id", user.ID, "blocked", r.PathValue("username"), "error", err)
+		apierror.WriteStore(w, err, "Failed to unblock user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
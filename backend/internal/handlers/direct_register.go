@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"backend/internal/apierror"
 	"backend/internal/models"
 	"backend/internal/store"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 
 	"github.com/google/uuid"
@@ -23,21 +25,10 @@ func NewDirectRegisterHandler(store store.StoreInterface) *DirectRegisterHandler
 
 // Register handles direct user registration
 func (h *DirectRegisterHandler) Register(w http.ResponseWriter, r *http.Request) {
-	log.Println("DirectRegister: Received request")
-	
-	// Set CORS headers for this endpoint
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-	
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
+	slog.DebugContext(r.Context(), "direct register request received")
 	
 	if r.Method != http.MethodPost {
-		w.Header().Set("Allow", http.MethodPost)
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		apierror.MethodNotAllowed(w, http.MethodPost)
 		return
 	}
 
@@ -47,18 +38,18 @@ func (h *DirectRegisterHandler) Register(w http.ResponseWriter, r *http.Request)
 	}
 	
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("DirectRegister: Failed to decode request body: %v", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		slog.DebugContext(r.Context(), "direct register: invalid request body", "error", err)
+		apierror.Write(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 	
-	log.Printf("DirectRegister: Attempting to register user: %s", req.Username)
+	slog.DebugContext(r.Context(), "direct register: registering user", "username", req.Username)
 	
 	// Hash the password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		log.Printf("DirectRegister: Failed to hash password: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "direct register: failed to hash password", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 	
@@ -72,12 +63,11 @@ func (h *DirectRegisterHandler) Register(w http.ResponseWriter, r *http.Request)
 	
 	// Save the user directly to the database
 	if err := h.store.CreateUser(user); err != nil {
-		log.Printf("DirectRegister: Failed to create user: %v", err)
-		if err.Error() == "UNIQUE constraint failed: users.username" || 
-		   err.Error() == "pq: duplicate key value violates unique constraint \"users_username_key\"" {
-			http.Error(w, "Username already exists", http.StatusConflict)
+		slog.ErrorContext(r.Context(), "direct register: failed to create user", "username", req.Username, "error", err)
+		if errors.Is(err, store.ErrConflict) {
+			apierror.WriteField(w, http.StatusConflict, "username", "Username already exists")
 		} else {
-			http.Error(w, "Failed to create user", http.StatusInternalServerError)
+			apierror.WriteStore(w, err, "Failed to create user")
 		}
 		return
 	}
@@ -95,5 +85,5 @@ func (h *DirectRegisterHandler) Register(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(response)
 	
-	log.Printf("DirectRegister: Successfully registered user: %s with ID: %s", user.Username, user.ID)
+	slog.InfoContext(r.Context(), "direct register: user registered", "username", user.Username, "user_id", user.ID)
 }
@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/config"
+	"backend/internal/hub"
+	"backend/internal/models"
+	"backend/internal/protocol"
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultPollWait is how long a poll waits for events when it does not say,
+// and maxPollWait is the longest it may ask for. Both stay under the idle
+// timeouts of common proxies.
+const (
+	defaultPollWait = 25 * time.Second
+	maxPollWait     = 55 * time.Second
+)
+
+// EventsHandler serves a room's events to clients that cannot use
+// WebSockets, as a server-sent event stream or by long-polling. Those
+// clients send messages with MessageHandler.PostMessage.
+type EventsHandler struct {
+	hub *hub.Hub
+
+	// Queue sizes and timeouts, and the key that signs login tokens
+	settings    *config.WebSocketConfig
+	tokenSecret string
+
+	// polls holds the long-poll sessions by cursor
+	mu    sync.Mutex
+	polls map[string]*pollSubscriber
+}
+
+// NewEventsHandler creates a new EventsHandler. Clients authenticate with
+// login tokens signed with tokenSecret.
+func NewEventsHandler(h *hub.Hub, settings *config.WebSocketConfig, tokenSecret string) *EventsHandler {
+	return &EventsHandler{
+		hub:         h,
+		settings:    settings,
+		tokenSecret: tokenSecret,
+		polls:       make(map[string]*pollSubscriber),
+	}
+}
+
+// streamSubscriber queues a room's events for an event stream.
+type streamSubscriber struct {
+	// events is closed by the hub when it ends the session, after
+	// setting reason
+	events chan []byte
+	reason string
+}
+
+// Deliver implements hub.Subscriber.
+func (s *streamSubscriber) Deliver(event *protocol.Event) bool {
+	select {
+	case s.events <- event.JSON():
+		return true
+	default:
+		return false
+	}
+}
+
+// Close implements hub.Subscriber.
+func (s *streamSubscriber) Close(reason string) {
+	s.reason = reason
+	close(s.events)
+}
+
+// Queued implements hub.Subscriber.
+func (s *streamSubscriber) Queued() (int, int) {
+	return len(s.events), cap(s.events)
+}
+
+// ServeEvents handles streaming a room's events as server-sent events. Each
+// event is one data line holding the same JSON as a WebSocket frame. If the
+// user is disconnected, a closed event says why before the stream ends; if
+// the stream ends without one, the client may reconnect and fetch what it
+// missed from the history.
+func (h *EventsHandler) ServeEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	session, ok := openSession(w, r, h.hub, h.tokenSecret, r.PathValue("id"), hub.TransportSSE)
+	if !ok {
+		return
+	}
+	log := session.Logger()
+
+	// Proxies must pass each event on at once rather than buffer the stream
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		log.ErrorContext(ctx, "event stream cannot be flushed", "error", err)
+		return
+	}
+
+	stream := &streamSubscriber{events: make(chan []byte, h.settings.SendQueueSize)}
+	h.hub.Register(session, stream)
+	defer h.hub.Unregister(session)
+
+	// write sends one chunk of the stream, giving up on clients that stop reading
+	write := func(chunk []byte) bool {
+		rc.SetWriteDeadline(time.Now().Add(h.settings.WriteWait))
+		if _, err := w.Write(chunk); err != nil {
+			log.DebugContext(ctx, "failed to write event", "error", err)
+			return false
+		}
+		if err := rc.Flush(); err != nil {
+			log.DebugContext(ctx, "failed to write event", "error", err)
+			return false
+		}
+		return true
+	}
+
+	// Comments keep proxies from closing an idle stream
+	ticker := time.NewTicker(h.settings.PingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-stream.events:
+			if !ok {
+				if stream.reason != "" {
+					closed, _ := json.Marshal(models.ClosedEvent{Type: models.EventTypeClosed, Reason: stream.reason})
+					write(sseData(nil, closed))
+				}
+				return
+			}
+			// Add queued events to the same chunk
+			chunk := sseData(nil, event)
+			for n := len(stream.events); n > 0; n-- {
+				event, ok := <-stream.events
+				if !ok {
+					break
+				}
+				chunk = sseData(chunk, event)
+			}
+			if !write(chunk) {
+				return
+			}
+
+		case <-ticker.C:
+			if !write([]byte(": ping\n\n")) {
+				return
+			}
+
+		case <-ctx.Done():
+			log.DebugContext(ctx, "event stream closed by client")
+			return
+		}
+	}
+}
+
+// sseData appends an event to chunk as a server-sent event.
+func sseData(chunk, event []byte) []byte {
+	chunk = append(chunk, "data: "...)
+	chunk = append(chunk, event...)
+	return append(chunk, "\n\n"...)
+}
+
+// PollResponse defines the JSON response to a long-poll request.
+type PollResponse struct {
+	Cursor string `json:"cursor"`
+	// Last is the sequence number of the last event returned; the next poll
+	// passes it as after
+	Last   int64             `json:"last"`
+	Events []json.RawMessage `json:"events"`
+}
+
+// Poll handles long-polling for a room's events. A request without a
+// cursor subscribes to the room and returns a cursor at once; the client
+// then fetches the history it needs and polls with the cursor. Each poll
+// waits up to wait seconds for events numbered after the given sequence
+// number, and acknowledges the ones up to it. A cursor that is not polled
+// for a while expires. An unknown or expired cursor is answered with 404,
+// after which the client subscribes again and catches up from the history.
+func (h *EventsHandler) Poll(w http.ResponseWriter, r *http.Request) {
+	roomID := r.PathValue("id")
+	query := r.URL.Query()
+	cursor := query.Get("cursor")
+	if cursor == "" {
+		session, ok := openSession(w, r, h.hub, h.tokenSecret, roomID, hub.TransportPoll)
+		if !ok {
+			return
+		}
+		h.startPoll(session)
+		writePollResponse(w, PollResponse{Cursor: session.ID, Events: []json.RawMessage{}})
+		return
+	}
+
+	user, ok := requestUser(w, r, h.tokenSecret)
+	if !ok {
+		return
+	}
+	var after int64
+	if value := query.Get("after"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			apierror.WriteField(w, http.StatusBadRequest, "after", "after must be a sequence number")
+			return
+		}
+		after = n
+	}
+	wait := defaultPollWait
+	if value := query.Get("wait"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || time.Duration(n)*time.Second > maxPollWait {
+			apierror.WriteField(w, http.StatusBadRequest, "wait", "wait must be between 0 and "+strconv.Itoa(int(maxPollWait.Seconds()))+" seconds")
+			return
+		}
+		wait = time.Duration(n) * time.Second
+	}
+
+	h.mu.Lock()
+	p := h.polls[cursor]
+	h.mu.Unlock()
+	// Cursors are only valid for the user and room they were issued for
+	if p == nil || p.session.User.ID != user.ID || p.session.Room() != roomID {
+		apierror.Write(w, http.StatusNotFound, "Unknown or expired cursor, subscribe again")
+		return
+	}
+
+	events, last, reason, ended := p.poll(r.Context(), after, wait)
+	if ended {
+		h.forget(p)
+		if reason == "" {
+			apierror.Write(w, http.StatusNotFound, "Unknown or expired cursor, subscribe again")
+			return
+		}
+		closed, _ := json.Marshal(models.ClosedEvent{Type: models.EventTypeClosed, Reason: reason})
+		events = append(events, closed)
+	}
+	writePollResponse(w, PollResponse{Cursor: cursor, Last: last, Events: events})
+}
+
+// writePollResponse writes a successful poll response.
+func writePollResponse(w http.ResponseWriter, response PollResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
+
+// startPoll registers a long-poll queue and starts its expiry timer.
+func (h *EventsHandler) startPoll(session *hub.Session) {
+	p := &pollSubscriber{
+		session:  session,
+		capacity: h.settings.SendQueueSize,
+		first:    1,
+		changed:  make(chan struct{}),
+		idle:     h.settings.PongWait,
+	}
+	p.expire = func() {
+		session.Logger().InfoContext(session.Context(), "long-poll cursor expired")
+		h.hub.Unregister(session)
+		h.forget(p)
+	}
+	p.mu.Lock()
+	p.startExpiry()
+	p.mu.Unlock()
+
+	h.mu.Lock()
+	h.polls[session.ID] = p
+	h.mu.Unlock()
+	h.hub.Register(session, p)
+}
+
+// forget drops a long-poll queue, so that its cursor is no longer known.
+func (h *EventsHandler) forget(p *pollSubscriber) {
+	h.mu.Lock()
+	if h.polls[p.session.ID] == p {
+		delete(h.polls, p.session.ID)
+	}
+	h.mu.Unlock()
+}
+
+// pollSubscriber keeps a room's events for a long-polling client until it
+// acknowledges them. Events are numbered from 1.
+type pollSubscriber struct {
+	session  *hub.Session
+	capacity int
+
+	mu     sync.Mutex
+	events [][]byte // unacknowledged events
+	first  int64    // the sequence number of events[0]
+
+	// changed is closed and replaced whenever an event arrives or the hub
+	// ends the session, waking the waiting polls
+	changed chan struct{}
+	closed  bool
+	reason  string
+
+	// The session ends if nobody polls for idle. generation counts the
+	// polls started, so that a timer that fires as a poll starts, too late
+	// to be stopped, sees that it is stale
+	polling    int
+	generation int
+	idle       time.Duration
+	expiry     *time.Timer
+	expire     func()
+}
+
+// Deliver implements hub.Subscriber.
+func (p *pollSubscriber) Deliver(event *protocol.Event) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.events) >= p.capacity {
+		return false
+	}
+	p.events = append(p.events, event.JSON())
+	p.notify()
+	return true
+}
+
+// Close implements hub.Subscriber.
+func (p *pollSubscriber) Close(reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.reason = reason
+	p.notify()
+}
+
+// Queued implements hub.Subscriber.
+func (p *pollSubscriber) Queued() (int, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.events), p.capacity
+}
+
+// startExpiry starts the timer that ends the session unless a poll starts
+// within p.idle. p.mu must be held.
+func (p *pollSubscriber) startExpiry() {
+	generation := p.generation
+	p.expiry = time.AfterFunc(p.idle, func() {
+		p.mu.Lock()
+		expired := p.generation == generation && !p.closed
+		if expired {
+			// Polls that start from now on see an ended session
+			p.closed = true
+			p.notify()
+		}
+		p.mu.Unlock()
+		if expired {
+			p.expire()
+		}
+	})
+}
+
+// notify wakes the waiting polls. p.mu must be held.
+func (p *pollSubscriber) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// poll acknowledges the events up to after, then waits up to wait for
+// newer ones, returning them and the sequence number of the last. If the
+// hub has ended the session it reports ended, with the reason the user
+// was disconnected, if any.
+func (p *pollSubscriber) poll(ctx context.Context, after int64, wait time.Duration) (events []json.RawMessage, last int64, reason string, ended bool) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.polling++
+	p.generation++
+	p.expiry.Stop()
+	defer func() {
+		p.polling--
+		if p.polling == 0 {
+			p.startExpiry()
+		}
+	}()
+
+	// Events up to after have been received
+	if n := after - p.first + 1; n > 0 {
+		n = min(n, int64(len(p.events)))
+		p.events = slices.Delete(p.events, 0, int(n))
+		p.first += n
+	}
+
+	for waiting := true; waiting && len(p.events) == 0 && !p.closed; {
+		changed := p.changed
+		p.mu.Unlock()
+		select {
+		case <-changed:
+		case <-timer.C:
+			waiting = false
+		case <-ctx.Done():
+			waiting = false
+		}
+		p.mu.Lock()
+	}
+
+	events = make([]json.RawMessage, len(p.events))
+	for i, event := range p.events {
+		events[i] = event
+	}
+	return events, p.first + int64(len(p.events)) - 1, p.reason, p.closed
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"backend/internal/config"
+	"backend/internal/models"
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// eventsServer serves an EventsHandler over HTTP. Requests name their user
+// by ID in the X-Test-User header instead of sending a token.
+type eventsServer struct {
+	*httptest.Server
+	env *testEnv
+}
+
+func newEventsServer(t *testing.T, env *testEnv, settings config.WebSocketConfig) *eventsServer {
+	t.Helper()
+	handler := NewEventsHandler(env.hub, &settings, "secret")
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/rooms/{id}/events", handler.ServeEvents)
+	mux.HandleFunc("GET /api/rooms/{id}/poll", handler.Poll)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := env.store.GetUserByID(r.Header.Get("X-Test-User"))
+		if err != nil {
+			http.Error(w, "unknown test user", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, asUser(r, user))
+	}))
+	t.Cleanup(server.Close)
+	return &eventsServer{Server: server, env: env}
+}
+
+// get sends a GET request as user.
+func (s *eventsServer) get(t *testing.T, ctx context.Context, user *models.User, path string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Test-User", user.ID)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	return resp
+}
+
+// poll sends a long-poll request as user and decodes a successful response.
+func (s *eventsServer) poll(t *testing.T, user *models.User, query url.Values) (PollResponse, int) {
+	t.Helper()
+	resp := s.get(t, context.Background(), user, "/api/rooms/"+s.env.room.ID+"/poll?"+query.Encode())
+	defer resp.Body.Close()
+	var response PollResponse
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			t.Fatalf("decoding poll response: %v", err)
+		}
+	}
+	return response, resp.StatusCode
+}
+
+// pollQuery builds the query of a poll with a cursor.
+func pollQuery(cursor string, after int64, wait int) url.Values {
+	return url.Values{"cursor": {cursor}, "after": {strconv.FormatInt(after, 10)}, "wait": {strconv.Itoa(wait)}}
+}
+
+// post sends a message to the test room as the room's owner.
+func (env *testEnv) post(t *testing.T, content string) {
+	t.Helper()
+	if _, err := env.hub.Post(context.Background(), env.owner, env.room.ID, content); err != nil {
+		t.Fatalf("Post(%q): %v", content, err)
+	}
+}
+
+// messageContents decodes events that must all be messages and returns
+// their contents.
+func messageContents(t *testing.T, events []json.RawMessage) []string {
+	t.Helper()
+	contents := []string{}
+	for _, raw := range events {
+		var message models.MessageDTO
+		if err := json.Unmarshal(raw, &message); err != nil || message.Type != models.EventTypeMessage {
+			t.Fatalf("event %s is not a message: %v", raw, err)
+		}
+		contents = append(contents, message.Content)
+	}
+	return contents
+}
+
+func TestServeEventsFramingAndHeartbeat(t *testing.T) {
+	env := newTestEnv(t)
+	settings := config.Default().WebSocket
+	settings.PingPeriod = 20 * time.Millisecond
+	server := newEventsServer(t, env, settings)
+	alice := newTestUser(t, env.store, "alice")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	resp := server.get(t, ctx, alice, "/api/rooms/"+env.room.ID+"/events")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status %d, Content-Type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// The stream is registered after its headers are sent
+	for deadline := time.Now().Add(2 * time.Second); len(env.hub.Sessions()) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("event stream was not registered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	env.post(t, "one")
+	env.post(t, "two\nlines")
+
+	// Each event is one data line ended by a blank line, and comments keep
+	// the stream alive between them
+	reader := bufio.NewReader(resp.Body)
+	var events []json.RawMessage
+	pings := 0
+	for len(events) < 2 || pings == 0 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading stream: %v (events %s, pings %d)", err, events, pings)
+		}
+		switch {
+		case line == ": ping\n":
+			pings++
+		case strings.HasPrefix(line, "data: "):
+			events = append(events, json.RawMessage(strings.TrimPrefix(line, "data: ")))
+		default:
+			t.Fatalf("unexpected line %q", line)
+		}
+		if blank, err := reader.ReadString('\n'); err != nil || blank != "\n" {
+			t.Fatalf("line %q followed by %q, %v; want a blank line", line, blank, err)
+		}
+	}
+	if got := messageContents(t, events); strings.Join(got, "|") != "one|two\nlines" {
+		t.Errorf("messages %q", got)
+	}
+}
+
+func TestPollAcksAndRedelivers(t *testing.T) {
+	env := newTestEnv(t)
+	server := newEventsServer(t, env, config.Default().WebSocket)
+	alice := newTestUser(t, env.store, "alice")
+
+	subscribed, status := server.poll(t, alice, nil)
+	if status != http.StatusOK || subscribed.Cursor == "" || subscribed.Last != 0 || len(subscribed.Events) != 0 {
+		t.Fatalf("subscribing = %+v, status %d", subscribed, status)
+	}
+	cursor := subscribed.Cursor
+	env.post(t, "one")
+	env.post(t, "two")
+
+	first, status := server.poll(t, alice, pollQuery(cursor, 0, 1))
+	if status != http.StatusOK || first.Last != 2 {
+		t.Fatalf("first poll = %+v, status %d", first, status)
+	}
+	if got := messageContents(t, first.Events); strings.Join(got, ",") != "one,two" {
+		t.Fatalf("first poll messages %q", got)
+	}
+
+	// Events are kept until a poll acknowledges them, so a lost response
+	// is answered again
+	again, _ := server.poll(t, alice, pollQuery(cursor, 0, 1))
+	if got := messageContents(t, again.Events); again.Last != 2 || strings.Join(got, ",") != "one,two" {
+		t.Fatalf("repeated poll = %q, last %d; want the same events", got, again.Last)
+	}
+
+	// Acknowledging the first keeps the second
+	partial, _ := server.poll(t, alice, pollQuery(cursor, 1, 1))
+	if got := messageContents(t, partial.Events); partial.Last != 2 || strings.Join(got, ",") != "two" {
+		t.Fatalf("poll after 1 = %q, last %d", got, partial.Last)
+	}
+
+	// Acknowledging everything waits for new events, numbered on
+	empty, _ := server.poll(t, alice, pollQuery(cursor, 2, 0))
+	if empty.Last != 2 || len(empty.Events) != 0 {
+		t.Fatalf("poll after 2 = %+v, want no events", empty)
+	}
+	env.post(t, "three")
+	next, _ := server.poll(t, alice, pollQuery(cursor, 2, 1))
+	if got := messageContents(t, next.Events); next.Last != 3 || strings.Join(got, ",") != "three" {
+		t.Fatalf("poll for new events = %q, last %d", got, next.Last)
+	}
+}
+
+func TestPollCursors(t *testing.T) {
+	env := newTestEnv(t)
+	server := newEventsServer(t, env, config.Default().WebSocket)
+	alice := newTestUser(t, env.store, "alice")
+	bob := newTestUser(t, env.store, "bob")
+
+	subscribed, _ := server.poll(t, alice, nil)
+	if _, status := server.poll(t, alice, pollQuery("no-such-cursor", 0, 0)); status != http.StatusNotFound {
+		t.Errorf("unknown cursor: status %d, want 404", status)
+	}
+	// Cursors belong to the user they were issued to
+	if _, status := server.poll(t, bob, pollQuery(subscribed.Cursor, 0, 0)); status != http.StatusNotFound {
+		t.Errorf("another user's cursor: status %d, want 404", status)
+	}
+	if _, status := server.poll(t, alice, url.Values{"cursor": {subscribed.Cursor}, "after": {"-1"}}); status != http.StatusBadRequest {
+		t.Errorf("negative after: status %d, want 400", status)
+	}
+	if _, status := server.poll(t, alice, url.Values{"cursor": {subscribed.Cursor}, "wait": {"3600"}}); status != http.StatusBadRequest {
+		t.Errorf("wait too long: status %d, want 400", status)
+	}
+	if _, status := server.poll(t, alice, pollQuery(subscribed.Cursor, 0, 0)); status != http.StatusOK {
+		t.Errorf("own cursor: status %d, want 200", status)
+	}
+}
+
+func TestPollCursorExpires(t *testing.T) {
+	env := newTestEnv(t)
+	settings := config.Default().WebSocket
+	settings.PongWait = 100 * time.Millisecond
+	server := newEventsServer(t, env, settings)
+	alice := newTestUser(t, env.store, "alice")
+
+	subscribed, _ := server.poll(t, alice, nil)
+	cursor := subscribed.Cursor
+
+	// A poll that waits longer than the idle timeout keeps the cursor alive
+	if _, status := server.poll(t, alice, pollQuery(cursor, 0, 1)); status != http.StatusOK {
+		t.Fatalf("long poll: status %d, want 200", status)
+	}
+	if _, status := server.poll(t, alice, pollQuery(cursor, 0, 0)); status != http.StatusOK {
+		t.Fatalf("poll after a long poll: status %d, want 200", status)
+	}
+
+	// Without polls it expires, and the session ends
+	time.Sleep(3 * settings.PongWait)
+	if _, status := server.poll(t, alice, pollQuery(cursor, 0, 0)); status != http.StatusNotFound {
+		t.Fatalf("expired cursor: status %d, want 404", status)
+	}
+	if sessions := env.hub.Sessions(); len(sessions) != 0 {
+		t.Errorf("sessions after expiry = %+v", sessions)
+	}
+}
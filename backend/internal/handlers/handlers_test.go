@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"backend/internal/config"
+	"backend/internal/hub"
+	"backend/internal/middleware"
+	"backend/internal/models"
+	"backend/internal/services"
+	"backend/internal/store"
+	"context"
+	"net/http"
+	"testing"
+)
+
+// testEnv is a hub over an in-memory store with one public room.
+type testEnv struct {
+	store    *store.MemoryStore
+	hub      *hub.Hub
+	messages *services.MessageService
+	owner    *models.User
+	room     *models.ChatRoom
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	mem := store.NewMemoryStore()
+	owner := newTestUser(t, mem, "owner")
+	room, err := services.NewRoomService(mem).CreateRoom("lobby", owner.ID, "public")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	messages := services.NewMessageService(mem)
+	h := hub.New(messages, &config.Default().RateLimit)
+	go h.Run()
+	return &testEnv{store: mem, hub: h, messages: messages, owner: owner, room: room}
+}
+
+func newTestUser(t *testing.T, s store.StoreInterface, username string) *models.User {
+	t.Helper()
+	user := &models.User{ID: services.GenerateUUID(), Username: username, Password: "hash"}
+	if err := s.CreateUser(user); err != nil {
+		t.Fatalf("CreateUser(%q): %v", username, err)
+	}
+	return user
+}
+
+// asUser returns r as sent by user, as if it had passed AuthMiddleware.
+func asUser(r *http.Request, user *models.User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), middleware.UserContextKey, user))
+}
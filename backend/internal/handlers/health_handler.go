@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// readinessTimeout bounds how long each readiness check may take.
+const readinessTimeout = 2 * time.Second
+
+// HealthCheck reports whether a dependency is usable; nil means it is.
+type HealthCheck func(ctx context.Context) error
+
+// HealthHandler serves the liveness and readiness probes.
+type HealthHandler struct {
+	names    []string
+	checks   map[string]HealthCheck
+	draining atomic.Bool
+}
+
+// HealthResponse defines the JSON response of the probes. Checks maps each
+// readiness check to "ok" or the reason it failed.
+type HealthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// NewHealthHandler creates a new HealthHandler with no readiness checks.
+func NewHealthHandler() *HealthHandler {
+	return &HealthHandler{checks: make(map[string]HealthCheck)}
+}
+
+// AddCheck adds a readiness check. It must be called before the handler
+// serves requests.
+func (h *HealthHandler) AddCheck(name string, check HealthCheck) {
+	if _, ok := h.checks[name]; !ok {
+		h.names = append(h.names, name)
+	}
+	h.checks[name] = check
+}
+
+// Drain makes the readiness probe fail from now on, so that load balancers
+// stop sending new requests while the server shuts down.
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
+}
+
+// Live handles the liveness probe. It succeeds as long as the process can
+// serve HTTP, so that a restart is only triggered when it cannot.
+func (h *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HealthResponse{Status: "ok"})
+}
+
+// Ready handles the readiness probe. It runs every check at once and
+// answers 503 Service Unavailable if any of them fails, or without running
+// them once the server is draining.
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(HealthResponse{Status: "draining"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]string, len(h.names))
+	ready := true
+	for _, name := range h.names {
+		wg.Add(1)
+		go func(name string, check HealthCheck) {
+			defer wg.Done()
+			result := "ok"
+			if err := check(ctx); err != nil {
+				slog.WarnContext(ctx, "readiness check failed", "check", name, "error", err)
+				result = err.Error()
+			}
+			mu.Lock()
+			results[name] = result
+			ready = ready && result == "ok"
+			mu.Unlock()
+		}(name, h.checks[name])
+	}
+	wg.Wait()
+
+	response := HealthResponse{Status: "ok", Checks: results}
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		response.Status = "unavailable"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"backend/internal/config"
+	"backend/internal/store"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// probe calls a probe handler and decodes its answer.
+func probe(t *testing.T, handler http.HandlerFunc) (HealthResponse, int) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	var response HealthResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("decoding probe response: %v", err)
+	}
+	return response, rec.Code
+}
+
+func TestReadyChecksTheStore(t *testing.T) {
+	db, err := store.NewDBStore(&config.DatabaseConfig{Type: "sqlite", SQLitePath: filepath.Join(t.TempDir(), "chatapp.db")})
+	if err != nil {
+		t.Fatalf("NewDBStore: %v", err)
+	}
+	health := NewHealthHandler()
+	health.AddCheck("database", db.Ping)
+	health.AddCheck("hub", func(ctx context.Context) error { return nil })
+
+	response, status := probe(t, health.Ready)
+	if status != http.StatusOK || response.Status != "ok" || response.Checks["database"] != "ok" || response.Checks["hub"] != "ok" {
+		t.Fatalf("ready = %d %+v, want 200 with every check ok", status, response)
+	}
+
+	// A store that cannot be reached takes the instance out of rotation,
+	// while it stays alive
+	db.Close()
+	response, status = probe(t, health.Ready)
+	if status != http.StatusServiceUnavailable || response.Status != "unavailable" || response.Checks["database"] == "ok" || response.Checks["hub"] != "ok" {
+		t.Fatalf("ready with a closed store = %d %+v, want 503 naming the database", status, response)
+	}
+	if response, status := probe(t, health.Live); status != http.StatusOK || response.Status != "ok" {
+		t.Fatalf("live with a closed store = %d %+v, want 200", status, response)
+	}
+}
+
+func TestReadyFailsWhileDraining(t *testing.T) {
+	health := NewHealthHandler()
+	checked := false
+	health.AddCheck("database", func(ctx context.Context) error {
+		checked = true
+		return nil
+	})
+	if _, status := probe(t, health.Ready); status != http.StatusOK {
+		t.Fatalf("ready = %d, want 200", status)
+	}
+
+	checked = false
+	health.Drain()
+	response, status := probe(t, health.Ready)
+	if status != http.StatusServiceUnavailable || response.Status != "draining" {
+		t.Fatalf("ready while draining = %d %+v, want 503 draining", status, response)
+	}
+	if checked {
+		t.Error("checks ran while draining")
+	}
+	if _, status := probe(t, health.Live); status != http.StatusOK {
+		t.Errorf("live while draining = %d, want 200", status)
+	}
+}
+
+func TestReadyReportsEachFailedCheck(t *testing.T) {
+	health := NewHealthHandler()
+	health.AddCheck("database", func(ctx context.Context) error { return errors.New("connection refused") })
+	health.AddCheck("migrations", func(ctx context.Context) error { return nil })
+
+	response, status := probe(t, health.Ready)
+	if status != http.StatusServiceUnavailable || response.Checks["database"] != "connection refused" || response.Checks["migrations"] != "ok" {
+		t.Fatalf("ready = %d %+v", status, response)
+	}
+}
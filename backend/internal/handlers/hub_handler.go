@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/hub"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// hubRequestTimeout is how long diagnostics wait for the hub to answer.
+const hubRequestTimeout = 2 * time.Second
+
+// HubHandler handles diagnostic requests about the hub.
+type HubHandler struct {
+	hub *hub.Hub
+}
+
+// NewHubHandler creates a new HubHandler.
+func NewHubHandler(h *hub.Hub) *HubHandler {
+	return &HubHandler{hub: h}
+}
+
+// DebugHub handles reporting the hub's rooms, subscribers and send queue depths.
+func (h *HubHandler) DebugHub(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), hubRequestTimeout)
+	defer cancel()
+	status, err := h.hub.Status(ctx)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to read hub status", "error", err)
+		apierror.Write(w, http.StatusServiceUnavailable, "The hub is not responding")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/contentfilter"
+	"backend/internal/hub"
+	"backend/internal/middleware"
+	"backend/internal/models"
+	"backend/internal/services"
+	"backend/internal/store"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultHistoryLimit is how many messages a history request returns when it
+// does not give a limit, and maxHistoryLimit is the most it can ask for.
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+// MessageHandler handles HTTP requests for room messages.
+type MessageHandler struct {
+	messageService *services.MessageService
+
+	// Messages sent over HTTP go through the hub like WebSocket frames, and
+	// their bodies are limited to the size of a frame
+	hub            *hub.Hub
+	maxMessageSize int64
+}
+
+// NewMessageHandler creates a new MessageHandler. Request bodies for new
+// messages may be up to maxMessageSize bytes.
+func NewMessageHandler(messageService *services.MessageService, h *hub.Hub, maxMessageSize int64) *MessageHandler {
+	return &MessageHandler{messageService: messageService, hub: h, maxMessageSize: maxMessageSize}
+}
+
+// PostMessageRequest defines the JSON body for sending a message.
+type PostMessageRequest struct {
+	Content string `json:"content"`
+}
+
+// PostMessageHeldResponse defines the JSON response for a message that a
+// content filter held for review.
+type PostMessageHeldResponse struct {
+	Status  string `json:"status"` // always "held"
+	Message string `json:"message"`
+}
+
+// GetHistoryResponse defines the JSON response for a room's message history.
+type GetHistoryResponse struct {
+	Messages []models.MessageDTO `json:"messages"`
+}
+
+// GetHistory handles fetching a room's recent messages. limit caps how many
+// are returned: the most recent ones, or with the optional since parameter
+// (RFC 3339), the first ones sent after it. Clients page forward by passing
+// the timestamp and, as since_id, the ID of the last message they received,
+// so that messages sent at the same time are not skipped.
+func (h *MessageHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	query := r.URL.Query()
+	var after models.MessageCursor
+	if value := query.Get("since"); value != "" {
+		var err error
+		if after.Timestamp, err = time.Parse(time.RFC3339Nano, value); err != nil {
+			apierror.WriteField(w, http.StatusBadRequest, "since", "since must be an RFC 3339 timestamp")
+			return
+		}
+	}
+	if after.ID = query.Get("since_id"); after.ID != "" && after.Timestamp.IsZero() {
+		apierror.WriteField(w, http.StatusBadRequest, "since_id", "since_id needs since")
+		return
+	}
+	limit := defaultHistoryLimit
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxHistoryLimit {
+			apierror.WriteField(w, http.StatusBadRequest, "limit", "limit must be between 1 and "+strconv.Itoa(maxHistoryLimit))
+			return
+		}
+		limit = n
+	}
+
+	messages, err := h.messageService.WithContext(r.Context()).GetHistory(r.PathValue("id"), user.ID, after, limit)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get room history", "room", r.PathValue("id"), "error", err)
+		if errors.Is(err, services.ErrBanned) || errors.Is(err, services.ErrAccountDisabled) || errors.Is(err, services.ErrNotRoomMember) {
+			apierror.Write(w, http.StatusForbidden, err.Error())
+		} else {
+			apierror.WriteStore(w, err, "Failed to retrieve messages")
+		}
+		return
+	}
+
+	response := GetHistoryResponse{Messages: make([]models.MessageDTO, len(messages))}
+	for i, message := range messages {
+		response.Messages[i] = models.NewMessageDTO(message)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// PostMessage handles sending a message to a room, for clients that receive
+// its events by server-sent events or long-polling. The message is checked
+// and delivered exactly like one sent over WebSocket.
+func (h *MessageHandler) PostMessage(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req PostMessageRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.maxMessageSize)).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apierror.WriteField(w, http.StatusBadRequest, "content", "Message is too large")
+		} else {
+			apierror.Write(w, http.StatusBadRequest, "Invalid request body")
+		}
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		apierror.WriteField(w, http.StatusBadRequest, "content", "Message content is required")
+		return
+	}
+
+	// Without a subscription to check, the room is checked for each message
+	roomID := r.PathValue("id")
+	if err := h.messageService.WithContext(r.Context()).CheckCanView(roomID, user.ID); err != nil {
+		slog.InfoContext(r.Context(), "message refused", "room", roomID, "error", err)
+		if errors.Is(err, services.ErrBanned) || errors.Is(err, services.ErrAccountDisabled) || errors.Is(err, services.ErrNotRoomMember) {
+			apierror.Write(w, http.StatusForbidden, err.Error())
+		} else {
+			apierror.WriteStore(w, err, "Failed to send message")
+		}
+		return
+	}
+
+	message, err := h.hub.Post(r.Context(), user, roomID, req.Content)
+	if err != nil {
+		slog.InfoContext(r.Context(), "message refused", "room", roomID, "error", err)
+		writePostError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.NewMessageDTO(message))
+}
+
+// writePostError answers a message the hub refused, with the same messages
+// as the error events sent over WebSocket.
+func writePostError(w http.ResponseWriter, err error) {
+	event := errorEvent(err, "")
+	var limited *hub.RateLimitError
+	var muted *services.MutedError
+	var filtered *hub.FilterError
+	switch {
+	case errors.As(err, &limited):
+		w.Header().Set("Retry-After", retryAfterSeconds(limited.RetryAfter))
+		apierror.Write(w, http.StatusTooManyRequests, event.Message)
+	case errors.As(err, &muted):
+		w.Header().Set("Retry-After", retryAfterSeconds(time.Until(muted.Until)))
+		apierror.Write(w, http.StatusForbidden, event.Message)
+	case errors.Is(err, services.ErrBanned) || errors.Is(err, services.ErrNotRoomMember):
+		apierror.Write(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, services.ErrRoomArchived):
+		apierror.Write(w, http.StatusForbidden, event.Message)
+	case errors.Is(err, store.ErrNotFound):
+		apierror.WriteStore(w, err, "Failed to send message")
+	case errors.As(err, &filtered) && filtered.Verdict == contentfilter.Hold:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(PostMessageHeldResponse{Status: "held", Message: event.Message})
+	case errors.As(err, &filtered):
+		apierror.WriteField(w, http.StatusBadRequest, "content", event.Message)
+	default:
+		w.Header().Set("Retry-After", "1")
+		apierror.Write(w, http.StatusServiceUnavailable, event.Message)
+	}
+}
+
+// retryAfterSeconds formats a wait for a Retry-After header, rounded up to
+// whole seconds.
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"backend/internal/models"
+	"backend/internal/services"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postMessage sends content to a room through PostMessage as user.
+func postMessage(env *testEnv, user *models.User, roomID, content string) *httptest.ResponseRecorder {
+	handler := NewMessageHandler(env.messages, env.hub, 4096)
+	body, _ := json.Marshal(PostMessageRequest{Content: content})
+	req := httptest.NewRequest(http.MethodPost, "/api/rooms/"+roomID+"/messages", strings.NewReader(string(body)))
+	req.SetPathValue("id", roomID)
+	rec := httptest.NewRecorder()
+	handler.PostMessage(rec, asUser(req, user))
+	return rec
+}
+
+// getHistory fetches the test room's history through GetHistory as user.
+func getHistory(t *testing.T, env *testEnv, user *models.User, query url.Values) ([]models.MessageDTO, int) {
+	t.Helper()
+	handler := NewMessageHandler(env.messages, env.hub, 4096)
+	req := httptest.NewRequest(http.MethodGet, "/api/rooms/"+env.room.ID+"/messages?"+query.Encode(), nil)
+	req.SetPathValue("id", env.room.ID)
+	rec := httptest.NewRecorder()
+	handler.GetHistory(rec, asUser(req, user))
+	var response GetHistoryResponse
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("decoding history: %v", err)
+		}
+	}
+	return response.Messages, rec.Code
+}
+
+func TestGetHistoryPagesThroughMessagesSharingATimestamp(t *testing.T) {
+	env := newTestEnv(t)
+	timestamp := time.Now().UTC().Truncate(time.Microsecond)
+	var ids []string
+	for _, content := range []string{"one", "two", "three"} {
+		message := &models.Message{ID: services.GenerateUUID(), RoomID: env.room.ID, SenderID: env.owner.ID, Content: content, Timestamp: timestamp}
+		if err := env.store.SaveMessage(message); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, message.ID)
+	}
+	sort.Strings(ids)
+
+	// Each page starts after the timestamp and ID of the last message of
+	// the one before
+	var got []string
+	query := url.Values{"since": {timestamp.Add(-time.Second).Format(time.RFC3339Nano)}, "limit": {"2"}}
+	for page := 0; page < 3; page++ {
+		messages, status := getHistory(t, env, env.owner, query)
+		if status != http.StatusOK {
+			t.Fatalf("page %d: status %d", page, status)
+		}
+		for _, message := range messages {
+			got = append(got, message.ID)
+		}
+		if len(messages) < 2 {
+			break
+		}
+		last := messages[len(messages)-1]
+		query.Set("since", last.Timestamp.Format(time.RFC3339Nano))
+		query.Set("since_id", last.ID)
+	}
+	if strings.Join(got, ",") != strings.Join(ids, ",") {
+		t.Errorf("paged through %q, want %q", got, ids)
+	}
+
+	if _, status := getHistory(t, env, env.owner, url.Values{"since_id": {ids[0]}}); status != http.StatusBadRequest {
+		t.Errorf("since_id without since: status %d, want 400", status)
+	}
+}
+
+func TestPostMessageJoinsPublicRoom(t *testing.T) {
+	env := newTestEnv(t)
+	alice := newTestUser(t, env.store, "alice")
+
+	// Web clients subscribe to public rooms without joining them first
+	rec := postMessage(env, alice, env.room.ID, "hello")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d, want 201: %s", rec.Code, rec.Body)
+	}
+	var message models.MessageDTO
+	if err := json.NewDecoder(rec.Body).Decode(&message); err != nil || message.Content != "hello" || message.Sender != "alice" {
+		t.Fatalf("response %+v, %v", message, err)
+	}
+	member, err := env.store.GetRoomMember(env.room.ID, alice.ID)
+	if err != nil || member.Status != services.MemberStatusMember {
+		t.Fatalf("membership after posting = %+v, %v; want a member", member, err)
+	}
+}
+
+func TestPostMessageRefusesNonMemberOfPrivateRoom(t *testing.T) {
+	env := newTestEnv(t)
+	alice := newTestUser(t, env.store, "alice")
+	private, err := services.NewRoomService(env.store).CreateRoom("den", env.owner.ID, "private")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+
+	if rec := postMessage(env, alice, private.ID, "hello"); rec.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want 403: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/middleware"
+	"backend/internal/models"
+	"backend/internal/services"
+	"backend/internal/store"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ModerationHandler handles HTTP requests for room moderation.
+type ModerationHandler struct {
+	moderationService *services.ModerationService
+}
+
+// NewModerationHandler creates a new ModerationHandler.
+func NewModerationHandler(moderationService *services.ModerationService) *ModerationHandler {
+	return &ModerationHandler{moderationService: moderationService}
+}
+
+// ModerationRequest defines the expected JSON body for a moderation action.
+type ModerationRequest struct {
+	Username        string `json:"username"`
+	Reason          string `json:"reason"`
+	DurationSeconds int    `json:"durationSeconds"` // mute only
+}
+
+// SetRoleRequest defines the expected JSON body for changing a member's role.
+type SetRoleRequest struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// GetModerationLogResponse defines the JSON response for a room's moderation log.
+type GetModerationLogResponse struct {
+	Actions []*models.ModerationAction `json:"actions"`
+}
+
+// GetHeldMessagesResponse defines the JSON response for a room's review queue.
+type GetHeldMessagesResponse struct {
+	Messages []*models.HeldMessage `json:"messages"`
+}
+
+// decodeModerationRequest reads and validates a ModerationRequest, writing an
+// error response and returning false if it is invalid.
+func decodeModerationRequest(w http.ResponseWriter, r *http.Request) (*ModerationRequest, bool) {
+	var req ModerationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "Invalid request body")
+		return nil, false
+	}
+	if req.Username == "" {
+		apierror.WriteField(w, http.StatusBadRequest, "username", "Username is required")
+		return nil, false
+	}
+	return &req, true
+}
+
+// Mute handles muting a member for a number of seconds.
+func (h *ModerationHandler) Mute(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	req, ok := decodeModerationRequest(w, r)
+	if !ok {
+		return
+	}
+
+	duration := time.Duration(req.DurationSeconds) * time.Second
+	member, err := h.moderationService.WithContext(r.Context()).Mute(r.PathValue("id"), user.ID, req.Username, duration, req.Reason)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to mute user", "room", r.PathValue("id"), "target", req.Username, "error", err)
+		writeModerationError(w, err, "Failed to mute user")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(member)
+}
+
+// Unmute handles lifting a member's mute.
+func (h *ModerationHandler) Unmute(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	req, ok := decodeModerationRequest(w, r)
+	if !ok {
+		return
+	}
+
+	member, err := h.moderationService.WithContext(r.Context()).Unmute(r.PathValue("id"), user.ID, req.Username)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to unmute user", "room", r.PathValue("id"), "target", req.Username, "error", err)
+		writeModerationError(w, err, "Failed to unmute user")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(member)
+}
+
+// Kick handles removing a member from a room.
+func (h *ModerationHandler) Kick(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	req, ok := decodeModerationRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.moderationService.WithContext(r.Context()).Kick(r.PathValue("id"), user.ID, req.Username, req.Reason); err != nil {
+		slog.ErrorContext(r.Context(), "failed to kick user", "room", r.PathValue("id"), "target", req.Username, "error", err)
+		writeModerationError(w, err, "Failed to kick user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Ban handles banning a user from a room.
+func (h *ModerationHandler) Ban(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	req, ok := decodeModerationRequest(w, r)
+	if !ok {
+		return
+	}
+
+	ban, err := h.moderationService.WithContext(r.Context()).Ban(r.PathValue("id"), user.ID, req.Username, req.Reason)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to ban user", "room", r.PathValue("id"), "target", req.Username, "error", err)
+		if errors.Is(err, store.ErrConflict) {
+			apierror.WriteField(w, http.StatusConflict, "username", "This user is already banned")
+		} else {
+			writeModerationError(w, err, "Failed to ban user")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ban)
+}
+
+// Unban handles lifting a user's ban from a room.
+func (h *ModerationHandler) Unban(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	req, ok := decodeModerationRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.moderationService.WithContext(r.Context()).Unban(r.PathValue("id"), user.ID, req.Username); err != nil {
+		slog.ErrorContext(r.Context(), "failed to unban user", "room", r.PathValue("id"), "target", req.Username, "error", err)
+		writeModerationError(w, err, "Failed to unban user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetRole handles promoting a member to moderator or demoting them.
+func (h *ModerationHandler) SetRole(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req SetRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Username == "" {
+		apierror.WriteField(w, http.StatusBadRequest, "username", "Username is required")
+		return
+	}
+
+	member, err := h.moderationService.WithContext(r.Context()).SetRole(r.PathValue("id"), user.ID, req.Username, req.Role)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to set member role", "room", r.PathValue("id"), "target", req.Username, "error", err)
+		writeModerationError(w, err, "Failed to change role")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(member)
+}
+
+// GetLog handles listing a room's moderation log.
+func (h *ModerationHandler) GetLog(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	actions, err := h.moderationService.WithContext(r.Context()).GetLog(r.PathValue("id"), user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get moderation log", "room", r.PathValue("id"), "error", err)
+		writeModerationError(w, err, "Failed to retrieve moderation log")
+		return
+	}
+	if actions == nil {
+		actions = []*models.ModerationAction{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(GetModerationLogResponse{Actions: actions})
+}
+
+// GetHeldMessages handles listing the messages held for review in a room.
+func (h *ModerationHandler) GetHeldMessages(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	held, err := h.moderationService.WithContext(r.Context()).GetHeldMessages(r.PathValue("id"), user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get held messages", "room", r.PathValue("id"), "error", err)
+		writeModerationError(w, err, "Failed to retrieve held messages")
+		return
+	}
+	if held == nil {
+		held = []*models.HeldMessage{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(GetHeldMessagesResponse{Messages: held})
+}
+
+// ApproveHeldMessage handles delivering a held message.
+func (h *ModerationHandler) ApproveHeldMessage(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	message, err := h.moderationService.WithContext(r.Context()).ApproveHeldMessage(r.PathValue("id"), user.ID, r.PathValue("messageId"))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to approve held message", "room", r.PathValue("id"), "message_id", r.PathValue("messageId"), "error", err)
+		writeModerationError(w, err, "Failed to approve message")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(message)
+}
+
+// DiscardHeldMessage handles throwing away a held message.
+func (h *ModerationHandler) DiscardHeldMessage(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.moderationService.WithContext(r.Context()).DiscardHeldMessage(r.PathValue("id"), user.ID, r.PathValue("messageId")); err != nil {
+		slog.ErrorContext(r.Context(), "failed to discard held message", "room", r.PathValue("id"), "message_id", r.PathValue("messageId"), "error", err)
+		writeModerationError(w, err, "Failed to discard message")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeModerationError maps moderation service errors to HTTP responses.
+func writeModerationError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrNotModerator),
+		errors.Is(err, services.ErrNotOwner),
+		errors.Is(err, services.ErrCannotModerate):
+		apierror.Write(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, services.ErrNotRoomMember):
+		apierror.WriteField(w, http.StatusConflict, "username", "This user is not a member of the room")
+	case errors.Is(err, services.ErrInvalidRole):
+		apierror.WriteField(w, http.StatusBadRequest, "role", err.Error())
+	case errors.Is(err, services.ErrInvalidDuration):
+		apierror.WriteField(w, http.StatusBadRequest, "durationSeconds", err.Error())
+	default:
+		apierror.WriteStore(w, err, message)
+	}
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/middleware"
+	"backend/internal/models"
+	"backend/internal/services"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ReportHandler handles HTTP requests for message reports.
+type ReportHandler struct {
+	reportService *services.ReportService
+}
+
+// NewReportHandler creates a new ReportHandler.
+func NewReportHandler(reportService *services.ReportService) *ReportHandler {
+	return &ReportHandler{reportService: reportService}
+}
+
+// ReportMessageRequest defines the expected JSON body for reporting a message.
+type ReportMessageRequest struct {
+	Category string `json:"category"`
+	Details  string `json:"details"`
+}
+
+// ResolveReportRequest defines the expected JSON body for closing a report.
+type ResolveReportRequest struct {
+	Action          string `json:"action"`
+	Reason          string `json:"reason"`
+	DurationSeconds int    `json:"durationSeconds"` // mute only
+}
+
+// ListReportsResponse defines the JSON response for a report queue.
+type ListReportsResponse struct {
+	Reports []*models.MessageReport `json:"reports"`
+}
+
+// reportStatusFilter reads the status query parameter of a report queue
+// request. It defaults to open reports; "all" selects every report.
+func reportStatusFilter(r *http.Request) (string, bool) {
+	switch status := r.URL.Query().Get("status"); status {
+	case "":
+		return services.ReportStatusOpen, true
+	case "all":
+		return "", true
+	case services.ReportStatusOpen, services.ReportStatusResolved, services.ReportStatusDismissed:
+		return status, true
+	default:
+		return "", false
+	}
+}
+
+// ReportMessage handles a room member reporting a message.
+func (h *ReportHandler) ReportMessage(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req ReportMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	report, err := h.reportService.WithContext(r.Context()).ReportMessage(r.PathValue("id"), user.ID, req.Category, req.Details)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to report message", "message_id", r.PathValue("id"), "error", err)
+		if errors.Is(err, services.ErrNotRoomMember) {
+			apierror.Write(w, http.StatusForbidden, "You are not a member of this room")
+		} else {
+			writeReportError(w, err, "Failed to report message")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(report)
+}
+
+// ListRoomReports handles listing a room's reports for its moderators.
+func (h *ReportHandler) ListRoomReports(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	status, ok := reportStatusFilter(r)
+	if !ok {
+		apierror.WriteField(w, http.StatusBadRequest, "status", "Status must be open, resolved, dismissed or all")
+		return
+	}
+
+	reports, err := h.reportService.WithContext(r.Context()).ListRoomReports(r.PathValue("id"), user.ID, status)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list room reports", "room", r.PathValue("id"), "error", err)
+		writeReportError(w, err, "Failed to retrieve reports")
+		return
+	}
+	writeReports(w, reports)
+}
+
+// ListAllReports handles listing the reports from every room. The route is
+// wrapped in middleware.RequireAdmin.
+func (h *ReportHandler) ListAllReports(w http.ResponseWriter, r *http.Request) {
+	status, ok := reportStatusFilter(r)
+	if !ok {
+		apierror.WriteField(w, http.StatusBadRequest, "status", "Status must be open, resolved, dismissed or all")
+		return
+	}
+
+	reports, err := h.reportService.WithContext(r.Context()).ListAllReports(status)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list reports", "error", err)
+		apierror.WriteStore(w, err, "Failed to retrieve reports")
+		return
+	}
+	writeReports(w, reports)
+}
+
+// writeReports writes a report queue as JSON.
+func writeReports(w http.ResponseWriter, reports []*models.MessageReport) {
+	if reports == nil {
+		reports = []*models.MessageReport{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ListReportsResponse{Reports: reports})
+}
+
+// ResolveReport handles a moderator closing a report, optionally acting on
+// the reported message or its sender.
+func (h *ReportHandler) ResolveReport(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req ResolveReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	report, err := h.reportService.WithContext(r.Context()).ResolveReport(r.PathValue("id"), user.ID, services.ReportResolution{
+		Action:   req.Action,
+		Reason:   req.Reason,
+		Duration: time.Duration(req.DurationSeconds) * time.Second,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to resolve report", "report_id", r.PathValue("id"), "error", err)
+		writeReportError(w, err, "Failed to resolve report")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// writeReportError maps report service errors to HTTP responses, falling back
+// to writeModerationError for errors from the moderation action.
+func writeReportError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidCategory):
+		apierror.WriteField(w, http.StatusBadRequest, "category", err.Error())
+	case errors.Is(err, services.ErrReportDetailsTooLong):
+		apierror.WriteField(w, http.StatusBadRequest, "details", err.Error())
+	case errors.Is(err, services.ErrInvalidReportAction):
+		apierror.WriteField(w, http.StatusBadRequest, "action", err.Error())
+	case errors.Is(err, services.ErrCannotReportOwn):
+		apierror.Write(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrAlreadyReported),
+		errors.Is(err, services.ErrReportClosed):
+		apierror.Write(w, http.StatusConflict, err.Error())
+	default:
+		writeModerationError(w, err, message)
+	}
+}
@@ -1,11 +1,14 @@
 package handlers
 
 import (
+	"backend/internal/apierror"
 	"backend/internal/middleware"
 	"backend/internal/models"
 	"backend/internal/services"
+	"backend/internal/store"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 )
 
@@ -24,6 +27,11 @@ type CreateRoomRequest struct {
 	Name string `json:"name"`
 }
 
+// InviteMemberRequest defines the expected JSON body for inviting a user to a room.
+type InviteMemberRequest struct {
+	Username string `json:"username"`
+}
+
 // GetRoomsResponse defines the JSON response for listing rooms.
 type GetRoomsResponse struct {
 	Rooms []models.ChatRoom `json:"rooms"`
@@ -34,26 +42,30 @@ func (h *RoomHandler) CreateRoom(w http.ResponseWriter, r *http.Request) {
 	// Get the authenticated user from context
 	user, ok := middleware.GetUserFromContext(r.Context())
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	var req CreateRoomRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	if req.Name == "" {
-		http.Error(w, "Room name is required", http.StatusBadRequest)
+		apierror.WriteField(w, http.StatusBadRequest, "name", "Room name is required")
 		return
 	}
 
 	// Create all new rooms as 'public' by default so all users can see and join them
-	room, err := h.roomService.CreateRoom(req.Name, user.ID, "public")
+	room, err := h.roomService.WithContext(r.Context()).CreateRoom(req.Name, user.ID, "public")
 	if err != nil {
-		log.Printf("Error creating room: %v", err)
-		http.Error(w, "Failed to create room", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "failed to create room", "error", err)
+		if errors.Is(err, store.ErrConflict) {
+			apierror.WriteField(w, http.StatusConflict, "name", "A room with this name already exists")
+		} else {
+			apierror.WriteStore(w, err, "Failed to create room")
+		}
 		return
 	}
 
@@ -67,14 +79,14 @@ func (h *RoomHandler) GetRooms(w http.ResponseWriter, r *http.Request) {
 	// Get the authenticated user from context
 	user, ok := middleware.GetUserFromContext(r.Context())
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	rooms, err := h.roomService.GetRoomsForUser(user.ID)
+	rooms, err := h.roomService.WithContext(r.Context()).GetRoomsForUser(user.ID)
 	if err != nil {
-		log.Printf("Error getting rooms for user %s: %v", user.ID, err)
-		http.Error(w, "Failed to retrieve rooms", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "failed to get rooms", "user_id", user.ID, "error", err)
+		apierror.WriteStore(w, err, "Failed to retrieve rooms")
 		return
 	}
 
@@ -85,3 +97,83 @@ func (h *RoomHandler) GetRooms(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// JoinRoom handles joining a public room or requesting to join a private one.
+func (h *RoomHandler) JoinRoom(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	member, err := h.roomService.WithContext(r.Context()).JoinRoom(r.PathValue("id"), user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to join room", "room", r.PathValue("id"), "user_id", user.ID, "error", err)
+		writeRoomError(w, err, "Failed to join room")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(member)
+}
+
+// InviteMember handles adding another user to a room.
+func (h *RoomHandler) InviteMember(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req InviteMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Username == "" {
+		apierror.WriteField(w, http.StatusBadRequest, "username", "Username is required")
+		return
+	}
+
+	member, err := h.roomService.WithContext(r.Context()).InviteMember(r.PathValue("id"), user.ID, req.Username)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to invite user", "room", r.PathValue("id"), "target", req.Username, "error", err)
+		writeRoomError(w, err, "Failed to invite member")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(member)
+}
+
+// LeaveRoom handles leaving a room.
+func (h *RoomHandler) LeaveRoom(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.roomService.WithContext(r.Context()).LeaveRoom(r.PathValue("id"), user.ID); err != nil {
+		slog.ErrorContext(r.Context(), "failed to leave room", "room", r.PathValue("id"), "user_id", user.ID, "error", err)
+		writeRoomError(w, err, "Failed to leave room")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeRoomError maps room service errors to HTTP responses.
+func writeRoomError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrNotRoomMember):
+		apierror.Write(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, services.ErrBanned), errors.Is(err, services.ErrRoomArchived),
+		errors.Is(err, services.ErrBlocked):
+		apierror.Write(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, services.ErrOwnerCannotLeave):
+		apierror.Write(w, http.StatusConflict, err.Error())
+	default:
+		apierror.WriteStore(w, err, message)
+	}
+}
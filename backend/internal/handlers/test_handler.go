@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"backend/internal/apierror"
 	"backend/internal/models"
 	"backend/internal/store"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 
 	"github.com/google/uuid"
@@ -32,23 +34,10 @@ func (h *TestHandler) getStore() (store.StoreInterface, error) {
 
 // TestRegister is a simplified registration endpoint for testing
 func (h *TestHandler) TestRegister(w http.ResponseWriter, r *http.Request) {
-	log.Println("TestRegister: Received request")
-	
-	// Log request details
-	log.Printf("TestRegister: Method: %s, Content-Type: %s", r.Method, r.Header.Get("Content-Type"))
-	
-	if r.Method == http.MethodOptions {
-		// Handle preflight request
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.WriteHeader(http.StatusOK)
-		return
-	}
+	slog.DebugContext(r.Context(), "test register request received")
 	
 	if r.Method != http.MethodPost {
-		w.Header().Set("Allow", http.MethodPost)
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		apierror.MethodNotAllowed(w, http.MethodPost)
 		return
 	}
 
@@ -59,26 +48,26 @@ func (h *TestHandler) TestRegister(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("TestRegister: Failed to decode request body: %v", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		slog.DebugContext(r.Context(), "test register: invalid request body", "error", err)
+		apierror.Write(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 	
-	log.Printf("TestRegister: Received registration request for username: %s", req.Username)
+	slog.DebugContext(r.Context(), "test register: registering user", "username", req.Username)
 	
 	// Get a reference to the store
 	dbStore, err := h.getStore()
 	if err != nil {
-		log.Printf("TestRegister: Failed to get store: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "test register: store unavailable", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 	
 	// Hash the password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		log.Printf("TestRegister: Failed to hash password: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "test register: failed to hash password", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 	
@@ -92,12 +81,11 @@ func (h *TestHandler) TestRegister(w http.ResponseWriter, r *http.Request) {
 	
 	// Save the user to the database
 	if err := dbStore.CreateUser(user); err != nil {
-		log.Printf("TestRegister: Failed to create user: %v", err)
-		if err.Error() == "UNIQUE constraint failed: users.username" || 
-		   err.Error() == "pq: duplicate key value violates unique constraint \"users_username_key\"" {
-			http.Error(w, "Username already exists", http.StatusConflict)
+		slog.ErrorContext(r.Context(), "test register: failed to create user", "username", req.Username, "error", err)
+		if errors.Is(err, store.ErrConflict) {
+			apierror.WriteField(w, http.StatusConflict, "username", "Username already exists")
 		} else {
-			http.Error(w, "Failed to create user", http.StatusInternalServerError)
+			apierror.WriteStore(w, err, "Failed to create user")
 		}
 		return
 	}
@@ -115,5 +103,5 @@ func (h *TestHandler) TestRegister(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(response)
 	
-	log.Printf("TestRegister: Successfully registered user in database: %s with ID: %s", user.Username, user.ID)
+	slog.InfoContext(r.Context(), "test register: user registered", "username", user.Username, "user_id", user.ID)
 }
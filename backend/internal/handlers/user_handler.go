@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"backend/internal/apierror"
 	"backend/internal/services"
+	"backend/internal/store"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 )
 
@@ -26,37 +29,32 @@ type RegisterRequest struct {
 // Register handles the user registration endpoint.
 func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		w.Header().Set("Allow", http.MethodPost)
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		apierror.MethodNotAllowed(w, http.MethodPost)
 		return
 	}
 
 	var req RegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	if req.Username == "" || req.Password == "" {
-		http.Error(w, "Username and password are required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "Username and password are required")
 		return
 	}
 
-	log.Printf("Attempting to register user: %s", req.Username)
-	user, err := h.userService.RegisterUser(req.Username, req.Password)
+	user, err := h.userService.WithContext(r.Context()).RegisterUser(req.Username, req.Password)
 	if err != nil {
-		// Log the detailed error
-		log.Printf("Failed to register user: %v", err)
-		
+
 		// Check for specific error types
-		if err.Error() == "username already exists" {
-			http.Error(w, "Username already exists. Please choose a different username.", http.StatusConflict) // 409 Conflict
+		if errors.Is(err, store.ErrConflict) {
+			apierror.WriteField(w, http.StatusConflict, "username", "Username already exists. Please choose a different username.")
 		} else {
-			http.Error(w, "Failed to register user: "+err.Error(), http.StatusInternalServerError)
+			apierror.WriteStore(w, err, "Failed to register user")
 		}
 		return
 	}
-	log.Printf("User registered successfully: %s (ID: %s)", user.Username, user.ID)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -81,37 +79,40 @@ type LoginResponse struct {
 // Login handles the user login endpoint.
 func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		w.Header().Set("Allow", http.MethodPost)
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		apierror.MethodNotAllowed(w, http.MethodPost)
 		return
 	}
 
 	var req LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	if req.Username == "" || req.Password == "" {
-		http.Error(w, "Username and password are required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "Username and password are required")
 		return
 	}
 
 	// Authenticate the user
-	log.Printf("Attempting to authenticate user: %s", req.Username)
-	token, err := h.userService.AuthenticateUser(req.Username, req.Password)
+	token, err := h.userService.WithContext(r.Context()).AuthenticateUser(req.Username, req.Password)
 	if err != nil {
-		log.Printf("Authentication failed for user %s: %v", req.Username, err)
-		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		slog.InfoContext(r.Context(), "login failed", "username", req.Username, "error", err)
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			apierror.Write(w, http.StatusUnauthorized, "Invalid username or password")
+		} else if errors.Is(err, services.ErrAccountDisabled) {
+			apierror.Write(w, http.StatusForbidden, "This account has been disabled")
+		} else {
+			apierror.WriteStore(w, err, "Failed to authenticate user")
+		}
 		return
 	}
 
 	// Get the user details from the service
-	log.Printf("Retrieving user details for: %s", req.Username)
-	user, err := h.userService.GetUserByUsername(req.Username)
+	user, err := h.userService.WithContext(r.Context()).GetUserByUsername(req.Username)
 	if err != nil {
-		log.Printf("Failed to retrieve user details for %s: %v", req.Username, err)
-		http.Error(w, "Failed to retrieve user details", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "failed to load user after login", "username", req.Username, "error", err)
+		apierror.WriteStore(w, err, "Failed to retrieve user details")
 		return
 	}
 
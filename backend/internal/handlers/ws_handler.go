@@ -1,323 +1,505 @@
 package handlers
 
 import (
+	"backend/internal/apierror"
+	"backend/internal/config"
+	"backend/internal/contentfilter"
+	"backend/internal/hub"
 	"backend/internal/middleware"
 	"backend/internal/models"
+	"backend/internal/origin"
+	"backend/internal/protocol"
 	"backend/internal/services"
-	"encoding/json"
-	"log"
+	"backend/internal/store"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-// WebSocketHandler handles WebSocket connections for real-time chat.
+// WebSocketHandler serves the WebSocket transport. A connection opened
+// without a room subscribes to rooms with subscribe and unsubscribe frames,
+// and names the room of each message it sends. One opened with a room_id
+// receives that room's events for its whole life, as older clients expect.
+// Clients choose how frames are encoded with the Sec-WebSocket-Protocol
+// header; those that offer no subprotocol speak JSON.
 type WebSocketHandler struct {
-	messageService *services.MessageService
-	clients        map[*Client]bool
-	broadcast      chan *models.Message
-	register       chan *Client
-	unregister     chan *Client
-}
+	hub *hub.Hub
 
-// Client represents a connected WebSocket client.
-type Client struct {
-	hub      *WebSocketHandler
-	conn     *websocket.Conn
-	send     chan []byte
-	user     *models.User
-	roomID   string
-}
+	// Connection limits and timeouts, and the key that signs login tokens
+	settings    *config.WebSocketConfig
+	tokenSecret string
 
-// NewWebSocketHandler creates a new WebSocketHandler.
-func NewWebSocketHandler(messageService *services.MessageService) *WebSocketHandler {
-	return &WebSocketHandler{
-		messageService: messageService,
-		clients:        make(map[*Client]bool),
-		broadcast:      make(chan *models.Message),
-		register:       make(chan *Client),
-		unregister:     make(chan *Client),
-	}
+	// Browser pages may only connect from the origins it allows
+	origins *origin.Policy
+
+	// Clients that keep exceeding the message rate limits are disconnected
+	rateLimits *config.RateLimitConfig
 }
 
-// Run starts the WebSocket hub.
-func (h *WebSocketHandler) Run() {
-	for {
-		select {
-		case client := <-h.register:
-			h.clients[client] = true
-			log.Printf("Client connected: %s in room %s", client.user.Username, client.roomID)
-
-		case client := <-h.unregister:
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-				log.Printf("Client disconnected: %s", client.user.Username)
-			}
+// Client is a WebSocket connection and its hub session. It is the session's
+// hub.Subscriber.
+type Client struct {
+	handler *WebSocketHandler
+	conn    *websocket.Conn
+	session *hub.Session
+	log     *slog.Logger
 
-		case message := <-h.broadcast:
-			// Save message to database
-			err := h.messageService.SaveMessage(message)
-			if err != nil {
-				log.Printf("Error saving message: %v", err)
-				continue
-			}
+	// codec encodes and decodes frames in the negotiated subprotocol
+	codec protocol.Codec
 
-			// Create a DTO to include the sender's username
-			messageDTO := models.MessageDTO{
-				ID:        message.ID,
-				RoomID:    message.RoomID,
-				SenderID:  message.SenderID,
-				Sender:    message.SenderUsername, // This is the key change
-				Content:   message.Content,
-				Timestamp: message.Timestamp,
-			}
+	// send carries room events from the hub, which closes it when it ends
+	// the session, after setting reason
+	send   chan *protocol.Event
+	reason string
 
-			// Broadcast the DTO to all clients in the same room
-			messageJSON, err := json.Marshal(messageDTO)
-			if err != nil {
-				log.Printf("Error marshaling message DTO: %v", err)
-				continue
-			}
+	// direct carries events for this client only, such as errors. Unlike send
+	// it is never closed, so readPump can write to it safely.
+	direct chan *protocol.Event
 
-			for client := range h.clients {
-				if client.roomID == message.RoomID {
-					select {
-					case client.send <- messageJSON:
-					default:
-						close(client.send)
-						delete(h.clients, client)
-					}
-				}
-			}
-		}
+	// violations holds the times of recent rate limit violations
+	violations []time.Time
+}
+
+// NewWebSocketHandler creates a new WebSocketHandler. Clients authenticate
+// with login tokens signed with tokenSecret, and browser pages may only
+// connect from the origins that origins allows.
+func NewWebSocketHandler(h *hub.Hub, settings *config.WebSocketConfig, rateLimits *config.RateLimitConfig, tokenSecret string, origins *origin.Policy) *WebSocketHandler {
+	return &WebSocketHandler{
+		hub:         h,
+		settings:    settings,
+		tokenSecret: tokenSecret,
+		origins:     origins,
+		rateLimits:  rateLimits,
 	}
 }
 
 // ServeWs handles WebSocket requests from clients.
 func (h *WebSocketHandler) ServeWs(w http.ResponseWriter, r *http.Request) {
-	log.Printf("WebSocket connection request received from %s", r.RemoteAddr)
-	
-	// Log headers for debugging
-	log.Printf("Request headers: %v", r.Header)
-	
-	// Get room ID from query parameter
+	// Without a room ID, the client subscribes to rooms after connecting
 	roomID := r.URL.Query().Get("room_id")
-	if roomID == "" {
-		log.Printf("WebSocket connection rejected: missing room_id parameter")
-		http.Error(w, "Room ID is required", http.StatusBadRequest)
+
+	// Clients that offer no subprotocol get JSON, as before subprotocols
+	// were introduced
+	offered := websocket.Subprotocols(r)
+	codec, err := protocol.Negotiate(offered)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, "Unsupported subprotocol, offer one of "+strings.Join(protocol.Subprotocols(), ", "))
 		return
 	}
-	log.Printf("WebSocket connection for room: %s", roomID)
 
-	// Get authenticated user from context
-	user, ok := middleware.GetUserFromContext(r.Context())
+	// Disabled users may not connect, nor banned users to the room
+	session, ok := openSession(w, r, h.hub, h.tokenSecret, roomID, hub.TransportWebSocket)
 	if !ok {
-		// For WebSocket connections, the token might be in the query string
-		token := r.URL.Query().Get("token")
-		if token != "" {
-			log.Printf("WebSocket using token from query parameter (length: %d)", len(token))
-			// Validate the token manually
-			var err error
-			user, err = validateToken(token)
-			if err != nil {
-				log.Printf("Invalid token in WebSocket connection: %v", err)
-				http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
-				return
-			}
-			// Continue with the authenticated user
-			log.Printf("WebSocket authenticated successfully for user: %s (ID: %s)", user.Username, user.ID)
-		} else {
-			log.Printf("WebSocket connection rejected: no token provided")
-			http.Error(w, "Unauthorized: no token provided", http.StatusUnauthorized)
-			return
-		}
-	} else {
-		log.Printf("WebSocket authenticated from context for user: %s", user.Username)
+		return
 	}
 
 	// Upgrade HTTP connection to WebSocket
 	upgrader := websocket.Upgrader{
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
-		// Allow all origins for development
-		CheckOrigin: func(r *http.Request) bool {
-			origin := r.Header.Get("Origin")
-			log.Printf("WebSocket origin: %s", origin)
-			return true // Allow all origins in development
-		},
+		ReadBufferSize:  h.settings.ReadBufferSize,
+		WriteBufferSize: h.settings.WriteBufferSize,
+		// WebSockets are not covered by CORS, so the origin is checked here
+		CheckOrigin:       h.origins.Check,
 		EnableCompression: true,
 	}
+	if len(offered) > 0 {
+		upgrader.Subprotocols = []string{codec.Name()}
+	}
 
-	// Add response headers to help with CORS
-	headers := w.Header()
-	headers.Add("Access-Control-Allow-Origin", "*")
-	headers.Add("Access-Control-Allow-Credentials", "true")
-	headers.Add("Access-Control-Allow-Headers", "content-type, authorization")
-
-	log.Printf("Attempting to upgrade connection to WebSocket")
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("WebSocket upgrade failed: %v", err)
-		http.Error(w, "Could not upgrade connection: "+err.Error(), http.StatusInternalServerError)
+		// The upgrader has already replied with an HTTP error
+		session.Logger().InfoContext(r.Context(), "websocket upgrade failed", "error", err)
 		return
 	}
-	log.Printf("WebSocket connection successfully established")
-	
 
 	// Create new client
 	client := &Client{
-		hub:    h,
-		conn:   conn,
-		send:   make(chan []byte, 256),
-		user:   user,
-		roomID: roomID,
+		handler: h,
+		conn:    conn,
+		session: session,
+		log:     session.Logger(),
+		codec:   codec,
+		send:    make(chan *protocol.Event, h.settings.SendQueueSize),
+		direct:  make(chan *protocol.Event, 16),
 	}
-	client.hub.register <- client
+	h.hub.Register(session, client)
 
 	// Start goroutines for reading and writing messages
 	go client.writePump()
 	go client.readPump()
 }
 
-// readPump pumps messages from the WebSocket connection to the hub.
+// openSession authenticates a request for room events and prepares its
+// session, bound to roomID unless it is empty, answering the request with an
+// error if it is refused. Browsers cannot set headers on WebSocket and
+// EventSource requests, so the token may also be given in the token query
+// parameter.
+func openSession(w http.ResponseWriter, r *http.Request, h *hub.Hub, tokenSecret, roomID, transport string) (*hub.Session, bool) {
+	ctx := r.Context()
+	user, ok := requestUser(w, r, tokenSecret)
+	if !ok {
+		return nil, false
+	}
+
+	var session *hub.Session
+	var err error
+	if roomID == "" {
+		session, err = h.NewSession(ctx, user, transport, r.RemoteAddr)
+	} else {
+		session, err = h.NewRoomSession(ctx, user, roomID, transport, r.RemoteAddr)
+	}
+	if err != nil {
+		slog.InfoContext(ctx, "session refused", "user", user.Username, "room", roomID, "transport", transport, "error", err)
+		if errors.Is(err, services.ErrBanned) || errors.Is(err, services.ErrAccountDisabled) || errors.Is(err, services.ErrNotRoomMember) {
+			apierror.Write(w, http.StatusForbidden, err.Error())
+		} else {
+			apierror.WriteStore(w, err, "Failed to check room access")
+		}
+		return nil, false
+	}
+	return session, true
+}
+
+// requestUser returns the user whose token is in the Authorization header
+// or the token query parameter, answering the request with 401 if there is
+// no valid token.
+func requestUser(w http.ResponseWriter, r *http.Request, tokenSecret string) (*models.User, bool) {
+	if user, ok := middleware.GetUserFromContext(r.Context()); ok {
+		return user, true
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = strings.TrimPrefix(r.URL.Query().Get("token"), "Bearer ")
+	}
+	if token == "" {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized: no token provided")
+		return nil, false
+	}
+	user, err := middleware.ParseToken(token, tokenSecret)
+	if err != nil {
+		slog.InfoContext(r.Context(), "subscription refused: invalid token", "error", err)
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+		return nil, false
+	}
+	return user, true
+}
+
+// Deliver implements hub.Subscriber.
+func (c *Client) Deliver(event *protocol.Event) bool {
+	select {
+	case c.send <- event:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close implements hub.Subscriber. writePump sends the close frame.
+func (c *Client) Close(reason string) {
+	c.reason = reason
+	close(c.send)
+}
+
+// Queued implements hub.Subscriber.
+func (c *Client) Queued() (int, int) {
+	return len(c.send), cap(c.send)
+}
+
+// readPump pumps frames from the WebSocket connection to the hub.
 func (c *Client) readPump() {
 	defer func() {
-		log.Printf("Client %s disconnecting from room %s", c.user.Username, c.roomID)
-		c.hub.unregister <- c
+		c.handler.hub.Unregister(c.session)
 		c.conn.Close()
 	}()
 
 	// Set read parameters
-	c.conn.SetReadLimit(4096) // Max message size
-	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	settings := c.handler.settings
+	c.conn.SetReadLimit(settings.MaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(settings.PongWait))
 	c.conn.SetPongHandler(func(string) error {
-		log.Printf("Received pong from client %s", c.user.Username)
-		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		c.conn.SetReadDeadline(time.Now().Add(settings.PongWait))
 		return nil
 	})
 
 	// Set close handler
 	c.conn.SetCloseHandler(func(code int, text string) error {
-		log.Printf("Client %s closing connection: code=%d, reason=%s", c.user.Username, code, text)
+		c.log.DebugContext(c.session.Context(), "client closing connection", "code", code, "reason", text)
 		message := websocket.FormatCloseMessage(code, "")
 		c.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
 		return nil
 	})
 
-	log.Printf("Started read pump for client %s in room %s", c.user.Username, c.roomID)
-
 	for {
 		_, msgBytes, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("Error reading message from client %s: %v", c.user.Username, err)
+				c.log.WarnContext(c.session.Context(), "unexpected websocket close", "error", err)
 			} else {
-				log.Printf("Client %s connection closed: %v", c.user.Username, err)
+				c.log.DebugContext(c.session.Context(), "websocket closed", "error", err)
 			}
 			break
 		}
-		
-		log.Printf("Received %d bytes from client %s", len(msgBytes), c.user.Username)
 
-		// Parse the message
-		var msgData struct {
-			Content string `json:"content"`
-		}
-		if err := json.Unmarshal(msgBytes, &msgData); err != nil {
-			log.Printf("Error unmarshaling message: %v", err)
+		// Parse the frames; a ref asks for an ack once a message has been saved
+		frames, err := c.codec.DecodeFrames(msgBytes)
+		if err != nil {
+			c.log.DebugContext(c.session.Context(), "ignoring malformed frame", "bytes", len(msgBytes), "error", err)
 			continue
 		}
 
-		// Create a new message
-		message := &models.Message{
-			ID:        services.GenerateUUID(),
-			RoomID:    c.roomID,
-			SenderID:  c.user.ID,
-			Content:   msgData.Content,
-			Timestamp: time.Now(),
+		for _, frame := range frames {
+			switch frame.Type {
+			case "", models.FrameTypeMessage:
+				if !c.handleMessage(frame) {
+					return
+				}
+			case models.FrameTypeSubscribe:
+				c.subscribe(frame)
+			case models.FrameTypeUnsubscribe:
+				c.unsubscribe(frame)
+			default:
+				c.sendEvent(frameError(frame, models.ErrorCodeBadRequest, "Unknown frame type "+strconv.Quote(frame.Type)))
+			}
+		}
+	}
+}
+
+// subscribe handles a subscribe frame. The hub confirms the subscription
+// with a subscribed event; a refusal is answered with an error event.
+func (c *Client) subscribe(frame models.Frame) {
+	switch {
+	case frame.RoomID == "":
+		c.sendEvent(frameError(frame, models.ErrorCodeBadRequest, "roomId is required"))
+		return
+	case c.session.Room() != "":
+		c.sendEvent(frameError(frame, models.ErrorCodeBadRequest, "This connection was opened for one room; connect without room_id to subscribe to rooms"))
+		return
+	case !c.session.Subscribed(frame.RoomID) && len(c.session.Rooms()) >= c.handler.settings.MaxRooms:
+		c.sendEvent(frameError(frame, models.ErrorCodeTooManyRooms, fmt.Sprintf("A connection may subscribe to at most %d rooms", c.handler.settings.MaxRooms)))
+		return
+	}
+
+	// Authorization is checked for every subscription, as for the history
+	ctx := c.session.Context()
+	err := c.handler.hub.Subscribe(ctx, c.session, frame.RoomID)
+	switch {
+	case err == nil:
+	case errors.Is(err, services.ErrBanned) || errors.Is(err, services.ErrAccountDisabled) || errors.Is(err, services.ErrNotRoomMember):
+		c.sendEvent(frameError(frame, models.ErrorCodeForbidden, err.Error()))
+	case errors.Is(err, store.ErrNotFound):
+		c.sendEvent(frameError(frame, models.ErrorCodeNotFound, "Room not found"))
+	default:
+		c.log.ErrorContext(ctx, "failed to check room access", "room", frame.RoomID, "error", err)
+		c.sendEvent(frameError(frame, models.ErrorCodeUnavailable, "Could not subscribe to the room, please try again"))
+	}
+}
+
+// unsubscribe handles an unsubscribe frame. The hub confirms it with an
+// unsubscribed event.
+func (c *Client) unsubscribe(frame models.Frame) {
+	switch {
+	case frame.RoomID == "":
+		c.sendEvent(frameError(frame, models.ErrorCodeBadRequest, "roomId is required"))
+	case c.session.Room() != "":
+		c.sendEvent(frameError(frame, models.ErrorCodeBadRequest, "This connection was opened for one room; close it instead"))
+	default:
+		c.handler.hub.Unsubscribe(c.session, frame.RoomID)
+	}
+}
+
+// frameError describes why a frame was refused.
+func frameError(frame models.Frame, code, message string) models.ErrorEvent {
+	return models.ErrorEvent{Type: models.EventTypeError, Code: code, Message: message, Ref: frame.Ref, RoomID: frame.RoomID}
+}
+
+// handleMessage posts the message in a frame to its room, which the
+// connection must be subscribed to. If the frame has a ref, the client is
+// sent an ack once the message has been saved, and error events about the
+// message carry it. It returns false if the client has been disconnected.
+func (c *Client) handleMessage(frame models.Frame) bool {
+	// A connection opened for one room may leave the room out
+	if frame.RoomID == "" {
+		frame.RoomID = c.session.Room()
+	}
+	switch {
+	case frame.RoomID == "":
+		c.sendEvent(frameError(frame, models.ErrorCodeBadRequest, "roomId is required"))
+		return true
+	case !c.session.Subscribed(frame.RoomID):
+		c.sendEvent(frameError(frame, models.ErrorCodeNotSubscribed, "Subscribe to the room before sending messages to it"))
+		return true
+	}
+
+	message, err := c.handler.hub.Post(c.session.Context(), c.session.User, frame.RoomID, frame.Content)
+	var limited *hub.RateLimitError
+	switch {
+	case err == nil:
+		if frame.Ref != "" {
+			c.sendEvent(models.AckEvent{
+				Type:      models.EventTypeAck,
+				Ref:       frame.Ref,
+				ID:        message.ID,
+				RoomID:    message.RoomID,
+				Timestamp: message.Timestamp,
+			})
+		}
+	case errors.As(err, &limited) && c.recordViolation(time.Now()):
+		c.log.WarnContext(c.session.Context(), "disconnecting client for repeatedly exceeding the rate limit")
+		c.closeWith(websocket.ClosePolicyViolation, "rate limit exceeded")
+		return false
+	case errors.Is(err, services.ErrBanned) && c.session.Room() != "":
+		c.closeWith(websocket.ClosePolicyViolation, "You are banned from this room")
+		return false
+	default:
+		event := errorEvent(err, frame.Ref)
+		event.RoomID = frame.RoomID
+		c.sendEvent(event)
+	}
+	return true
+}
+
+// errorEvent describes why the hub refused a message, in the form sent to
+// clients. ref is the ref of the client's frame, if any.
+func errorEvent(err error, ref string) models.ErrorEvent {
+	event := models.ErrorEvent{Type: models.EventTypeError, Ref: ref}
+	var limited *hub.RateLimitError
+	var muted *services.MutedError
+	var filtered *hub.FilterError
+	switch {
+	case errors.As(err, &limited):
+		event.Code = models.ErrorCodeRateLimited
+		event.Message = fmt.Sprintf("Too many messages, retry in %s", limited.RetryAfter.Round(time.Millisecond))
+		event.RetryAfterMs = limited.RetryAfter.Milliseconds() + 1
+	case errors.As(err, &muted):
+		event.Code = models.ErrorCodeMuted
+		event.Message = muted.Error()
+		event.RetryAfterMs = time.Until(muted.Until).Milliseconds() + 1
+	case errors.Is(err, services.ErrRoomArchived):
+		event.Code = models.ErrorCodeRoomArchived
+		event.Message = err.Error()
+	case errors.Is(err, services.ErrBanned) || errors.Is(err, services.ErrNotRoomMember):
+		event.Code = models.ErrorCodeForbidden
+		event.Message = err.Error()
+	case errors.As(err, &filtered) && filtered.Verdict == contentfilter.Hold:
+		event.Code = models.ErrorCodeMessageHeld
+		event.Message = "Your message is waiting for a moderator to review it: " + filtered.Reason
+	case errors.As(err, &filtered):
+		event.Code = models.ErrorCodeMessageRejected
+		event.Message = "Your message was not sent: " + filtered.Reason
+	default:
+		event.Code = models.ErrorCodeUnavailable
+		event.Message = "Your message could not be sent, please try again"
+	}
+	return event
+}
+
+// recordViolation notes a rate limit violation at now and reports whether the
+// client has now exceeded the allowed number within the violation window.
+func (c *Client) recordViolation(now time.Time) bool {
+	limits := c.handler.rateLimits
+	if limits.MaxViolations <= 0 {
+		return false
+	}
+
+	cutoff := now.Add(-limits.ViolationWindow)
+	recent := c.violations[:0]
+	for _, t := range c.violations {
+		if t.After(cutoff) {
+			recent = append(recent, t)
 		}
+	}
+	c.violations = append(recent, now)
+	return len(c.violations) > limits.MaxViolations
+}
 
-		// Add sender's username to the message before broadcasting
-		message.SenderUsername = c.user.Username
+// closeWith sends a close frame with the given code and reason, and drops the
+// connection if the client does not complete the closing handshake in time.
+func (c *Client) closeWith(code int, reason string) {
+	// Control frame payloads are limited to 125 bytes, two of which hold the code
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	time.AfterFunc(c.handler.settings.CloseGracePeriod, func() { c.conn.Close() })
+}
 
-		// Send to broadcast channel
-		c.hub.broadcast <- message
+// sendEvent queues an event for this client only. It is dropped if the client is not keeping up.
+func (c *Client) sendEvent(value interface{}) {
+	event, err := protocol.NewEvent(value)
+	if err != nil {
+		c.log.ErrorContext(c.session.Context(), "failed to encode event", "error", err)
+		return
+	}
+	select {
+	case c.direct <- event:
+	default:
+		c.log.WarnContext(c.session.Context(), "dropping event for slow client")
 	}
 }
 
 // writePump pumps messages from the hub to the WebSocket connection.
 func (c *Client) writePump() {
-	ticker := time.NewTicker(30 * time.Second) // Send pings to client every 30 seconds
-	defer func() {
-		log.Printf("Stopping write pump for client %s in room %s", c.user.Username, c.roomID)
-		ticker.Stop()
-		c.conn.Close()
-	}()
-
-	log.Printf("Started write pump for client %s in room %s", c.user.Username, c.roomID)
+	settings := c.handler.settings
+	ticker := time.NewTicker(settings.PingPeriod)
+	defer ticker.Stop()
 
 	for {
 		select {
-		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		case event, ok := <-c.send:
 			if !ok {
-				// The hub closed the channel
-				log.Printf("Hub closed channel for client %s, sending close message", c.user.Username)
-				err := c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
-				if err != nil {
-					log.Printf("Error sending close message to client %s: %v", c.user.Username, err)
+				// The hub ended the session: a reason means the user was
+				// disconnected, such as by a ban
+				c.conn.SetWriteDeadline(time.Now().Add(settings.WriteWait))
+				if c.reason != "" {
+					c.closeWith(websocket.ClosePolicyViolation, c.reason)
+				} else {
+					c.closeWith(websocket.CloseNormalClosure, "")
 				}
 				return
 			}
 
-			log.Printf("Sending %d bytes to client %s", len(message), c.user.Username)
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				log.Printf("Error getting writer for client %s: %v", c.user.Username, err)
-				return
+			// Codecs that batch add the queued events to the same message.
+			// JSON sends one event per message, so that clients can parse
+			// each message as it is.
+			message := c.codec.AppendEvent(nil, event)
+			if c.codec.Batches() {
+				for n := len(c.send); n > 0; n-- {
+					message = c.codec.AppendEvent(message, <-c.send)
+				}
 			}
-			
-			_, err = w.Write(message)
-			if err != nil {
-				log.Printf("Error writing message to client %s: %v", c.user.Username, err)
+			if !c.write(message) {
 				return
 			}
 
-			// Add queued messages
-			n := len(c.send)
-			if n > 0 {
-				log.Printf("Sending %d additional queued messages to client %s", n, c.user.Username)
-			}
-			
-			for i := 0; i < n; i++ {
-				_, err := w.Write([]byte{'\n'})
-				if err != nil {
-					log.Printf("Error writing newline to client %s: %v", c.user.Username, err)
-					return
-				}
-				
-				_, err = w.Write(<-c.send)
-				if err != nil {
-					log.Printf("Error writing queued message to client %s: %v", c.user.Username, err)
-					return
-				}
-			}
-
-			if err := w.Close(); err != nil {
-				log.Printf("Error closing writer for client %s: %v", c.user.Username, err)
+		case event := <-c.direct:
+			if !c.write(c.codec.AppendEvent(nil, event)) {
 				return
 			}
 
 		case <-ticker.C:
-			log.Printf("Sending ping to client %s", c.user.Username)
-			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			c.conn.SetWriteDeadline(time.Now().Add(settings.WriteWait))
 			if err := c.conn.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
-				log.Printf("Error sending ping to client %s: %v", c.user.Username, err)
+				c.log.DebugContext(c.session.Context(), "failed to send ping", "error", err)
+				c.conn.Close()
 				return
 			}
-			log.Printf("Ping sent successfully to client %s", c.user.Username)
 		}
 	}
 }
+
+// write sends one message, closing the connection if it cannot be written.
+func (c *Client) write(message []byte) bool {
+	c.conn.SetWriteDeadline(time.Now().Add(c.handler.settings.WriteWait))
+	if err := c.conn.WriteMessage(c.codec.MessageType(), message); err != nil {
+		c.log.DebugContext(c.session.Context(), "failed to write message", "error", err)
+		c.conn.Close()
+		return false
+	}
+	return true
+}
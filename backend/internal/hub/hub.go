@@ -0,0 +1,490 @@
+// Package hub delivers each room's live events to the sessions subscribed
+// to it, and takes in the messages users send. It does not know about
+// transports: WebSocket connections, event streams and long-poll queues
+// register sessions through the Subscriber interface.
+package hub
+
+import (
+	"backend/internal/config"
+	"backend/internal/metrics"
+	"backend/internal/models"
+	"backend/internal/protocol"
+	"backend/internal/ratelimit"
+	"backend/internal/services"
+	"backend/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrRoomSession is returned by Subscribe for a session opened with
+// NewRoomSession, which cannot change rooms.
+var ErrRoomSession = errors.New("session is bound to one room")
+
+// Hub holds the sessions and their subscriptions to rooms. A single Run loop
+// owns them, and the other methods talk to it over channels.
+type Hub struct {
+	messageService *services.MessageService
+	sessionSet     map[*Session]bool
+	broadcast      chan inboundMessage
+	publish        chan *models.Message // already saved, only delivered
+	roomEvents     chan roomEvent
+	register       chan *Session
+	unregister     chan *Session
+	subscriptions  chan subscriptionChange
+	disconnect     chan disconnectRequest
+	sessions       chan chan []models.Session
+	status         chan chan models.HubStatus
+	pings          chan chan struct{}
+	blocks         chan blockUpdate
+
+	// Flood control for incoming messages
+	userLimiter *ratelimit.Limiter // keyed by user ID
+	roomLimiter *ratelimit.Limiter // keyed by room ID
+}
+
+// subscriptionChange subscribes a session to a room, or unsubscribes it.
+type subscriptionChange struct {
+	session    *Session
+	roomID     string
+	subscribed bool
+}
+
+// disconnectRequest asks the hub to end every session that matches, or if
+// roomID is set, to remove the matching sessions from that room. If done is
+// not nil, the number of sessions affected is sent on it.
+type disconnectRequest struct {
+	match  func(s *Session) bool
+	roomID string
+	reason string
+	done   chan int
+}
+
+// blockUpdate tells the hub that a user has blocked or unblocked another.
+type blockUpdate struct {
+	blockerID string
+	blockedID string
+	blocked   bool
+}
+
+// inboundMessage is a message on its way to be saved and delivered. The
+// hub sends the outcome on result.
+type inboundMessage struct {
+	ctx     context.Context
+	message *models.Message
+	result  chan error
+}
+
+// roomEvent is an encoded event for every session subscribed to a room.
+type roomEvent struct {
+	roomID string
+	event  *protocol.Event
+}
+
+// New creates a Hub that saves messages with messageService and throttles
+// them as rateLimits says. Run must be started before it is used.
+func New(messageService *services.MessageService, rateLimits *config.RateLimitConfig) *Hub {
+	return &Hub{
+		messageService: messageService,
+		sessionSet:     make(map[*Session]bool),
+		broadcast:      make(chan inboundMessage),
+		publish:        make(chan *models.Message),
+		roomEvents:     make(chan roomEvent),
+		register:       make(chan *Session),
+		unregister:     make(chan *Session),
+		subscriptions:  make(chan subscriptionChange),
+		disconnect:     make(chan disconnectRequest),
+		sessions:       make(chan chan []models.Session),
+		status:         make(chan chan models.HubStatus),
+		pings:          make(chan chan struct{}),
+		blocks:         make(chan blockUpdate),
+		userLimiter:    ratelimit.New(rateLimits.UserMessageRate, rateLimits.UserMessageBurst),
+		roomLimiter:    ratelimit.New(rateLimits.RoomMessageRate, rateLimits.RoomMessageBurst),
+	}
+}
+
+// Register starts delivering the session's events to subscriber. The
+// session must come from NewSession or NewRoomSession.
+func (h *Hub) Register(s *Session, subscriber Subscriber) {
+	s.subscriber = subscriber
+	h.register <- s
+}
+
+// Unregister ends a session and closes its subscriber, unless the hub has
+// already ended it.
+func (h *Hub) Unregister(s *Session) {
+	h.unregister <- s
+}
+
+// Subscribe checks that the session's user may receive the room's events,
+// and subscribes the registered session to them. The subscriber is sent a
+// SubscriptionEvent before the room's first event, even if the session was
+// already subscribed. It returns ErrRoomSession, or the errors of
+// services.MessageService.CheckCanView.
+func (h *Hub) Subscribe(ctx context.Context, s *Session, roomID string) error {
+	if s.room != "" {
+		return ErrRoomSession
+	}
+	if err := h.messageService.WithContext(ctx).CheckCanView(roomID, s.User.ID); err != nil {
+		return err
+	}
+	h.subscriptions <- subscriptionChange{session: s, roomID: roomID, subscribed: true}
+	return nil
+}
+
+// Unsubscribe stops delivering the room's events to a session opened with
+// NewSession. The subscriber is sent a SubscriptionEvent after the room's
+// last event.
+func (h *Hub) Unsubscribe(s *Session, roomID string) {
+	h.subscriptions <- subscriptionChange{session: s, roomID: roomID}
+}
+
+// Run starts the hub.
+func (h *Hub) Run() {
+	for {
+		// Each event is timed from when it is received until it has been handled
+		var event string
+		var start time.Time
+
+		select {
+		case s := <-h.register:
+			event, start = "register", time.Now()
+			h.sessionSet[s] = true
+			metrics.Subscribers.Add(float64(len(s.rooms)), s.Transport)
+			s.log.InfoContext(s.ctx, "session connected")
+
+		case s := <-h.unregister:
+			event, start = "unregister", time.Now()
+			if h.sessionSet[s] {
+				h.remove(s, "")
+				s.log.InfoContext(s.ctx, "session disconnected")
+			}
+
+		case change := <-h.subscriptions:
+			event, start = "subscribe", time.Now()
+			s := change.session
+			if !h.sessionSet[s] {
+				// The session ended while the change was on its way
+				break
+			}
+			if change.subscribed {
+				if s.setSubscribed(change.roomID, true) {
+					metrics.Subscribers.Add(1, s.Transport)
+					s.log.InfoContext(s.ctx, "subscribed to room", "room", change.roomID)
+				}
+				h.notify(s, models.EventTypeSubscribed, change.roomID, "")
+			} else {
+				if s.setSubscribed(change.roomID, false) {
+					metrics.Subscribers.Add(-1, s.Transport)
+					s.log.InfoContext(s.ctx, "unsubscribed from room", "room", change.roomID)
+				}
+				h.notify(s, models.EventTypeUnsubscribed, change.roomID, "")
+			}
+
+		case req := <-h.disconnect:
+			event, start = "disconnect", time.Now()
+			affected := 0
+			for s := range h.sessionSet {
+				if !req.match(s) {
+					continue
+				}
+				if req.roomID == "" {
+					s.log.InfoContext(s.ctx, "disconnecting session", "reason", req.reason)
+					h.remove(s, req.reason)
+					affected++
+				} else if s.rooms[req.roomID] {
+					s.log.InfoContext(s.ctx, "removing session from room", "room", req.roomID, "reason", req.reason)
+					h.leave(s, req.roomID, req.reason)
+					affected++
+				}
+			}
+			if req.done != nil {
+				req.done <- affected
+			}
+
+		case reply := <-h.sessions:
+			event, start = "sessions", time.Now()
+			sessions := make([]models.Session, 0, len(h.sessionSet))
+			for s := range h.sessionSet {
+				sessions = append(sessions, s.describe())
+			}
+			reply <- sessions
+
+		case reply := <-h.status:
+			event, start = "status", time.Now()
+			reply <- h.snapshot()
+
+		case reply := <-h.pings:
+			event, start = "ping", time.Now()
+			close(reply)
+
+		case in := <-h.broadcast:
+			event, start = "broadcast", time.Now()
+			// Save message to database
+			err := h.messageService.WithContext(in.ctx).SaveMessage(in.message)
+			if err == nil {
+				h.deliver(in.ctx, in.message)
+			}
+			in.result <- err
+
+		case message := <-h.publish:
+			event, start = "publish", time.Now()
+			h.deliver(context.Background(), message)
+
+		case roomEvent := <-h.roomEvents:
+			event, start = "room_event", time.Now()
+			h.sendToRoom(roomEvent.roomID, roomEvent.event, "")
+
+		case update := <-h.blocks:
+			event, start = "block", time.Now()
+			for s := range h.sessionSet {
+				if s.User.ID == update.blockerID {
+					if update.blocked {
+						s.blocked[update.blockedID] = true
+					} else {
+						delete(s.blocked, update.blockedID)
+					}
+				}
+			}
+		}
+
+		metrics.HubEventDuration.Observe(time.Since(start).Seconds(), event)
+	}
+}
+
+// snapshot describes the sessions by room. It must only be called from Run.
+func (h *Hub) snapshot() models.HubStatus {
+	rooms := make(map[string]*models.HubRoom)
+	for s := range h.sessionSet {
+		queued, capacity := s.subscriber.Queued()
+		client := models.HubClient{
+			Session:       s.describe(),
+			Queued:        queued,
+			QueueCapacity: capacity,
+		}
+		for roomID := range s.rooms {
+			room, ok := rooms[roomID]
+			if !ok {
+				room = &models.HubRoom{RoomID: roomID}
+				rooms[roomID] = room
+			}
+			room.Clients++
+			room.Sessions = append(room.Sessions, client)
+		}
+	}
+
+	status := models.HubStatus{Clients: len(h.sessionSet), Rooms: make([]models.HubRoom, 0, len(rooms))}
+	for _, room := range rooms {
+		status.Rooms = append(status.Rooms, *room)
+	}
+	return status
+}
+
+// remove forgets a session and closes its subscriber with reason. It must
+// only be called from Run.
+func (h *Hub) remove(s *Session, reason string) {
+	delete(h.sessionSet, s)
+	s.subscriber.Close(reason)
+	metrics.Subscribers.Add(-float64(len(s.rooms)), s.Transport)
+}
+
+// leave removes a session from a room, telling it reason. A session bound
+// to the room ends. It must only be called from Run.
+func (h *Hub) leave(s *Session, roomID, reason string) {
+	if s.room != "" {
+		h.remove(s, reason)
+		return
+	}
+	if s.setSubscribed(roomID, false) {
+		metrics.Subscribers.Add(-1, s.Transport)
+	}
+	h.notify(s, models.EventTypeUnsubscribed, roomID, reason)
+}
+
+// notify sends a session a SubscriptionEvent. It must only be called from
+// Run.
+func (h *Hub) notify(s *Session, eventType, roomID, reason string) {
+	event, err := protocol.NewEvent(models.SubscriptionEvent{Type: eventType, RoomID: roomID, Reason: reason})
+	if err != nil {
+		s.log.ErrorContext(s.ctx, "failed to encode subscription event", "room", roomID, "error", err)
+		return
+	}
+	h.deliverTo(s, event)
+}
+
+// deliverTo queues an event for a session, dropping the session if it is
+// not keeping up. It reports whether the event was queued, and must only be
+// called from Run.
+func (h *Hub) deliverTo(s *Session, event *protocol.Event) bool {
+	if s.subscriber.Deliver(event) {
+		return true
+	}
+	s.log.WarnContext(s.ctx, "dropping session that is not keeping up")
+	h.remove(s, "")
+	metrics.SendBufferDrops.Inc()
+	return false
+}
+
+// deliver sends a saved message to every session subscribed to its room,
+// tracing the fan-out as part of ctx. It must only be called from Run.
+func (h *Hub) deliver(ctx context.Context, message *models.Message) {
+	_, span := tracing.Start(ctx, "hub.fanout", trace.WithAttributes(attribute.String("chat.room", message.RoomID), attribute.String("chat.message_id", message.ID)))
+	defer span.End()
+
+	// Create a DTO to include the sender's username
+	messageDTO := models.NewMessageDTO(message)
+
+	// Broadcast the DTO to all sessions subscribed to the same room, encoded
+	// once for all of them
+	event, err := protocol.NewEvent(messageDTO)
+	if err != nil {
+		slog.Error("failed to encode message", "message_id", message.ID, "error", err)
+		tracing.RecordError(span, err)
+		return
+	}
+	recipients := h.sendToRoom(message.RoomID, event, message.SenderID)
+	span.SetAttributes(attribute.Int("chat.recipients", recipients))
+	metrics.MessagesBroadcast.Inc()
+}
+
+// sendToRoom queues an event for every session subscribed to the room,
+// dropping sessions that are not keeping up. If senderID is not empty,
+// sessions that have blocked the sender are skipped. It returns how many
+// sessions the event was queued for, and must only be called from Run.
+func (h *Hub) sendToRoom(roomID string, event *protocol.Event, senderID string) int {
+	queued := 0
+	for s := range h.sessionSet {
+		if s.rooms[roomID] && !s.blocked[senderID] && h.deliverTo(s, event) {
+			queued++
+		}
+	}
+	return queued
+}
+
+// PublishMessage delivers a message that has already been saved, such as an
+// approved held message, to every session subscribed to its room.
+func (h *Hub) PublishMessage(message *models.Message) {
+	h.publish <- message
+}
+
+// PublishDeletion tells every session subscribed to the room that a message
+// was deleted.
+func (h *Hub) PublishDeletion(roomID, messageID string) {
+	event, err := protocol.NewEvent(models.MessageDeletedEvent{
+		Type:   models.EventTypeMessageDeleted,
+		ID:     messageID,
+		RoomID: roomID,
+	})
+	if err != nil {
+		slog.Error("failed to encode message deletion", "message_id", messageID, "error", err)
+		return
+	}
+	h.roomEvents <- roomEvent{roomID: roomID, event: event}
+}
+
+// SetBlocked updates the block lists of the blocker's sessions, so that
+// messages from a newly blocked user stop arriving at once.
+func (h *Hub) SetBlocked(blockerID, blockedID string, blocked bool) {
+	h.blocks <- blockUpdate{blockerID: blockerID, blockedID: blockedID, blocked: blocked}
+}
+
+// DisconnectUser removes the user's sessions from the room, telling them
+// reason. Sessions bound to the room end.
+func (h *Hub) DisconnectUser(roomID, userID, reason string) {
+	h.disconnect <- disconnectRequest{
+		match:  func(s *Session) bool { return s.User.ID == userID },
+		roomID: roomID,
+		reason: reason,
+	}
+}
+
+// DisconnectUserEverywhere ends every session the user has.
+func (h *Hub) DisconnectUserEverywhere(userID, reason string) {
+	h.disconnect <- disconnectRequest{
+		match:  func(s *Session) bool { return s.User.ID == userID },
+		reason: reason,
+	}
+}
+
+// DisconnectRoom removes every session from the room. Sessions bound to the
+// room end.
+func (h *Hub) DisconnectRoom(roomID, reason string) {
+	h.disconnect <- disconnectRequest{
+		match:  func(s *Session) bool { return true },
+		roomID: roomID,
+		reason: reason,
+	}
+}
+
+// DisconnectAll ends every session without a reason, so that clients
+// reconnect, as when the server shuts down. It returns how many there were.
+func (h *Hub) DisconnectAll() int {
+	done := make(chan int, 1)
+	h.disconnect <- disconnectRequest{
+		match: func(s *Session) bool { return true },
+		done:  done,
+	}
+	return <-done
+}
+
+// DisconnectSession ends the session with the given ID. It reports whether
+// there was one.
+func (h *Hub) DisconnectSession(sessionID, reason string) bool {
+	done := make(chan int, 1)
+	h.disconnect <- disconnectRequest{
+		match:  func(s *Session) bool { return s.ID == sessionID },
+		reason: reason,
+		done:   done,
+	}
+	return <-done > 0
+}
+
+// Status returns a snapshot of the hub's rooms and sessions, busiest room
+// first. It fails if the hub does not answer before ctx is done.
+func (h *Hub) Status(ctx context.Context) (models.HubStatus, error) {
+	reply := make(chan models.HubStatus, 1)
+	select {
+	case h.status <- reply:
+	case <-ctx.Done():
+		return models.HubStatus{}, fmt.Errorf("hub did not respond: %w", ctx.Err())
+	}
+	status := <-reply
+	sort.Slice(status.Rooms, func(i, j int) bool {
+		if status.Rooms[i].Clients != status.Rooms[j].Clients {
+			return status.Rooms[i].Clients > status.Rooms[j].Clients
+		}
+		return status.Rooms[i].RoomID < status.Rooms[j].RoomID
+	})
+	for _, room := range status.Rooms {
+		sort.Slice(room.Sessions, func(i, j int) bool { return room.Sessions[i].ConnectedAt.Before(room.Sessions[j].ConnectedAt) })
+	}
+	return status, nil
+}
+
+// Ping checks that the hub's Run loop is handling events, by sending it a
+// request and waiting for the answer until ctx is done.
+func (h *Hub) Ping(ctx context.Context) error {
+	reply := make(chan struct{})
+	select {
+	case h.pings <- reply:
+	case <-ctx.Done():
+		return fmt.Errorf("hub did not respond: %w", ctx.Err())
+	}
+	<-reply
+	return nil
+}
+
+// Sessions lists the sessions currently registered with the hub.
+func (h *Hub) Sessions() []models.Session {
+	reply := make(chan []models.Session, 1)
+	h.sessions <- reply
+	sessions := <-reply
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ConnectedAt.Before(sessions[j].ConnectedAt) })
+	return sessions
+}
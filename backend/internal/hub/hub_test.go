@@ -0,0 +1,443 @@
+package hub
+
+import (
+	"backend/internal/config"
+	"backend/internal/models"
+	"backend/internal/protocol"
+	"backend/internal/services"
+	"backend/internal/store"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSubscriber records what the hub gives it.
+type fakeSubscriber struct {
+	capacity int
+
+	mu     sync.Mutex
+	events [][]byte
+	closed bool
+	reason string
+}
+
+func (f *fakeSubscriber) Deliver(event *protocol.Event) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.events) >= f.capacity {
+		return false
+	}
+	f.events = append(f.events, event.JSON())
+	return true
+}
+
+func (f *fakeSubscriber) Close(reason string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	f.reason = reason
+}
+
+func (f *fakeSubscriber) Queued() (int, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.events), f.capacity
+}
+
+// messages decodes the messages delivered so far.
+func (f *fakeSubscriber) messages(t *testing.T) []models.MessageDTO {
+	t.Helper()
+	var messages []models.MessageDTO
+	for _, event := range f.decode(t) {
+		if event.Type == models.EventTypeMessage {
+			var message models.MessageDTO
+			json.Unmarshal(event.raw, &message)
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// subscriptionEvents decodes the subscription events delivered so far.
+func (f *fakeSubscriber) subscriptionEvents(t *testing.T) []models.SubscriptionEvent {
+	t.Helper()
+	var events []models.SubscriptionEvent
+	for _, event := range f.decode(t) {
+		if event.Type == models.EventTypeSubscribed || event.Type == models.EventTypeUnsubscribed {
+			var subscription models.SubscriptionEvent
+			json.Unmarshal(event.raw, &subscription)
+			events = append(events, subscription)
+		}
+	}
+	return events
+}
+
+// decode reads the type of each event delivered so far.
+func (f *fakeSubscriber) decode(t *testing.T) []typedEvent {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	events := make([]typedEvent, len(f.events))
+	for i, event := range f.events {
+		if err := json.Unmarshal(event, &events[i]); err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
+		events[i].raw = event
+	}
+	return events
+}
+
+// typedEvent is an event with its type read.
+type typedEvent struct {
+	Type string `json:"type"`
+	raw  []byte
+}
+
+// testHub is a running hub on a memory store with one public room.
+type testHub struct {
+	*Hub
+	store *store.MemoryStore
+	owner *models.User
+	room  *models.ChatRoom
+}
+
+func newTestHub(t *testing.T, limits config.RateLimitConfig) *testHub {
+	t.Helper()
+	mem := store.NewMemoryStore()
+	owner := newTestUser(t, mem, "owner")
+	room, err := services.NewRoomService(mem).CreateRoom("lobby", owner.ID, "public")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	h := New(services.NewMessageService(mem), &limits)
+	go h.Run()
+	return &testHub{Hub: h, store: mem, owner: owner, room: room}
+}
+
+func newTestUser(t *testing.T, s store.StoreInterface, username string) *models.User {
+	t.Helper()
+	user := &models.User{ID: services.GenerateUUID(), Username: username, Password: "hash"}
+	if err := s.CreateUser(user); err != nil {
+		t.Fatalf("CreateUser(%q): %v", username, err)
+	}
+	return user
+}
+
+// member creates a user who has joined the hub's room.
+func (h *testHub) member(t *testing.T, username string) *models.User {
+	t.Helper()
+	user := newTestUser(t, h.store, username)
+	if _, err := services.NewRoomService(h.store).JoinRoom(h.room.ID, user.ID); err != nil {
+		t.Fatalf("JoinRoom(%s): %v", username, err)
+	}
+	return user
+}
+
+// roomSession registers a session bound to the room with a fake subscriber.
+func (h *testHub) roomSession(t *testing.T, user *models.User, transport string, capacity int) (*Session, *fakeSubscriber) {
+	t.Helper()
+	s, err := h.NewRoomSession(context.Background(), user, h.room.ID, transport, "192.0.2.1:1234")
+	if err != nil {
+		t.Fatalf("NewRoomSession(%s): %v", user.Username, err)
+	}
+	fake := &fakeSubscriber{capacity: capacity}
+	h.Register(s, fake)
+	return s, fake
+}
+
+// session registers a WebSocket session with no rooms and a fake subscriber.
+func (h *testHub) session(t *testing.T, user *models.User) (*Session, *fakeSubscriber) {
+	t.Helper()
+	s, err := h.NewSession(context.Background(), user, TransportWebSocket, "192.0.2.1:1234")
+	if err != nil {
+		t.Fatalf("NewSession(%s): %v", user.Username, err)
+	}
+	fake := &fakeSubscriber{capacity: 8}
+	h.Register(s, fake)
+	return s, fake
+}
+
+// createRoom creates another room owned by the hub's room owner.
+func (h *testHub) createRoom(t *testing.T, name, roomType string) *models.ChatRoom {
+	t.Helper()
+	room, err := services.NewRoomService(h.store).CreateRoom(name, h.owner.ID, roomType)
+	if err != nil {
+		t.Fatalf("CreateRoom(%q): %v", name, err)
+	}
+	return room
+}
+
+func TestPostDeliversToEveryTransport(t *testing.T) {
+	h := newTestHub(t, config.Default().RateLimit)
+	alice := h.member(t, "alice")
+	bob := newTestUser(t, h.store, "bob")
+	carol := newTestUser(t, h.store, "carol")
+	if _, err := services.NewBlockService(h.store, h).Block(carol.ID, "alice"); err != nil {
+		t.Fatalf("Block: %v", err)
+	}
+
+	_, toAlice := h.roomSession(t, alice, TransportWebSocket, 8)
+	_, toBob := h.roomSession(t, bob, TransportSSE, 8)
+	_, toCarol := h.roomSession(t, carol, TransportPoll, 8)
+
+	message, err := h.Post(context.Background(), alice, h.room.ID, "hello")
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	if message.SenderUsername != "alice" || message.Content != "hello" {
+		t.Errorf("Post returned %+v", message)
+	}
+
+	// The sender sees their own message; carol has blocked alice
+	for name, fake := range map[string]*fakeSubscriber{"alice": toAlice, "bob": toBob} {
+		got := fake.messages(t)
+		if len(got) != 1 || got[0].ID != message.ID || got[0].Sender != "alice" {
+			t.Errorf("%s received %+v", name, got)
+		}
+	}
+	if got := toCarol.messages(t); len(got) != 0 {
+		t.Errorf("carol received %+v from a blocked user", got)
+	}
+
+	saved, err := h.store.GetMessagesByRoom(h.room.ID)
+	if err != nil || len(saved) != 1 || saved[0].ID != message.ID {
+		t.Fatalf("saved messages = %+v, %v", saved, err)
+	}
+}
+
+func TestSessionsReportTransport(t *testing.T) {
+	h := newTestHub(t, config.Default().RateLimit)
+	alice := newTestUser(t, h.store, "alice")
+	s, fake := h.roomSession(t, alice, TransportSSE, 8)
+
+	sessions := h.Sessions()
+	if len(sessions) != 1 || sessions[0].ID != s.ID || sessions[0].Transport != TransportSSE || sessions[0].Username != "alice" ||
+		len(sessions[0].Rooms) != 1 || sessions[0].Rooms[0] != h.room.ID {
+		t.Fatalf("Sessions = %+v", sessions)
+	}
+
+	h.Unregister(s)
+	if sessions := h.Sessions(); len(sessions) != 0 {
+		t.Fatalf("Sessions after Unregister = %+v", sessions)
+	}
+	if !fake.closed || fake.reason != "" {
+		t.Errorf("closed %v with reason %q, want closed without a reason", fake.closed, fake.reason)
+	}
+
+	// Unregistering again is harmless
+	h.Unregister(s)
+}
+
+func TestDisconnectUserGivesReason(t *testing.T) {
+	h := newTestHub(t, config.Default().RateLimit)
+	alice := newTestUser(t, h.store, "alice")
+	bob := newTestUser(t, h.store, "bob")
+	_, toAlice := h.roomSession(t, alice, TransportWebSocket, 8)
+	_, toBob := h.roomSession(t, bob, TransportPoll, 8)
+
+	h.DisconnectUser(h.room.ID, bob.ID, "You were kicked from the room")
+	// Sessions is answered after the disconnect has been handled
+	if sessions := h.Sessions(); len(sessions) != 1 || sessions[0].UserID != alice.ID {
+		t.Fatalf("Sessions = %+v", sessions)
+	}
+	if !toBob.closed || toBob.reason != "You were kicked from the room" {
+		t.Errorf("bob closed %v with reason %q", toBob.closed, toBob.reason)
+	}
+	if toAlice.closed {
+		t.Error("alice was disconnected too")
+	}
+}
+
+func TestDisconnectAllLetsClientsReconnect(t *testing.T) {
+	h := newTestHub(t, config.Default().RateLimit)
+	alice := newTestUser(t, h.store, "alice")
+	bob := newTestUser(t, h.store, "bob")
+	_, toAlice := h.roomSession(t, alice, TransportWebSocket, 8)
+	_, toBob := h.roomSession(t, bob, TransportSSE, 8)
+
+	if n := h.DisconnectAll(); n != 2 {
+		t.Fatalf("DisconnectAll = %d, want 2", n)
+	}
+	if sessions := h.Sessions(); len(sessions) != 0 {
+		t.Fatalf("Sessions = %+v", sessions)
+	}
+	// Without a reason, clients are not told they were removed
+	for _, fake := range []*fakeSubscriber{toAlice, toBob} {
+		if !fake.closed || fake.reason != "" {
+			t.Errorf("closed %v with reason %q, want closed without a reason", fake.closed, fake.reason)
+		}
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	h := newTestHub(t, config.Default().RateLimit)
+	alice := h.member(t, "alice")
+	bob := newTestUser(t, h.store, "bob")
+	_, toBob := h.roomSession(t, bob, TransportPoll, 1)
+
+	for _, content := range []string{"one", "two"} {
+		if _, err := h.Post(context.Background(), alice, h.room.ID, content); err != nil {
+			t.Fatalf("Post(%q): %v", content, err)
+		}
+	}
+	if !toBob.closed || toBob.reason != "" {
+		t.Errorf("closed %v with reason %q, want dropped without a reason", toBob.closed, toBob.reason)
+	}
+	if sessions := h.Sessions(); len(sessions) != 0 {
+		t.Fatalf("Sessions = %+v", sessions)
+	}
+}
+
+func TestPostRefusals(t *testing.T) {
+	limits := config.Default().RateLimit
+	limits.UserMessageBurst = 1
+	h := newTestHub(t, limits)
+	alice := h.member(t, "alice")
+
+	if _, err := h.Post(context.Background(), alice, h.room.ID, "first"); err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	var limited *RateLimitError
+	if _, err := h.Post(context.Background(), alice, h.room.ID, "second"); !errors.As(err, &limited) || limited.RetryAfter <= 0 {
+		t.Errorf("second Post error = %v, want a rate limit error", err)
+	}
+
+	bob := newTestUser(t, h.store, "bob")
+	if _, err := h.Post(context.Background(), bob, "no-such-room", "hello"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Post to a missing room error = %v, want store.ErrNotFound", err)
+	}
+
+	// Posting in a public room joins it, but private rooms need an invite
+	carol := newTestUser(t, h.store, "carol")
+	private := h.createRoom(t, "den", "private")
+	if _, err := h.Post(context.Background(), carol, private.ID, "hello"); !errors.Is(err, services.ErrNotRoomMember) {
+		t.Errorf("Post by a non-member of a private room error = %v, want ErrNotRoomMember", err)
+	}
+	dave := newTestUser(t, h.store, "dave")
+	if _, err := h.Post(context.Background(), dave, h.room.ID, "hello"); err != nil {
+		t.Errorf("Post by a non-member of a public room: %v", err)
+	}
+	if member, err := h.store.GetRoomMember(h.room.ID, dave.ID); err != nil || member.Status != services.MemberStatusMember {
+		t.Errorf("membership after posting = %+v, %v; want a member", member, err)
+	}
+}
+
+func TestRoomLimitDoesNotChargeSender(t *testing.T) {
+	limits := config.Default().RateLimit
+	limits.UserMessageRate = 0.001
+	limits.UserMessageBurst = 1
+	limits.RoomMessageRate = 5
+	limits.RoomMessageBurst = 1
+	h := newTestHub(t, limits)
+	alice := h.member(t, "alice")
+	bob := h.member(t, "bob")
+
+	if _, err := h.Post(context.Background(), alice, h.room.ID, "first"); err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	var limited *RateLimitError
+	if _, err := h.Post(context.Background(), bob, h.room.ID, "busy"); !errors.As(err, &limited) {
+		t.Fatalf("Post to a busy room error = %v, want a rate limit error", err)
+	}
+
+	// Bob's only token was refunded when the room refused him, so he may
+	// post once the room has room again
+	time.Sleep(limited.RetryAfter)
+	if _, err := h.Post(context.Background(), bob, h.room.ID, "retry"); err != nil {
+		t.Fatalf("Post after the room refilled: %v", err)
+	}
+}
+
+func TestSubscribeAcrossRooms(t *testing.T) {
+	h := newTestHub(t, config.Default().RateLimit)
+	general := h.createRoom(t, "general", "public")
+	secret := h.createRoom(t, "secret", "private")
+	alice := newTestUser(t, h.store, "alice")
+	s, fake := h.session(t, alice)
+	ctx := context.Background()
+
+	for _, roomID := range []string{h.room.ID, general.ID} {
+		if err := h.Subscribe(ctx, s, roomID); err != nil {
+			t.Fatalf("Subscribe(%s): %v", roomID, err)
+		}
+	}
+	// Private rooms are only open to members
+	if err := h.Subscribe(ctx, s, secret.ID); !errors.Is(err, services.ErrNotRoomMember) {
+		t.Errorf("Subscribe to a private room error = %v, want ErrNotRoomMember", err)
+	}
+	if err := h.Subscribe(ctx, s, "no-such-room"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Subscribe to a missing room error = %v, want store.ErrNotFound", err)
+	}
+
+	for _, roomID := range []string{h.room.ID, general.ID, secret.ID} {
+		if _, err := h.Post(ctx, h.owner, roomID, "hello "+roomID); err != nil {
+			t.Fatalf("Post: %v", err)
+		}
+	}
+	got := fake.messages(t)
+	if len(got) != 2 || got[0].RoomID != h.room.ID || got[1].RoomID != general.ID {
+		t.Fatalf("received %+v, want a message from each subscribed room", got)
+	}
+
+	h.Unsubscribe(s, general.ID)
+	if _, err := h.Post(ctx, h.owner, general.ID, "anyone there?"); err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	if got := fake.messages(t); len(got) != 2 {
+		t.Errorf("received %d messages after unsubscribing, want 2", len(got))
+	}
+	want := []models.SubscriptionEvent{
+		{Type: models.EventTypeSubscribed, RoomID: h.room.ID},
+		{Type: models.EventTypeSubscribed, RoomID: general.ID},
+		{Type: models.EventTypeUnsubscribed, RoomID: general.ID},
+	}
+	if got := fake.subscriptionEvents(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("subscription events = %+v, want %+v", got, want)
+	}
+	if sessions := h.Sessions(); len(sessions) != 1 || !reflect.DeepEqual(sessions[0].Rooms, []string{h.room.ID}) {
+		t.Errorf("Sessions = %+v", sessions)
+	}
+
+	// A session bound to one room cannot change rooms
+	bound, _ := h.roomSession(t, alice, TransportSSE, 8)
+	if err := h.Subscribe(ctx, bound, general.ID); !errors.Is(err, ErrRoomSession) {
+		t.Errorf("Subscribe on a room session error = %v, want ErrRoomSession", err)
+	}
+}
+
+func TestDisconnectUserFromOneRoom(t *testing.T) {
+	h := newTestHub(t, config.Default().RateLimit)
+	general := h.createRoom(t, "general", "public")
+	alice := newTestUser(t, h.store, "alice")
+	s, fake := h.session(t, alice)
+	for _, roomID := range []string{h.room.ID, general.ID} {
+		if err := h.Subscribe(context.Background(), s, roomID); err != nil {
+			t.Fatalf("Subscribe(%s): %v", roomID, err)
+		}
+	}
+
+	// A kick from one room leaves the connection and its other rooms alone
+	h.DisconnectUser(h.room.ID, alice.ID, "You were kicked from the room")
+	if sessions := h.Sessions(); len(sessions) != 1 || !reflect.DeepEqual(sessions[0].Rooms, []string{general.ID}) {
+		t.Fatalf("Sessions = %+v", sessions)
+	}
+	events := fake.subscriptionEvents(t)
+	if last := events[len(events)-1]; last.Type != models.EventTypeUnsubscribed || last.RoomID != h.room.ID || last.Reason != "You were kicked from the room" {
+		t.Errorf("last subscription event = %+v", last)
+	}
+	if fake.closed {
+		t.Error("session closed by a kick from one room")
+	}
+
+	h.DisconnectUserEverywhere(alice.ID, "Your account has been disabled")
+	if sessions := h.Sessions(); len(sessions) != 0 {
+		t.Fatalf("Sessions = %+v", sessions)
+	}
+	if !fake.closed || fake.reason != "Your account has been disabled" {
+		t.Errorf("closed %v with reason %q", fake.closed, fake.reason)
+	}
+}
@@ -0,0 +1,146 @@
+package hub
+
+import (
+	"backend/internal/contentfilter"
+	"backend/internal/metrics"
+	"backend/internal/models"
+	"backend/internal/services"
+	"backend/internal/store"
+	"backend/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RateLimitError is returned by Post when the sender or the room has sent
+// too many messages.
+type RateLimitError struct {
+	RetryAfter time.Duration // when the sender may try again
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("too many messages, retry in %s", e.RetryAfter.Round(time.Millisecond))
+}
+
+// FilterError is returned by Post when a content filter held the message
+// for review or rejected it.
+type FilterError struct {
+	Verdict contentfilter.Verdict // Hold or Reject
+	Reason  string
+}
+
+func (e *FilterError) Error() string {
+	if e.Verdict == contentfilter.Hold {
+		return "message held for review: " + e.Reason
+	}
+	return "message rejected: " + e.Reason
+}
+
+// ErrUnavailable is returned by Post when the message could not be checked
+// or saved. The sender may try again.
+var ErrUnavailable = errors.New("message could not be saved")
+
+// Post checks, screens and saves a message from user to the room, and
+// delivers it to the room's subscribers. It returns the saved message, or
+// one of:
+//   - *RateLimitError if the user or the room is sending too fast
+//   - *services.MutedError, services.ErrRoomArchived, services.ErrBanned or
+//     services.ErrNotRoomMember if the user may not post in the room
+//   - store.ErrNotFound if the room does not exist
+//   - *FilterError if a content filter held or rejected the message
+//   - ErrUnavailable if it could not be saved
+//
+// The message is traced as one span, from the checks through saving to
+// delivery.
+func (h *Hub) Post(ctx context.Context, user *models.User, roomID, content string) (*models.Message, error) {
+	ctx, span := tracing.Start(ctx, "chat.message",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.String("chat.room", roomID), attribute.String("chat.user_id", user.ID)))
+	defer span.End()
+	metrics.MessagesReceived.Inc()
+	messages := h.messageService.WithContext(ctx)
+
+	// Apply flood control before the message reaches the hub
+	if ok, retryAfter := h.allowMessage(user.ID, roomID); !ok {
+		span.SetAttributes(attribute.String("chat.outcome", "rate_limited"))
+		return nil, &RateLimitError{RetryAfter: retryAfter}
+	}
+
+	// Only members who are not muted may post, and not in a missing room.
+	// Posting in a public room joins it, so that moderators can act on
+	// everyone who posts
+	err := messages.CheckCanSend(roomID, user.ID)
+	if errors.Is(err, services.ErrNotRoomMember) {
+		err = messages.JoinPublicRoom(roomID, user.ID)
+	}
+	if err != nil {
+		var muted *services.MutedError
+		if errors.As(err, &muted) || errors.Is(err, services.ErrRoomArchived) || errors.Is(err, services.ErrBanned) ||
+			errors.Is(err, services.ErrNotRoomMember) || errors.Is(err, store.ErrNotFound) {
+			span.SetAttributes(attribute.String("chat.outcome", "refused"))
+			return nil, err
+		}
+		slog.ErrorContext(ctx, "failed to check whether user can post", "room", roomID, "user", user.Username, "error", err)
+		tracing.RecordError(span, err)
+		return nil, ErrUnavailable
+	}
+
+	message := &models.Message{
+		ID:             services.GenerateUUID(),
+		RoomID:         roomID,
+		SenderID:       user.ID,
+		SenderUsername: user.Username,
+		Content:        content,
+		// PostgreSQL keeps microseconds, so a live message's timestamp is
+		// cut to match the stored one and can be used as a history cursor
+		Timestamp: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	span.SetAttributes(attribute.String("chat.message_id", message.ID))
+
+	// Content filters may redact, hold or reject the message
+	result, err := messages.ScreenMessage(message)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to hold message", "room", roomID, "message_id", message.ID, "error", err)
+		tracing.RecordError(span, err)
+		return nil, ErrUnavailable
+	}
+	switch result.Verdict {
+	case contentfilter.Hold:
+		span.SetAttributes(attribute.String("chat.outcome", "held"))
+		return nil, &FilterError{Verdict: result.Verdict, Reason: result.Reason}
+	case contentfilter.Reject:
+		span.SetAttributes(attribute.String("chat.outcome", "rejected"))
+		return nil, &FilterError{Verdict: result.Verdict, Reason: result.Reason}
+	}
+
+	// The Run loop saves and delivers messages one at a time, so that every
+	// subscriber sees them in the order they were saved
+	in := inboundMessage{ctx: ctx, message: message, result: make(chan error, 1)}
+	h.broadcast <- in
+	if err := <-in.result; err != nil {
+		slog.ErrorContext(ctx, "failed to save message", "room", roomID, "message_id", message.ID, "error", err)
+		tracing.RecordError(span, err)
+		return nil, ErrUnavailable
+	}
+	span.SetAttributes(attribute.String("chat.outcome", "delivered"))
+	return message, nil
+}
+
+// allowMessage applies the per-user and per-room limits to one incoming message.
+// When it is refused, the returned duration says when the user may retry. A
+// message the room refuses does not count against the user.
+func (h *Hub) allowMessage(userID, roomID string) (bool, time.Duration) {
+	if ok, retryAfter := h.userLimiter.Allow(userID); !ok {
+		return false, retryAfter
+	}
+	if ok, retryAfter := h.roomLimiter.Allow(roomID); !ok {
+		h.userLimiter.Refund(userID)
+		return false, retryAfter
+	}
+	return true, 0
+}
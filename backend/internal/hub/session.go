@@ -0,0 +1,190 @@
+package hub
+
+import (
+	"backend/internal/models"
+	"backend/internal/protocol"
+	"backend/internal/services"
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Transports a subscriber can use, as reported in sessions.
+const (
+	TransportWebSocket = "websocket"
+	TransportSSE       = "sse"
+	TransportPoll      = "poll"
+)
+
+// Subscriber is the transport end of a session: a WebSocket connection, an
+// event stream or a long-poll queue. The hub calls its methods from its Run
+// loop, so they must not block.
+type Subscriber interface {
+	// Deliver queues an event for the user. The event is shared with the
+	// room's other subscribers, each of which sends it in its own encoding.
+	// It reports false if the queue is full; the hub then ends the session,
+	// and the user has to connect again and fetch what they missed from the
+	// history.
+	Deliver(event *protocol.Event) bool
+
+	// Close is called once, when the hub ends the session. reason says why
+	// the user was disconnected, such as a ban. It is empty when the
+	// subscriber fell behind or was unregistered by its transport.
+	Close(reason string)
+
+	// Queued reports how many events wait to be sent and how many may.
+	Queued() (queued, capacity int)
+}
+
+// Session is one connection's subscriptions to room events. A session
+// opened with NewRoomSession receives one room's events for its whole life,
+// and ends when the user is removed from the room. One opened with
+// NewSession starts with no rooms, and is subscribed to them one at a time
+// with Subscribe; removing the user from a room only unsubscribes it, and
+// the subscriber is told with a SubscriptionEvent.
+type Session struct {
+	ID          string
+	User        *models.User
+	Transport   string
+	RemoteAddr  string
+	ConnectedAt time.Time
+
+	// room is the room a session opened with NewRoomSession is bound to
+	room string
+
+	// ctx carries the ID of the request that opened the session, and log
+	// tags every line with the user and session, so that a session's log
+	// lines can be followed from start to end.
+	ctx context.Context
+	log *slog.Logger
+
+	subscriber Subscriber
+
+	// rooms holds the IDs of the rooms the session is subscribed to. Only
+	// the hub's Run loop changes it.
+	mu    sync.Mutex
+	rooms map[string]bool
+
+	// blocked holds the IDs of users whose messages this session does not
+	// receive. After Register it is only used by the hub's Run loop.
+	blocked map[string]bool
+}
+
+// NewSession checks that user may receive room events and prepares a
+// session with no rooms, which receives nothing until it is passed to
+// Register and subscribed to rooms. It returns services.ErrAccountDisabled
+// if the user's account is disabled.
+func (h *Hub) NewSession(ctx context.Context, user *models.User, transport, remoteAddr string) (*Session, error) {
+	if err := h.messageService.WithContext(ctx).CheckActive(user.ID); err != nil {
+		return nil, err
+	}
+	return h.newSession(ctx, user, "", transport, remoteAddr)
+}
+
+// NewRoomSession checks that user may receive the room's events and
+// prepares a session bound to the room, which receives nothing until it is
+// passed to Register. It returns the errors of
+// services.MessageService.CheckCanView.
+func (h *Hub) NewRoomSession(ctx context.Context, user *models.User, roomID, transport, remoteAddr string) (*Session, error) {
+	if err := h.messageService.WithContext(ctx).CheckCanView(roomID, user.ID); err != nil {
+		return nil, err
+	}
+	s, err := h.newSession(ctx, user, roomID, transport, remoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	s.rooms[roomID] = true
+	s.log = s.log.With("room", roomID)
+	return s, nil
+}
+
+// newSession loads the user's block list and prepares a session.
+func (h *Hub) newSession(ctx context.Context, user *models.User, roomID, transport, remoteAddr string) (*Session, error) {
+	// Messages from users this user has blocked are not delivered to them
+	blocked, err := h.messageService.WithContext(ctx).GetBlockedUserIDs(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{
+		ID:          services.GenerateUUID(),
+		User:        user,
+		Transport:   transport,
+		RemoteAddr:  remoteAddr,
+		ConnectedAt: time.Now(),
+		room:        roomID,
+		// The session outlives the request, so only its values are kept
+		ctx:     context.WithoutCancel(ctx),
+		rooms:   make(map[string]bool),
+		blocked: blocked,
+	}
+	s.log = slog.With("user", user.Username, "session", s.ID, "transport", transport)
+	return s, nil
+}
+
+// Context returns the context of the request that opened the session,
+// without its cancellation.
+func (s *Session) Context() context.Context {
+	return s.ctx
+}
+
+// Logger returns a logger that tags lines with the session's user and ID.
+func (s *Session) Logger() *slog.Logger {
+	return s.log
+}
+
+// Room returns the room a session opened with NewRoomSession is bound to,
+// or "" for a session that subscribes to rooms one at a time.
+func (s *Session) Room() string {
+	return s.room
+}
+
+// Subscribed reports whether the session receives the room's events.
+func (s *Session) Subscribed(roomID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rooms[roomID]
+}
+
+// Rooms returns the IDs of the rooms the session is subscribed to, sorted.
+func (s *Session) Rooms() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rooms := make([]string, 0, len(s.rooms))
+	for roomID := range s.rooms {
+		rooms = append(rooms, roomID)
+	}
+	sort.Strings(rooms)
+	return rooms
+}
+
+// setSubscribed adds the room to the session's rooms, or removes it. It
+// reports whether that changed anything, and must only be called from Run.
+func (s *Session) setSubscribed(roomID string, subscribed bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rooms[roomID] == subscribed {
+		return false
+	}
+	if subscribed {
+		s.rooms[roomID] = true
+	} else {
+		delete(s.rooms, roomID)
+	}
+	return true
+}
+
+// describe describes the session for administrators.
+func (s *Session) describe() models.Session {
+	return models.Session{
+		ID:          s.ID,
+		UserID:      s.User.ID,
+		Username:    s.User.Username,
+		Rooms:       s.Rooms(),
+		Transport:   s.Transport,
+		RemoteAddr:  s.RemoteAddr,
+		ConnectedAt: s.ConnectedAt,
+	}
+}
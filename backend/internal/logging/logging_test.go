@@ -0,0 +1,112 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNewRejectsUnknownSettings(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "loud", "text"); err == nil {
+		t.Error("New with level loud succeeded, want an error")
+	}
+	if _, err := New(&bytes.Buffer{}, "info", "xml"); err == nil {
+		t.Error("New with format xml succeeded, want an error")
+	}
+}
+
+func TestLevelFiltersRecords(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "WARN", "text")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	logger.Info("quiet")
+	logger.Warn("loud")
+	if out := buf.String(); strings.Contains(out, "quiet") || !strings.Contains(out, "loud") {
+		t.Fatalf("output = %q, want only the warning", out)
+	}
+}
+
+func TestRequestIDIsAdded(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "debug", "json")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	ctx := WithRequestID(context.Background(), "req-123")
+	logger.With("user", "alice").InfoContext(ctx, "hello")
+	logger.Info("no context")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), buf.String())
+	}
+	var first, second map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("first line is not JSON: %v", err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatalf("second line is not JSON: %v", err)
+	}
+	if first["request_id"] != "req-123" || first["user"] != "alice" {
+		t.Errorf("first line = %v, want request_id req-123 and user alice", first)
+	}
+	if _, ok := second["request_id"]; ok {
+		t.Errorf("second line = %v, want no request_id", second)
+	}
+}
+
+func TestSecretsAreRedacted(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info", "text")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer s3cret-jwt")
+	header.Set("Cookie", "session=s3cret-cookie")
+	header.Set("User-Agent", "test-agent")
+	u, _ := url.Parse("ws://alice:s3cret-pw@localhost/api/ws?room_id=lobby&token=s3cret-query")
+
+	logger.Info("request",
+		"password", "s3cret-password",
+		"access_token", "s3cret-token",
+		slog.Group("db", "Password", "s3cret-db"),
+		"headers", header,
+		"query", u.Query(),
+		"url", u,
+		"username", "alice",
+	)
+
+	out := buf.String()
+	if strings.Contains(out, "s3cret") {
+		t.Fatalf("output leaks a secret: %s", out)
+	}
+	for _, want := range []string{"username=alice", "headers.User-Agent=test-agent", "query.room_id=lobby", "room_id=lobby", Redacted} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output %q does not contain %q", out, want)
+		}
+	}
+}
+
+func TestIsSensitive(t *testing.T) {
+	for _, name := range []string{"Authorization", "password", "X-Api-Key", "access_token", "Set-Cookie", "clientSecret"} {
+		if !IsSensitive(name) {
+			t.Errorf("IsSensitive(%q) = false, want true", name)
+		}
+	}
+	for _, name := range []string{"username", "room", "error", "Content-Type"} {
+		if IsSensitive(name) {
+			t.Errorf("IsSensitive(%q) = true, want false", name)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package logging
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Redacted replaces the value of an attribute that holds a secret.
+const Redacted = "[REDACTED]"
+
+// sensitiveWords are the parts of a key, header or query parameter name that
+// mark its value as a secret.
+var sensitiveWords = []string{"authorization", "password", "passwd", "secret", "token", "cookie", "apikey", "credential"}
+
+// IsSensitive reports whether name, an attribute key, header or query
+// parameter, names a secret. Case, hyphens and underscores are ignored, so
+// "Authorization", "access_token" and "X-Api-Key" all match.
+func IsSensitive(name string) bool {
+	name = strings.ToLower(name)
+	name = strings.NewReplacer("-", "", "_", "").Replace(name)
+	for _, word := range sensitiveWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact is the handlers' ReplaceAttr function. It hides the values of
+// sensitive attributes, and of sensitive entries in headers, query strings
+// and URLs logged as attributes.
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if IsSensitive(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	if a.Value.Kind() != slog.KindAny {
+		return a
+	}
+
+	switch v := a.Value.Any().(type) {
+	case http.Header:
+		return slog.Attr{Key: a.Key, Value: redactValues(v)}
+	case url.Values:
+		return slog.Attr{Key: a.Key, Value: redactValues(v)}
+	case *url.URL:
+		if v != nil {
+			return slog.String(a.Key, RedactURL(v))
+		}
+	}
+	return a
+}
+
+// redactValues turns a header or query string into a group, one attribute
+// per name, with the values of sensitive names hidden.
+func redactValues(values map[string][]string) slog.Value {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	attrs := make([]slog.Attr, 0, len(names))
+	for _, name := range names {
+		value := strings.Join(values[name], ", ")
+		if IsSensitive(name) {
+			value = Redacted
+		}
+		attrs = append(attrs, slog.String(name, value))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// RedactURL returns u as a string with the values of sensitive query
+// parameters, and any password, hidden.
+func RedactURL(u *url.URL) string {
+	redacted := *u
+	query := u.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		for _, value := range query[name] {
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString(url.QueryEscape(name))
+			b.WriteByte('=')
+			if IsSensitive(name) {
+				b.WriteString(Redacted)
+			} else {
+				b.WriteString(url.QueryEscape(value))
+			}
+		}
+	}
+	redacted.RawQuery = b.String()
+	return redacted.Redacted()
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import "database/sql"
+
+// The application's metrics, registered with Default.
+var (
+	// Subscribers is the number of room subscriptions, by transport. A
+	// session subscribed to several rooms counts once for each. Rooms are not
+	// a label, as every room ever joined would keep a series.
+	Subscribers = Default.NewGauge("chat_subscribers", "Subscriptions to room events by transport.", "transport")
+	// MessagesReceived counts chat messages sent by clients, over any transport.
+	MessagesReceived = Default.NewCounter("chat_messages_received_total", "Chat messages received from clients.")
+	// MessagesBroadcast counts messages the hub has delivered to a room.
+	MessagesBroadcast = Default.NewCounter("chat_messages_broadcast_total", "Chat messages delivered to rooms by the hub.")
+	// SendBufferDrops counts subscribers dropped because their send buffer was full.
+	SendBufferDrops = Default.NewCounter("chat_send_buffer_drops_total", "Subscribers dropped because their send buffer was full.")
+	// HubEventDuration is how long the hub's loop takes to handle each event.
+	HubEventDuration = Default.NewHistogram("chat_hub_event_duration_seconds", "Time the hub loop spends handling one event, by event type.", nil, "event")
+	// SaveMessageDuration is how long saving a message and its mentions takes.
+	SaveMessageDuration = Default.NewHistogram("chat_save_message_duration_seconds", "Time taken to save a chat message.", nil)
+	// SaveMessageErrors counts messages that could not be saved.
+	SaveMessageErrors = Default.NewCounter("chat_save_message_errors_total", "Chat messages that could not be saved.")
+	// HTTPRequests counts HTTP requests by route pattern, method and status code.
+	HTTPRequests = Default.NewCounter("http_requests_total", "HTTP requests by route, method and status.", "route", "method", "status")
+	// HTTPRequestDuration is the latency of HTTP requests by route pattern and method.
+	HTTPRequestDuration = Default.NewHistogram("http_request_duration_seconds", "HTTP request latency by route and method.", nil, "route", "method")
+)
+
+// RegisterDBStats exposes the connection pool statistics returned by stats,
+// normally a *sql.DB's Stats method, with Default.
+func RegisterDBStats(stats func() sql.DBStats) {
+	gauge := func(name, help string, value func(s sql.DBStats) float64) {
+		Default.NewGaugeFunc(name, help, func() float64 { return value(stats()) })
+	}
+	counter := func(name, help string, value func(s sql.DBStats) float64) {
+		Default.NewCounterFunc(name, help, func() float64 { return value(stats()) })
+	}
+
+	gauge("db_max_open_connections", "Maximum number of open connections to the database.",
+		func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) })
+	gauge("db_open_connections", "Established connections to the database, in use and idle.",
+		func(s sql.DBStats) float64 { return float64(s.OpenConnections) })
+	gauge("db_in_use_connections", "Connections currently in use.",
+		func(s sql.DBStats) float64 { return float64(s.InUse) })
+	gauge("db_idle_connections", "Idle connections.",
+		func(s sql.DBStats) float64 { return float64(s.Idle) })
+	counter("db_wait_count_total", "Connections waited for.",
+		func(s sql.DBStats) float64 { return float64(s.WaitCount) })
+	counter("db_wait_duration_seconds_total", "Total time spent waiting for a connection.",
+		func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() })
+	counter("db_max_idle_closed_total", "Connections closed because of the idle connection limit.",
+		func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) })
+	counter("db_max_idle_time_closed_total", "Connections closed because they were idle for too long.",
+		func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) })
+	counter("db_max_lifetime_closed_total", "Connections closed because they reached their maximum lifetime.",
+		func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) })
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTextFormat(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("requests_total", "Requests.", "route", "status")
+	clients := r.NewGauge("clients", "Connected clients.", "room")
+	latency := r.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1})
+	r.NewGaugeFunc("pool_open", "Open connections.", func() float64 { return 3 })
+
+	requests.Inc("/a", "200")
+	requests.Add(2, "/a", "200")
+	requests.Inc(`/b"`, "500")
+	clients.Add(1, "lobby")
+	clients.Add(1, "den")
+	clients.Add(-1, "den") // removed at zero
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(3)
+
+	var out strings.Builder
+	if _, err := r.WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	want := `# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{route="/a",status="200"} 3
+requests_total{route="/b\"",status="500"} 1
+# HELP clients Connected clients.
+# TYPE clients gauge
+clients{room="lobby"} 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 3.55
+latency_seconds_count 3
+# HELP pool_open Open connections.
+# TYPE pool_open gauge
+pool_open 3
+`
+	if out.String() != want {
+		t.Fatalf("output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestRegistryRejectsDuplicatesAndBadLabels(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("dup_total", "Help.", "a")
+
+	mustPanic(t, "duplicate name", func() { r.NewGauge("dup_total", "Help.") })
+	mustPanic(t, "wrong label count", func() { c.Inc() })
+	mustPanic(t, "negative counter", func() { c.Add(-1, "x") })
+}
+
+func mustPanic(t *testing.T, name string, fn func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("%s did not panic", name)
+		}
+	}()
+	fn()
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// UserStore loads user accounts. store.StoreInterface satisfies it.
+type UserStore interface {
+	GetUserByID(id string) (*models.User, error)
+}
+
+// contextBinder is implemented by stores that can trace their queries as
+// part of a request, such as store.StoreInterface.
+type contextBinder interface {
+	WithContext(ctx context.Context) store.StoreInterface
+}
+
+// ActiveUser replaces the user taken from the token with the current account,
+// so that disabled and deleted accounts are refused even while their tokens
+// are still valid. It must run after AuthMiddleware.
+func ActiveUser(users UserStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenUser, ok := GetUserFromContext(r.Context())
+			if !ok {
+				apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+
+			lookup := users
+			if bound, ok := users.(contextBinder); ok {
+				lookup = bound.WithContext(r.Context())
+			}
+			user, err := lookup.GetUserByID(tokenUser.ID)
+			if err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					apierror.Write(w, http.StatusUnauthorized, "This account no longer exists")
+				} else {
+					slog.ErrorContext(r.Context(), "failed to load user", "user_id", tokenUser.ID, "error", err)
+					apierror.WriteStore(w, err, "Failed to load user")
+				}
+				return
+			}
+			if user.Disabled {
+				apierror.Write(w, http.StatusForbidden, "This account has been disabled")
+				return
+			}
+
+			// The password hash is not needed past this point
+			user.Password = ""
+			ctx := context.WithValue(r.Context(), UserContextKey, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireAdmin only lets administrators through. It must run after ActiveUser,
+// which loads the admin flag from the store.
+func RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := GetUserFromContext(r.Context())
+		if !ok {
+			apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		if !user.IsAdmin {
+			apierror.Write(w, http.StatusForbidden, "Administrator access required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
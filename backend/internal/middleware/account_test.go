@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestActiveUserAndRequireAdmin(t *testing.T) {
+	mem := store.NewMemoryStore()
+	for _, user := range []*models.User{
+		{ID: "u-admin", Username: "root", IsAdmin: true},
+		{ID: "u-user", Username: "alice"},
+		{ID: "u-disabled", Username: "bob", Disabled: true},
+	} {
+		if err := mem.CreateUser(user); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := ActiveUser(mem)(RequireAdmin(ok))
+
+	tests := []struct {
+		userID string
+		want   int
+	}{
+		{"u-admin", http.StatusOK},
+		{"u-user", http.StatusForbidden},
+		{"u-disabled", http.StatusForbidden},
+		{"u-deleted", http.StatusUnauthorized},
+	}
+	for _, tc := range tests {
+		// The token only carries the ID; the admin flag must come from the store
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/users", nil)
+		req = req.WithContext(context.WithValue(req.Context(), UserContextKey, &models.User{ID: tc.userID}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("user %s: status %d, want %d", tc.userID, rec.Code, tc.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"backend/internal/apierror"
 	"backend/internal/models"
 	"context"
 	"errors"
@@ -10,68 +11,75 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// JWT secret key - must match the one in user_service.go
-const jwtSecret = "your-256-bit-secret-key-change-this-in-production"
-
 // contextKey is a custom type for context keys to avoid collisions
 type contextKey string
 
 // UserContextKey is the key used to store the user in the request context
 const UserContextKey contextKey = "user"
 
-// AuthMiddleware checks for a valid JWT token and adds the user to the request context
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Get the Authorization header
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
-			return
-		}
-
-		// Check if it's a Bearer token
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			http.Error(w, "Invalid authorization format", http.StatusUnauthorized)
-			return
-		}
-
-		// Extract the token
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-
-		// Parse and validate the token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Validate the signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("unexpected signing method")
+// AuthMiddleware returns middleware that checks for a valid JWT token signed
+// with secret and adds the user to the request context
+func AuthMiddleware(secret string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Get the Authorization header
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				apierror.Write(w, http.StatusUnauthorized, "Authorization header required")
+				return
 			}
-			return []byte(jwtSecret), nil
-		})
 
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
-			return
-		}
+			// Check if it's a Bearer token
+			if !strings.HasPrefix(authHeader, "Bearer ") {
+				apierror.Write(w, http.StatusUnauthorized, "Invalid authorization format")
+				return
+			}
 
-		// Extract claims
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			http.Error(w, "Invalid token claims", http.StatusUnauthorized)
-			return
-		}
+			// Parse and validate the token
+			user, err := ParseToken(strings.TrimPrefix(authHeader, "Bearer "), secret)
+			if err != nil {
+				apierror.Write(w, http.StatusUnauthorized, "Invalid or expired token")
+				return
+			}
 
-		// Create a user from the claims
-		userID, _ := claims["sub"].(string)
-		username, _ := claims["username"].(string)
+			// Add the user to the request context
+			ctx := context.WithValue(r.Context(), UserContextKey, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
 
-		user := &models.User{
-			ID:       userID,
-			Username: username,
+// ParseToken validates a JWT token signed with secret and returns the user it
+// was issued to. Only the ID and username are set.
+func ParseToken(tokenString, secret string) (*models.User, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		// Validate the signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
 		}
-
-		// Add the user to the request context
-		ctx := context.WithValue(r.Context(), UserContextKey, user)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		return []byte(secret), nil
 	})
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid or expired token")
+	}
+
+	// Extract claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims")
+	}
+
+	// Create a user from the claims
+	userID, _ := claims["sub"].(string)
+	username, _ := claims["username"].(string)
+	if userID == "" || username == "" {
+		return nil, errors.New("invalid token: missing user information")
+	}
+
+	return &models.User{
+		ID:       userID,
+		Username: username,
+	}, nil
 }
 
 // GetUserFromContext extracts the user from the request context
@@ -79,8 +87,3 @@ func GetUserFromContext(ctx context.Context) (*models.User, bool) {
 	user, ok := ctx.Value(UserContextKey).(*models.User)
 	return user, ok
 }
-
-// RequireAuth is a helper function to create protected routes
-func RequireAuth(handler http.HandlerFunc) http.Handler {
-	return AuthMiddleware(handler)
-}
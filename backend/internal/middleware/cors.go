@@ -1,29 +1,47 @@
 package middleware
 
 import (
+	"backend/internal/apierror"
+	"backend/internal/origin"
 	"net/http"
 )
 
-// CORS middleware adds Cross-Origin Resource Sharing headers to responses
-func CORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Log the request for debugging
-		// Set CORS headers to allow the specific frontend origin
-		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
+// CORS returns middleware that adds Cross-Origin Resource Sharing headers to
+// responses for requests from origins the policy allows. Preflight requests
+// from other origins are refused.
+func CORS(origins *origin.Policy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The answer depends on the origin, so caches must too
+			w.Header().Add("Vary", "Origin")
 
-		// Set other CORS headers
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
-		w.Header().Set("Access-Control-Allow-Credentials", "true") // Allow credentials
-		w.Header().Set("Access-Control-Max-Age", "86400") // Cache preflight requests for 24 hours
+			requestOrigin := r.Header.Get("Origin")
+			allowed := origins.AllowsRequest(r)
+			if requestOrigin != "" && allowed {
+				// Echo the origin; a wildcard may not be combined with credentials
+				w.Header().Set("Access-Control-Allow-Origin", requestOrigin)
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, X-Request-ID")
+				w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
+				w.Header().Set("Access-Control-Allow-Credentials", "true") // Allow credentials
+				w.Header().Set("Access-Control-Max-Age", "86400")          // Cache preflight requests for 24 hours
+			}
 
-		// Handle preflight requests
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
+			// Handle preflight requests
+			if r.Method == http.MethodOptions {
+				if !origins.Check(r) {
+					apierror.Write(w, http.StatusForbidden, "Origin not allowed")
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+				return
+			}
 
-		// Call the next handler
-		next.ServeHTTP(w, r)
-	})
+			// Other requests from a refused origin still run, as a browser
+			// sends simple requests without asking first, but the browser
+			// keeps the response from the page. WebSocket upgrades check the
+			// origin themselves.
+			next.ServeHTTP(w, r)
+		})
+	}
 }
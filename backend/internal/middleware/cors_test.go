@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"backend/internal/origin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	policy, err := origin.New([]string{"https://*.example.com"})
+	if err != nil {
+		t.Fatalf("origin.New: %v", err)
+	}
+	served := 0
+	handler := CORS(policy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(method, requestOrigin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://api.internal/api/rooms", nil)
+		if requestOrigin != "" {
+			req.Header.Set("Origin", requestOrigin)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		origin      string
+		status      int
+		allowOrigin string
+		served      bool
+	}{
+		{"allowed preflight", http.MethodOptions, "https://chat.example.com", http.StatusOK, "https://chat.example.com", false},
+		{"refused preflight", http.MethodOptions, "https://evil.test", http.StatusForbidden, "", false},
+		{"allowed request", http.MethodGet, "https://chat.example.com", http.StatusOK, "https://chat.example.com", true},
+		{"refused request runs without CORS headers", http.MethodGet, "https://evil.test", http.StatusOK, "", true},
+		{"request without origin", http.MethodGet, "", http.StatusOK, "", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			served = 0
+			rec := request(tc.method, tc.origin)
+			if rec.Code != tc.status {
+				t.Errorf("status = %d, want %d", rec.Code, tc.status)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tc.allowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tc.allowOrigin)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Credentials"); (got == "true") != (tc.allowOrigin != "") {
+				t.Errorf("Access-Control-Allow-Credentials = %q with Allow-Origin %q", got, tc.allowOrigin)
+			}
+			if rec.Header().Get("Vary") != "Origin" {
+				t.Errorf("Vary = %q, want Origin", rec.Header().Get("Vary"))
+			}
+			if (served == 1) != tc.served {
+				t.Errorf("handler ran %d times, want served = %t", served, tc.served)
+			}
+		})
+	}
+}
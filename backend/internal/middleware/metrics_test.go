@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"backend/internal/metrics"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetricsRecordsRoutePattern(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/rooms/{id}/messages", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := Metrics(mux)
+
+	route := "GET /api/rooms/{id}/messages"
+	before := metrics.HTTPRequests.Value(route, http.MethodGet, "418")
+	unmatched := metrics.HTTPRequests.Value("unmatched", http.MethodGet, "404")
+
+	for _, path := range []string{"/api/rooms/1/messages", "/api/rooms/2/messages", "/nowhere"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := metrics.HTTPRequests.Value(route, http.MethodGet, "418") - before; got != 2 {
+		t.Fatalf("requests for %s = %v, want 2", route, got)
+	}
+	if got := metrics.HTTPRequests.Value("unmatched", http.MethodGet, "404") - unmatched; got != 1 {
+		t.Fatalf("unmatched requests = %v, want 1", got)
+	}
+	if metrics.HTTPRequestDuration.Count(route, http.MethodGet) < 2 {
+		t.Fatal("request durations not recorded")
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/clientip"
+	"backend/internal/ratelimit"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// RateLimit limits how many requests each client IP, as found by clients,
+// can make, answering 429 Too Many Requests with a Retry-After header once
+// the limit is reached. Requests for the exempt paths, such as probes, are
+// never limited.
+func RateLimit(limiter *ratelimit.Limiter, clients *clientip.Resolver, exempt ...string) func(http.Handler) http.Handler {
+	exemptPaths := make(map[string]bool, len(exempt))
+	for _, path := range exempt {
+		exemptPaths[path] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Preflight requests are answered by CORS and are not counted
+			if r.Method == http.MethodOptions || exemptPaths[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ok, retryAfter := limiter.Allow(clients.IP(r))
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				apierror.Write(w, http.StatusTooManyRequests, "Too many requests, please slow down")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"backend/internal/clientip"
+	"backend/internal/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimit(t *testing.T) {
+	clients, err := clientip.New([]string{"10.0.0.100"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := RateLimit(ratelimit.New(1, 2), clients, "/healthz")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	requestPath := func(remoteAddr, path, forwardedFor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		return requestPath(remoteAddr, "/api/rooms", "")
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := request("10.0.0.1:1234"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d, want 200", i, rec.Code)
+		}
+	}
+
+	rec := request("10.0.0.1:5678")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status %d, want 429", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("Retry-After = %q, want 1", rec.Header().Get("Retry-After"))
+	}
+
+	if rec := request("10.0.0.2:1234"); rec.Code != http.StatusOK {
+		t.Fatalf("other client: status %d, want 200", rec.Code)
+	}
+
+	// Probes are never limited
+	if rec := requestPath("10.0.0.1:5678", "/healthz", ""); rec.Code != http.StatusOK {
+		t.Fatalf("exempt path: status %d, want 200", rec.Code)
+	}
+
+	// Clients behind a trusted proxy are told apart, and an untrusted
+	// client cannot escape its limit by naming another address
+	if rec := requestPath("10.0.0.100:1234", "/api/rooms", "10.0.0.3"); rec.Code != http.StatusOK {
+		t.Fatalf("client behind a proxy: status %d, want 200", rec.Code)
+	}
+	if rec := requestPath("10.0.0.100:1234", "/api/rooms", "10.0.0.1"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("limited client behind a proxy: status %d, want 429", rec.Code)
+	}
+	if rec := requestPath("10.0.0.1:1234", "/api/rooms", "10.0.0.4"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("spoofed X-Forwarded-For: status %d, want 429", rec.Code)
+	}
+}
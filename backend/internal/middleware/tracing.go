@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing starts a server span for each request with otelhttp, continuing
+// the caller's trace if the request has a traceparent header. The span is
+// named after the route pattern once the ServeMux has matched it. It must
+// run inside RequestID so that the request's log lines carry both IDs.
+func Tracing(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(routeAttribute(next), "HTTP",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			if route := route(r); route != "" {
+				return r.Method + " " + route
+			}
+			return r.Method
+		}))
+}
+
+// routeAttribute records the matched route on the request's span. The
+// ServeMux records the matched pattern on the request it was given, so it is
+// only known after next returns.
+func routeAttribute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		if route := route(r); route != "" {
+			trace.SpanFromContext(r.Context()).SetAttributes(semconv.HTTPRoute(route))
+		}
+	})
+}
+
+// route returns the pattern the ServeMux matched, without its method.
+func route(r *http.Request) string {
+	if _, path, ok := strings.Cut(r.Pattern, " "); ok {
+		return path
+	}
+	return r.Pattern
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingNamesSpanAfterRoute(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var inner trace.SpanContext
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/rooms/{id}/messages", func(w http.ResponseWriter, r *http.Request) {
+		inner = trace.SpanContextFromContext(r.Context())
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	handler := Tracing(mux)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/rooms/42/messages", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("ended %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "GET /api/rooms/{id}/messages" || span.SpanKind() != trace.SpanKindServer {
+		t.Errorf("span %q of kind %v, want a server span named after the route", span.Name(), span.SpanKind())
+	}
+	if span.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || span.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("span did not continue the caller's trace: trace %s, parent %s", span.SpanContext().TraceID(), span.Parent().SpanID())
+	}
+	if inner.SpanID() != span.SpanContext().SpanID() {
+		t.Error("handler's context does not carry the request span")
+	}
+	if span.Status().Code != codes.Error {
+		t.Errorf("status = %v, want error for a 500 response", span.Status())
+	}
+
+	attrs := map[string]any{}
+	for _, attr := range span.Attributes() {
+		attrs[string(attr.Key)] = attr.Value.AsInterface()
+	}
+	if attrs["http.route"] != "/api/rooms/{id}/messages" || attrs["http.response.status_code"] != int64(http.StatusInternalServerError) {
+		t.Errorf("attributes = %v", attrs)
+	}
+}
@@ -0,0 +1,96 @@
+package models
+
+import "time"
+
+// Event types sent to clients in the "type" field.
+const (
+	EventTypeMessage        = "message"
+	EventTypeMessageDeleted = "message_deleted"
+	EventTypeError          = "error"
+	EventTypeAck            = "ack"
+	EventTypeClosed         = "closed"
+	EventTypeSubscribed     = "subscribed"
+	EventTypeUnsubscribed   = "unsubscribed"
+)
+
+// Frame types a client sends over WebSocket in the "type" field. A frame
+// without a type is a message.
+const (
+	FrameTypeMessage     = "message"
+	FrameTypeSubscribe   = "subscribe"
+	FrameTypeUnsubscribe = "unsubscribe"
+)
+
+// Error codes carried by ErrorEvent.
+const (
+	ErrorCodeRateLimited  = "rate_limited"
+	ErrorCodeMuted        = "muted"
+	ErrorCodeRoomArchived = "room_archived"
+	ErrorCodeUnavailable  = "unavailable"
+
+	// A frame was malformed, or named a room the client may not use
+	ErrorCodeBadRequest    = "bad_request"
+	ErrorCodeForbidden     = "forbidden"
+	ErrorCodeNotFound      = "not_found"
+	ErrorCodeNotSubscribed = "not_subscribed"
+	ErrorCodeTooManyRooms  = "too_many_rooms"
+
+	// The message was held for review or rejected by a content filter
+	ErrorCodeMessageHeld     = "message_held"
+	ErrorCodeMessageRejected = "message_rejected"
+)
+
+// ErrorEvent is sent over WebSocket when a client's frame is rejected.
+type ErrorEvent struct {
+	Type         string `json:"type"` // always EventTypeError
+	Code         string `json:"code"`
+	Message      string `json:"message"`
+	RetryAfterMs int64  `json:"retryAfterMs,omitempty"` // for rate_limited and muted, when the client may send again
+	Ref          string `json:"ref,omitempty"`          // the ref of the rejected frame, if it had one
+	RoomID       string `json:"roomId,omitempty"`       // the room the rejected frame was for
+}
+
+// AckEvent is sent over WebSocket to the sender of a frame that carried a
+// ref, once its message has been saved.
+type AckEvent struct {
+	Type      string    `json:"type"` // always EventTypeAck
+	Ref       string    `json:"ref"`
+	ID        string    `json:"id"` // the saved message's ID
+	RoomID    string    `json:"roomId"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// MessageDeletedEvent is sent over WebSocket when a moderator deletes a message.
+type MessageDeletedEvent struct {
+	Type   string `json:"type"` // always EventTypeMessageDeleted
+	ID     string `json:"id"`
+	RoomID string `json:"roomId"`
+}
+
+// ClosedEvent ends an event stream or a long-poll subscription that the
+// server closed, such as after a kick or ban. It stands in for the close
+// frame with code 1008 that WebSocket clients receive; clients should not
+// subscribe again without the user's say.
+type ClosedEvent struct {
+	Type   string `json:"type"` // always EventTypeClosed
+	Reason string `json:"reason"`
+}
+
+// Frame is sent by WebSocket clients. Subscribe and unsubscribe frames name
+// a room; message frames carry content for a room, and may leave out the
+// room on a connection opened for one room.
+type Frame struct {
+	Type    string `json:"type,omitempty"` // a FrameType constant; empty means FrameTypeMessage
+	RoomID  string `json:"roomId,omitempty"`
+	Content string `json:"content,omitempty"`
+	Ref     string `json:"ref,omitempty"` // asks for an ack, and tags errors about the frame
+}
+
+// SubscriptionEvent is sent over WebSocket when a connection starts or
+// stops receiving a room's events. Reason says why the server unsubscribed
+// the user, such as a ban; it is empty when the client unsubscribed.
+type SubscriptionEvent struct {
+	Type   string `json:"type"` // EventTypeSubscribed or EventTypeUnsubscribed
+	RoomID string `json:"roomId"`
+	Reason string `json:"reason,omitempty"`
+}
@@ -5,10 +5,55 @@ import "time"
 // MessageDTO is the data transfer object for a message sent over WebSocket.
 // It includes the sender's username for easy display on the frontend.
 type MessageDTO struct {
+	Type      string    `json:"type"` // always EventTypeMessage
 	ID        string    `json:"id"`
 	RoomID    string    `json:"roomId"`
 	SenderID  string    `json:"senderId"`
 	Sender    string    `json:"sender"` // Username of the sender
 	Content   string    `json:"content"`
 	Timestamp time.Time `json:"timestamp"`
+	Mentions  []string  `json:"mentions,omitempty"` // Usernames mentioned in the content
+}
+
+// NewMessageDTO converts a message whose SenderUsername is set into a MessageDTO.
+func NewMessageDTO(message *Message) MessageDTO {
+	return MessageDTO{
+		Type:      EventTypeMessage,
+		ID:        message.ID,
+		RoomID:    message.RoomID,
+		SenderID:  message.SenderID,
+		Sender:    message.SenderUsername,
+		Content:   message.Content,
+		Timestamp: message.Timestamp,
+		Mentions:  message.Mentions,
+	}
+}
+
+// Cursor returns the message's position in its room's history.
+func (m MessageDTO) Cursor() MessageCursor {
+	return MessageCursor{Timestamp: m.Timestamp, ID: m.ID}
+}
+
+// MessageCursor is a position in a room's history, from which clients page
+// forward. Messages are ordered by timestamp and then by ID, so that those
+// sent at the same time keep one order and no page boundary falls between
+// them unseen. A cursor without an ID is after every message sent at its
+// Timestamp.
+type MessageCursor struct {
+	Timestamp time.Time
+	ID        string
+}
+
+// IsZero reports whether c is the zero cursor, which the history endpoint
+// takes to mean the most recent messages.
+func (c MessageCursor) IsZero() bool {
+	return c.Timestamp.IsZero() && c.ID == ""
+}
+
+// Precedes reports whether a message at position comes after c.
+func (c MessageCursor) Precedes(position MessageCursor) bool {
+	if !position.Timestamp.Equal(c.Timestamp) {
+		return position.Timestamp.After(c.Timestamp)
+	}
+	return c.ID != "" && position.ID > c.ID
 }
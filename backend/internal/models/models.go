@@ -7,6 +7,8 @@ type User struct {
 	ID       string `json:"id"`
 	Username string `json:"username"`
 	Password string `json:"-"` // Password is never returned in JSON responses
+	IsAdmin  bool   `json:"isAdmin" db:"is_admin"`
+	Disabled bool   `json:"disabled" db:"disabled"` // Disabled users cannot log in or connect
 }
 
 // ChatRoom represents a chat room in the system.
@@ -15,6 +17,7 @@ type ChatRoom struct {
 	Name     string `json:"name"`
 	OwnerID  string `json:"ownerId" db:"owner_id"`
 	RoomType string `json:"roomType" db:"room_type"` // 'public' or 'private'
+	Archived bool   `json:"archived" db:"archived"`  // Archived rooms are read-only and hidden from room lists
 }
 
 // Message represents a chat message in the system.
@@ -25,11 +28,139 @@ type Message struct {
 	Content        string    `json:"content" db:"content"`
 	Timestamp      time.Time `json:"timestamp" db:"timestamp"`
 	SenderUsername string    `json:"-"` // This field is for internal use and not stored in the DB
+	Mentions       []string  `json:"-"` // Usernames mentioned in the content, stored in message_mentions
 }
 
 // RoomMember represents the relationship between a user and a room.
 type RoomMember struct {
-	RoomID string `json:"roomId" db:"room_id"`
-	UserID string `json:"userId" db:"user_id"`
-	Status string `json:"status" db:"status"` // e.g., "member", "pending"
+	RoomID     string     `json:"roomId" db:"room_id"`
+	UserID     string     `json:"userId" db:"user_id"`
+	Status     string     `json:"status" db:"status"`                    // e.g., "member", "pending"
+	Role       string     `json:"role" db:"role"`                        // "owner", "moderator" or "member"
+	MutedUntil *time.Time `json:"mutedUntil,omitempty" db:"muted_until"` // nil when the member is not muted
+}
+
+// RoomBan records that a user is banned from a room.
+type RoomBan struct {
+	RoomID    string    `json:"roomId" db:"room_id"`
+	UserID    string    `json:"userId" db:"user_id"`
+	BannedBy  string    `json:"bannedBy" db:"banned_by"`
+	Reason    string    `json:"reason" db:"reason"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+// UserBlock records that one user has blocked another.
+type UserBlock struct {
+	BlockerID       string    `json:"blockerId" db:"blocker_id"`
+	BlockedID       string    `json:"blockedId" db:"blocked_id"`
+	BlockedUsername string    `json:"username" db:"-"`
+	CreatedAt       time.Time `json:"createdAt" db:"created_at"`
+}
+
+// ModerationAction is an entry in a room's moderation log.
+type ModerationAction struct {
+	ID        string     `json:"id" db:"id"`
+	RoomID    string     `json:"roomId" db:"room_id"`
+	ActorID   string     `json:"actorId" db:"actor_id"`
+	TargetID  string     `json:"targetId" db:"target_id"`
+	Action    string     `json:"action" db:"action"` // e.g., "mute", "kick", "ban"
+	Reason    string     `json:"reason" db:"reason"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" db:"expires_at"` // when a mute ends
+	ReportID  string     `json:"reportId,omitempty" db:"report_id"`   // set when the action resolved a report
+	CreatedAt time.Time  `json:"createdAt" db:"created_at"`
+}
+
+// MessageMention records that a message mentioned a user with @username.
+type MessageMention struct {
+	MessageID string `json:"messageId" db:"message_id"`
+	UserID    string `json:"userId" db:"user_id"`
+}
+
+// HeldMessage is a message that a content filter held back for review. It is
+// only delivered once a moderator approves it.
+type HeldMessage struct {
+	ID             string    `json:"id" db:"id"`
+	RoomID         string    `json:"roomId" db:"room_id"`
+	SenderID       string    `json:"senderId" db:"sender_id"`
+	SenderUsername string    `json:"sender,omitempty" db:"-"` // filled in for moderators
+	Content        string    `json:"content" db:"content"`    // with any redactions applied
+	Reason         string    `json:"reason" db:"reason"`
+	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
+}
+
+// MessageReport is a user's complaint about a message. Content and SentAt are
+// a snapshot of the message taken when it was reported.
+type MessageReport struct {
+	ID               string     `json:"id" db:"id"`
+	MessageID        string     `json:"messageId" db:"message_id"`
+	RoomID           string     `json:"roomId" db:"room_id"`
+	ReporterID       string     `json:"reporterId" db:"reporter_id"`
+	ReporterUsername string     `json:"reporter,omitempty" db:"-"` // filled in for moderators
+	SenderID         string     `json:"senderId" db:"sender_id"`
+	SenderUsername   string     `json:"sender,omitempty" db:"-"` // filled in for moderators
+	Category         string     `json:"category" db:"category"`  // e.g., "spam", "harassment"
+	Details          string     `json:"details" db:"details"`
+	Content          string     `json:"content" db:"content"`
+	SentAt           time.Time  `json:"sentAt" db:"sent_at"`
+	Status           string     `json:"status" db:"status"`         // "open", "resolved" or "dismissed"
+	Resolution       string     `json:"resolution" db:"resolution"` // the action taken, e.g. "ban"
+	ResolvedBy       string     `json:"resolvedBy,omitempty" db:"resolved_by"`
+	ResolvedAt       *time.Time `json:"resolvedAt,omitempty" db:"resolved_at"`
+	CreatedAt        time.Time  `json:"createdAt" db:"created_at"`
+}
+
+// Session describes a live connection receiving room events, over WebSocket,
+// an event stream or long-polling. A WebSocket connection may subscribe to
+// several rooms; the other transports receive one room's events.
+type Session struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"userId"`
+	Username    string    `json:"username"`
+	Rooms       []string  `json:"rooms"`     // IDs of the rooms subscribed to
+	Transport   string    `json:"transport"` // "websocket", "sse" or "poll"
+	RemoteAddr  string    `json:"remoteAddr"`
+	ConnectedAt time.Time `json:"connectedAt"`
+}
+
+// HubStatus is a snapshot of the hub, for diagnostics.
+type HubStatus struct {
+	Clients int       `json:"clients"`
+	Rooms   []HubRoom `json:"rooms"`
+}
+
+// HubRoom lists the sessions subscribed to one room.
+type HubRoom struct {
+	RoomID   string      `json:"roomId"`
+	Clients  int         `json:"clients"`
+	Sessions []HubClient `json:"sessions"`
+}
+
+// HubClient is a session with the state of its send queue. A queue that
+// stays near its capacity belongs to a client that is not keeping up.
+type HubClient struct {
+	Session
+	Queued        int `json:"queued"`
+	QueueCapacity int `json:"queueCapacity"`
+}
+
+// SiteStats summarizes the accounts, rooms and messages in the database.
+type SiteStats struct {
+	Users         int         `json:"users"`
+	Admins        int         `json:"admins"`
+	DisabledUsers int         `json:"disabledUsers"`
+	Rooms         int         `json:"rooms"`
+	PublicRooms   int         `json:"publicRooms"`
+	PrivateRooms  int         `json:"privateRooms"`
+	ArchivedRooms int         `json:"archivedRooms"`
+	Members       int         `json:"members"`
+	Messages      int         `json:"messages"`
+	RoomStats     []RoomStats `json:"roomStats"` // busiest first
+}
+
+// RoomStats counts the members and messages of one room.
+type RoomStats struct {
+	RoomID   string `json:"roomId"`
+	Name     string `json:"name"`
+	Members  int    `json:"members"`
+	Messages int    `json:"messages"`
 }
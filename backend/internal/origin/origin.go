@@ -0,0 +1,163 @@
+// Package origin decides which browser origins may call the API and open
+// WebSocket connections.
+package origin
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// regexPrefix marks a pattern as a regular expression.
+const regexPrefix = "regex:"
+
+// Policy is a list of allowed origins. A pattern is one of:
+//
+//   - an exact origin: "https://chat.example.com"
+//   - a wildcard subdomain: "https://*.example.com" allows any subdomain of
+//     example.com, at any depth, but not example.com itself
+//   - a regular expression: "regex:^https://pr-[0-9]+\.preview\.example\.com$",
+//     which must match the whole origin
+//
+// Schemes and hosts compare case-insensitively, and a port must match
+// exactly: "https://*.example.com" does not allow "https://a.example.com:8443".
+type Policy struct {
+	exact     map[string]bool
+	wildcards []wildcard
+	regexps   []*regexp.Regexp
+}
+
+// wildcard is a parsed "scheme://*.domain[:port]" pattern.
+type wildcard struct {
+	scheme string
+	suffix string // ".domain"
+	port   string
+}
+
+// New parses patterns into a Policy. It reports the first invalid pattern.
+func New(patterns []string) (*Policy, error) {
+	p := &Policy{exact: make(map[string]bool)}
+	for _, pattern := range patterns {
+		if err := p.add(pattern); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Validate reports whether pattern is a valid origin pattern.
+func Validate(pattern string) error {
+	return (&Policy{exact: make(map[string]bool)}).add(pattern)
+}
+
+// add parses one pattern into the policy.
+func (p *Policy) add(pattern string) error {
+	if expr, ok := strings.CutPrefix(pattern, regexPrefix); ok {
+		re, err := regexp.Compile(`^(?:` + expr + `)$`)
+		if err != nil {
+			return fmt.Errorf("origin pattern %q: %w", pattern, err)
+		}
+		p.regexps = append(p.regexps, re)
+		return nil
+	}
+
+	scheme, host, port, err := split(pattern)
+	if err != nil {
+		return fmt.Errorf("origin pattern %q: %w; use a form such as \"https://chat.example.com\" or \"https://*.example.com\"", pattern, err)
+	}
+	if domain, ok := strings.CutPrefix(host, "*."); ok {
+		if domain == "" || strings.Contains(domain, "*") {
+			return fmt.Errorf("origin pattern %q: a wildcard must be followed by a domain", pattern)
+		}
+		p.wildcards = append(p.wildcards, wildcard{scheme: scheme, suffix: "." + domain, port: port})
+		return nil
+	}
+	if strings.Contains(host, "*") {
+		return fmt.Errorf("origin pattern %q: a wildcard may only replace the leftmost labels, as in \"https://*.example.com\"", pattern)
+	}
+	p.exact[join(scheme, host, port)] = true
+	return nil
+}
+
+// Allows reports whether a request from origin may be served. A nil Policy
+// allows nothing.
+func (p *Policy) Allows(origin string) bool {
+	if p == nil {
+		return false
+	}
+	scheme, host, port, err := split(origin)
+	if err != nil || strings.Contains(host, "*") {
+		return false
+	}
+	if p.exact[join(scheme, host, port)] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		if scheme == w.scheme && port == w.port && len(host) > len(w.suffix) && strings.HasSuffix(host, w.suffix) {
+			return true
+		}
+	}
+	normalized := join(scheme, host, port)
+	for _, re := range p.regexps {
+		if re.MatchString(normalized) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsRequest reports whether the request may be served given its Origin
+// header. Requests without an Origin do not come from a browser page on
+// another site, and requests from the server's own origin are not
+// cross-origin, so both are allowed.
+func (p *Policy) AllowsRequest(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || SameOrigin(r) || p.Allows(origin)
+}
+
+// Check is AllowsRequest, but logs a rejection. It suits
+// websocket.Upgrader.CheckOrigin.
+func (p *Policy) Check(r *http.Request) bool {
+	if p.AllowsRequest(r) {
+		return true
+	}
+	slog.WarnContext(r.Context(), "origin rejected", "origin", r.Header.Get("Origin"), "method", r.Method, "path", r.URL.Path)
+	return false
+}
+
+// SameOrigin reports whether the request's Origin names the host it was sent to.
+func SameOrigin(r *http.Request) bool {
+	u, err := url.Parse(r.Header.Get("Origin"))
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
+
+// split breaks an origin into its lower-cased scheme, host and port. The
+// origin may not have a path, query, fragment or user information.
+func split(origin string) (scheme, host, port string, err error) {
+	u, err := url.Parse(origin)
+	switch {
+	case err != nil:
+		return "", "", "", fmt.Errorf("not a URL")
+	case u.Scheme != "http" && u.Scheme != "https":
+		return "", "", "", fmt.Errorf("the scheme must be http or https")
+	case u.Hostname() == "":
+		return "", "", "", fmt.Errorf("missing host")
+	case u.User != nil || u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.Opaque != "":
+		return "", "", "", fmt.Errorf("an origin is only a scheme, host and port")
+	}
+	return u.Scheme, strings.ToLower(u.Hostname()), u.Port(), nil
+}
+
+// join rebuilds a normalized origin.
+func join(scheme, host, port string) string {
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]" // IPv6
+	}
+	if port == "" {
+		return scheme + "://" + host
+	}
+	return scheme + "://" + host + ":" + port
+}
@@ -0,0 +1,135 @@
+package origin
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAllows(t *testing.T) {
+	policy, err := New([]string{
+		"http://localhost:3000",
+		"https://Chat.Example.com",
+		"https://*.example.org",
+		"https://*.staging.example.net:8443",
+		`regex:https://pr-[0-9]+\.preview\.example\.io`,
+		"http://[::1]:3000",
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		// Exact
+		{"http://localhost:3000", true},
+		{"https://chat.example.com", true},
+		{"HTTPS://CHAT.EXAMPLE.COM", true},
+		{"http://localhost:3001", false},
+		{"https://localhost:3000", false},
+		{"http://chat.example.com", false},
+		{"https://chat.example.com.evil.test", false},
+		{"http://[::1]:3000", true},
+
+		// Wildcard subdomains
+		{"https://app.example.org", true},
+		{"https://a.b.example.org", true},
+		{"https://example.org", false},
+		{"https://evilexample.org", false},
+		{"http://app.example.org", false},
+		{"https://app.example.org:8443", false},
+		{"https://web.staging.example.net:8443", true},
+		{"https://web.staging.example.net", false},
+
+		// Regular expressions match the whole origin
+		{"https://pr-42.preview.example.io", true},
+		{"https://pr-42.preview.example.io.evil.test", false},
+		{"https://pr-x.preview.example.io", false},
+
+		// Not origins at all
+		{"", false},
+		{"null", false},
+		{"https://chat.example.com/path", false},
+		{"file:///etc/passwd", false},
+		{"https://*.example.org", false},
+	}
+	for _, tc := range tests {
+		if got := policy.Allows(tc.origin); got != tc.want {
+			t.Errorf("Allows(%q) = %t, want %t", tc.origin, got, tc.want)
+		}
+	}
+}
+
+func TestNewRejectsInvalidPatterns(t *testing.T) {
+	tests := []struct {
+		pattern, want string
+	}{
+		{"chat.example.com", "scheme must be http or https"},
+		{"https://chat.example.com/", "only a scheme, host and port"},
+		{"https://user@chat.example.com", "only a scheme, host and port"},
+		{"https://", "missing host"},
+		{"*", "scheme must be http or https"},
+		{"https://*", "may only replace the leftmost labels"},
+		{"https://*.", "wildcard must be followed by a domain"},
+		{"https://app.*.example.com", "may only replace the leftmost labels"},
+		{"https://*.*.example.com", "wildcard must be followed by a domain"},
+		{"regex:https://(", "missing closing )"},
+	}
+	for _, tc := range tests {
+		if _, err := New([]string{tc.pattern}); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("New(%q) error = %v, want it to contain %q", tc.pattern, err, tc.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	policy, err := New([]string{"https://chat.example.com"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	request := func(origin string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "https://api.example.com/api/ws", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		return req
+	}
+
+	if !policy.Check(request("")) {
+		t.Error("a request without an Origin was refused")
+	}
+	if !policy.Check(request("https://api.example.com")) {
+		t.Error("a same-origin request was refused")
+	}
+	if !policy.Check(request("https://chat.example.com")) {
+		t.Error("an allowed origin was refused")
+	}
+	if logs.Len() != 0 {
+		t.Errorf("allowed requests were logged:\n%s", logs.String())
+	}
+
+	if policy.Check(request("https://evil.test")) {
+		t.Fatal("a foreign origin was allowed")
+	}
+	for _, want := range []string{`msg="origin rejected"`, "origin=https://evil.test", "path=/api/ws"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("log lacks %q:\n%s", want, logs.String())
+		}
+	}
+
+	// Without a policy, only non-browser and same-origin requests pass
+	var none *Policy
+	if !none.Check(request("")) || !none.Check(request("https://api.example.com")) || none.Check(request("https://chat.example.com")) {
+		t.Error("a nil Policy should allow only requests without a foreign Origin")
+	}
+}
@@ -0,0 +1,108 @@
+package protocol
+
+import (
+	"backend/internal/models"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/gorilla/websocket"
+)
+
+// jsonCodec sends each event as its own JSON text message, so that clients
+// can parse a message without splitting it.
+type jsonCodec struct{}
+
+// Name implements Codec.
+func (jsonCodec) Name() string {
+	return JSON
+}
+
+// MessageType implements Codec.
+func (jsonCodec) MessageType() int {
+	return websocket.TextMessage
+}
+
+// Batches implements Codec.
+func (jsonCodec) Batches() bool {
+	return false
+}
+
+// AppendEvent implements Codec.
+func (jsonCodec) AppendEvent(message []byte, event *Event) []byte {
+	return append(message, event.json...)
+}
+
+// DecodeEvents implements Codec. Servers from before subprotocols were
+// introduced batched events into one message, one per line, so a message
+// may hold several JSON values.
+func (jsonCodec) DecodeEvents(message []byte) ([]any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(message))
+	var events []any
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				return events, nil
+			}
+			return nil, err
+		}
+		event, err := decodeJSONEvent(raw)
+		if err != nil {
+			return nil, err
+		}
+		if event != nil {
+			events = append(events, event)
+		}
+	}
+}
+
+// decodeJSONEvent decodes one event by its type. It returns nil for types
+// it does not know.
+func decodeJSONEvent(raw json.RawMessage) (any, error) {
+	var header struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return nil, err
+	}
+	switch header.Type {
+	case models.EventTypeMessage:
+		return decodeJSON[models.MessageDTO](raw)
+	case models.EventTypeMessageDeleted:
+		return decodeJSON[models.MessageDeletedEvent](raw)
+	case models.EventTypeError:
+		return decodeJSON[models.ErrorEvent](raw)
+	case models.EventTypeAck:
+		return decodeJSON[models.AckEvent](raw)
+	case models.EventTypeClosed:
+		return decodeJSON[models.ClosedEvent](raw)
+	case models.EventTypeSubscribed, models.EventTypeUnsubscribed:
+		return decodeJSON[models.SubscriptionEvent](raw)
+	}
+	return nil, nil
+}
+
+// decodeJSON decodes an event of type T.
+func decodeJSON[T any](raw json.RawMessage) (any, error) {
+	var event T
+	if err := json.Unmarshal(raw, &event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// EncodeFrame implements Codec.
+func (jsonCodec) EncodeFrame(frame models.Frame) ([]byte, error) {
+	return json.Marshal(frame)
+}
+
+// DecodeFrames implements Codec. A JSON message holds one frame.
+func (jsonCodec) DecodeFrames(message []byte) ([]models.Frame, error) {
+	var frame models.Frame
+	if err := json.Unmarshal(message, &frame); err != nil {
+		return nil, err
+	}
+	return []models.Frame{frame}, nil
+}
@@ -0,0 +1,169 @@
+package protocol
+
+import (
+	"backend/internal/models"
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// A MessagePack message holds one or more MessagePack maps back to back,
+// each an event or a frame with the same keys as its JSON form. Times use
+// the MessagePack timestamp extension. Decoders ignore keys they do not
+// know, and skip events of types they do not know.
+
+// ErrMalformed is returned when a MessagePack message cannot be decoded.
+var ErrMalformed = errors.New("malformed MessagePack message")
+
+// msgpackCodec sends events as MessagePack maps, batching queued events
+// into one message.
+type msgpackCodec struct{}
+
+// Name implements Codec.
+func (msgpackCodec) Name() string {
+	return MessagePack
+}
+
+// MessageType implements Codec.
+func (msgpackCodec) MessageType() int {
+	return websocket.BinaryMessage
+}
+
+// Batches implements Codec.
+func (msgpackCodec) Batches() bool {
+	return true
+}
+
+// AppendEvent implements Codec.
+func (msgpackCodec) AppendEvent(message []byte, event *Event) []byte {
+	return append(message, event.msgpack...)
+}
+
+// DecodeEvents implements Codec.
+func (msgpackCodec) DecodeEvents(message []byte) ([]any, error) {
+	var events []any
+	err := eachMessagePackValue(message, func(raw msgpack.RawMessage) error {
+		event, err := decodeMessagePackEvent(raw)
+		if event != nil {
+			events = append(events, event)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// decodeMessagePackEvent decodes one event by its type. It returns nil for
+// types it does not know.
+func decodeMessagePackEvent(raw msgpack.RawMessage) (any, error) {
+	var header struct {
+		Type string `json:"type"`
+	}
+	if err := unmarshalMessagePack(raw, &header); err != nil {
+		return nil, err
+	}
+	// Timestamps decode in local time, and events carry UTC as in JSON
+	switch header.Type {
+	case models.EventTypeMessage:
+		var event models.MessageDTO
+		if err := unmarshalMessagePack(raw, &event); err != nil {
+			return nil, err
+		}
+		event.Timestamp = event.Timestamp.UTC()
+		return event, nil
+	case models.EventTypeMessageDeleted:
+		return decodeMessagePack[models.MessageDeletedEvent](raw)
+	case models.EventTypeError:
+		return decodeMessagePack[models.ErrorEvent](raw)
+	case models.EventTypeAck:
+		var event models.AckEvent
+		if err := unmarshalMessagePack(raw, &event); err != nil {
+			return nil, err
+		}
+		event.Timestamp = event.Timestamp.UTC()
+		return event, nil
+	case models.EventTypeClosed:
+		return decodeMessagePack[models.ClosedEvent](raw)
+	case models.EventTypeSubscribed, models.EventTypeUnsubscribed:
+		return decodeMessagePack[models.SubscriptionEvent](raw)
+	}
+	return nil, nil
+}
+
+// decodeMessagePack decodes an event of type T.
+func decodeMessagePack[T any](raw msgpack.RawMessage) (any, error) {
+	var event T
+	if err := unmarshalMessagePack(raw, &event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// EncodeFrame implements Codec.
+func (msgpackCodec) EncodeFrame(frame models.Frame) ([]byte, error) {
+	return marshalMessagePack(frame)
+}
+
+// DecodeFrames implements Codec. A message may hold several frames.
+func (msgpackCodec) DecodeFrames(message []byte) ([]models.Frame, error) {
+	var frames []models.Frame
+	err := eachMessagePackValue(message, func(raw msgpack.RawMessage) error {
+		var frame models.Frame
+		if err := unmarshalMessagePack(raw, &frame); err != nil {
+			return err
+		}
+		frames = append(frames, frame)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return frames, nil
+}
+
+// eachMessagePackValue calls f with each of the values in a message, which
+// must hold at least one.
+func eachMessagePackValue(message []byte, f func(raw msgpack.RawMessage) error) error {
+	if len(message) == 0 {
+		return fmt.Errorf("%w: empty message", ErrMalformed)
+	}
+	reader := bytes.NewReader(message)
+	decoder := msgpack.NewDecoder(reader)
+	for reader.Len() > 0 {
+		var raw msgpack.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+		if err := f(raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// marshalMessagePack encodes a value with the keys of its JSON form.
+func marshalMessagePack(value any) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := msgpack.NewEncoder(&buf)
+	encoder.SetCustomStructTag("json")
+	encoder.UseCompactInts(true)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unmarshalMessagePack decodes one value encoded by marshalMessagePack.
+func unmarshalMessagePack(raw msgpack.RawMessage, value any) error {
+	decoder := msgpack.NewDecoder(bytes.NewReader(raw))
+	decoder.SetCustomStructTag("json")
+	if err := decoder.Decode(value); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	return nil
+}
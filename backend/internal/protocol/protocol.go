@@ -0,0 +1,152 @@
+// Package protocol encodes the events the server sends over WebSocket and
+// the frames clients send back. Clients choose an encoding with the
+// Sec-WebSocket-Protocol header: JSON text messages, one event per message,
+// or MessagePack binary messages, which may hold several events.
+package protocol
+
+import (
+	"backend/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Subprotocols clients may offer in the Sec-WebSocket-Protocol header.
+const (
+	JSON        = "chat.v1.json"
+	MessagePack = "chat.v1.msgpack"
+)
+
+// ErrUnsupported is returned by Negotiate when a client offers no
+// subprotocol the server supports.
+var ErrUnsupported = errors.New("unsupported subprotocol")
+
+// Codec encodes and decodes the messages of one subprotocol.
+type Codec interface {
+	// Name returns the codec's subprotocol.
+	Name() string
+
+	// MessageType returns the type of WebSocket message the codec's
+	// messages are sent as, websocket.TextMessage or websocket.BinaryMessage.
+	MessageType() int
+
+	// Batches reports whether one message may carry several events.
+	Batches() bool
+
+	// AppendEvent appends an event to a message. A codec that does not
+	// batch must be given an empty message.
+	AppendEvent(message []byte, event *Event) []byte
+
+	// DecodeEvents decodes the events in a message from the server, as
+	// values of the models event types. Events of types it does not know
+	// are skipped, so that clients keep working when new ones are added.
+	DecodeEvents(message []byte) ([]any, error)
+
+	// EncodeFrame encodes a frame as a message to the server.
+	EncodeFrame(frame models.Frame) ([]byte, error)
+
+	// DecodeFrames decodes the frames in a message from a client.
+	DecodeFrames(message []byte) ([]models.Frame, error)
+}
+
+// codecs holds the supported codecs by subprotocol.
+var codecs = map[string]Codec{
+	JSON:        jsonCodec{},
+	MessagePack: msgpackCodec{},
+}
+
+// Subprotocols returns the supported subprotocols.
+func Subprotocols() []string {
+	return []string{JSON, MessagePack}
+}
+
+// Lookup returns the codec for the subprotocol a server selected. Servers
+// that select none speak JSON.
+func Lookup(name string) (Codec, bool) {
+	if name == "" {
+		return jsonCodec{}, true
+	}
+	codec, ok := codecs[name]
+	return codec, ok
+}
+
+// Negotiate returns the codec for the first of the subprotocols a client
+// offered that is supported. Clients that offer none get JSON, as they did
+// before subprotocols were introduced. It returns ErrUnsupported if every
+// offered subprotocol is unknown.
+func Negotiate(offered []string) (Codec, error) {
+	if len(offered) == 0 {
+		return jsonCodec{}, nil
+	}
+	for _, name := range offered {
+		if codec, ok := codecs[name]; ok {
+			return codec, nil
+		}
+	}
+	return nil, ErrUnsupported
+}
+
+// Event is an event encoded once for every subscriber, in each encoding.
+// It is not changed after NewEvent, so it may be shared between goroutines.
+type Event struct {
+	value   any
+	json    []byte
+	msgpack []byte
+}
+
+// NewEvent encodes an event. value must be one of the models event types:
+// MessageDTO, MessageDeletedEvent, ErrorEvent, AckEvent, ClosedEvent or
+// SubscriptionEvent.
+func NewEvent(value any) (*Event, error) {
+	if err := checkEvent(value); err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %T: %w", value, err)
+	}
+	packed, err := marshalMessagePack(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %T: %w", value, err)
+	}
+	return &Event{value: value, json: encoded, msgpack: packed}, nil
+}
+
+// checkEvent returns an error unless value is one of the event types, with
+// a type that matches it.
+func checkEvent(value any) error {
+	var eventType string
+	var allowed []string
+	switch event := value.(type) {
+	case models.MessageDTO:
+		eventType, allowed = event.Type, []string{models.EventTypeMessage}
+	case models.MessageDeletedEvent:
+		eventType, allowed = event.Type, []string{models.EventTypeMessageDeleted}
+	case models.ErrorEvent:
+		eventType, allowed = event.Type, []string{models.EventTypeError}
+	case models.AckEvent:
+		eventType, allowed = event.Type, []string{models.EventTypeAck}
+	case models.ClosedEvent:
+		eventType, allowed = event.Type, []string{models.EventTypeClosed}
+	case models.SubscriptionEvent:
+		eventType, allowed = event.Type, []string{models.EventTypeSubscribed, models.EventTypeUnsubscribed}
+	default:
+		return fmt.Errorf("unknown event %T", value)
+	}
+	if !slices.Contains(allowed, eventType) {
+		return fmt.Errorf("%T has type %q", value, eventType)
+	}
+	return nil
+}
+
+// Value returns the event NewEvent was given.
+func (e *Event) Value() any {
+	return e.value
+}
+
+// JSON returns the event encoded as JSON, as sent over event streams and
+// long-polls.
+func (e *Event) JSON() []byte {
+	return e.json
+}
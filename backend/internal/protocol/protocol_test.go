@@ -0,0 +1,258 @@
+package protocol
+
+import (
+	"backend/internal/models"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// testEvents holds every event type, with fields that are easy to get
+// wrong: empty and multi-line strings, nanosecond times and lists.
+var testEvents = []any{
+	models.MessageDTO{
+		Type:      models.EventTypeMessage,
+		ID:        "m1",
+		RoomID:    "r1",
+		SenderID:  "u1",
+		Sender:    "alice",
+		Content:   "line one\nline two {\"type\":\"message\"} ✓",
+		Timestamp: time.Date(2024, 5, 1, 10, 0, 0, 123456789, time.UTC),
+		Mentions:  []string{"bob", "carol"},
+	},
+	models.MessageDTO{
+		Type:      models.EventTypeMessage,
+		ID:        "m2",
+		RoomID:    "r1",
+		SenderID:  "u2",
+		Sender:    "bob",
+		Content:   "",
+		Timestamp: time.Date(1969, 12, 31, 23, 59, 59, 5, time.UTC),
+	},
+	models.MessageDeletedEvent{Type: models.EventTypeMessageDeleted, ID: "m1", RoomID: "r1"},
+	models.ErrorEvent{
+		Type:         models.EventTypeError,
+		Code:         models.ErrorCodeRateLimited,
+		Message:      "Too many messages, retry in 250ms",
+		RetryAfterMs: 251,
+		Ref:          "ref-1",
+		RoomID:       "r1",
+	},
+	models.ErrorEvent{Type: models.EventTypeError, Code: models.ErrorCodeUnavailable, Message: "Your message could not be sent, please try again"},
+	models.AckEvent{
+		Type:      models.EventTypeAck,
+		Ref:       "ref-2",
+		ID:        "m3",
+		RoomID:    "r2",
+		Timestamp: time.Date(2024, 5, 1, 10, 0, 1, 0, time.UTC),
+	},
+	models.ClosedEvent{Type: models.EventTypeClosed, Reason: "You were banned from the room"},
+	models.SubscriptionEvent{Type: models.EventTypeSubscribed, RoomID: "r2"},
+	models.SubscriptionEvent{Type: models.EventTypeUnsubscribed, RoomID: "r2", Reason: "You were kicked from the room"},
+}
+
+// testFrames holds every frame type.
+var testFrames = []models.Frame{
+	{Type: models.FrameTypeMessage, RoomID: "r1", Content: "hello\nworld", Ref: "ref-1"},
+	{Type: models.FrameTypeMessage, Content: "no room or ref"},
+	{Type: models.FrameTypeSubscribe, RoomID: "r1"},
+	{Type: models.FrameTypeUnsubscribe, RoomID: "r1", Ref: "ref-2"},
+}
+
+func TestEventsRoundTrip(t *testing.T) {
+	for _, name := range Subprotocols() {
+		t.Run(name, func(t *testing.T) {
+			codec, _ := Lookup(name)
+			var got []any
+			var message []byte
+			for _, value := range testEvents {
+				event, err := NewEvent(value)
+				if err != nil {
+					t.Fatalf("NewEvent(%#v): %v", value, err)
+				}
+				message = codec.AppendEvent(message, event)
+				// Codecs that do not batch send each event on its own
+				if !codec.Batches() {
+					got = append(got, decodeEvents(t, codec, message)...)
+					message = nil
+				}
+			}
+			if message != nil {
+				got = append(got, decodeEvents(t, codec, message)...)
+			}
+			if !reflect.DeepEqual(got, testEvents) {
+				t.Errorf("decoded %#v\nwant %#v", got, testEvents)
+			}
+		})
+	}
+}
+
+// decodeEvents decodes a message, failing the test if it cannot.
+func decodeEvents(t *testing.T, codec Codec, message []byte) []any {
+	t.Helper()
+	events, err := codec.DecodeEvents(message)
+	if err != nil {
+		t.Fatalf("DecodeEvents(%q): %v", message, err)
+	}
+	return events
+}
+
+func TestFramesRoundTrip(t *testing.T) {
+	for _, name := range Subprotocols() {
+		t.Run(name, func(t *testing.T) {
+			codec, _ := Lookup(name)
+			for _, frame := range testFrames {
+				message, err := codec.EncodeFrame(frame)
+				if err != nil {
+					t.Fatalf("EncodeFrame(%#v): %v", frame, err)
+				}
+				got, err := codec.DecodeFrames(message)
+				if err != nil {
+					t.Fatalf("DecodeFrames(%q): %v", message, err)
+				}
+				if want := []models.Frame{frame}; !reflect.DeepEqual(got, want) {
+					t.Errorf("decoded %#v, want %#v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMessagePackFrames(t *testing.T) {
+	codec, _ := Lookup(MessagePack)
+
+	// One message may carry several frames
+	var batch []byte
+	for _, frame := range testFrames {
+		encoded, err := codec.EncodeFrame(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		batch = append(batch, encoded...)
+	}
+	if frames, err := codec.DecodeFrames(batch); err != nil || !reflect.DeepEqual(frames, testFrames) {
+		t.Errorf("batch decoded as %#v, %v", frames, err)
+	}
+
+	// Frames are maps; other values are refused
+	notMap, err := msgpack.Marshal("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := codec.DecodeFrames(notMap); !errors.Is(err, ErrMalformed) {
+		t.Errorf("decoding a string frame: %v, want ErrMalformed", err)
+	}
+}
+
+func TestMessagePackIsStandard(t *testing.T) {
+	// Any MessagePack library can read events, as maps with the keys of
+	// their JSON form and times as timestamps
+	event, err := NewEvent(testEvents[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err := msgpack.Unmarshal(event.msgpack, &decoded); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	message := testEvents[0].(models.MessageDTO)
+	if decoded["type"] != models.EventTypeMessage || decoded["roomId"] != message.RoomID || decoded["content"] != message.Content {
+		t.Errorf("decoded %#v", decoded)
+	}
+	if timestamp, ok := decoded["timestamp"].(time.Time); !ok || !timestamp.Equal(message.Timestamp) {
+		t.Errorf("timestamp decoded as %#v, want %v", decoded["timestamp"], message.Timestamp)
+	}
+}
+
+func TestMessagePackRejectsTruncatedMessages(t *testing.T) {
+	codec, _ := Lookup(MessagePack)
+	for _, value := range testEvents {
+		event, err := NewEvent(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		message := codec.AppendEvent(nil, event)
+		for n := 1; n < len(message); n++ {
+			if events, err := codec.DecodeEvents(message[:n]); !errors.Is(err, ErrMalformed) {
+				t.Fatalf("%T cut to %d of %d bytes decoded as %#v, %v", value, n, len(message), events, err)
+			}
+		}
+	}
+	if _, err := codec.DecodeEvents(nil); !errors.Is(err, ErrMalformed) {
+		t.Errorf("empty message: %v, want ErrMalformed", err)
+	}
+}
+
+func TestDecodersSkipUnknownEvents(t *testing.T) {
+	closed := models.ClosedEvent{Type: models.EventTypeClosed, Reason: "bye"}
+	event, err := NewEvent(closed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Newer servers may send new event types, and new keys
+	codec, _ := Lookup(MessagePack)
+	var message []byte
+	for _, value := range []map[string]any{
+		{"type": "typing", "user": "bob"},
+		{"type": models.EventTypeClosed, "reason": "bye", "code": 4001},
+	} {
+		encoded, err := msgpack.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		message = append(message, encoded...)
+	}
+	if events, err := codec.DecodeEvents(message); err != nil || !reflect.DeepEqual(events, []any{closed}) {
+		t.Errorf("MessagePack decoded %#v, %v", events, err)
+	}
+
+	// Older servers batched JSON events one per line
+	jsonCodec, _ := Lookup(JSON)
+	message = []byte(`{"type":"typing","user":"bob"}` + "\n" + string(event.JSON()))
+	if events, err := jsonCodec.DecodeEvents(message); err != nil || !reflect.DeepEqual(events, []any{closed}) {
+		t.Errorf("JSON decoded %#v, %v", events, err)
+	}
+}
+
+func TestNewEventRejectsUnknownEvents(t *testing.T) {
+	for _, value := range []any{
+		"message",
+		&models.ClosedEvent{Type: models.EventTypeClosed},
+		models.ClosedEvent{Type: models.EventTypeError},
+		models.SubscriptionEvent{Type: models.EventTypeClosed},
+	} {
+		if _, err := NewEvent(value); err == nil {
+			t.Errorf("NewEvent(%#v) succeeded", value)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for _, test := range []struct {
+		offered []string
+		want    string
+		err     error
+	}{
+		{nil, JSON, nil},
+		{[]string{JSON}, JSON, nil},
+		{[]string{"chat.v2.msgpack", MessagePack, JSON}, MessagePack, nil},
+		{[]string{"chat.v2.msgpack"}, "", ErrUnsupported},
+	} {
+		codec, err := Negotiate(test.offered)
+		if err != test.err || (codec != nil && codec.Name() != test.want) {
+			t.Errorf("Negotiate(%q) = %v, %v; want %s, %v", test.offered, codec, err, test.want, test.err)
+		}
+	}
+
+	if codec, ok := Lookup(""); !ok || codec.Name() != JSON || codec.MessageType() != websocket.TextMessage {
+		t.Errorf(`Lookup("") = %v, %v; want JSON`, codec, ok)
+	}
+	if codec, ok := Lookup(MessagePack); !ok || codec.MessageType() != websocket.BinaryMessage {
+		t.Errorf("Lookup(MessagePack) = %v, %v", codec, ok)
+	}
+}
@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterBurstAndRefill(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := New(2, 3) // 2 per second, bursts of 3
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("alice"); !ok {
+			t.Fatalf("request %d denied within burst", i)
+		}
+	}
+	ok, wait := l.Allow("alice")
+	if ok {
+		t.Fatal("request beyond burst allowed")
+	}
+	if wait != 500*time.Millisecond {
+		t.Fatalf("retry after = %v, want 500ms", wait)
+	}
+
+	// Other keys have their own bucket
+	if ok, _ := l.Allow("bob"); !ok {
+		t.Fatal("bob denied by alice's bucket")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := l.Allow("alice"); !ok {
+		t.Fatal("request denied after refill")
+	}
+	if ok, _ := l.Allow("alice"); ok {
+		t.Fatal("refill granted more than one token")
+	}
+}
+
+func TestLimiterRefund(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := New(1, 2)
+	l.now = func() time.Time { return now }
+
+	l.Allow("alice")
+	l.Allow("alice")
+	l.Refund("alice")
+	if ok, _ := l.Allow("alice"); !ok {
+		t.Fatal("refunded token not available")
+	}
+	if ok, _ := l.Allow("alice"); ok {
+		t.Fatal("refund granted more than one token")
+	}
+
+	// Refunds never fill a bucket beyond its burst
+	l.Allow("bob")
+	l.Refund("bob")
+	l.Refund("bob")
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("bob"); !ok {
+			t.Fatalf("request %d denied within burst", i)
+		}
+	}
+	if ok, _ := l.Allow("bob"); ok {
+		t.Fatal("refunds filled the bucket beyond its burst")
+	}
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	var nilLimiter *Limiter
+	if ok, _ := nilLimiter.Allow("x"); !ok {
+		t.Fatal("nil limiter denied a request")
+	}
+
+	l := New(0, 1)
+	for i := 0; i < 100; i++ {
+		if ok, _ := l.Allow("x"); !ok {
+			t.Fatal("zero-rate limiter denied a request")
+		}
+	}
+}
+
+func TestLimiterPrunesIdleBuckets(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := New(10, 1)
+	l.now = func() time.Time { return now }
+
+	l.Allow("idle")
+	now = now.Add(time.Second)
+	for i := 0; i < pruneEvery; i++ {
+		l.Allow("busy")
+	}
+	if l.Len() != 1 {
+		t.Fatalf("tracked keys = %d, want 1 after pruning", l.Len())
+	}
+}
@@ -0,0 +1,111 @@
+// Package server wires the chat application together: the services over a
+// store, the hub that delivers room events, and the HTTP handlers and router
+// in front of them. cmd/server and the end-to-end tests build the
+// application the same way through New.
+package server
+
+import (
+	"backend/internal/api"
+	"backend/internal/clientip"
+	"backend/internal/config"
+	"backend/internal/contentfilter"
+	"backend/internal/handlers"
+	"backend/internal/hub"
+	"backend/internal/origin"
+	"backend/internal/ratelimit"
+	"backend/internal/services"
+	"backend/internal/store"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// Server is the chat application's HTTP API and the hub behind it.
+type Server struct {
+	// Handler serves every route of the API
+	Handler http.Handler
+
+	// Hub delivers room events over every transport
+	Hub *hub.Hub
+
+	// Health serves the liveness and readiness probes
+	Health *handlers.HealthHandler
+}
+
+// New builds the application over a store that is open and migrated, and
+// starts its hub. It also makes sure the administrator named by cfg exists.
+// The store must stay open for as long as the server is used.
+func New(cfg *config.Config, dbStore store.StoreInterface) (*Server, error) {
+	// Initialize services
+	userService := services.NewUserService(dbStore, cfg.Auth.JWTSecret, cfg.Auth.TokenTTL)
+	roomService := services.NewRoomService(dbStore)
+	messageService := services.NewMessageService(dbStore)
+
+	// Screen messages with the configured content filters
+	filters, err := contentfilter.FromConfig(&cfg.ContentFilter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure content filters: %w", err)
+	}
+	messageService.SetContentFilter(filters)
+	slog.Info("content filtering enabled", "filters", filters.Len())
+
+	// One origin policy covers REST requests and WebSocket upgrades
+	clientIPs, err := clientip.New(cfg.RateLimit.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure trusted proxies: %w", err)
+	}
+	origins, err := origin.New(cfg.CORS.AllowedOrigins)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure allowed origins: %w", err)
+	}
+
+	// The hub delivers room events over every transport
+	chatHub := hub.New(messageService, &cfg.RateLimit)
+	moderationService := services.NewModerationService(dbStore, chatHub, chatHub)
+	adminService := services.NewAdminService(dbStore, chatHub)
+
+	// Make sure the configured administrator exists
+	if cfg.Admin.Username != "" {
+		if err := adminService.Bootstrap(cfg.Admin.Username, cfg.Admin.Password); err != nil {
+			return nil, fmt.Errorf("failed to bootstrap administrator %q: %w", cfg.Admin.Username, err)
+		}
+	}
+
+	// Readiness covers the database, its schema and the hub's event loop
+	healthHandler := handlers.NewHealthHandler()
+	healthHandler.AddCheck("database", dbStore.Ping)
+	healthHandler.AddCheck("migrations", func(ctx context.Context) error {
+		pending, err := dbStore.PendingMigrations(ctx)
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			return fmt.Errorf("migrations pending: %d", pending)
+		}
+		return nil
+	})
+	healthHandler.AddCheck("hub", chatHub.Ping)
+
+	router := api.NewRouter(cfg, api.Dependencies{
+		Users:       handlers.NewUserHandler(userService),
+		Rooms:       handlers.NewRoomHandler(roomService),
+		Messages:    handlers.NewMessageHandler(messageService, chatHub, cfg.WebSocket.MaxMessageSize),
+		Blocks:      handlers.NewBlockHandler(services.NewBlockService(dbStore, chatHub)),
+		Moderation:  handlers.NewModerationHandler(moderationService),
+		Reports:     handlers.NewReportHandler(services.NewReportService(dbStore, moderationService)),
+		Admin:       handlers.NewAdminHandler(adminService),
+		Health:      healthHandler,
+		WebSocket:   handlers.NewWebSocketHandler(chatHub, &cfg.WebSocket, &cfg.RateLimit, cfg.Auth.JWTSecret, origins),
+		Events:      handlers.NewEventsHandler(chatHub, &cfg.WebSocket, cfg.Auth.JWTSecret),
+		Hub:         handlers.NewHubHandler(chatHub),
+		Store:       dbStore,
+		HTTPLimiter: ratelimit.New(cfg.RateLimit.HTTPRequestRate, cfg.RateLimit.HTTPRequestBurst),
+		ClientIPs:   clientIPs,
+		Origins:     origins,
+	})
+
+	go chatHub.Run()
+	slog.Info("hub started")
+	return &Server{Handler: router, Hub: chatHub, Health: healthHandler}, nil
+}
@@ -0,0 +1,387 @@
+package services
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrCannotModifySelf is returned when an administrator tries to disable, demote or delete their own account.
+	ErrCannotModifySelf = errors.New("administrators cannot disable, demote or delete their own account")
+	// ErrSessionNotFound is returned when disconnecting a session that is not open.
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrOwnerRole is returned when changing or removing the membership of a room's owner.
+	ErrOwnerRole = errors.New("the room owner's membership cannot be changed")
+)
+
+// SessionManager lists and closes live connections on behalf of administrators.
+type SessionManager interface {
+	SessionDisconnector
+	// DisconnectUserEverywhere closes every connection the user has open.
+	DisconnectUserEverywhere(userID, reason string)
+	// DisconnectRoom closes every connection to the room.
+	DisconnectRoom(roomID, reason string)
+	// DisconnectSession closes one connection and reports whether it was open.
+	DisconnectSession(sessionID, reason string) bool
+	// Sessions lists the open connections.
+	Sessions() []models.Session
+}
+
+// AdminService provides site-wide administration of users, rooms and sessions.
+// Callers are expected to have checked that the acting user is an administrator.
+type AdminService struct {
+	store    store.StoreInterface
+	sessions SessionManager
+}
+
+// NewAdminService creates a new AdminService.
+func NewAdminService(s store.StoreInterface, sessions SessionManager) *AdminService {
+	return &AdminService{store: s, sessions: sessions}
+}
+
+// WithContext returns a copy of the service whose queries are traced as part of ctx.
+func (s *AdminService) WithContext(ctx context.Context) *AdminService {
+	return &AdminService{store: s.store.WithContext(ctx), sessions: s.sessions}
+}
+
+// Bootstrap makes the named user an administrator, creating the account with
+// the given password if it does not exist yet. It is run at startup so that a
+// fresh installation has an administrator. An existing account is only
+// promoted if the password matches it, so that whoever registered the name
+// first cannot take over the site, and a disabled account stays disabled.
+func (s *AdminService) Bootstrap(username, password string) error {
+	return s.store.WithTx(func(tx store.StoreInterface) error {
+		user, err := tx.GetUserByUsername(username)
+		if errors.Is(err, store.ErrNotFound) {
+			if password == "" {
+				return errors.New("administrator account " + username + " does not exist and no password was given to create it")
+			}
+			hashed, err := hashPassword(password)
+			if err != nil {
+				return err
+			}
+			slog.Info("creating administrator account", "username", username)
+			return tx.CreateUser(&models.User{ID: uuid.NewString(), Username: username, Password: hashed, IsAdmin: true})
+		}
+		if err != nil {
+			return err
+		}
+
+		if user.Disabled {
+			slog.Warn("administrator account is disabled, leaving it as it is", "username", username, "admin", user.IsAdmin)
+			return nil
+		}
+		if user.IsAdmin {
+			return nil
+		}
+		if password == "" || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+			slog.Warn("not granting administrator rights: the account exists and its password does not match ADMIN_PASSWORD", "username", username)
+			return nil
+		}
+		slog.Info("granting administrator rights", "username", username)
+		user.IsAdmin = true
+		return tx.UpdateUser(user)
+	})
+}
+
+// ListUsers returns every user account.
+func (s *AdminService) ListUsers() ([]*models.User, error) {
+	return s.store.ListUsers()
+}
+
+// SetUserDisabled disables or re-enables a user account. Disabling an account
+// also closes all of the user's connections.
+func (s *AdminService) SetUserDisabled(actorID, userID string, disabled bool) (*models.User, error) {
+	if actorID == userID {
+		return nil, ErrCannotModifySelf
+	}
+
+	var user *models.User
+	err := s.store.WithTx(func(tx store.StoreInterface) error {
+		var err error
+		user, err = tx.GetUserByID(userID)
+		if err != nil {
+			return err
+		}
+		user.Disabled = disabled
+		return tx.UpdateUser(user)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if disabled {
+		s.sessions.DisconnectUserEverywhere(userID, "Your account has been disabled")
+	}
+	return user, nil
+}
+
+// DeleteUser deletes a user account along with their messages and the rooms they own.
+func (s *AdminService) DeleteUser(actorID, userID string) error {
+	if actorID == userID {
+		return ErrCannotModifySelf
+	}
+
+	var ownedRooms []string
+	err := s.store.WithTx(func(tx store.StoreInterface) error {
+		if _, err := tx.GetUserByID(userID); err != nil {
+			return err
+		}
+
+		rooms, err := tx.ListRooms()
+		if err != nil {
+			return err
+		}
+		for _, room := range rooms {
+			if room.OwnerID != userID {
+				continue
+			}
+			if err := deleteRoom(tx, room.ID); err != nil {
+				return err
+			}
+			ownedRooms = append(ownedRooms, room.ID)
+		}
+
+		if err := tx.DeleteMessagesBySender(userID); err != nil {
+			return err
+		}
+		return tx.DeleteUser(userID)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.sessions.DisconnectUserEverywhere(userID, "Your account has been deleted")
+	for _, roomID := range ownedRooms {
+		s.sessions.DisconnectRoom(roomID, "This room has been deleted")
+	}
+	return nil
+}
+
+// CreateUser creates an account with the given password, optionally as an administrator.
+func (s *AdminService) CreateUser(username, password string, admin bool) (*models.User, error) {
+	hashed, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	user := &models.User{ID: uuid.NewString(), Username: username, Password: hashed, IsAdmin: admin}
+	if err := s.store.CreateUser(user); err != nil {
+		return nil, err
+	}
+	slog.Info("user created by administrator", "username", username, "admin", admin)
+	return user, nil
+}
+
+// SetUserAdmin grants or revokes administrator rights. Administrators
+// cannot revoke their own.
+func (s *AdminService) SetUserAdmin(actorID, userID string, admin bool) (*models.User, error) {
+	if actorID == userID && !admin {
+		return nil, ErrCannotModifySelf
+	}
+
+	var user *models.User
+	err := s.store.WithTx(func(tx store.StoreInterface) error {
+		var err error
+		user, err = tx.GetUserByID(userID)
+		if err != nil {
+			return err
+		}
+		user.IsAdmin = admin
+		return tx.UpdateUser(user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ResetPassword replaces a user's password. Tokens issued before the reset
+// stay valid until they expire.
+func (s *AdminService) ResetPassword(userID, password string) error {
+	hashed, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return s.store.WithTx(func(tx store.StoreInterface) error {
+		user, err := tx.GetUserByID(userID)
+		if err != nil {
+			return err
+		}
+		user.Password = hashed
+		return tx.UpdateUser(user)
+	})
+}
+
+// ListRooms returns every room, including private and archived ones.
+func (s *AdminService) ListRooms() ([]*models.ChatRoom, error) {
+	return s.store.ListRooms()
+}
+
+// SetRoomArchived archives or restores a room. Archived rooms are hidden from
+// room lists and no longer accept new members or messages.
+func (s *AdminService) SetRoomArchived(roomID string, archived bool) (*models.ChatRoom, error) {
+	var room *models.ChatRoom
+	err := s.store.WithTx(func(tx store.StoreInterface) error {
+		var err error
+		room, err = tx.GetRoomByID(roomID)
+		if err != nil {
+			return err
+		}
+		room.Archived = archived
+		return tx.UpdateRoom(room)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// DeleteRoom deletes a room with all of its messages and closes its connections.
+func (s *AdminService) DeleteRoom(roomID string) error {
+	err := s.store.WithTx(func(tx store.StoreInterface) error {
+		return deleteRoom(tx, roomID)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.sessions.DisconnectRoom(roomID, "This room has been deleted")
+	return nil
+}
+
+// Members lists the memberships of a room, including pending ones.
+func (s *AdminService) Members(roomID string) ([]*models.RoomMember, error) {
+	if _, err := s.store.GetRoomByID(roomID); err != nil {
+		return nil, err
+	}
+	return s.store.GetRoomMembers(roomID)
+}
+
+// AddMember makes a user a member of a room with the given role, accepting
+// a pending request or invitation if there is one and changing the role of
+// an existing member.
+func (s *AdminService) AddMember(roomID, userID, role string) (*models.RoomMember, error) {
+	if role != RoleMember && role != RoleModerator {
+		return nil, ErrInvalidRole
+	}
+
+	member := &models.RoomMember{RoomID: roomID, UserID: userID, Status: MemberStatusMember, Role: role}
+	err := s.store.WithTx(func(tx store.StoreInterface) error {
+		existing, err := tx.GetRoomMember(roomID, userID)
+		if errors.Is(err, store.ErrNotFound) {
+			return tx.AddRoomMember(member)
+		}
+		if err != nil {
+			return err
+		}
+		if existing.Role == RoleOwner {
+			return ErrOwnerRole
+		}
+		member.MutedUntil = existing.MutedUntil
+		return tx.UpdateRoomMember(member)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// RemoveMember removes a user from a room and closes their connections to it.
+// The owner cannot be removed.
+func (s *AdminService) RemoveMember(roomID, userID string) error {
+	err := s.store.WithTx(func(tx store.StoreInterface) error {
+		member, err := tx.GetRoomMember(roomID, userID)
+		if err != nil {
+			return err
+		}
+		if member.Role == RoleOwner {
+			return ErrOwnerRole
+		}
+		return tx.RemoveRoomMember(roomID, userID)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.sessions.DisconnectUser(roomID, userID, "You have been removed from this room")
+	return nil
+}
+
+// Stats counts the accounts, rooms, memberships and messages.
+func (s *AdminService) Stats() (*models.SiteStats, error) {
+	stats := &models.SiteStats{}
+
+	users, err := s.store.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		stats.Users++
+		if user.IsAdmin {
+			stats.Admins++
+		}
+		if user.Disabled {
+			stats.DisabledUsers++
+		}
+	}
+
+	rooms, err := s.store.ListRooms()
+	if err != nil {
+		return nil, err
+	}
+	for _, room := range rooms {
+		stats.Rooms++
+		if room.RoomType == "private" {
+			stats.PrivateRooms++
+		} else {
+			stats.PublicRooms++
+		}
+		if room.Archived {
+			stats.ArchivedRooms++
+		}
+
+		members, err := s.store.GetRoomMembers(room.ID)
+		if err != nil {
+			return nil, err
+		}
+		messages, err := s.store.CountMessages(room.ID)
+		if err != nil {
+			return nil, err
+		}
+		stats.Members += len(members)
+		stats.Messages += messages
+		stats.RoomStats = append(stats.RoomStats, models.RoomStats{RoomID: room.ID, Name: room.Name, Members: len(members), Messages: messages})
+	}
+	sort.SliceStable(stats.RoomStats, func(i, j int) bool {
+		return stats.RoomStats[i].Messages > stats.RoomStats[j].Messages
+	})
+	return stats, nil
+}
+
+// deleteRoom deletes a room's messages and then the room itself.
+func deleteRoom(tx store.StoreInterface, roomID string) error {
+	if err := tx.DeleteMessagesByRoom(roomID); err != nil {
+		return err
+	}
+	return tx.DeleteRoom(roomID)
+}
+
+// Sessions lists the open subscriptions to room events, over every transport.
+func (s *AdminService) Sessions() []models.Session {
+	return s.sessions.Sessions()
+}
+
+// DisconnectSession force-closes one WebSocket connection.
+func (s *AdminService) DisconnectSession(sessionID string) error {
+	if !s.sessions.DisconnectSession(sessionID, "Disconnected by an administrator") {
+		return ErrSessionNotFound
+	}
+	return nil
+}
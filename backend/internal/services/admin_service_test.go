@@ -0,0 +1,343 @@
+package services
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"backend/internal/store/storetest"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testTokenSecret signs the login tokens issued in tests.
+const testTokenSecret = "test-secret-that-is-long-enough-for-hs256"
+
+// fakeSessions is a SessionManager that records disconnects.
+type fakeSessions struct {
+	recordingDisconnector
+	users    []string
+	rooms    []string
+	sessions []models.Session
+}
+
+func (f *fakeSessions) DisconnectUserEverywhere(userID, reason string) {
+	f.users = append(f.users, userID)
+}
+
+func (f *fakeSessions) DisconnectRoom(roomID, reason string) {
+	f.rooms = append(f.rooms, roomID)
+}
+
+func (f *fakeSessions) DisconnectSession(sessionID, reason string) bool {
+	for _, session := range f.sessions {
+		if session.ID == sessionID {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeSessions) Sessions() []models.Session {
+	return f.sessions
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	mem := store.NewMemoryStore()
+	admin := NewAdminService(mem, &fakeSessions{})
+
+	if err := admin.Bootstrap("root", ""); err == nil {
+		t.Fatal("Bootstrap without a password created an account")
+	}
+	if err := admin.Bootstrap("root", "secret123"); err != nil {
+		t.Fatalf("Bootstrap: %v", err)
+	}
+	root, err := mem.GetUserByUsername("root")
+	if err != nil || !root.IsAdmin {
+		t.Fatalf("root = %+v, %v; want an admin", root, err)
+	}
+	if _, err := NewUserService(mem, testTokenSecret, time.Hour).AuthenticateUser("root", "secret123"); err != nil {
+		t.Fatalf("AuthenticateUser: %v", err)
+	}
+
+	// An existing account is only promoted with its own password
+	alice, err := NewUserService(mem, testTokenSecret, time.Hour).RegisterUser("alice", "password1")
+	if err != nil {
+		t.Fatalf("RegisterUser: %v", err)
+	}
+	if err := admin.Bootstrap("alice", "wrong-password"); err != nil {
+		t.Fatalf("Bootstrap: %v", err)
+	}
+	if unchanged, _ := mem.GetUserByID(alice.ID); unchanged.IsAdmin {
+		t.Fatal("Bootstrap promoted an account with the wrong password")
+	}
+	if err := admin.Bootstrap("alice", "password1"); err != nil {
+		t.Fatalf("Bootstrap: %v", err)
+	}
+	promoted, err := mem.GetUserByID(alice.ID)
+	if err != nil || !promoted.IsAdmin || promoted.Password != alice.Password {
+		t.Fatalf("alice = %+v, %v; want an admin with the same password", promoted, err)
+	}
+
+	// A disabled administrator stays disabled across restarts
+	promoted.Disabled = true
+	if err := mem.UpdateUser(promoted); err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.Bootstrap("alice", "password1"); err != nil {
+		t.Fatalf("Bootstrap: %v", err)
+	}
+	if disabled, _ := mem.GetUserByID(alice.ID); !disabled.Disabled {
+		t.Fatal("Bootstrap re-enabled a disabled account")
+	}
+}
+
+func TestDisableUser(t *testing.T) {
+	mem := store.NewMemoryStore()
+	sessions := &fakeSessions{}
+	admin := NewAdminService(mem, sessions)
+	users := NewUserService(mem, testTokenSecret, time.Hour)
+
+	root := newTestUser(t, mem, "root")
+	bob, err := users.RegisterUser("bob", "password1")
+	if err != nil {
+		t.Fatalf("RegisterUser: %v", err)
+	}
+	room, err := NewRoomService(mem).CreateRoom("lobby", root.ID, "public")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+
+	if _, err := admin.SetUserDisabled(root.ID, root.ID, true); !errors.Is(err, ErrCannotModifySelf) {
+		t.Fatalf("disabling self error = %v, want ErrCannotModifySelf", err)
+	}
+	if _, err := admin.SetUserDisabled(root.ID, bob.ID, true); err != nil {
+		t.Fatalf("SetUserDisabled: %v", err)
+	}
+	if len(sessions.users) != 1 || sessions.users[0] != bob.ID {
+		t.Fatalf("disconnected users = %v, want bob", sessions.users)
+	}
+	if _, err := users.AuthenticateUser("bob", "password1"); !errors.Is(err, ErrAccountDisabled) {
+		t.Fatalf("AuthenticateUser error = %v, want ErrAccountDisabled", err)
+	}
+	if err := NewMessageService(mem).CheckCanConnect(room.ID, bob.ID); !errors.Is(err, ErrAccountDisabled) {
+		t.Fatalf("CheckCanConnect error = %v, want ErrAccountDisabled", err)
+	}
+
+	if _, err := admin.SetUserDisabled(root.ID, bob.ID, false); err != nil {
+		t.Fatalf("SetUserDisabled: %v", err)
+	}
+	if _, err := users.AuthenticateUser("bob", "password1"); err != nil {
+		t.Fatalf("AuthenticateUser after enabling: %v", err)
+	}
+}
+
+func TestDeleteUserRemovesTheirRoomsAndMessages(t *testing.T) {
+	mem := store.NewMemoryStore()
+	sessions := &fakeSessions{}
+	admin := NewAdminService(mem, sessions)
+	rooms := NewRoomService(mem)
+	messages := NewMessageService(mem)
+
+	root := newTestUser(t, mem, "root")
+	troll := newTestUser(t, mem, "troll")
+	lobby, err := rooms.CreateRoom("lobby", root.ID, "public")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	den, err := rooms.CreateRoom("den", troll.ID, "public")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	for _, msg := range []*models.Message{
+		{ID: GenerateUUID(), RoomID: lobby.ID, SenderID: root.ID, Content: "welcome", Timestamp: time.Now()},
+		{ID: GenerateUUID(), RoomID: lobby.ID, SenderID: troll.ID, Content: "spam", Timestamp: time.Now()},
+		{ID: GenerateUUID(), RoomID: den.ID, SenderID: root.ID, Content: "hello?", Timestamp: time.Now()},
+	} {
+		if err := messages.SaveMessage(msg); err != nil {
+			t.Fatalf("SaveMessage: %v", err)
+		}
+	}
+
+	// A failure part way through leaves everything in place
+	faulty := NewAdminService(storetest.NewFaultStore(mem, "DeleteUser"), sessions)
+	if err := faulty.DeleteUser(root.ID, troll.ID); !errors.Is(err, storetest.ErrInjected) {
+		t.Fatalf("DeleteUser error = %v, want injected failure", err)
+	}
+	if _, err := mem.GetRoomByID(den.ID); err != nil {
+		t.Fatalf("room deleted by failed DeleteUser: %v", err)
+	}
+
+	if err := admin.DeleteUser(root.ID, troll.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, err := mem.GetUserByID(troll.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("user after delete: %v, want ErrNotFound", err)
+	}
+	if _, err := mem.GetRoomByID(den.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("owned room after delete: %v, want ErrNotFound", err)
+	}
+	left, err := mem.GetMessagesByRoom(lobby.ID)
+	if err != nil || len(left) != 1 || left[0].Content != "welcome" {
+		t.Fatalf("lobby messages = %+v, %v; want only welcome", left, err)
+	}
+	if len(sessions.users) != 1 || len(sessions.rooms) != 1 || sessions.rooms[0] != den.ID {
+		t.Fatalf("disconnects = users %v rooms %v, want troll and den", sessions.users, sessions.rooms)
+	}
+}
+
+func TestArchiveRoom(t *testing.T) {
+	mem := store.NewMemoryStore()
+	admin := NewAdminService(mem, &fakeSessions{})
+	rooms := NewRoomService(mem)
+
+	owner := newTestUser(t, mem, "owner")
+	guest := newTestUser(t, mem, "guest")
+	room, err := rooms.CreateRoom("lobby", owner.ID, "public")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+
+	if _, err := admin.SetRoomArchived(room.ID, true); err != nil {
+		t.Fatalf("SetRoomArchived: %v", err)
+	}
+	if _, err := rooms.JoinRoom(room.ID, guest.ID); !errors.Is(err, ErrRoomArchived) {
+		t.Fatalf("JoinRoom error = %v, want ErrRoomArchived", err)
+	}
+	if err := NewMessageService(mem).CheckCanSend(room.ID, owner.ID); !errors.Is(err, ErrRoomArchived) {
+		t.Fatalf("CheckCanSend error = %v, want ErrRoomArchived", err)
+	}
+	if list, err := rooms.GetRoomsForUser(owner.ID); err != nil || len(list) != 0 {
+		t.Fatalf("GetRoomsForUser = %v, %v; want no rooms", list, err)
+	}
+
+	if _, err := admin.SetRoomArchived(room.ID, false); err != nil {
+		t.Fatalf("SetRoomArchived: %v", err)
+	}
+	if _, err := rooms.JoinRoom(room.ID, guest.ID); err != nil {
+		t.Fatalf("JoinRoom after unarchiving: %v", err)
+	}
+}
+
+func TestDisconnectSession(t *testing.T) {
+	admin := NewAdminService(store.NewMemoryStore(), &fakeSessions{sessions: []models.Session{{ID: "s1"}}})
+
+	if err := admin.DisconnectSession("s1"); err != nil {
+		t.Fatalf("DisconnectSession: %v", err)
+	}
+	if err := admin.DisconnectSession("s2"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("DisconnectSession error = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestCreateUserPromoteAndResetPassword(t *testing.T) {
+	mem := store.NewMemoryStore()
+	admin := NewAdminService(mem, &fakeSessions{})
+	users := NewUserService(mem, testTokenSecret, time.Hour)
+
+	alice, err := admin.CreateUser("alice", "first-password", false)
+	if err != nil || alice.IsAdmin {
+		t.Fatalf("CreateUser = %+v, %v; want a regular user", alice, err)
+	}
+	if _, err := admin.CreateUser("alice", "other", false); !errors.Is(err, store.ErrConflict) {
+		t.Fatalf("duplicate CreateUser error = %v, want ErrConflict", err)
+	}
+
+	if user, err := admin.SetUserAdmin("", alice.ID, true); err != nil || !user.IsAdmin {
+		t.Fatalf("SetUserAdmin = %+v, %v; want an admin", user, err)
+	}
+	if _, err := admin.SetUserAdmin(alice.ID, alice.ID, false); !errors.Is(err, ErrCannotModifySelf) {
+		t.Fatalf("self-demotion error = %v, want ErrCannotModifySelf", err)
+	}
+
+	if err := admin.ResetPassword(alice.ID, "second-password"); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	if _, err := users.AuthenticateUser("alice", "first-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("old password error = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := users.AuthenticateUser("alice", "second-password"); err != nil {
+		t.Errorf("new password: %v", err)
+	}
+	if err := admin.ResetPassword("missing", "x"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("ResetPassword(missing) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestManageMembers(t *testing.T) {
+	mem := store.NewMemoryStore()
+	sessions := &fakeSessions{}
+	admin := NewAdminService(mem, sessions)
+	rooms := NewRoomService(mem)
+
+	owner := newTestUser(t, mem, "owner")
+	guest := newTestUser(t, mem, "guest")
+	room, err := rooms.CreateRoom("ops", owner.ID, "private")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := admin.AddMember(room.ID, guest.ID, RoleOwner); !errors.Is(err, ErrInvalidRole) {
+		t.Fatalf("AddMember as owner error = %v, want ErrInvalidRole", err)
+	}
+	if _, err := admin.AddMember(room.ID, guest.ID, RoleMember); err != nil {
+		t.Fatalf("AddMember: %v", err)
+	}
+	if member, err := admin.AddMember(room.ID, guest.ID, RoleModerator); err != nil || member.Role != RoleModerator {
+		t.Fatalf("AddMember for an existing member = %+v, %v; want the role changed", member, err)
+	}
+	if _, err := admin.AddMember(room.ID, owner.ID, RoleMember); !errors.Is(err, ErrOwnerRole) {
+		t.Fatalf("demoting the owner error = %v, want ErrOwnerRole", err)
+	}
+
+	members, err := admin.Members(room.ID)
+	if err != nil || len(members) != 2 {
+		t.Fatalf("Members = %d, %v; want 2", len(members), err)
+	}
+
+	if err := admin.RemoveMember(room.ID, owner.ID); !errors.Is(err, ErrOwnerRole) {
+		t.Fatalf("removing the owner error = %v, want ErrOwnerRole", err)
+	}
+	if err := admin.RemoveMember(room.ID, guest.ID); err != nil {
+		t.Fatalf("RemoveMember: %v", err)
+	}
+	if len(sessions.calls) != 1 || sessions.calls[0] != room.ID+"/"+guest.ID {
+		t.Errorf("disconnects = %v, want the removed member's", sessions.calls)
+	}
+	if _, err := admin.Members("missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Members(missing) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	mem := store.NewMemoryStore()
+	admin := NewAdminService(mem, &fakeSessions{})
+	rooms := NewRoomService(mem)
+
+	owner := newTestUser(t, mem, "owner")
+	if _, err := admin.CreateUser("root", "secret123", true); err != nil {
+		t.Fatal(err)
+	}
+	quiet, _ := rooms.CreateRoom("quiet", owner.ID, "public")
+	busy, _ := rooms.CreateRoom("busy", owner.ID, "private")
+	for i := 0; i < 3; i++ {
+		if err := mem.SaveMessage(&models.Message{ID: string(rune('a' + i)), RoomID: busy.ID, SenderID: owner.ID, Content: "hi", Timestamp: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := admin.SetRoomArchived(quiet.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := admin.Stats()
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	counts := []int{stats.Users, stats.Admins, stats.DisabledUsers, stats.Rooms, stats.PublicRooms, stats.PrivateRooms, stats.ArchivedRooms, stats.Members, stats.Messages}
+	if want := []int{2, 1, 0, 2, 1, 1, 1, 2, 3}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("Stats counts = %v, want %v", counts, want)
+	}
+	if len(stats.RoomStats) != 2 || stats.RoomStats[0].Name != "busy" || stats.RoomStats[0].Messages != 3 {
+		t.Errorf("RoomStats = %+v, want busy first with 3 messages", stats.RoomStats)
+	}
+}
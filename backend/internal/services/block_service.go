@@ -0,0 +1,105 @@
+package services
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrCannotBlockSelf is returned when a user tries to block themselves.
+	ErrCannotBlockSelf = errors.New("you cannot block yourself")
+	// ErrBlocked is returned when a user tries to contact someone who has blocked them.
+	ErrBlocked = errors.New("this user is not accepting invitations from you")
+)
+
+// BlockUpdater keeps live connections in step with users' block lists, so
+// that messages from blocked users stop being delivered at once.
+type BlockUpdater interface {
+	SetBlocked(blockerID, blockedID string, blocked bool)
+}
+
+// BlockService lets users block and unblock other users.
+type BlockService struct {
+	store   store.StoreInterface
+	updater BlockUpdater
+}
+
+// NewBlockService creates a new BlockService.
+func NewBlockService(s store.StoreInterface, updater BlockUpdater) *BlockService {
+	return &BlockService{store: s, updater: updater}
+}
+
+// WithContext returns a copy of the service whose queries are traced as part of ctx.
+func (s *BlockService) WithContext(ctx context.Context) *BlockService {
+	return &BlockService{store: s.store.WithContext(ctx), updater: s.updater}
+}
+
+// Block stops blockerID seeing messages from the named user and stops that
+// user inviting them to rooms. Blocking someone twice returns a store conflict.
+func (s *BlockService) Block(blockerID, username string) (*models.UserBlock, error) {
+	blocked, err := s.store.GetUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if blocked.ID == blockerID {
+		return nil, ErrCannotBlockSelf
+	}
+
+	block := &models.UserBlock{
+		BlockerID:       blockerID,
+		BlockedID:       blocked.ID,
+		BlockedUsername: blocked.Username,
+		CreatedAt:       time.Now(),
+	}
+	if err := s.store.CreateBlock(block); err != nil {
+		return nil, err
+	}
+
+	s.updater.SetBlocked(blockerID, blocked.ID, true)
+	return block, nil
+}
+
+// Unblock lifts blockerID's block of the named user.
+func (s *BlockService) Unblock(blockerID, username string) error {
+	blocked, err := s.store.GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	if err := s.store.DeleteBlock(blockerID, blocked.ID); err != nil {
+		return err
+	}
+
+	s.updater.SetBlocked(blockerID, blocked.ID, false)
+	return nil
+}
+
+// ListBlocks returns the users that blockerID has blocked, oldest first.
+func (s *BlockService) ListBlocks(blockerID string) ([]*models.UserBlock, error) {
+	blocks, err := s.store.GetBlocksByUser(blockerID)
+	if err != nil {
+		return nil, err
+	}
+	for _, block := range blocks {
+		user, err := s.store.GetUserByID(block.BlockedID)
+		if err != nil {
+			return nil, err
+		}
+		block.BlockedUsername = user.Username
+	}
+	return blocks, nil
+}
+
+// checkNotBlocked returns ErrBlocked if userID has blocked senderID.
+func checkNotBlocked(s store.StoreInterface, userID, senderID string) error {
+	_, err := s.GetBlock(userID, senderID)
+	if err == nil {
+		return ErrBlocked
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	return err
+}
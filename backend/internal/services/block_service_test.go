@@ -0,0 +1,136 @@
+package services
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"errors"
+	"testing"
+	"time"
+)
+
+// recordingBlockUpdater records SetBlocked calls as "+blocked" or "-blocked".
+type recordingBlockUpdater struct {
+	updates []string
+}
+
+func (u *recordingBlockUpdater) SetBlocked(blockerID, blockedID string, blocked bool) {
+	if blocked {
+		u.updates = append(u.updates, "+"+blockedID)
+	} else {
+		u.updates = append(u.updates, "-"+blockedID)
+	}
+}
+
+func TestBlockAndUnblock(t *testing.T) {
+	mem := store.NewMemoryStore()
+	updater := &recordingBlockUpdater{}
+	blocks := NewBlockService(mem, updater)
+	alice := newTestUser(t, mem, "alice")
+	troll := newTestUser(t, mem, "troll")
+
+	if _, err := blocks.Block(alice.ID, "alice"); !errors.Is(err, ErrCannotBlockSelf) {
+		t.Fatalf("Block(self) error = %v, want ErrCannotBlockSelf", err)
+	}
+	if _, err := blocks.Block(alice.ID, "nobody"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Block(unknown) error = %v, want ErrNotFound", err)
+	}
+	if _, err := blocks.Block(alice.ID, "troll"); err != nil {
+		t.Fatalf("Block: %v", err)
+	}
+	if _, err := blocks.Block(alice.ID, "troll"); !errors.Is(err, store.ErrConflict) {
+		t.Fatalf("second Block error = %v, want ErrConflict", err)
+	}
+
+	list, err := blocks.ListBlocks(alice.ID)
+	if err != nil || len(list) != 1 || list[0].BlockedUsername != "troll" {
+		t.Fatalf("ListBlocks = %+v, %v; want troll", list, err)
+	}
+
+	if err := blocks.Unblock(alice.ID, "troll"); err != nil {
+		t.Fatalf("Unblock: %v", err)
+	}
+	if err := blocks.Unblock(alice.ID, "troll"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("second Unblock error = %v, want ErrNotFound", err)
+	}
+	if want := []string{"+" + troll.ID, "-" + troll.ID}; len(updater.updates) != 2 || updater.updates[0] != want[0] || updater.updates[1] != want[1] {
+		t.Fatalf("updates = %v, want %v", updater.updates, want)
+	}
+}
+
+func TestBlockedUserCannotInvite(t *testing.T) {
+	mem := store.NewMemoryStore()
+	blocks := NewBlockService(mem, &recordingBlockUpdater{})
+	rooms := NewRoomService(mem)
+	alice := newTestUser(t, mem, "alice")
+	troll := newTestUser(t, mem, "troll")
+	room, err := rooms.CreateRoom("den", troll.ID, "private")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+
+	if _, err := blocks.Block(alice.ID, "troll"); err != nil {
+		t.Fatalf("Block: %v", err)
+	}
+	if _, err := rooms.InviteMember(room.ID, troll.ID, "alice"); !errors.Is(err, ErrBlocked) {
+		t.Fatalf("InviteMember error = %v, want ErrBlocked", err)
+	}
+
+	// The block only works one way
+	bob := newTestUser(t, mem, "bob")
+	if _, err := blocks.Block(alice.ID, "bob"); err != nil {
+		t.Fatalf("Block: %v", err)
+	}
+	if _, err := rooms.InviteMember(room.ID, troll.ID, "bob"); err != nil {
+		t.Fatalf("InviteMember(bob): %v", err)
+	}
+	if _, err := rooms.InviteMember(room.ID, bob.ID, "alice"); !errors.Is(err, ErrBlocked) {
+		t.Fatalf("InviteMember by bob error = %v, want ErrBlocked", err)
+	}
+}
+
+func TestHistoryHidesBlockedUsers(t *testing.T) {
+	mem := store.NewMemoryStore()
+	blocks := NewBlockService(mem, &recordingBlockUpdater{})
+	rooms := NewRoomService(mem)
+	messages := NewMessageService(mem)
+	alice := newTestUser(t, mem, "alice")
+	troll := newTestUser(t, mem, "troll")
+	room, err := rooms.CreateRoom("lobby", alice.ID, "public")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+
+	base := time.Now().Add(-time.Minute)
+	for i, sender := range []*models.User{alice, troll, alice} {
+		msg := &models.Message{ID: GenerateUUID(), RoomID: room.ID, SenderID: sender.ID, Content: "hi", Timestamp: base.Add(time.Duration(i) * time.Second)}
+		if err := messages.SaveMessage(msg); err != nil {
+			t.Fatalf("SaveMessage: %v", err)
+		}
+	}
+	if _, err := blocks.Block(alice.ID, "troll"); err != nil {
+		t.Fatalf("Block: %v", err)
+	}
+
+	history, err := messages.GetHistory(room.ID, alice.ID, models.MessageCursor{}, 0)
+	if err != nil || len(history) != 2 || history[0].SenderUsername != "alice" || history[1].SenderUsername != "alice" {
+		t.Fatalf("GetHistory(alice) = %+v, %v; want alice's two messages", history, err)
+	}
+	history, err = messages.GetHistory(room.ID, troll.ID, models.MessageCursor{}, 2)
+	if err != nil || len(history) != 2 || history[0].SenderUsername != "troll" {
+		t.Fatalf("GetHistory(troll, 2) = %+v, %v; want the last two messages", history, err)
+	}
+
+	blocked, err := messages.GetBlockedUserIDs(alice.ID)
+	if err != nil || len(blocked) != 1 || !blocked[troll.ID] {
+		t.Fatalf("GetBlockedUserIDs = %v, %v; want troll", blocked, err)
+	}
+
+	// Private room history is for members only
+	den, err := rooms.CreateRoom("den", troll.ID, "private")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	if _, err := messages.GetHistory(den.ID, alice.ID, models.MessageCursor{}, 0); !errors.Is(err, ErrNotRoomMember) {
+		t.Fatalf("GetHistory(private) error = %v, want ErrNotRoomMember", err)
+	}
+}
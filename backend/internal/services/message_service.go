@@ -1,21 +1,56 @@
 package services
 
 import (
+	"backend/internal/contentfilter"
+	"backend/internal/metrics"
 	"backend/internal/models"
 	"backend/internal/store"
+	"backend/internal/tracing"
+	"context"
+	"errors"
+	"log/slog"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // MessageService provides message-related business logic.
 type MessageService struct {
-	store store.StoreInterface
+	store   store.StoreInterface
+	filters *contentfilter.Chain // nil allows everything
+	ctx     context.Context
 }
 
 // NewMessageService creates a new MessageService.
 func NewMessageService(s store.StoreInterface) *MessageService {
-	return &MessageService{store: s}
+	return &MessageService{store: s, ctx: context.Background()}
+}
+
+// WithContext returns a copy of the service that works as part of ctx: its
+// spans and queries are traced as children of ctx's span, and its log lines
+// carry ctx's request ID.
+func (s *MessageService) WithContext(ctx context.Context) *MessageService {
+	copy := *s
+	copy.ctx = ctx
+	copy.store = s.store.WithContext(ctx)
+	return &copy
+}
+
+// startSpan starts a span for one of the service's operations. The returned
+// store's queries are traced as children of the span.
+func (s *MessageService) startSpan(name string, attrs ...attribute.KeyValue) (context.Context, store.StoreInterface, trace.Span) {
+	ctx, span := tracing.Start(s.ctx, "MessageService."+name, trace.WithAttributes(attrs...))
+	return ctx, s.store.WithContext(ctx), span
+}
+
+// SetContentFilter sets the filters that ScreenMessage applies. It should be
+// called during startup, before messages are handled.
+func (s *MessageService) SetContentFilter(filters *contentfilter.Chain) {
+	s.filters = filters
 }
 
 // GenerateUUID is a helper function to generate a UUID.
@@ -23,9 +58,265 @@ func GenerateUUID() string {
 	return uuid.NewString()
 }
 
-// SaveMessage saves a message to the database.
+// mentionPattern matches @username mentions in message content.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w.-]+)`)
+
+// ParseMentions returns the distinct usernames mentioned in content, in order of appearance.
+func ParseMentions(content string) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		// Trailing punctuation ends a mention, as in "thanks @bob."
+		username := strings.TrimRight(match[1], ".-")
+		if username != "" && !seen[username] {
+			seen[username] = true
+			usernames = append(usernames, username)
+		}
+	}
+	return usernames
+}
+
+// CheckActive returns store.ErrNotFound if the user does not exist, or
+// ErrAccountDisabled if their account is disabled.
+func (s *MessageService) CheckActive(userID string) error {
+	user, err := s.store.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.Disabled {
+		return ErrAccountDisabled
+	}
+	return nil
+}
+
+// CheckCanConnect returns store.ErrNotFound if the room does not exist,
+// ErrAccountDisabled if the user's account is disabled, or ErrBanned if the
+// user is banned from the room.
+func (s *MessageService) CheckCanConnect(roomID, userID string) error {
+	if _, err := s.store.GetRoomByID(roomID); err != nil {
+		return err
+	}
+	if err := s.CheckActive(userID); err != nil {
+		return err
+	}
+	return checkNotBanned(s.store, roomID, userID)
+}
+
+// CheckCanView returns the errors of CheckCanConnect, or ErrNotRoomMember if
+// the room is private and the user is not a member. Only users who pass it
+// may read the room's history or receive its events.
+func (s *MessageService) CheckCanView(roomID, userID string) error {
+	if err := s.CheckCanConnect(roomID, userID); err != nil {
+		return err
+	}
+	room, err := s.store.GetRoomByID(roomID)
+	if err != nil {
+		return err
+	}
+	if room.RoomType != "public" {
+		member, err := s.store.GetRoomMember(roomID, userID)
+		if errors.Is(err, store.ErrNotFound) || (err == nil && member.Status != MemberStatusMember) {
+			return ErrNotRoomMember
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckCanSend returns ErrBanned if the user is banned from the room,
+// ErrRoomArchived if the room is archived, ErrNotRoomMember if they are not
+// a member of it, or a *MutedError if they are muted in it. Only members may
+// post, even in public rooms, so that moderators can mute and kick anyone
+// who does; see JoinPublicRoom for users who post without joining.
+func (s *MessageService) CheckCanSend(roomID, userID string) error {
+	if err := checkNotBanned(s.store, roomID, userID); err != nil {
+		return err
+	}
+
+	room, err := s.store.GetRoomByID(roomID)
+	if err != nil {
+		return err
+	}
+	if room.Archived {
+		return ErrRoomArchived
+	}
+
+	member, err := s.store.GetRoomMember(roomID, userID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && member.Status != MemberStatusMember) {
+		return ErrNotRoomMember
+	}
+	if err != nil {
+		return err
+	}
+	if member.MutedUntil != nil && member.MutedUntil.After(time.Now()) {
+		return &MutedError{Until: *member.MutedUntil}
+	}
+	return nil
+}
+
+// JoinPublicRoom makes the user a member of a public room they post in
+// without having joined it, as web clients only subscribe to rooms. It
+// returns ErrNotRoomMember if the room is private, where users must be
+// invited or have their request approved, and ErrBanned if they are banned.
+func (s *MessageService) JoinPublicRoom(roomID, userID string) error {
+	return s.store.WithTx(func(tx store.StoreInterface) error {
+		room, err := tx.GetRoomByID(roomID)
+		if err != nil {
+			return err
+		}
+		if room.RoomType != "public" {
+			return ErrNotRoomMember
+		}
+		if room.Archived {
+			return ErrRoomArchived
+		}
+		if err := checkNotBanned(tx, roomID, userID); err != nil {
+			return err
+		}
+
+		existing, err := tx.GetRoomMember(roomID, userID)
+		switch {
+		case err == nil:
+			// Another message joined them first
+			if existing.Status != MemberStatusMember {
+				return ErrNotRoomMember
+			}
+			return nil
+		case !errors.Is(err, store.ErrNotFound):
+			return err
+		}
+		return tx.AddRoomMember(&models.RoomMember{RoomID: roomID, UserID: userID, Status: MemberStatusMember, Role: RoleMember})
+	})
+}
+
+// ScreenMessage runs the content filters over a message before it is saved.
+// Redactions are applied to message.Content. A held message is added to the
+// room's review queue instead of being delivered; the caller must only save
+// and deliver the message if the verdict is Allow or Redact. If a filter
+// fails, the message is held rather than let through unchecked.
+func (s *MessageService) ScreenMessage(message *models.Message) (result contentfilter.Result, err error) {
+	ctx, st, span := s.startSpan("ScreenMessage", attribute.String("chat.room", message.RoomID), attribute.String("chat.message_id", message.ID))
+	defer func() {
+		span.SetAttributes(attribute.String("chat.verdict", result.Verdict.String()))
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	result, err = s.filters.Check(message.Content)
+	if err != nil {
+		slog.WarnContext(ctx, "content filter failed, holding message", "message_id", message.ID, "room", message.RoomID, "error", err)
+		result = contentfilter.Result{Verdict: contentfilter.Hold, Content: message.Content, Reason: "content filter unavailable"}
+	}
+
+	switch result.Verdict {
+	case contentfilter.Redact:
+		message.Content = result.Content
+	case contentfilter.Hold:
+		held := &models.HeldMessage{
+			ID:        message.ID,
+			RoomID:    message.RoomID,
+			SenderID:  message.SenderID,
+			Content:   result.Content,
+			Reason:    result.Reason,
+			CreatedAt: message.Timestamp,
+		}
+		if err := st.SaveHeldMessage(held); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// SaveMessage saves a message and its mentions to the database in one transaction.
+// Mentions of unknown usernames are ignored. On success message.Mentions holds the
+// usernames that were recorded.
 func (s *MessageService) SaveMessage(message *models.Message) error {
-	return s.store.SaveMessage(message)
+	_, st, span := s.startSpan("SaveMessage", attribute.String("chat.room", message.RoomID), attribute.String("chat.message_id", message.ID))
+	defer span.End()
+
+	start := time.Now()
+	err := st.WithTx(func(tx store.StoreInterface) error {
+		return saveMessage(tx, message)
+	})
+	metrics.SaveMessageDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.SaveMessageErrors.Inc()
+		tracing.RecordError(span, err)
+	}
+	return err
+}
+
+// saveMessage saves a message and its mentions within tx and sets message.Mentions.
+func saveMessage(tx store.StoreInterface, message *models.Message) error {
+	if err := tx.SaveMessage(message); err != nil {
+		return err
+	}
+
+	var mentioned []string
+	for _, username := range ParseMentions(message.Content) {
+		user, err := tx.GetUserByUsername(username)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tx.SaveMention(&models.MessageMention{MessageID: message.ID, UserID: user.ID}); err != nil {
+			return err
+		}
+		mentioned = append(mentioned, user.Username)
+	}
+
+	message.Mentions = mentioned
+	return nil
+}
+
+// GetHistory returns the messages in a room after the cursor, oldest first,
+// with their senders' usernames. Messages from users that viewerID has blocked
+// are left out. If limit is positive, at most limit messages are returned:
+// the first ones after the cursor if it is set, so that clients can page
+// forward, and otherwise the most recent ones. Private room history is only
+// shown to members.
+func (s *MessageService) GetHistory(roomID, viewerID string, after models.MessageCursor, limit int) ([]*models.Message, error) {
+	if err := s.CheckCanView(roomID, viewerID); err != nil {
+		return nil, err
+	}
+
+	messages, err := s.store.GetRoomHistory(roomID, viewerID, after, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	usernames := make(map[string]string)
+	for _, message := range messages {
+		username, ok := usernames[message.SenderID]
+		if !ok {
+			sender, err := s.store.GetUserByID(message.SenderID)
+			if err != nil {
+				return nil, err
+			}
+			username = sender.Username
+			usernames[message.SenderID] = username
+		}
+		message.SenderUsername = username
+	}
+	return messages, nil
+}
+
+// GetBlockedUserIDs returns the IDs of the users that userID has blocked.
+func (s *MessageService) GetBlockedUserIDs(userID string) (map[string]bool, error) {
+	blocks, err := s.store.GetBlocksByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	blocked := make(map[string]bool, len(blocks))
+	for _, block := range blocks {
+		blocked[block.BlockedID] = true
+	}
+	return blocked, nil
 }
 
 // GetMessagesByRoom retrieves all messages for a specific room.
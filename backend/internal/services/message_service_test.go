@@ -0,0 +1,160 @@
+package services
+
+import (
+	"backend/internal/contentfilter"
+	"backend/internal/models"
+	"backend/internal/store"
+	"backend/internal/store/storetest"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseMentions(t *testing.T) {
+	got := ParseMentions("hi @alice and @bob.smith, also @alice again. mail me at x@example.com @carol.")
+	want := []string{"alice", "bob.smith", "carol"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ParseMentions = %v, want %v", got, want)
+	}
+}
+
+func TestSaveMessageRecordsMentions(t *testing.T) {
+	mem := store.NewMemoryStore()
+	alice := newTestUser(t, mem, "alice")
+	bob := newTestUser(t, mem, "bob")
+	room, err := NewRoomService(mem).CreateRoom("lobby", alice.ID, "public")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+
+	msg := &models.Message{ID: GenerateUUID(), RoomID: room.ID, SenderID: alice.ID, Content: "hey @bob and @nobody", Timestamp: time.Now()}
+	if err := NewMessageService(mem).SaveMessage(msg); err != nil {
+		t.Fatalf("SaveMessage: %v", err)
+	}
+	if !reflect.DeepEqual(msg.Mentions, []string{"bob"}) {
+		t.Fatalf("Mentions = %v, want [bob]", msg.Mentions)
+	}
+
+	mentions, err := mem.GetMentionsByMessage(msg.ID)
+	if err != nil || len(mentions) != 1 || mentions[0].UserID != bob.ID {
+		t.Fatalf("stored mentions = %+v, %v", mentions, err)
+	}
+}
+
+func TestSaveMessageRollsBackWhenMentionFails(t *testing.T) {
+	mem := store.NewMemoryStore()
+	alice := newTestUser(t, mem, "alice")
+	newTestUser(t, mem, "bob")
+	room, err := NewRoomService(mem).CreateRoom("lobby", alice.ID, "public")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+
+	messages := NewMessageService(storetest.NewFaultStore(mem, "SaveMention"))
+	msg := &models.Message{ID: GenerateUUID(), RoomID: room.ID, SenderID: alice.ID, Content: "hey @bob", Timestamp: time.Now()}
+	if err := messages.SaveMessage(msg); !errors.Is(err, storetest.ErrInjected) {
+		t.Fatalf("SaveMessage error = %v, want injected failure", err)
+	}
+
+	stored, err := mem.GetMessagesByRoom(room.ID)
+	if err != nil {
+		t.Fatalf("GetMessagesByRoom: %v", err)
+	}
+	if len(stored) != 0 {
+		t.Fatalf("found %d messages after failed save, want 0", len(stored))
+	}
+}
+
+func TestScreenMessage(t *testing.T) {
+	mem := store.NewMemoryStore()
+	alice := newTestUser(t, mem, "alice")
+	room, err := NewRoomService(mem).CreateRoom("lobby", alice.ID, "public")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+
+	messages := NewMessageService(mem)
+	messages.SetContentFilter(contentfilter.NewChain(
+		contentfilter.NewWordList([]string{"darn"}, contentfilter.Redact),
+		contentfilter.NewDomainBlocklist([]string{"spam.example"}, contentfilter.Reject),
+		contentfilter.NewWordList([]string{"casino"}, contentfilter.Hold),
+	))
+
+	tests := []struct {
+		content string
+		verdict contentfilter.Verdict
+		want    string // content after screening
+	}{
+		{"hello", contentfilter.Allow, "hello"},
+		{"darn it", contentfilter.Redact, "**** it"},
+		{"go to spam.example", contentfilter.Reject, "go to spam.example"},
+		{"darn casino", contentfilter.Hold, "darn casino"},
+	}
+	for _, tc := range tests {
+		msg := &models.Message{ID: GenerateUUID(), RoomID: room.ID, SenderID: alice.ID, Content: tc.content, Timestamp: time.Now()}
+		result, err := messages.ScreenMessage(msg)
+		if err != nil {
+			t.Fatalf("ScreenMessage(%q): %v", tc.content, err)
+		}
+		if result.Verdict != tc.verdict || msg.Content != tc.want {
+			t.Errorf("ScreenMessage(%q) = %v %q, want %v %q", tc.content, result.Verdict, msg.Content, tc.verdict, tc.want)
+		}
+	}
+
+	// Only the held message is queued, with the redaction applied
+	queue, err := mem.GetHeldMessagesByRoom(room.ID)
+	if err != nil || len(queue) != 1 || queue[0].Content != "**** casino" {
+		t.Fatalf("held messages = %+v, %v; want the redacted casino message", queue, err)
+	}
+
+	// A failing filter holds the message rather than letting it through
+	messages.SetContentFilter(contentfilter.NewChain(contentfilter.FilterFunc(func(string) (contentfilter.Result, error) {
+		return contentfilter.Result{}, errors.New("classifier down")
+	})))
+	msg := &models.Message{ID: GenerateUUID(), RoomID: room.ID, SenderID: alice.ID, Content: "hello", Timestamp: time.Now()}
+	if result, err := messages.ScreenMessage(msg); err != nil || result.Verdict != contentfilter.Hold {
+		t.Fatalf("ScreenMessage with failing filter = %+v, %v; want hold", result, err)
+	}
+}
+
+func TestGetHistoryPagesForwardFromSince(t *testing.T) {
+	mem := store.NewMemoryStore()
+	alice := newTestUser(t, mem, "alice")
+	room, err := NewRoomService(mem).CreateRoom("lobby", alice.ID, "public")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	messages := NewMessageService(mem)
+	base := time.Now().Add(-time.Minute)
+	for i := 0; i < 5; i++ {
+		msg := &models.Message{ID: GenerateUUID(), RoomID: room.ID, SenderID: alice.ID, Content: string(rune('a' + i)), Timestamp: base.Add(time.Duration(i) * time.Second)}
+		if err := messages.SaveMessage(msg); err != nil {
+			t.Fatalf("SaveMessage: %v", err)
+		}
+	}
+	contents := func(history []*models.Message) string {
+		var s string
+		for _, m := range history {
+			s += m.Content
+		}
+		return s
+	}
+
+	// More than limit messages follow since: the first ones come back
+	history, err := messages.GetHistory(room.ID, alice.ID, models.MessageCursor{Timestamp: base}, 2)
+	if err != nil || contents(history) != "bc" {
+		t.Fatalf("GetHistory(since first, 2) = %q, %v; want bc", contents(history), err)
+	}
+	last := history[1]
+	history, err = messages.GetHistory(room.ID, alice.ID, models.MessageCursor{Timestamp: last.Timestamp, ID: last.ID}, 2)
+	if err != nil || contents(history) != "de" {
+		t.Fatalf("GetHistory(next page) = %q, %v; want de", contents(history), err)
+	}
+
+	// Without since, the most recent ones come back
+	history, err = messages.GetHistory(room.ID, alice.ID, models.MessageCursor{}, 2)
+	if err != nil || contents(history) != "de" {
+		t.Fatalf("GetHistory(2) = %q, %v; want de", contents(history), err)
+	}
+}
@@ -0,0 +1,557 @@
+package services
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Actions recorded in a room's moderation log.
+const (
+	ActionMute    = "mute"
+	ActionUnmute  = "unmute"
+	ActionKick    = "kick"
+	ActionBan     = "ban"
+	ActionUnban   = "unban"
+	ActionPromote = "promote"
+	ActionDemote  = "demote"
+	ActionApprove = "approve" // a held message was delivered
+	ActionDiscard = "discard" // a held message was thrown away
+
+	ActionDeleteMessage = "delete_message"
+)
+
+var (
+	// ErrNotModerator is returned when a moderation action is attempted by a
+	// user who is neither the room owner nor one of its moderators.
+	ErrNotModerator = errors.New("only the room owner and moderators can moderate this room")
+	// ErrNotOwner is returned when someone other than the owner changes roles.
+	ErrNotOwner = errors.New("only the room owner can change member roles")
+	// ErrCannotModerate is returned when the target's role is not below the actor's.
+	ErrCannotModerate = errors.New("you cannot moderate a user whose role is equal to or above yours")
+	// ErrBanned is returned when a banned user tries to join, connect to or post in a room.
+	ErrBanned = errors.New("user is banned from this room")
+	// ErrInvalidRole is returned when a member is given a role that cannot be assigned.
+	ErrInvalidRole = errors.New("role must be moderator or member")
+	// ErrInvalidDuration is returned when a mute has no positive duration.
+	ErrInvalidDuration = errors.New("mute duration must be positive")
+)
+
+// MutedError is returned when a muted member tries to post a message.
+type MutedError struct {
+	Until time.Time
+}
+
+func (e *MutedError) Error() string {
+	return fmt.Sprintf("you are muted in this room until %s", e.Until.UTC().Format(time.RFC3339))
+}
+
+// SessionDisconnector closes live connections, so that kicked and banned
+// users are removed from the room immediately.
+type SessionDisconnector interface {
+	// DisconnectUser closes every connection the user has open to the room.
+	DisconnectUser(roomID, userID, reason string)
+}
+
+// MessagePublisher tells the room's live connections about changes made by
+// moderators, so that approved and deleted messages show without a reload.
+type MessagePublisher interface {
+	// PublishMessage sends a saved message to everyone connected to its room.
+	PublishMessage(message *models.Message)
+	// PublishDeletion tells everyone connected to the room that a message was deleted.
+	PublishDeletion(roomID, messageID string)
+}
+
+// ModerationService provides room moderation: roles, mutes, kicks, bans and
+// the review queue of held messages. Every action is recorded in the room's
+// moderation log.
+type ModerationService struct {
+	store     store.StoreInterface
+	sessions  SessionDisconnector
+	publisher MessagePublisher
+
+	// Set by forReport: reportID links logged actions to the report they
+	// resolve, and pending collects the effects to apply once it commits.
+	reportID string
+	pending  *[]func()
+}
+
+// NewModerationService creates a new ModerationService.
+func NewModerationService(s store.StoreInterface, sessions SessionDisconnector, publisher MessagePublisher) *ModerationService {
+	return &ModerationService{store: s, sessions: sessions, publisher: publisher}
+}
+
+// WithContext returns a copy of the service whose queries are traced as part of ctx.
+func (s *ModerationService) WithContext(ctx context.Context) *ModerationService {
+	copy := *s
+	copy.store = s.store.WithContext(ctx)
+	return &copy
+}
+
+// forReport returns a copy of the service that works inside tx and links
+// every action it logs to the given report. Disconnects and deliveries are
+// added to pending rather than applied, so that the caller can apply them
+// after the transaction commits.
+func (s *ModerationService) forReport(tx store.StoreInterface, reportID string, pending *[]func()) *ModerationService {
+	return &ModerationService{store: tx, sessions: s.sessions, publisher: s.publisher, reportID: reportID, pending: pending}
+}
+
+// afterCommit applies an effect on live connections, deferring it if the
+// service belongs to an enclosing transaction.
+func (s *ModerationService) afterCommit(fn func()) {
+	if s.pending != nil {
+		*s.pending = append(*s.pending, fn)
+		return
+	}
+	fn()
+}
+
+// roleAdmin is the role site administrators act with in rooms they do not
+// moderate. It is never stored on a membership.
+const roleAdmin = "admin"
+
+// roleRank orders roles so that a higher rank can moderate a lower one.
+func roleRank(role string) int {
+	switch role {
+	case roleAdmin:
+		return 4
+	case RoleOwner:
+		return 3
+	case RoleModerator:
+		return 2
+	case RoleMember:
+		return 1
+	}
+	return 0
+}
+
+// moderationTarget is the user an action applies to, and their membership if they have one.
+type moderationTarget struct {
+	user   *models.User
+	member *models.RoomMember
+}
+
+// requireModerator returns the actor's membership, or ErrNotModerator unless
+// they are the owner or a moderator of the room. Site administrators may
+// moderate every room; for them a membership with roleAdmin is returned.
+func requireModerator(s store.StoreInterface, roomID, actorID string) (*models.RoomMember, error) {
+	if _, err := s.GetRoomByID(roomID); err != nil {
+		return nil, err
+	}
+
+	actor, err := s.GetRoomMember(roomID, actorID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	if err == nil && actor.Status == MemberStatusMember && roleRank(actor.Role) >= roleRank(RoleModerator) {
+		return actor, nil
+	}
+
+	user, err := s.GetUserByID(actorID)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsAdmin {
+		return &models.RoomMember{RoomID: roomID, UserID: actorID, Status: MemberStatusMember, Role: roleAdmin}, nil
+	}
+	return nil, ErrNotModerator
+}
+
+// authorize checks that actorID may moderate the user with the given username
+// in the room, and returns the actor's membership and the target.
+func authorize(tx store.StoreInterface, roomID, actorID, username string) (*models.RoomMember, *moderationTarget, error) {
+	actor, err := requireModerator(tx, roomID, actorID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := tx.GetUserByUsername(username)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.ID == actorID {
+		return nil, nil, ErrCannotModerate
+	}
+
+	target := &moderationTarget{user: user}
+	member, err := tx.GetRoomMember(roomID, user.ID)
+	switch {
+	case err == nil:
+		target.member = member
+	case !errors.Is(err, store.ErrNotFound):
+		return nil, nil, err
+	}
+
+	actorUser, err := tx.GetUserByID(actorID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if effectiveRank(user, target.member) >= effectiveRank(actorUser, actor) {
+		return nil, nil, ErrCannotModerate
+	}
+	return actor, target, nil
+}
+
+// effectiveRank is how highly a user ranks in a room: by their membership or,
+// for site administrators, their site role, whichever is higher. A user
+// without a membership ranks as a member, so that they cannot be moderated
+// by anyone a member could not be.
+func effectiveRank(user *models.User, member *models.RoomMember) int {
+	rank := roleRank(RoleMember)
+	if member != nil {
+		rank = max(rank, roleRank(member.Role))
+	}
+	if user.IsAdmin {
+		rank = max(rank, roleRank(roleAdmin))
+	}
+	return rank
+}
+
+// logAction records a moderation action in the room's log.
+func (s *ModerationService) logAction(tx store.StoreInterface, roomID, actorID, targetID, action, reason string, expiresAt *time.Time) error {
+	return tx.SaveModerationAction(&models.ModerationAction{
+		ID:        uuid.NewString(),
+		RoomID:    roomID,
+		ActorID:   actorID,
+		TargetID:  targetID,
+		Action:    action,
+		Reason:    reason,
+		ExpiresAt: expiresAt,
+		ReportID:  s.reportID,
+		CreatedAt: time.Now(),
+	})
+}
+
+// Mute stops a member from posting messages in the room for the given duration.
+func (s *ModerationService) Mute(roomID, actorID, username string, duration time.Duration, reason string) (*models.RoomMember, error) {
+	if duration <= 0 {
+		return nil, ErrInvalidDuration
+	}
+
+	var member *models.RoomMember
+	err := s.store.WithTx(func(tx store.StoreInterface) error {
+		_, target, err := authorize(tx, roomID, actorID, username)
+		if err != nil {
+			return err
+		}
+		if target.member == nil {
+			return ErrNotRoomMember
+		}
+
+		until := time.Now().Add(duration)
+		member = target.member
+		member.MutedUntil = &until
+		if err := tx.UpdateRoomMember(member); err != nil {
+			return err
+		}
+		return s.logAction(tx, roomID, actorID, target.user.ID, ActionMute, reason, &until)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// Unmute lets a muted member post messages again.
+func (s *ModerationService) Unmute(roomID, actorID, username string) (*models.RoomMember, error) {
+	var member *models.RoomMember
+	err := s.store.WithTx(func(tx store.StoreInterface) error {
+		_, target, err := authorize(tx, roomID, actorID, username)
+		if err != nil {
+			return err
+		}
+		if target.member == nil {
+			return ErrNotRoomMember
+		}
+
+		member = target.member
+		member.MutedUntil = nil
+		if err := tx.UpdateRoomMember(member); err != nil {
+			return err
+		}
+		return s.logAction(tx, roomID, actorID, target.user.ID, ActionUnmute, "", nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// Kick removes a member from the room and closes their live connections to it.
+// Unlike a ban, a kicked user may join the room again.
+func (s *ModerationService) Kick(roomID, actorID, username, reason string) error {
+	var targetID string
+	err := s.store.WithTx(func(tx store.StoreInterface) error {
+		_, target, err := authorize(tx, roomID, actorID, username)
+		if err != nil {
+			return err
+		}
+		if target.member == nil {
+			return ErrNotRoomMember
+		}
+
+		targetID = target.user.ID
+		if err := tx.RemoveRoomMember(roomID, targetID); err != nil {
+			return err
+		}
+		return s.logAction(tx, roomID, actorID, targetID, ActionKick, reason, nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.afterCommit(func() {
+		s.sessions.DisconnectUser(roomID, targetID, disconnectReason("You were kicked from the room", reason))
+	})
+	return nil
+}
+
+// Ban removes a user from the room, closes their live connections to it and
+// stops them joining it again until they are unbanned.
+func (s *ModerationService) Ban(roomID, actorID, username, reason string) (*models.RoomBan, error) {
+	var ban *models.RoomBan
+	err := s.store.WithTx(func(tx store.StoreInterface) error {
+		_, target, err := authorize(tx, roomID, actorID, username)
+		if err != nil {
+			return err
+		}
+
+		ban = &models.RoomBan{
+			RoomID:    roomID,
+			UserID:    target.user.ID,
+			BannedBy:  actorID,
+			Reason:    reason,
+			CreatedAt: time.Now(),
+		}
+		if err := tx.CreateBan(ban); err != nil {
+			return err
+		}
+		if target.member != nil {
+			if err := tx.RemoveRoomMember(roomID, target.user.ID); err != nil {
+				return err
+			}
+		}
+		return s.logAction(tx, roomID, actorID, target.user.ID, ActionBan, reason, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.afterCommit(func() {
+		s.sessions.DisconnectUser(roomID, ban.UserID, disconnectReason("You were banned from the room", reason))
+	})
+	return ban, nil
+}
+
+// Unban lifts a user's ban so that they can join the room again.
+func (s *ModerationService) Unban(roomID, actorID, username string) error {
+	return s.store.WithTx(func(tx store.StoreInterface) error {
+		_, target, err := authorize(tx, roomID, actorID, username)
+		if err != nil {
+			return err
+		}
+		if err := tx.DeleteBan(roomID, target.user.ID); err != nil {
+			return err
+		}
+		return s.logAction(tx, roomID, actorID, target.user.ID, ActionUnban, "", nil)
+	})
+}
+
+// SetRole makes a member a moderator or demotes them back to a member.
+// Only the room owner can change roles.
+func (s *ModerationService) SetRole(roomID, actorID, username, role string) (*models.RoomMember, error) {
+	if role != RoleModerator && role != RoleMember {
+		return nil, ErrInvalidRole
+	}
+
+	var member *models.RoomMember
+	err := s.store.WithTx(func(tx store.StoreInterface) error {
+		actor, target, err := authorize(tx, roomID, actorID, username)
+		if err != nil {
+			return err
+		}
+		if actor.Role != RoleOwner {
+			return ErrNotOwner
+		}
+		if target.member == nil || target.member.Status != MemberStatusMember {
+			return ErrNotRoomMember
+		}
+
+		member = target.member
+		if member.Role == role {
+			return nil
+		}
+		action := ActionPromote
+		if role == RoleMember {
+			action = ActionDemote
+		}
+		member.Role = role
+		if err := tx.UpdateRoomMember(member); err != nil {
+			return err
+		}
+		return s.logAction(tx, roomID, actorID, target.user.ID, action, "", nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// DeleteMessage deletes a message from the room and removes it from the
+// screens of everyone connected.
+func (s *ModerationService) DeleteMessage(roomID, actorID, messageID, reason string) error {
+	err := s.store.WithTx(func(tx store.StoreInterface) error {
+		message, err := tx.GetMessageByID(messageID)
+		if err != nil {
+			return err
+		}
+		if message.RoomID != roomID {
+			return fmt.Errorf("message %s in room %s: %w", messageID, roomID, store.ErrNotFound)
+		}
+		sender, err := tx.GetUserByID(message.SenderID)
+		if err != nil {
+			return err
+		}
+		if _, _, err := authorize(tx, roomID, actorID, sender.Username); err != nil {
+			return err
+		}
+
+		if err := tx.DeleteMessage(messageID); err != nil {
+			return err
+		}
+		return s.logAction(tx, roomID, actorID, sender.ID, ActionDeleteMessage, reason, nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.afterCommit(func() { s.publisher.PublishDeletion(roomID, messageID) })
+	return nil
+}
+
+// GetLog returns the room's moderation log, newest first. Only the owner and
+// moderators can read it.
+func (s *ModerationService) GetLog(roomID, actorID string) ([]*models.ModerationAction, error) {
+	if _, err := requireModerator(s.store, roomID, actorID); err != nil {
+		return nil, err
+	}
+	return s.store.GetModerationLog(roomID)
+}
+
+// GetHeldMessages returns the room's review queue, oldest first. Only the
+// owner and moderators can read it.
+func (s *ModerationService) GetHeldMessages(roomID, actorID string) ([]*models.HeldMessage, error) {
+	if _, err := requireModerator(s.store, roomID, actorID); err != nil {
+		return nil, err
+	}
+
+	queue, err := s.store.GetHeldMessagesByRoom(roomID)
+	if err != nil {
+		return nil, err
+	}
+	for _, held := range queue {
+		sender, err := s.store.GetUserByID(held.SenderID)
+		if err != nil {
+			return nil, err
+		}
+		held.SenderUsername = sender.Username
+	}
+	return queue, nil
+}
+
+// getHeldMessage returns a held message, or store.ErrNotFound if it is not
+// queued in the given room.
+func getHeldMessage(tx store.StoreInterface, roomID, heldID string) (*models.HeldMessage, error) {
+	held, err := tx.GetHeldMessage(heldID)
+	if err != nil {
+		return nil, err
+	}
+	if held.RoomID != roomID {
+		return nil, fmt.Errorf("held message %s in room %s: %w", heldID, roomID, store.ErrNotFound)
+	}
+	return held, nil
+}
+
+// ApproveHeldMessage saves a held message as if it had been allowed when it
+// was sent, and delivers it to the room.
+func (s *ModerationService) ApproveHeldMessage(roomID, actorID, heldID string) (*models.Message, error) {
+	var message *models.Message
+	err := s.store.WithTx(func(tx store.StoreInterface) error {
+		if _, err := requireModerator(tx, roomID, actorID); err != nil {
+			return err
+		}
+		held, err := getHeldMessage(tx, roomID, heldID)
+		if err != nil {
+			return err
+		}
+		sender, err := tx.GetUserByID(held.SenderID)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.DeleteHeldMessage(held.ID); err != nil {
+			return err
+		}
+		message = &models.Message{
+			ID:             held.ID,
+			RoomID:         held.RoomID,
+			SenderID:       held.SenderID,
+			SenderUsername: sender.Username,
+			Content:        held.Content,
+			Timestamp:      held.CreatedAt,
+		}
+		if err := saveMessage(tx, message); err != nil {
+			return err
+		}
+		return s.logAction(tx, roomID, actorID, held.SenderID, ActionApprove, "", nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.afterCommit(func() { s.publisher.PublishMessage(message) })
+	return message, nil
+}
+
+// DiscardHeldMessage removes a held message from the review queue without delivering it.
+func (s *ModerationService) DiscardHeldMessage(roomID, actorID, heldID string) error {
+	return s.store.WithTx(func(tx store.StoreInterface) error {
+		if _, err := requireModerator(tx, roomID, actorID); err != nil {
+			return err
+		}
+		held, err := getHeldMessage(tx, roomID, heldID)
+		if err != nil {
+			return err
+		}
+		if err := tx.DeleteHeldMessage(held.ID); err != nil {
+			return err
+		}
+		return s.logAction(tx, roomID, actorID, held.SenderID, ActionDiscard, "", nil)
+	})
+}
+
+// checkNotBanned returns ErrBanned if the user is banned from the room.
+func checkNotBanned(s store.StoreInterface, roomID, userID string) error {
+	_, err := s.GetBan(roomID, userID)
+	if err == nil {
+		return ErrBanned
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// disconnectReason builds the text sent with the close frame, adding the
+// moderator's reason when one was given.
+func disconnectReason(message, reason string) string {
+	if reason == "" {
+		return message
+	}
+	return message + ": " + reason
+}
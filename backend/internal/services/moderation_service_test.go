@@ -0,0 +1,366 @@
+package services
+
+import (
+	"backend/internal/contentfilter"
+	"backend/internal/models"
+	"backend/internal/store"
+	"backend/internal/store/storetest"
+	"errors"
+	"testing"
+	"time"
+)
+
+// recordingDisconnector records DisconnectUser, PublishMessage and
+// PublishDeletion calls instead of touching sockets.
+type recordingDisconnector struct {
+	calls     []string // roomID/userID
+	published []*models.Message
+	deleted   []string // message IDs
+}
+
+func (d *recordingDisconnector) DisconnectUser(roomID, userID, reason string) {
+	d.calls = append(d.calls, roomID+"/"+userID)
+}
+
+func (d *recordingDisconnector) PublishMessage(message *models.Message) {
+	d.published = append(d.published, message)
+}
+
+func (d *recordingDisconnector) PublishDeletion(roomID, messageID string) {
+	d.deleted = append(d.deleted, messageID)
+}
+
+// moderationFixture is a public room with an owner, a moderator and two members.
+type moderationFixture struct {
+	store      store.StoreInterface
+	rooms      *RoomService
+	moderation *ModerationService
+	sessions   *recordingDisconnector
+	room       *models.ChatRoom
+	owner      *models.User
+	moderator  *models.User
+	alice      *models.User
+	bob        *models.User
+}
+
+func newModerationFixture(t *testing.T, s store.StoreInterface) *moderationFixture {
+	t.Helper()
+	f := &moderationFixture{store: s, rooms: NewRoomService(s), sessions: &recordingDisconnector{}}
+	f.moderation = NewModerationService(s, f.sessions, f.sessions)
+	f.owner = newTestUser(t, s, "owner")
+	f.moderator = newTestUser(t, s, "mod")
+	f.alice = newTestUser(t, s, "alice")
+	f.bob = newTestUser(t, s, "bob")
+
+	var err error
+	f.room, err = f.rooms.CreateRoom("lobby", f.owner.ID, "public")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	for _, user := range []*models.User{f.moderator, f.alice, f.bob} {
+		if _, err := f.rooms.JoinRoom(f.room.ID, user.ID); err != nil {
+			t.Fatalf("JoinRoom(%s): %v", user.Username, err)
+		}
+	}
+	if _, err := f.moderation.SetRole(f.room.ID, f.owner.ID, "mod", RoleModerator); err != nil {
+		t.Fatalf("SetRole: %v", err)
+	}
+	return f
+}
+
+func TestModerationPermissions(t *testing.T) {
+	f := newModerationFixture(t, store.NewMemoryStore())
+
+	if member, err := f.store.GetRoomMember(f.room.ID, f.owner.ID); err != nil || member.Role != RoleOwner {
+		t.Fatalf("owner membership = %+v, %v; want owner role", member, err)
+	}
+
+	tests := []struct {
+		name    string
+		actor   *models.User
+		target  string
+		wantErr error
+	}{
+		{"member cannot moderate", f.alice, "bob", ErrNotModerator},
+		{"moderator cannot moderate moderator", f.moderator, "mod", ErrCannotModerate},
+		{"moderator cannot moderate owner", f.moderator, "owner", ErrCannotModerate},
+		{"owner cannot moderate self", f.owner, "owner", ErrCannotModerate},
+		{"moderator can moderate member", f.moderator, "alice", nil},
+		{"owner can moderate moderator", f.owner, "mod", nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := f.moderation.Mute(f.room.ID, tc.actor.ID, tc.target, time.Minute, "")
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Mute error = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+
+	// Users without a membership rank by their site role
+	admin := newTestUser(t, f.store, "admin")
+	admin.IsAdmin = true
+	if err := f.store.UpdateUser(admin); err != nil {
+		t.Fatal(err)
+	}
+	newTestUser(t, f.store, "outsider")
+	if _, err := f.moderation.Ban(f.room.ID, f.owner.ID, "admin", ""); !errors.Is(err, ErrCannotModerate) {
+		t.Fatalf("Ban of a site administrator error = %v, want ErrCannotModerate", err)
+	}
+	if _, err := f.moderation.Ban(f.room.ID, f.moderator.ID, "outsider", ""); err != nil {
+		t.Fatalf("Ban of a non-member: %v", err)
+	}
+	if _, err := f.moderation.Mute(f.room.ID, admin.ID, "owner", time.Minute, ""); err != nil {
+		t.Fatalf("Mute of the owner by a site administrator: %v", err)
+	}
+
+	if _, err := f.moderation.SetRole(f.room.ID, f.moderator.ID, "alice", RoleModerator); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("SetRole by moderator error = %v, want ErrNotOwner", err)
+	}
+	if _, err := f.moderation.SetRole(f.room.ID, f.owner.ID, "alice", RoleOwner); !errors.Is(err, ErrInvalidRole) {
+		t.Fatalf("SetRole(owner) error = %v, want ErrInvalidRole", err)
+	}
+	if _, err := f.moderation.GetLog(f.room.ID, f.alice.ID); !errors.Is(err, ErrNotModerator) {
+		t.Fatalf("GetLog by member error = %v, want ErrNotModerator", err)
+	}
+}
+
+func TestMuteBlocksSending(t *testing.T) {
+	f := newModerationFixture(t, store.NewMemoryStore())
+	messages := NewMessageService(f.store)
+
+	if _, err := f.moderation.Mute(f.room.ID, f.moderator.ID, "alice", 0, ""); !errors.Is(err, ErrInvalidDuration) {
+		t.Fatalf("Mute(0) error = %v, want ErrInvalidDuration", err)
+	}
+	if _, err := f.moderation.Mute(f.room.ID, f.moderator.ID, "alice", time.Hour, "spam"); err != nil {
+		t.Fatalf("Mute: %v", err)
+	}
+
+	var muted *MutedError
+	if err := messages.CheckCanSend(f.room.ID, f.alice.ID); !errors.As(err, &muted) {
+		t.Fatalf("CheckCanSend error = %v, want MutedError", err)
+	}
+	if time.Until(muted.Until) < 59*time.Minute {
+		t.Fatalf("muted until %v, want about an hour from now", muted.Until)
+	}
+	if err := messages.CheckCanSend(f.room.ID, f.bob.ID); err != nil {
+		t.Fatalf("CheckCanSend for unmuted member: %v", err)
+	}
+
+	if _, err := f.moderation.Unmute(f.room.ID, f.moderator.ID, "alice"); err != nil {
+		t.Fatalf("Unmute: %v", err)
+	}
+	if err := messages.CheckCanSend(f.room.ID, f.alice.ID); err != nil {
+		t.Fatalf("CheckCanSend after unmute: %v", err)
+	}
+}
+
+func TestOnlyMembersCanPost(t *testing.T) {
+	f := newModerationFixture(t, store.NewMemoryStore())
+	messages := NewMessageService(f.store)
+	outsider := newTestUser(t, f.store, "outsider")
+
+	// Non-members cannot post until they join, so moderators never face a
+	// poster they cannot mute or kick
+	if err := messages.CheckCanSend(f.room.ID, outsider.ID); !errors.Is(err, ErrNotRoomMember) {
+		t.Fatalf("CheckCanSend for a non-member error = %v, want ErrNotRoomMember", err)
+	}
+	if err := messages.JoinPublicRoom(f.room.ID, outsider.ID); err != nil {
+		t.Fatalf("JoinPublicRoom: %v", err)
+	}
+	if err := messages.JoinPublicRoom(f.room.ID, outsider.ID); err != nil {
+		t.Fatalf("JoinPublicRoom as a member: %v", err)
+	}
+	if err := messages.CheckCanSend(f.room.ID, outsider.ID); err != nil {
+		t.Fatalf("CheckCanSend after joining: %v", err)
+	}
+
+	// Mute path: a member who posts can be muted
+	if _, err := f.moderation.Mute(f.room.ID, f.moderator.ID, "outsider", time.Hour, "spam"); err != nil {
+		t.Fatalf("Mute: %v", err)
+	}
+	var muted *MutedError
+	if err := messages.CheckCanSend(f.room.ID, outsider.ID); !errors.As(err, &muted) {
+		t.Fatalf("CheckCanSend when muted error = %v, want MutedError", err)
+	}
+
+	// Kick path: a kicked member cannot post until they join again
+	if err := f.moderation.Kick(f.room.ID, f.moderator.ID, "outsider", "spam"); err != nil {
+		t.Fatalf("Kick: %v", err)
+	}
+	if err := messages.CheckCanSend(f.room.ID, outsider.ID); !errors.Is(err, ErrNotRoomMember) {
+		t.Fatalf("CheckCanSend after kick error = %v, want ErrNotRoomMember", err)
+	}
+
+	// Pending join requests to private rooms do not let users post either
+	private, err := f.rooms.CreateRoom("den", f.owner.ID, "private")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	if member, err := f.rooms.JoinRoom(private.ID, f.alice.ID); err != nil || member.Status != MemberStatusPending {
+		t.Fatalf("JoinRoom(private) = %+v, %v; want a pending request", member, err)
+	}
+	if err := messages.CheckCanSend(private.ID, f.alice.ID); !errors.Is(err, ErrNotRoomMember) {
+		t.Fatalf("CheckCanSend for a pending member error = %v, want ErrNotRoomMember", err)
+	}
+	if err := messages.JoinPublicRoom(private.ID, f.alice.ID); !errors.Is(err, ErrNotRoomMember) {
+		t.Fatalf("JoinPublicRoom(private) error = %v, want ErrNotRoomMember", err)
+	}
+	if err := messages.JoinPublicRoom(private.ID, outsider.ID); !errors.Is(err, ErrNotRoomMember) {
+		t.Fatalf("JoinPublicRoom(private) for a non-member error = %v, want ErrNotRoomMember", err)
+	}
+}
+
+func TestKickDisconnectsMember(t *testing.T) {
+	f := newModerationFixture(t, store.NewMemoryStore())
+
+	if err := f.moderation.Kick(f.room.ID, f.moderator.ID, "alice", "be nice"); err != nil {
+		t.Fatalf("Kick: %v", err)
+	}
+	if _, err := f.store.GetRoomMember(f.room.ID, f.alice.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("membership after kick: %v, want ErrNotFound", err)
+	}
+	if len(f.sessions.calls) != 1 || f.sessions.calls[0] != f.room.ID+"/"+f.alice.ID {
+		t.Fatalf("disconnects = %v, want alice", f.sessions.calls)
+	}
+
+	// A kicked user is not banned
+	if err := f.moderation.Kick(f.room.ID, f.moderator.ID, "alice", ""); !errors.Is(err, ErrNotRoomMember) {
+		t.Fatalf("second Kick error = %v, want ErrNotRoomMember", err)
+	}
+	if _, err := f.rooms.JoinRoom(f.room.ID, f.alice.ID); err != nil {
+		t.Fatalf("JoinRoom after kick: %v", err)
+	}
+}
+
+func TestBanAndUnban(t *testing.T) {
+	f := newModerationFixture(t, store.NewMemoryStore())
+	messages := NewMessageService(f.store)
+
+	if _, err := f.moderation.Ban(f.room.ID, f.moderator.ID, "alice", "spam"); err != nil {
+		t.Fatalf("Ban: %v", err)
+	}
+	if _, err := f.moderation.Ban(f.room.ID, f.moderator.ID, "alice", "spam"); !errors.Is(err, store.ErrConflict) {
+		t.Fatalf("second Ban error = %v, want ErrConflict", err)
+	}
+	if len(f.sessions.calls) != 1 {
+		t.Fatalf("disconnects = %v, want one", f.sessions.calls)
+	}
+
+	if _, err := f.rooms.JoinRoom(f.room.ID, f.alice.ID); !errors.Is(err, ErrBanned) {
+		t.Fatalf("JoinRoom while banned error = %v, want ErrBanned", err)
+	}
+	if _, err := f.rooms.InviteMember(f.room.ID, f.bob.ID, "alice"); !errors.Is(err, ErrBanned) {
+		t.Fatalf("InviteMember while banned error = %v, want ErrBanned", err)
+	}
+	if err := messages.CheckCanConnect(f.room.ID, f.alice.ID); !errors.Is(err, ErrBanned) {
+		t.Fatalf("CheckCanConnect error = %v, want ErrBanned", err)
+	}
+
+	if err := f.moderation.Unban(f.room.ID, f.moderator.ID, "alice"); err != nil {
+		t.Fatalf("Unban: %v", err)
+	}
+	if _, err := f.rooms.JoinRoom(f.room.ID, f.alice.ID); err != nil {
+		t.Fatalf("JoinRoom after unban: %v", err)
+	}
+
+	log, err := f.moderation.GetLog(f.room.ID, f.owner.ID)
+	if err != nil {
+		t.Fatalf("GetLog: %v", err)
+	}
+	var actions []string
+	for _, entry := range log {
+		actions = append(actions, entry.Action)
+	}
+	want := []string{ActionUnban, ActionBan, ActionPromote}
+	if len(actions) != len(want) {
+		t.Fatalf("log actions = %v, want %v", actions, want)
+	}
+	for i := range want {
+		if actions[i] != want[i] {
+			t.Fatalf("log actions = %v, want %v", actions, want)
+		}
+	}
+}
+
+func TestBanRollsBackWhenLogFails(t *testing.T) {
+	mem := store.NewMemoryStore()
+	f := newModerationFixture(t, mem)
+
+	faulty := NewModerationService(storetest.NewFaultStore(mem, "SaveModerationAction"), f.sessions, f.sessions)
+	if _, err := faulty.Ban(f.room.ID, f.moderator.ID, "alice", ""); !errors.Is(err, storetest.ErrInjected) {
+		t.Fatalf("Ban error = %v, want injected failure", err)
+	}
+
+	if _, err := mem.GetBan(f.room.ID, f.alice.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("ban left behind: %v", err)
+	}
+	if _, err := mem.GetRoomMember(f.room.ID, f.alice.ID); err != nil {
+		t.Fatalf("membership removed by failed ban: %v", err)
+	}
+	if len(f.sessions.calls) != 0 {
+		t.Fatalf("disconnects = %v, want none", f.sessions.calls)
+	}
+}
+
+func TestHeldMessageReview(t *testing.T) {
+	f := newModerationFixture(t, store.NewMemoryStore())
+	messages := NewMessageService(f.store)
+	messages.SetContentFilter(contentfilter.NewChain(contentfilter.NewWordList([]string{"casino"}, contentfilter.Hold)))
+
+	hold := func(content string) *models.Message {
+		msg := &models.Message{ID: GenerateUUID(), RoomID: f.room.ID, SenderID: f.alice.ID, Content: content, Timestamp: time.Now()}
+		result, err := messages.ScreenMessage(msg)
+		if err != nil || result.Verdict != contentfilter.Hold {
+			t.Fatalf("ScreenMessage(%q) = %+v, %v; want hold", content, result, err)
+		}
+		return msg
+	}
+	first := hold("casino night @bob")
+	second := hold("more casino")
+
+	if _, err := f.moderation.GetHeldMessages(f.room.ID, f.alice.ID); !errors.Is(err, ErrNotModerator) {
+		t.Fatalf("GetHeldMessages by member error = %v, want ErrNotModerator", err)
+	}
+	queue, err := f.moderation.GetHeldMessages(f.room.ID, f.moderator.ID)
+	if err != nil || len(queue) != 2 || queue[0].ID != first.ID || queue[0].SenderUsername != "alice" {
+		t.Fatalf("GetHeldMessages = %+v, %v; want both messages from alice", queue, err)
+	}
+	if history, _ := messages.GetMessagesByRoom(f.room.ID); len(history) != 0 {
+		t.Fatalf("held messages in history: %+v", history)
+	}
+
+	approved, err := f.moderation.ApproveHeldMessage(f.room.ID, f.moderator.ID, first.ID)
+	if err != nil {
+		t.Fatalf("ApproveHeldMessage: %v", err)
+	}
+	if len(approved.Mentions) != 1 || approved.Mentions[0] != "bob" {
+		t.Fatalf("approved mentions = %v, want bob", approved.Mentions)
+	}
+	if len(f.sessions.published) != 1 || f.sessions.published[0].ID != first.ID {
+		t.Fatalf("published = %+v, want the approved message", f.sessions.published)
+	}
+	if _, err := f.moderation.ApproveHeldMessage(f.room.ID, f.moderator.ID, first.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("second approval error = %v, want ErrNotFound", err)
+	}
+
+	if err := f.moderation.DiscardHeldMessage(f.room.ID, f.moderator.ID, second.ID); err != nil {
+		t.Fatalf("DiscardHeldMessage: %v", err)
+	}
+	history, err := messages.GetMessagesByRoom(f.room.ID)
+	if err != nil || len(history) != 1 || history[0].ID != first.ID {
+		t.Fatalf("history = %+v, %v; want only the approved message", history, err)
+	}
+	if queue, _ := f.moderation.GetHeldMessages(f.room.ID, f.moderator.ID); len(queue) != 0 {
+		t.Fatalf("queue after review = %+v, want empty", queue)
+	}
+
+	log, err := f.moderation.GetLog(f.room.ID, f.owner.ID)
+	if err != nil || len(log) < 2 {
+		t.Fatalf("GetLog = %+v, %v", log, err)
+	}
+	actions := map[string]bool{log[0].Action: true, log[1].Action: true}
+	if !actions[ActionApprove] || !actions[ActionDiscard] {
+		t.Fatalf("log = %+v, want approve and discard entries", log)
+	}
+}
@@ -0,0 +1,265 @@
+package services
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Report statuses.
+const (
+	ReportStatusOpen      = "open"
+	ReportStatusResolved  = "resolved"
+	ReportStatusDismissed = "dismissed"
+)
+
+// Actions a moderator can take to close a report.
+const (
+	ReportActionDismiss       = "dismiss"
+	ReportActionDeleteMessage = ActionDeleteMessage
+	ReportActionMute          = ActionMute
+	ReportActionBan           = ActionBan
+)
+
+// reportCategories are the reasons a message can be reported for.
+var reportCategories = map[string]bool{
+	"spam":       true,
+	"harassment": true,
+	"hate":       true,
+	"sexual":     true,
+	"violence":   true,
+	"other":      true,
+}
+
+// maxReportDetails is the longest free-text explanation a reporter can give.
+const maxReportDetails = 1000
+
+var (
+	// ErrInvalidCategory is returned when a report has an unknown category.
+	ErrInvalidCategory = errors.New("category must be spam, harassment, hate, sexual, violence or other")
+	// ErrReportDetailsTooLong is returned when a report's details exceed maxReportDetails.
+	ErrReportDetailsTooLong = errors.New("details must be at most 1000 characters")
+	// ErrAlreadyReported is returned when a user reports the same message twice.
+	ErrAlreadyReported = errors.New("you have already reported this message")
+	// ErrCannotReportOwn is returned when a user reports their own message.
+	ErrCannotReportOwn = errors.New("you cannot report your own message")
+	// ErrReportClosed is returned when acting on a report that is no longer open.
+	ErrReportClosed = errors.New("this report has already been closed")
+	// ErrInvalidReportAction is returned when a report is closed with an unknown action.
+	ErrInvalidReportAction = errors.New("action must be dismiss, delete_message, mute or ban")
+)
+
+// ReportResolution is the action a moderator takes on a report.
+type ReportResolution struct {
+	Action   string        // one of the ReportAction constants
+	Reason   string        // recorded in the moderation log
+	Duration time.Duration // mute only
+}
+
+// ReportService lets users report messages and moderators work through the reports.
+type ReportService struct {
+	store      store.StoreInterface
+	moderation *ModerationService
+}
+
+// NewReportService creates a new ReportService. Actions taken on reports are
+// carried out by moderation.
+func NewReportService(s store.StoreInterface, moderation *ModerationService) *ReportService {
+	return &ReportService{store: s, moderation: moderation}
+}
+
+// WithContext returns a copy of the service whose queries, including those of
+// the moderation actions it takes, are traced as part of ctx.
+func (s *ReportService) WithContext(ctx context.Context) *ReportService {
+	return &ReportService{store: s.store.WithContext(ctx), moderation: s.moderation.WithContext(ctx)}
+}
+
+// ReportMessage files a report about a message on behalf of a member of its
+// room. The message's content is copied into the report so that it can still
+// be reviewed if the message is later deleted.
+func (s *ReportService) ReportMessage(messageID, reporterID, category, details string) (*models.MessageReport, error) {
+	if !reportCategories[category] {
+		return nil, ErrInvalidCategory
+	}
+	if len([]rune(details)) > maxReportDetails {
+		return nil, ErrReportDetailsTooLong
+	}
+
+	var report *models.MessageReport
+	err := s.store.WithTx(func(tx store.StoreInterface) error {
+		message, err := tx.GetMessageByID(messageID)
+		if err != nil {
+			return err
+		}
+		if message.SenderID == reporterID {
+			return ErrCannotReportOwn
+		}
+
+		member, err := tx.GetRoomMember(message.RoomID, reporterID)
+		if errors.Is(err, store.ErrNotFound) || (err == nil && member.Status != MemberStatusMember) {
+			return ErrNotRoomMember
+		}
+		if err != nil {
+			return err
+		}
+
+		report = &models.MessageReport{
+			ID:         uuid.NewString(),
+			MessageID:  message.ID,
+			RoomID:     message.RoomID,
+			ReporterID: reporterID,
+			SenderID:   message.SenderID,
+			Category:   category,
+			Details:    details,
+			Content:    message.Content,
+			SentAt:     message.Timestamp,
+			Status:     ReportStatusOpen,
+			CreatedAt:  time.Now(),
+		}
+		err = tx.CreateReport(report)
+		if errors.Is(err, store.ErrConflict) {
+			return ErrAlreadyReported
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// ListRoomReports returns a room's reports with the given status (or all of
+// them if status is empty), oldest first. Only the owner, moderators and
+// administrators can read them.
+func (s *ReportService) ListRoomReports(roomID, actorID, status string) ([]*models.MessageReport, error) {
+	if _, err := requireModerator(s.store, roomID, actorID); err != nil {
+		return nil, err
+	}
+	reports, err := s.store.ListReports(roomID, status)
+	if err != nil {
+		return nil, err
+	}
+	return reports, s.fillUsernames(reports)
+}
+
+// ListAllReports returns the reports from every room with the given status
+// (or all of them if status is empty), oldest first. Callers are expected to
+// have checked that the acting user is an administrator.
+func (s *ReportService) ListAllReports(status string) ([]*models.MessageReport, error) {
+	reports, err := s.store.ListReports("", status)
+	if err != nil {
+		return nil, err
+	}
+	return reports, s.fillUsernames(reports)
+}
+
+// fillUsernames sets the reporter and sender names of reports. Reports about
+// users who have since been deleted keep an empty sender name.
+func (s *ReportService) fillUsernames(reports []*models.MessageReport) error {
+	names := make(map[string]string)
+	lookup := func(userID string) (string, error) {
+		if name, ok := names[userID]; ok {
+			return name, nil
+		}
+		user, err := s.store.GetUserByID(userID)
+		if errors.Is(err, store.ErrNotFound) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		names[userID] = user.Username
+		return user.Username, nil
+	}
+
+	for _, report := range reports {
+		var err error
+		if report.ReporterUsername, err = lookup(report.ReporterID); err != nil {
+			return err
+		}
+		if report.SenderUsername, err = lookup(report.SenderID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResolveReport closes an open report by dismissing it or by deleting the
+// message, muting the sender or banning them. The moderation action is linked
+// to the report in the moderation log. Every other open report about the same
+// message is closed with it.
+func (s *ReportService) ResolveReport(reportID, actorID string, resolution ReportResolution) (*models.MessageReport, error) {
+	var report *models.MessageReport
+	var pending []func()
+	err := s.store.WithTx(func(tx store.StoreInterface) error {
+		var err error
+		report, err = tx.GetReport(reportID)
+		if err != nil {
+			return err
+		}
+		if _, err := requireModerator(tx, report.RoomID, actorID); err != nil {
+			return err
+		}
+		if report.Status != ReportStatusOpen {
+			return ErrReportClosed
+		}
+
+		status := ReportStatusResolved
+		moderation := s.moderation.forReport(tx, report.ID, &pending)
+		switch resolution.Action {
+		case ReportActionDismiss:
+			status = ReportStatusDismissed
+		case ReportActionDeleteMessage:
+			err = moderation.DeleteMessage(report.RoomID, actorID, report.MessageID, resolution.Reason)
+		case ReportActionMute, ReportActionBan:
+			var sender *models.User
+			if sender, err = tx.GetUserByID(report.SenderID); err != nil {
+				return err
+			}
+			if resolution.Action == ReportActionMute {
+				_, err = moderation.Mute(report.RoomID, actorID, sender.Username, resolution.Duration, resolution.Reason)
+			} else {
+				_, err = moderation.Ban(report.RoomID, actorID, sender.Username, resolution.Reason)
+			}
+		default:
+			return ErrInvalidReportAction
+		}
+		if err != nil {
+			return err
+		}
+
+		related, err := tx.ListReports(report.RoomID, ReportStatusOpen)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		for _, r := range related {
+			if r.MessageID != report.MessageID {
+				continue
+			}
+			r.Status = status
+			r.Resolution = resolution.Action
+			r.ResolvedBy = actorID
+			r.ResolvedAt = &now
+			if err := tx.UpdateReport(r); err != nil {
+				return err
+			}
+			if r.ID == report.ID {
+				report = r
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fn := range pending {
+		fn()
+	}
+	return report, nil
+}
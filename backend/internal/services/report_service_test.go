@@ -0,0 +1,142 @@
+package services
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"errors"
+	"testing"
+	"time"
+)
+
+// sendTestMessage stores a message from sender in the fixture's room.
+func sendTestMessage(t *testing.T, f *moderationFixture, sender *models.User, content string) *models.Message {
+	t.Helper()
+	msg := &models.Message{ID: GenerateUUID(), RoomID: f.room.ID, SenderID: sender.ID, Content: content, Timestamp: time.Now()}
+	if err := NewMessageService(f.store).SaveMessage(msg); err != nil {
+		t.Fatalf("SaveMessage: %v", err)
+	}
+	return msg
+}
+
+func TestReportMessage(t *testing.T) {
+	f := newModerationFixture(t, store.NewMemoryStore())
+	reports := NewReportService(f.store, f.moderation)
+	msg := sendTestMessage(t, f, f.alice, "buy followers")
+	outsider := newTestUser(t, f.store, "outsider")
+
+	tests := []struct {
+		name     string
+		reporter *models.User
+		category string
+		wantErr  error
+	}{
+		{"unknown category", f.bob, "rude", ErrInvalidCategory},
+		{"own message", f.alice, "spam", ErrCannotReportOwn},
+		{"not a member", outsider, "spam", ErrNotRoomMember},
+		{"member", f.bob, "spam", nil},
+		{"same reporter again", f.bob, "harassment", ErrAlreadyReported},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := reports.ReportMessage(msg.ID, tc.reporter.ID, tc.category, "")
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("ReportMessage error = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+	if _, err := reports.ReportMessage("missing", f.bob.ID, "spam", ""); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("ReportMessage(missing) error = %v, want ErrNotFound", err)
+	}
+
+	// The report keeps the content after the message itself is gone
+	if err := f.store.DeleteMessage(msg.ID); err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+	if _, err := reports.ListRoomReports(f.room.ID, f.bob.ID, ReportStatusOpen); !errors.Is(err, ErrNotModerator) {
+		t.Fatalf("ListRoomReports by member error = %v, want ErrNotModerator", err)
+	}
+	queue, err := reports.ListRoomReports(f.room.ID, f.moderator.ID, ReportStatusOpen)
+	if err != nil || len(queue) != 1 {
+		t.Fatalf("ListRoomReports = %+v, %v; want one report", queue, err)
+	}
+	if r := queue[0]; r.Content != "buy followers" || r.ReporterUsername != "bob" || r.SenderUsername != "alice" {
+		t.Fatalf("report = %+v, want snapshot of alice's message reported by bob", r)
+	}
+}
+
+func TestResolveReportWithBan(t *testing.T) {
+	f := newModerationFixture(t, store.NewMemoryStore())
+	reports := NewReportService(f.store, f.moderation)
+	msg := sendTestMessage(t, f, f.alice, "you are all idiots")
+
+	first, err := reports.ReportMessage(msg.ID, f.bob.ID, "harassment", "")
+	if err != nil {
+		t.Fatalf("ReportMessage: %v", err)
+	}
+	second, err := reports.ReportMessage(msg.ID, f.moderator.ID, "harassment", "second report")
+	if err != nil {
+		t.Fatalf("ReportMessage: %v", err)
+	}
+
+	if _, err := reports.ResolveReport(first.ID, f.bob.ID, ReportResolution{Action: ReportActionBan}); !errors.Is(err, ErrNotModerator) {
+		t.Fatalf("ResolveReport by member error = %v, want ErrNotModerator", err)
+	}
+	if _, err := reports.ResolveReport(first.ID, f.moderator.ID, ReportResolution{Action: "warn"}); !errors.Is(err, ErrInvalidReportAction) {
+		t.Fatalf("ResolveReport(warn) error = %v, want ErrInvalidReportAction", err)
+	}
+
+	resolved, err := reports.ResolveReport(first.ID, f.moderator.ID, ReportResolution{Action: ReportActionBan, Reason: "abuse"})
+	if err != nil {
+		t.Fatalf("ResolveReport: %v", err)
+	}
+	if resolved.Status != ReportStatusResolved || resolved.ResolvedBy != f.moderator.ID || resolved.ResolvedAt == nil {
+		t.Fatalf("resolved report = %+v", resolved)
+	}
+	if len(f.sessions.calls) != 1 || f.sessions.calls[0] != f.room.ID+"/"+f.alice.ID {
+		t.Fatalf("disconnects = %v, want alice", f.sessions.calls)
+	}
+
+	// Other reports about the same message are closed too
+	if other, err := f.store.GetReport(second.ID); err != nil || other.Status != ReportStatusResolved {
+		t.Fatalf("second report = %+v, %v; want resolved", other, err)
+	}
+	if _, err := reports.ResolveReport(second.ID, f.moderator.ID, ReportResolution{Action: ReportActionDismiss}); !errors.Is(err, ErrReportClosed) {
+		t.Fatalf("ResolveReport on closed report error = %v, want ErrReportClosed", err)
+	}
+
+	log, err := f.moderation.GetLog(f.room.ID, f.owner.ID)
+	if err != nil || len(log) == 0 || log[0].Action != ActionBan || log[0].ReportID != first.ID {
+		t.Fatalf("latest log entry = %+v, %v; want ban linked to the report", log, err)
+	}
+}
+
+func TestResolveReportDeletesMessage(t *testing.T) {
+	f := newModerationFixture(t, store.NewMemoryStore())
+	reports := NewReportService(f.store, f.moderation)
+	msg := sendTestMessage(t, f, f.bob, "spam spam spam")
+
+	report, err := reports.ReportMessage(msg.ID, f.alice.ID, "spam", "")
+	if err != nil {
+		t.Fatalf("ReportMessage: %v", err)
+	}
+
+	// Administrators can resolve reports in rooms they are not members of
+	admin := newTestUser(t, f.store, "root")
+	admin.IsAdmin = true
+	if err := f.store.UpdateUser(admin); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if _, err := reports.ResolveReport(report.ID, admin.ID, ReportResolution{Action: ReportActionDeleteMessage}); err != nil {
+		t.Fatalf("ResolveReport: %v", err)
+	}
+
+	if _, err := f.store.GetMessageByID(msg.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("message after delete: %v, want ErrNotFound", err)
+	}
+	if len(f.sessions.deleted) != 1 || f.sessions.deleted[0] != msg.ID {
+		t.Fatalf("published deletions = %v, want %s", f.sessions.deleted, msg.ID)
+	}
+	if all, err := reports.ListAllReports(""); err != nil || len(all) != 1 || all[0].Content != "spam spam spam" {
+		t.Fatalf("ListAllReports = %+v, %v; want the resolved report", all, err)
+	}
+}
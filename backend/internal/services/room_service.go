@@ -3,10 +3,34 @@ package services
 import (
 	"backend/internal/models"
 	"backend/internal/store"
+	"context"
+	"errors"
 
 	"github.com/google/uuid"
 )
 
+// Membership statuses stored in room_members.
+const (
+	MemberStatusMember  = "member"
+	MemberStatusPending = "pending"
+)
+
+// Room roles stored in room_members, from most to least powerful.
+const (
+	RoleOwner     = "owner"
+	RoleModerator = "moderator"
+	RoleMember    = "member"
+)
+
+var (
+	// ErrNotRoomMember is returned when an action requires room membership.
+	ErrNotRoomMember = errors.New("user is not a member of this room")
+	// ErrOwnerCannotLeave is returned when the room owner tries to leave their own room.
+	ErrOwnerCannotLeave = errors.New("the room owner cannot leave the room")
+	// ErrRoomArchived is returned when joining or posting in an archived room.
+	ErrRoomArchived = errors.New("this room has been archived")
+)
+
 // RoomService provides room-related business logic.
 type RoomService struct {
 	store store.StoreInterface
@@ -17,7 +41,13 @@ func NewRoomService(s store.StoreInterface) *RoomService {
 	return &RoomService{store: s}
 }
 
+// WithContext returns a copy of the service whose queries are traced as part of ctx.
+func (s *RoomService) WithContext(ctx context.Context) *RoomService {
+	return &RoomService{store: s.store.WithContext(ctx)}
+}
+
 // CreateRoom handles the business logic of creating a new chat room.
+// The room and its owner's membership are created atomically.
 func (s *RoomService) CreateRoom(name, ownerID, roomType string) (*models.ChatRoom, error) {
 	// Create a new room model
 	newRoom := &models.ChatRoom{
@@ -27,20 +57,21 @@ func (s *RoomService) CreateRoom(name, ownerID, roomType string) (*models.ChatRo
 		RoomType: roomType,
 	}
 
-	// Save the room to the database
-	if err := s.store.CreateRoom(newRoom); err != nil {
-		return nil, err
-	}
-
-	// Add the owner as the first member of the room
-	firstMember := &models.RoomMember{
-		RoomID: newRoom.ID,
-		UserID: ownerID,
-		Status: "member", // The owner is automatically a member
-	}
+	err := s.store.WithTx(func(tx store.StoreInterface) error {
+		// Save the room to the database
+		if err := tx.CreateRoom(newRoom); err != nil {
+			return err
+		}
 
-	if err := s.store.AddRoomMember(firstMember); err != nil {
-		// In a real-world app, we might want to roll back the room creation here.
+		// Add the owner as the first member of the room
+		return tx.AddRoomMember(&models.RoomMember{
+			RoomID: newRoom.ID,
+			UserID: ownerID,
+			Status: MemberStatusMember, // The owner is automatically a member
+			Role:   RoleOwner,
+		})
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -62,3 +93,118 @@ func (s *RoomService) GetRoomsForUser(userID string) ([]models.ChatRoom, error)
 
 	return result, nil
 }
+
+// JoinRoom adds a user to a room. Public rooms are joined immediately; joining a
+// private room records a pending request. Joining a room twice is not an error.
+// Users banned from the room cannot join it, and archived rooms cannot be joined.
+func (s *RoomService) JoinRoom(roomID, userID string) (*models.RoomMember, error) {
+	var member *models.RoomMember
+	err := s.store.WithTx(func(tx store.StoreInterface) error {
+		room, err := tx.GetRoomByID(roomID)
+		if err != nil {
+			return err
+		}
+		if room.Archived {
+			return ErrRoomArchived
+		}
+		if err := checkNotBanned(tx, roomID, userID); err != nil {
+			return err
+		}
+
+		status := MemberStatusMember
+		if room.RoomType != "public" {
+			status = MemberStatusPending
+		}
+
+		existing, err := tx.GetRoomMember(roomID, userID)
+		switch {
+		case err == nil:
+			// Already a member, or already waiting for approval
+			member = existing
+			return nil
+		case !errors.Is(err, store.ErrNotFound):
+			return err
+		}
+
+		member = &models.RoomMember{RoomID: roomID, UserID: userID, Status: status, Role: RoleMember}
+		return tx.AddRoomMember(member)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// InviteMember makes the user with the given username a full member of a room.
+// The inviter must be a member. A pending join request is approved by the invite.
+// Users banned from the room, or who have blocked the inviter, cannot be invited.
+func (s *RoomService) InviteMember(roomID, inviterID, username string) (*models.RoomMember, error) {
+	var member *models.RoomMember
+	err := s.store.WithTx(func(tx store.StoreInterface) error {
+		if err := requireMember(tx, roomID, inviterID); err != nil {
+			return err
+		}
+
+		invitee, err := tx.GetUserByUsername(username)
+		if err != nil {
+			return err
+		}
+		if err := checkNotBanned(tx, roomID, invitee.ID); err != nil {
+			return err
+		}
+		if err := checkNotBlocked(tx, invitee.ID, inviterID); err != nil {
+			return err
+		}
+
+		member = &models.RoomMember{RoomID: roomID, UserID: invitee.ID, Status: MemberStatusMember, Role: RoleMember}
+		existing, err := tx.GetRoomMember(roomID, invitee.ID)
+		switch {
+		case err == nil && existing.Status == MemberStatusMember:
+			member = existing
+			return nil
+		case err == nil:
+			existing.Status = MemberStatusMember
+			member = existing
+			return tx.UpdateRoomMember(member)
+		case errors.Is(err, store.ErrNotFound):
+			return tx.AddRoomMember(member)
+		default:
+			return err
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// LeaveRoom removes a user's membership of a room.
+func (s *RoomService) LeaveRoom(roomID, userID string) error {
+	return s.store.WithTx(func(tx store.StoreInterface) error {
+		room, err := tx.GetRoomByID(roomID)
+		if err != nil {
+			return err
+		}
+		if room.OwnerID == userID {
+			return ErrOwnerCannotLeave
+		}
+		return tx.RemoveRoomMember(roomID, userID)
+	})
+}
+
+// requireMember returns ErrNotRoomMember unless the user is a full member of the room,
+// and ErrRoomArchived if the room has been archived.
+func requireMember(s store.StoreInterface, roomID, userID string) error {
+	room, err := s.GetRoomByID(roomID)
+	if err != nil {
+		return err
+	}
+	if room.Archived {
+		return ErrRoomArchived
+	}
+	member, err := s.GetRoomMember(roomID, userID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && member.Status != MemberStatusMember) {
+		return ErrNotRoomMember
+	}
+	return err
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"backend/internal/config"
+	"backend/internal/models"
+	"backend/internal/store"
+	"backend/internal/store/storetest"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// newTestUser stores a user directly and returns it.
+func newTestUser(t *testing.T, s store.StoreInterface, username string) *models.User {
+	t.Helper()
+	user := &models.User{ID: GenerateUUID(), Username: username, Password: "hash"}
+	if err := s.CreateUser(user); err != nil {
+		t.Fatalf("CreateUser(%q): %v", username, err)
+	}
+	return user
+}
+
+func TestCreateRoomRollsBackWhenMembershipFails(t *testing.T) {
+	mem := store.NewMemoryStore()
+	owner := newTestUser(t, mem, "owner")
+
+	rooms := NewRoomService(storetest.NewFaultStore(mem, "AddRoomMember"))
+	if _, err := rooms.CreateRoom("lobby", owner.ID, "public"); !errors.Is(err, storetest.ErrInjected) {
+		t.Fatalf("CreateRoom error = %v, want injected failure", err)
+	}
+
+	// No orphan room may be left behind
+	list, err := mem.GetRoomsByUserID(owner.ID)
+	if err != nil {
+		t.Fatalf("GetRoomsByUserID: %v", err)
+	}
+	if len(list) != 0 {
+		t.Fatalf("found %d rooms after failed CreateRoom, want 0", len(list))
+	}
+
+	// The name is still available once the failure goes away
+	room, err := NewRoomService(mem).CreateRoom("lobby", owner.ID, "public")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	if member, err := mem.GetRoomMember(room.ID, owner.ID); err != nil || member.Status != MemberStatusMember {
+		t.Fatalf("owner membership = %+v, %v", member, err)
+	}
+}
+
+func TestCreateRoomRollsBackOnSQLite(t *testing.T) {
+	db, err := store.NewDBStore(&config.DatabaseConfig{Type: "sqlite", SQLitePath: filepath.Join(t.TempDir(), "chatapp.db")})
+	if err != nil {
+		t.Fatalf("NewDBStore: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	owner := newTestUser(t, db, "owner")
+
+	rooms := NewRoomService(storetest.NewFaultStore(db, "AddRoomMember"))
+	if _, err := rooms.CreateRoom("lobby", owner.ID, "public"); !errors.Is(err, storetest.ErrInjected) {
+		t.Fatalf("CreateRoom error = %v, want injected failure", err)
+	}
+	if list, err := db.GetRoomsByUserID(owner.ID); err != nil || len(list) != 0 {
+		t.Fatalf("rooms after failed CreateRoom = %v, %v; want none", list, err)
+	}
+}
+
+func TestJoinRoom(t *testing.T) {
+	mem := store.NewMemoryStore()
+	owner := newTestUser(t, mem, "owner")
+	guest := newTestUser(t, mem, "guest")
+	rooms := NewRoomService(mem)
+
+	public, err := rooms.CreateRoom("lobby", owner.ID, "public")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	private, err := rooms.CreateRoom("secret", owner.ID, "private")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+
+	if m, err := rooms.JoinRoom(public.ID, guest.ID); err != nil || m.Status != MemberStatusMember {
+		t.Fatalf("JoinRoom(public) = %+v, %v; want member", m, err)
+	}
+	if m, err := rooms.JoinRoom(public.ID, guest.ID); err != nil || m.Status != MemberStatusMember {
+		t.Fatalf("second JoinRoom(public) = %+v, %v; want member", m, err)
+	}
+	if m, err := rooms.JoinRoom(private.ID, guest.ID); err != nil || m.Status != MemberStatusPending {
+		t.Fatalf("JoinRoom(private) = %+v, %v; want pending", m, err)
+	}
+	if _, err := rooms.JoinRoom(GenerateUUID(), guest.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("JoinRoom(unknown) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestInviteMember(t *testing.T) {
+	mem := store.NewMemoryStore()
+	owner := newTestUser(t, mem, "owner")
+	guest := newTestUser(t, mem, "guest")
+	outsider := newTestUser(t, mem, "outsider")
+	rooms := NewRoomService(mem)
+
+	private, err := rooms.CreateRoom("secret", owner.ID, "private")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+
+	if _, err := rooms.InviteMember(private.ID, outsider.ID, "guest"); !errors.Is(err, ErrNotRoomMember) {
+		t.Fatalf("InviteMember by outsider error = %v, want ErrNotRoomMember", err)
+	}
+
+	// A pending request is upgraded by the invite
+	if _, err := rooms.JoinRoom(private.ID, guest.ID); err != nil {
+		t.Fatalf("JoinRoom: %v", err)
+	}
+	if m, err := rooms.InviteMember(private.ID, owner.ID, "guest"); err != nil || m.Status != MemberStatusMember {
+		t.Fatalf("InviteMember = %+v, %v; want member", m, err)
+	}
+
+	// A failed update leaves the invitee pending
+	if _, err := rooms.JoinRoom(private.ID, outsider.ID); err != nil {
+		t.Fatalf("JoinRoom: %v", err)
+	}
+	faulty := NewRoomService(storetest.NewFaultStore(mem, "UpdateRoomMember"))
+	if _, err := faulty.InviteMember(private.ID, owner.ID, "outsider"); !errors.Is(err, storetest.ErrInjected) {
+		t.Fatalf("InviteMember error = %v, want injected failure", err)
+	}
+	if m, err := mem.GetRoomMember(private.ID, outsider.ID); err != nil || m.Status != MemberStatusPending {
+		t.Fatalf("membership after failed invite = %+v, %v; want pending", m, err)
+	}
+}
+
+func TestLeaveRoom(t *testing.T) {
+	mem := store.NewMemoryStore()
+	owner := newTestUser(t, mem, "owner")
+	guest := newTestUser(t, mem, "guest")
+	rooms := NewRoomService(mem)
+
+	room, err := rooms.CreateRoom("lobby", owner.ID, "public")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	if _, err := rooms.JoinRoom(room.ID, guest.ID); err != nil {
+		t.Fatalf("JoinRoom: %v", err)
+	}
+
+	if err := rooms.LeaveRoom(room.ID, owner.ID); !errors.Is(err, ErrOwnerCannotLeave) {
+		t.Fatalf("LeaveRoom(owner) error = %v, want ErrOwnerCannotLeave", err)
+	}
+	if err := rooms.LeaveRoom(room.ID, guest.ID); err != nil {
+		t.Fatalf("LeaveRoom: %v", err)
+	}
+	if err := rooms.LeaveRoom(room.ID, guest.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("second LeaveRoom error = %v, want ErrNotFound", err)
+	}
+}
@@ -3,8 +3,9 @@ package services
 import (
 	"backend/internal/models"
 	"backend/internal/store"
+	"context"
 	"errors"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -12,15 +13,19 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-// JWT secret key used to sign tokens
-const jwtSecret = "your-256-bit-secret-key-change-this-in-production"
-
-// TokenExpiration defines how long a JWT token is valid
-const TokenExpiration = 24 * time.Hour
+var (
+	// ErrInvalidCredentials is returned when a username or password does not match.
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrAccountDisabled is returned when a disabled user tries to log in or connect.
+	ErrAccountDisabled = errors.New("this account has been disabled")
+)
 
 // UserService provides user-related business logic.
 type UserService struct {
-	store store.StoreInterface
+	store       store.StoreInterface
+	ctx         context.Context
+	tokenSecret []byte
+	tokenTTL    time.Duration
 }
 
 // TokenClaims represents the claims in the JWT token
@@ -30,49 +35,45 @@ type TokenClaims struct {
 	jwt.RegisteredClaims
 }
 
-// NewUserService creates a new UserService.
-func NewUserService(s store.StoreInterface) *UserService {
-	return &UserService{store: s}
+// NewUserService creates a new UserService that signs login tokens with
+// tokenSecret and makes them valid for tokenTTL.
+func NewUserService(s store.StoreInterface, tokenSecret string, tokenTTL time.Duration) *UserService {
+	return &UserService{store: s, ctx: context.Background(), tokenSecret: []byte(tokenSecret), tokenTTL: tokenTTL}
+}
+
+// WithContext returns a copy of the service whose queries are traced as part
+// of ctx and whose log lines carry ctx's request ID.
+func (s *UserService) WithContext(ctx context.Context) *UserService {
+	return &UserService{store: s.store.WithContext(ctx), ctx: ctx, tokenSecret: s.tokenSecret, tokenTTL: s.tokenTTL}
 }
 
 // RegisterUser handles the business logic of creating a new user.
 func (s *UserService) RegisterUser(username, password string) (*models.User, error) {
-	log.Printf("RegisterUser: Starting registration for username: %s", username)
-	
 	// Skip the username check and directly try to create the user
 	// The database will enforce uniqueness constraint on the username
 	
 	// Hash the password for security
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := hashPassword(password)
 	if err != nil {
-		log.Printf("RegisterUser: Failed to hash password: %v", err)
+		slog.ErrorContext(s.ctx, "failed to hash password", "error", err)
 		return nil, err
 	}
 
 	// Create a new user model
 	userID := uuid.NewString()
-	log.Printf("RegisterUser: Generated UUID: %s", userID)
 	newUser := &models.User{
 		ID:       userID,
 		Username: username,
-		Password: string(hashedPassword),
+		Password: hashedPassword,
 	}
 
 	// Save the user to the database
-	log.Printf("RegisterUser: Attempting to save user to database")
 	if err = s.store.CreateUser(newUser); err != nil {
-		log.Printf("RegisterUser: Database error creating user: %v", err)
-		
-		// Check if the error is due to a duplicate username
-		if err.Error() == "UNIQUE constraint failed: users.username" || 
-		   err.Error() == "pq: duplicate key value violates unique constraint \"users_username_key\"" {
-			return nil, errors.New("username already exists")
-		}
-		
+		// A duplicate username surfaces as store.ErrConflict on the username field
 		return nil, err
 	}
 
-	log.Printf("RegisterUser: User successfully created in database")
+	slog.InfoContext(s.ctx, "user registered", "username", username, "user_id", userID)
 	return newUser, nil
 }
 
@@ -86,18 +87,26 @@ func (s *UserService) AuthenticateUser(username, password string) (string, error
 	// Get the user from the database
 	user, err := s.store.GetUserByUsername(username)
 	if err != nil {
-		return "", errors.New("invalid username or password")
+		if errors.Is(err, store.ErrNotFound) {
+			return "", ErrInvalidCredentials
+		}
+		return "", err
 	}
 
 	// Additional safety check to prevent nil pointer dereference
 	if user == nil {
-		return "", errors.New("invalid username or password")
+		return "", ErrInvalidCredentials
 	}
 
 	// Compare the provided password with the stored hash
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	if err != nil {
-		return "", errors.New("invalid username or password")
+		return "", ErrInvalidCredentials
+	}
+
+	// Only tell the caller the account is disabled once they have proven who they are
+	if user.Disabled {
+		return "", ErrAccountDisabled
 	}
 
 	// Generate a JWT token
@@ -109,6 +118,15 @@ func (s *UserService) AuthenticateUser(username, password string) (string, error
 	return token, nil
 }
 
+// hashPassword hashes a password with bcrypt for storage.
+func hashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
 // generateJWT creates a new JWT token for a user
 func (s *UserService) generateJWT(user *models.User) (string, error) {
 	// Create the claims
@@ -116,7 +134,7 @@ func (s *UserService) generateJWT(user *models.User) (string, error) {
 		UserID:   user.ID,
 		Username: user.Username,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(TokenExpiration)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.tokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 			Issuer:    "chat-app",
@@ -128,7 +146,7 @@ func (s *UserService) generateJWT(user *models.User) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	// Sign the token with the secret key
-	tokenString, err := token.SignedString([]byte(jwtSecret))
+	tokenString, err := token.SignedString(s.tokenSecret)
 	if err != nil {
 		return "", err
 	}
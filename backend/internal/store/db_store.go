@@ -2,11 +2,18 @@ package store
 
 import (
 	"backend/internal/config"
+	"backend/internal/tracing"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
 	// Import database drivers
 	_ "github.com/lib/pq"           // PostgreSQL driver
 	_ "github.com/mattn/go-sqlite3" // SQLite driver (kept for backward compatibility)
@@ -14,8 +21,18 @@ import (
 
 // DBStore implements the StoreInterface with a SQL database
 type DBStore struct {
-	db     *sql.DB
-	config *config.DatabaseConfig
+	db      *sql.DB
+	q       querier // db, or tx inside WithTx
+	tx      *sql.Tx
+	dialect Dialect
+	ctx     context.Context // set by WithContext; queries are traced as its children
+}
+
+// querier is the subset of *sql.DB and *sql.Tx used by the store methods.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 }
 
 // Ensure DBStore implements StoreInterface
@@ -23,18 +40,21 @@ var _ StoreInterface = (*DBStore)(nil)
 
 // NewDBStore creates a new database store
 func NewDBStore(cfg *config.DatabaseConfig) (*DBStore, error) {
-	var db *sql.DB
-	var err error
+	dialect, ok := DialectFor(cfg.Type)
+	if !ok {
+		return nil, fmt.Errorf("unsupported database type %q", cfg.Type)
+	}
 
-	// Choose database type based on configuration
+	// Choose the connection string based on configuration
+	dsn := cfg.ConnectionString()
 	if cfg.IsSQLite() {
-		log.Println("Using SQLite database")
-		db, err = sql.Open("sqlite3", cfg.SQLiteConnectionString())
+		slog.Info("using SQLite database", "path", cfg.SQLitePath)
+		dsn = cfg.SQLiteConnectionString()
 	} else {
-		log.Println("Using PostgreSQL database")
-		db, err = sql.Open("postgres", cfg.ConnectionString())
+		slog.Info("using PostgreSQL database", "host", cfg.Host, "port", cfg.Port, "database", cfg.DBName)
 	}
 
+	db, err := sql.Open(dialect.DriverName(), dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -46,108 +66,120 @@ func NewDBStore(cfg *config.DatabaseConfig) (*DBStore, error) {
 
 	// Verify connection is working
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	log.Println("Database connection established successfully")
-	return &DBStore{db: db, config: cfg}, nil
+	slog.Info("database connection established")
+	return NewDBStoreFromDB(db, dialect), nil
+}
+
+// NewDBStoreFromDB wraps an already opened database using the given dialect.
+func NewDBStoreFromDB(db *sql.DB, dialect Dialect) *DBStore {
+	return &DBStore{db: db, q: db, dialect: dialect, ctx: context.Background()}
+}
+
+// WithContext returns a view of the store whose queries run with ctx. Only
+// its values are used: a caller that goes away does not cut a query short.
+func (s *DBStore) WithContext(ctx context.Context) StoreInterface {
+	view := *s
+	view.ctx = context.WithoutCancel(ctx)
+	return &view
+}
+
+// Stats returns the connection pool statistics of the underlying database.
+func (s *DBStore) Stats() sql.DBStats {
+	return s.db.Stats()
+}
+
+// Dialect returns the SQL dialect used by this store.
+func (s *DBStore) Dialect() Dialect {
+	return s.dialect
 }
 
 // Close closes the database connection
 func (s *DBStore) Close() error {
+	if s.tx != nil {
+		return errors.New("cannot close the store inside a transaction")
+	}
 	return s.db.Close()
 }
 
-// Migrate creates the necessary database tables if they don't already exist
+// Ping checks that a connection to the database can be made.
+func (s *DBStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// PendingMigrations returns how many known migrations have not been applied.
+func (s *DBStore) PendingMigrations(ctx context.Context) (int, error) {
+	migrator, err := s.Migrator()
+	if err != nil {
+		return 0, err
+	}
+	pending, err := migrator.Pending(ctx)
+	return len(pending), err
+}
+
+// WithTx runs fn inside a database transaction.
+func (s *DBStore) WithTx(fn func(tx StoreInterface) error) (err error) {
+	if s.tx != nil {
+		// Already in a transaction; join it
+		return fn(s)
+	}
+
+	// The transaction's queries are traced as children of one span
+	ctx, span := tracing.Start(s.ctx, "db.transaction",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", s.dialect.Name())))
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return s.translateError(err)
+	}
+	txStore := &DBStore{db: s.db, q: tx, tx: tx, dialect: s.dialect, ctx: ctx}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			span.SetStatus(codes.Error, "panic")
+			panic(p)
+		}
+		if err != nil {
+			tx.Rollback()
+			tracing.RecordError(span, err)
+			return
+		}
+		err = s.translateError(tx.Commit())
+		tracing.RecordError(span, err)
+	}()
+
+	return fn(txStore)
+}
+
+// Migrator returns a Migrator for this store's database and dialect.
+func (s *DBStore) Migrator() (*Migrator, error) {
+	return NewMigrator(s.db, s.dialect)
+}
+
+// Migrate applies any pending versioned schema migrations.
 func (s *DBStore) Migrate() error {
-	log.Println("Starting database migration")
+	if s.tx != nil {
+		return errors.New("cannot migrate inside a transaction")
+	}
 
-	// Choose the appropriate schema based on database type
-	var schema string
-	if s.config.IsSQLite() {
-		schema = sqliteMigrationSchema
-	} else {
-		schema = postgresMigrationSchema
+	migrator, err := s.Migrator()
+	if err != nil {
+		return err
 	}
 
-	_, err := s.db.Exec(schema)
+	applied, err := migrator.Up()
 	if err != nil {
-		log.Printf("Database migration failed: %v", err)
+		slog.Error("database migration failed", "error", err)
 		return err
 	}
 
-	log.Println("Database migration completed successfully")
+	slog.Info("database migrated", "applied", applied)
 	return nil
 }
-
-// SQLite migration schema
-const sqliteMigrationSchema = `
-CREATE TABLE IF NOT EXISTS users (
-    id TEXT PRIMARY KEY,
-    username TEXT NOT NULL UNIQUE,
-    password TEXT NOT NULL
-);
-
-CREATE TABLE IF NOT EXISTS chat_rooms (
-    id TEXT PRIMARY KEY,
-    name TEXT NOT NULL UNIQUE,
-    owner_id TEXT NOT NULL,
-    room_type TEXT NOT NULL DEFAULT 'public', -- can be 'public' or 'private'
-    FOREIGN KEY (owner_id) REFERENCES users(id)
-);
-
-CREATE TABLE IF NOT EXISTS messages (
-    id TEXT PRIMARY KEY,
-    room_id TEXT NOT NULL,
-    sender_id TEXT NOT NULL,
-    content TEXT NOT NULL,
-    timestamp DATETIME NOT NULL,
-    FOREIGN KEY (room_id) REFERENCES chat_rooms(id),
-    FOREIGN KEY (sender_id) REFERENCES users(id)
-);
-
-CREATE TABLE IF NOT EXISTS room_members (
-    room_id TEXT NOT NULL,
-    user_id TEXT NOT NULL,
-    status TEXT NOT NULL DEFAULT 'pending', -- can be 'member' or 'pending'
-    PRIMARY KEY (room_id, user_id),
-    FOREIGN KEY (room_id) REFERENCES chat_rooms(id) ON DELETE CASCADE,
-    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-);
-`
-
-// PostgreSQL migration schema
-const postgresMigrationSchema = `
-CREATE TABLE IF NOT EXISTS users (
-    id TEXT PRIMARY KEY,
-    username TEXT NOT NULL UNIQUE,
-    password TEXT NOT NULL
-);
-
-CREATE TABLE IF NOT EXISTS chat_rooms (
-    id TEXT PRIMARY KEY,
-    name TEXT NOT NULL UNIQUE,
-    owner_id TEXT NOT NULL,
-    room_type TEXT NOT NULL DEFAULT 'public', -- can be 'public' or 'private'
-    FOREIGN KEY (owner_id) REFERENCES users(id)
-);
-
-CREATE TABLE IF NOT EXISTS messages (
-    id TEXT PRIMARY KEY,
-    room_id TEXT NOT NULL,
-    sender_id TEXT NOT NULL,
-    content TEXT NOT NULL,
-    timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
-    FOREIGN KEY (room_id) REFERENCES chat_rooms(id),
-    FOREIGN KEY (sender_id) REFERENCES users(id)
-);
-
-CREATE TABLE IF NOT EXISTS room_members (
-    room_id TEXT NOT NULL,
-    user_id TEXT NOT NULL,
-    status TEXT NOT NULL DEFAULT 'pending', -- can be 'member' or 'pending'
-    PRIMARY KEY (room_id, user_id),
-    FOREIGN KEY (room_id) REFERENCES chat_rooms(id) ON DELETE CASCADE,
-    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-);
-`
@@ -2,142 +2,700 @@ package store
 
 import (
 	"backend/internal/models"
+	"backend/internal/tracing"
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// Every query is written once with ? placeholders and rebound for the active dialect.
+
+// exec runs a statement that returns no rows.
+func (s *DBStore) exec(query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := s.startQuery(query)
+	defer span.End()
+	result, err := s.q.ExecContext(ctx, s.dialect.Rebind(query), args...)
+	tracing.RecordError(span, err)
+	return result, err
+}
+
+// query runs a statement that returns rows.
+func (s *DBStore) query(query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := s.startQuery(query)
+	defer span.End()
+	rows, err := s.q.QueryContext(ctx, s.dialect.Rebind(query), args...)
+	tracing.RecordError(span, err)
+	return rows, err
+}
+
+// queryRow runs a statement that returns at most one row.
+func (s *DBStore) queryRow(query string, args ...interface{}) *sql.Row {
+	ctx, span := s.startQuery(query)
+	defer span.End()
+	return s.q.QueryRowContext(ctx, s.dialect.Rebind(query), args...)
+}
+
+// startQuery starts the span of one statement, named after its first keyword
+// (SELECT, INSERT, ...). The statement is recorded without its arguments, so
+// no user data reaches the trace.
+func (s *DBStore) startQuery(query string) (context.Context, trace.Span) {
+	query = strings.TrimSpace(query)
+	operation, _, _ := strings.Cut(query, " ")
+	operation = strings.ToUpper(operation)
+	return tracing.Start(s.ctx, "db."+strings.ToLower(operation),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", s.dialect.Name()),
+			attribute.String("db.operation.name", operation),
+			attribute.String("db.query.text", query),
+		))
+}
+
+// translateError converts a driver error into one of the store's typed errors.
+// Errors the dialect does not recognise are returned unchanged.
+func (s *DBStore) translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	kind, field := s.dialect.ClassifyError(err)
+	switch kind {
+	case ErrorKindUniqueViolation:
+		return &ConflictError{Field: field}
+	case ErrorKindForeignKeyViolation:
+		return fmt.Errorf("referenced record does not exist: %w", ErrNotFound)
+	case ErrorKindUnavailable:
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return err
+}
+
 // CreateUser creates a new user in the database.
 func (s *DBStore) CreateUser(user *models.User) error {
-	query := `INSERT INTO users (id, username, password) VALUES (?, ?, ?)`
-	if !s.config.IsSQLite() {
-		query = `INSERT INTO users (id, username, password) VALUES ($1, $2, $3)`
+	_, err := s.exec(`INSERT INTO users (id, username, password, is_admin, disabled) VALUES (?, ?, ?, ?, ?)`,
+		user.ID, user.Username, user.Password, user.IsAdmin, user.Disabled)
+	return s.translateError(err)
+}
+
+// userColumns are the columns scanned by scanUser, in order.
+const userColumns = `id, username, password, is_admin, disabled`
+
+// scanUser scans a row selected with userColumns.
+func scanUser(row interface{ Scan(...interface{}) error }) (*models.User, error) {
+	var user models.User
+	if err := row.Scan(&user.ID, &user.Username, &user.Password, &user.IsAdmin, &user.Disabled); err != nil {
+		return nil, err
 	}
-	_, err := s.db.Exec(query, user.ID, user.Username, user.Password)
-	return err
+	return &user, nil
+}
+
+// GetUserByID retrieves a user by their ID.
+func (s *DBStore) GetUserByID(id string) (*models.User, error) {
+	user, err := scanUser(s.queryRow(`SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("user " + id)
+		}
+		return nil, s.translateError(err)
+	}
+	return user, nil
 }
 
 // GetUserByUsername retrieves a user by their username.
 func (s *DBStore) GetUserByUsername(username string) (*models.User, error) {
-	query := `SELECT id, username, password FROM users WHERE username = ?`
-	if !s.config.IsSQLite() {
-		query = `SELECT id, username, password FROM users WHERE username = $1`
+	user, err := scanUser(s.queryRow(`SELECT `+userColumns+` FROM users WHERE username = ?`, username))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("user " + username)
+		}
+		return nil, s.translateError(err)
 	}
+	return user, nil
+}
 
-	var user models.User
-	err := s.db.QueryRow(query, username).Scan(&user.ID, &user.Username, &user.Password)
+// ListUsers retrieves every user, ordered by username.
+func (s *DBStore) ListUsers() ([]*models.User, error) {
+	rows, err := s.query(`SELECT ` + userColumns + ` FROM users ORDER BY username ASC`)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, errors.New("user not found")
+		return nil, s.translateError(err)
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
 		}
-		return nil, err
+		users = append(users, user)
 	}
-	return &user, nil
+
+	return users, s.translateError(rows.Err())
+}
+
+// UpdateUser changes the password, admin flag and disabled flag of an existing user.
+func (s *DBStore) UpdateUser(user *models.User) error {
+	result, err := s.exec(`UPDATE users SET password = ?, is_admin = ?, disabled = ? WHERE id = ?`,
+		user.Password, user.IsAdmin, user.Disabled, user.ID)
+	return s.expectOneRow(result, err, "user "+user.ID)
+}
+
+// DeleteUser deletes a user. Their memberships, bans, held messages, filed reports, blocks and mentions go with them, but
+// the user's messages and rooms must be deleted first.
+func (s *DBStore) DeleteUser(id string) error {
+	result, err := s.exec(`DELETE FROM users WHERE id = ?`, id)
+	if err != nil {
+		return s.deleteError(err)
+	}
+	return s.expectOneRow(result, nil, "user "+id)
 }
 
 // CreateRoom creates a new chat room in the database.
 func (s *DBStore) CreateRoom(room *models.ChatRoom) error {
-	query := `INSERT INTO chat_rooms (id, name, owner_id, room_type) VALUES (?, ?, ?, ?)`
-	if !s.config.IsSQLite() {
-		query = `INSERT INTO chat_rooms (id, name, owner_id, room_type) VALUES ($1, $2, $3, $4)`
+	_, err := s.exec(`INSERT INTO chat_rooms (id, name, owner_id, room_type, archived) VALUES (?, ?, ?, ?, ?)`,
+		room.ID, room.Name, room.OwnerID, room.RoomType, room.Archived)
+	return s.translateError(err)
+}
+
+// roomColumns are the columns scanned by scanRoom, in order.
+const roomColumns = `id, name, owner_id, room_type, archived`
+
+// scanRoom scans a row selected with roomColumns.
+func scanRoom(row interface{ Scan(...interface{}) error }) (*models.ChatRoom, error) {
+	var room models.ChatRoom
+	if err := row.Scan(&room.ID, &room.Name, &room.OwnerID, &room.RoomType, &room.Archived); err != nil {
+		return nil, err
 	}
+	return &room, nil
+}
 
-	_, err := s.db.Exec(query, room.ID, room.Name, room.OwnerID, room.RoomType)
-	return err
+// GetRoomByID retrieves a chat room by its ID.
+func (s *DBStore) GetRoomByID(roomID string) (*models.ChatRoom, error) {
+	room, err := scanRoom(s.queryRow(`SELECT `+roomColumns+` FROM chat_rooms WHERE id = ?`, roomID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("room " + roomID)
+		}
+		return nil, s.translateError(err)
+	}
+	return room, nil
 }
 
-// AddRoomMember adds a user to a room with a specific status.
+// ListRooms retrieves every room, including private and archived ones, ordered by name.
+func (s *DBStore) ListRooms() ([]*models.ChatRoom, error) {
+	return s.queryRooms(`SELECT ` + roomColumns + ` FROM chat_rooms ORDER BY name ASC`)
+}
+
+// UpdateRoom changes the name, type and archived flag of an existing room.
+func (s *DBStore) UpdateRoom(room *models.ChatRoom) error {
+	result, err := s.exec(`UPDATE chat_rooms SET name = ?, room_type = ?, archived = ? WHERE id = ?`,
+		room.Name, room.RoomType, room.Archived, room.ID)
+	return s.expectOneRow(result, err, "room "+room.ID)
+}
+
+// DeleteRoom deletes a room. Its memberships, bans, held messages, reports and moderation log go with it,
+// but the room's messages must be deleted first.
+func (s *DBStore) DeleteRoom(roomID string) error {
+	result, err := s.exec(`DELETE FROM chat_rooms WHERE id = ?`, roomID)
+	if err != nil {
+		return s.deleteError(err)
+	}
+	return s.expectOneRow(result, nil, "room "+roomID)
+}
+
+// deleteError translates an error from a DELETE. A foreign key violation there
+// means the row is still referenced, so it is reported as ErrInUse.
+func (s *DBStore) deleteError(err error) error {
+	if kind, _ := s.dialect.ClassifyError(err); kind == ErrorKindForeignKeyViolation {
+		return fmt.Errorf("%w: %w", ErrInUse, err)
+	}
+	return s.translateError(err)
+}
+
+// AddRoomMember adds a user to a room with a specific status and role.
 func (s *DBStore) AddRoomMember(member *models.RoomMember) error {
-	query := `INSERT INTO room_members (room_id, user_id, status) VALUES (?, ?, ?)`
-	if !s.config.IsSQLite() {
-		query = `INSERT INTO room_members (room_id, user_id, status) VALUES ($1, $2, $3)`
+	_, err := s.exec(`INSERT INTO room_members (room_id, user_id, status, role, muted_until) VALUES (?, ?, ?, ?, ?)`,
+		member.RoomID, member.UserID, member.Status, member.Role, s.nullableTime(member.MutedUntil))
+	return s.translateError(err)
+}
+
+// GetRoomMember retrieves a user's membership in a room.
+func (s *DBStore) GetRoomMember(roomID, userID string) (*models.RoomMember, error) {
+	var member models.RoomMember
+	var mutedUntil sql.NullTime
+	err := s.queryRow(`SELECT room_id, user_id, status, role, muted_until FROM room_members WHERE room_id = ? AND user_id = ?`, roomID, userID).
+		Scan(&member.RoomID, &member.UserID, &member.Status, &member.Role, &mutedUntil)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("membership of " + userID + " in room " + roomID)
+		}
+		return nil, s.translateError(err)
 	}
+	member.MutedUntil = timePointer(mutedUntil)
+	return &member, nil
+}
 
-	_, err := s.db.Exec(query, member.RoomID, member.UserID, member.Status)
-	return err
+// GetRoomMembers retrieves every membership in a room, ordered by user ID.
+func (s *DBStore) GetRoomMembers(roomID string) ([]*models.RoomMember, error) {
+	rows, err := s.query(`SELECT room_id, user_id, status, role, muted_until FROM room_members WHERE room_id = ? ORDER BY user_id`, roomID)
+	if err != nil {
+		return nil, s.translateError(err)
+	}
+	defer rows.Close()
+
+	var members []*models.RoomMember
+	for rows.Next() {
+		var member models.RoomMember
+		var mutedUntil sql.NullTime
+		if err := rows.Scan(&member.RoomID, &member.UserID, &member.Status, &member.Role, &mutedUntil); err != nil {
+			return nil, s.translateError(err)
+		}
+		member.MutedUntil = timePointer(mutedUntil)
+		members = append(members, &member)
+	}
+	return members, s.translateError(rows.Err())
+}
+
+// UpdateRoomMember changes the status, role and mute of an existing membership.
+func (s *DBStore) UpdateRoomMember(member *models.RoomMember) error {
+	result, err := s.exec(`UPDATE room_members SET status = ?, role = ?, muted_until = ? WHERE room_id = ? AND user_id = ?`,
+		member.Status, member.Role, s.nullableTime(member.MutedUntil), member.RoomID, member.UserID)
+	return s.expectOneRow(result, err, "membership of "+member.UserID+" in room "+member.RoomID)
+}
+
+// RemoveRoomMember deletes a user's membership in a room.
+func (s *DBStore) RemoveRoomMember(roomID, userID string) error {
+	result, err := s.exec(`DELETE FROM room_members WHERE room_id = ? AND user_id = ?`, roomID, userID)
+	return s.expectOneRow(result, err, "membership of "+userID+" in room "+roomID)
+}
+
+// expectOneRow translates err and returns ErrNotFound if the statement changed no rows.
+func (s *DBStore) expectOneRow(result sql.Result, err error, what string) error {
+	if err != nil {
+		return s.translateError(err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return s.translateError(err)
+	}
+	if affected == 0 {
+		return notFound(what)
+	}
+	return nil
+}
+
+// CreateBan bans a user from a room. A user can be banned from a room once.
+func (s *DBStore) CreateBan(ban *models.RoomBan) error {
+	_, err := s.exec(`INSERT INTO room_bans (room_id, user_id, banned_by, reason, created_at) VALUES (?, ?, ?, ?, ?)`,
+		ban.RoomID, ban.UserID, ban.BannedBy, ban.Reason, s.dialect.TimeValue(ban.CreatedAt))
+	return s.translateError(err)
+}
+
+// GetBan retrieves a user's ban from a room.
+func (s *DBStore) GetBan(roomID, userID string) (*models.RoomBan, error) {
+	var ban models.RoomBan
+	err := s.queryRow(`SELECT room_id, user_id, banned_by, reason, created_at FROM room_bans WHERE room_id = ? AND user_id = ?`, roomID, userID).
+		Scan(&ban.RoomID, &ban.UserID, &ban.BannedBy, &ban.Reason, &ban.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("ban of " + userID + " from room " + roomID)
+		}
+		return nil, s.translateError(err)
+	}
+	return &ban, nil
+}
+
+// DeleteBan lifts a user's ban from a room.
+func (s *DBStore) DeleteBan(roomID, userID string) error {
+	result, err := s.exec(`DELETE FROM room_bans WHERE room_id = ? AND user_id = ?`, roomID, userID)
+	return s.expectOneRow(result, err, "ban of "+userID+" from room "+roomID)
+}
+
+// SaveModerationAction appends an entry to a room's moderation log.
+func (s *DBStore) SaveModerationAction(action *models.ModerationAction) error {
+	_, err := s.exec(`INSERT INTO room_moderation_log (id, room_id, actor_id, target_id, action, reason, expires_at, report_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		action.ID, action.RoomID, action.ActorID, action.TargetID, action.Action, action.Reason,
+		s.nullableTime(action.ExpiresAt), action.ReportID, s.dialect.TimeValue(action.CreatedAt))
+	return s.translateError(err)
+}
+
+// GetModerationLog retrieves a room's moderation log, newest first.
+func (s *DBStore) GetModerationLog(roomID string) ([]*models.ModerationAction, error) {
+	rows, err := s.query(`SELECT id, room_id, actor_id, target_id, action, reason, expires_at, report_id, created_at FROM room_moderation_log WHERE room_id = ? ORDER BY created_at DESC, id ASC`, roomID)
+	if err != nil {
+		return nil, s.translateError(err)
+	}
+	defer rows.Close()
+
+	var actions []*models.ModerationAction
+	for rows.Next() {
+		var action models.ModerationAction
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&action.ID, &action.RoomID, &action.ActorID, &action.TargetID, &action.Action, &action.Reason, &expiresAt, &action.ReportID, &action.CreatedAt); err != nil {
+			return nil, err
+		}
+		action.ExpiresAt = timePointer(expiresAt)
+		actions = append(actions, &action)
+	}
+
+	return actions, s.translateError(rows.Err())
+}
+
+// heldMessageColumns are the columns scanned by scanHeldMessage, in order.
+const heldMessageColumns = `id, room_id, sender_id, content, reason, created_at`
+
+// scanHeldMessage scans a row selected with heldMessageColumns.
+func scanHeldMessage(row interface{ Scan(...interface{}) error }) (*models.HeldMessage, error) {
+	var held models.HeldMessage
+	if err := row.Scan(&held.ID, &held.RoomID, &held.SenderID, &held.Content, &held.Reason, &held.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &held, nil
+}
+
+// SaveHeldMessage adds a message to its room's review queue.
+func (s *DBStore) SaveHeldMessage(held *models.HeldMessage) error {
+	_, err := s.exec(`INSERT INTO held_messages (`+heldMessageColumns+`) VALUES (?, ?, ?, ?, ?, ?)`,
+		held.ID, held.RoomID, held.SenderID, held.Content, held.Reason, s.dialect.TimeValue(held.CreatedAt))
+	return s.translateError(err)
+}
+
+// GetHeldMessage retrieves a held message by its ID.
+func (s *DBStore) GetHeldMessage(id string) (*models.HeldMessage, error) {
+	held, err := scanHeldMessage(s.queryRow(`SELECT `+heldMessageColumns+` FROM held_messages WHERE id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("held message " + id)
+		}
+		return nil, s.translateError(err)
+	}
+	return held, nil
+}
+
+// GetHeldMessagesByRoom retrieves a room's review queue, oldest first.
+func (s *DBStore) GetHeldMessagesByRoom(roomID string) ([]*models.HeldMessage, error) {
+	rows, err := s.query(`SELECT `+heldMessageColumns+` FROM held_messages WHERE room_id = ? ORDER BY created_at ASC, id ASC`, roomID)
+	if err != nil {
+		return nil, s.translateError(err)
+	}
+	defer rows.Close()
+
+	var held []*models.HeldMessage
+	for rows.Next() {
+		h, err := scanHeldMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		held = append(held, h)
+	}
+
+	return held, s.translateError(rows.Err())
+}
+
+// DeleteHeldMessage removes a message from the review queue.
+func (s *DBStore) DeleteHeldMessage(id string) error {
+	result, err := s.exec(`DELETE FROM held_messages WHERE id = ?`, id)
+	return s.expectOneRow(result, err, "held message "+id)
+}
+
+// reportColumns are the columns scanned by scanReport, in order.
+const reportColumns = `id, message_id, room_id, reporter_id, sender_id, category, details, content, sent_at, status, resolution, resolved_by, resolved_at, created_at`
+
+// scanReport scans a row selected with reportColumns.
+func scanReport(row interface{ Scan(...interface{}) error }) (*models.MessageReport, error) {
+	var report models.MessageReport
+	var resolvedAt sql.NullTime
+	if err := row.Scan(&report.ID, &report.MessageID, &report.RoomID, &report.ReporterID, &report.SenderID,
+		&report.Category, &report.Details, &report.Content, &report.SentAt,
+		&report.Status, &report.Resolution, &report.ResolvedBy, &resolvedAt, &report.CreatedAt); err != nil {
+		return nil, err
+	}
+	report.ResolvedAt = timePointer(resolvedAt)
+	return &report, nil
+}
+
+// CreateReport stores a new report. A user can report a message once.
+func (s *DBStore) CreateReport(report *models.MessageReport) error {
+	_, err := s.exec(`INSERT INTO message_reports (`+reportColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		report.ID, report.MessageID, report.RoomID, report.ReporterID, report.SenderID,
+		report.Category, report.Details, report.Content, s.dialect.TimeValue(report.SentAt),
+		report.Status, report.Resolution, report.ResolvedBy, s.nullableTime(report.ResolvedAt), s.dialect.TimeValue(report.CreatedAt))
+	return s.translateError(err)
+}
+
+// GetReport retrieves a report by its ID.
+func (s *DBStore) GetReport(id string) (*models.MessageReport, error) {
+	report, err := scanReport(s.queryRow(`SELECT `+reportColumns+` FROM message_reports WHERE id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("report " + id)
+		}
+		return nil, s.translateError(err)
+	}
+	return report, nil
+}
+
+// ListReports retrieves reports oldest first. An empty roomID or status matches every room or status.
+func (s *DBStore) ListReports(roomID, status string) ([]*models.MessageReport, error) {
+	rows, err := s.query(`SELECT `+reportColumns+` FROM message_reports
+		WHERE (? = '' OR room_id = ?) AND (? = '' OR status = ?)
+		ORDER BY created_at ASC, id ASC`, roomID, roomID, status, status)
+	if err != nil {
+		return nil, s.translateError(err)
+	}
+	defer rows.Close()
+
+	var reports []*models.MessageReport
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, s.translateError(rows.Err())
+}
+
+// UpdateReport changes the status and resolution of an existing report.
+func (s *DBStore) UpdateReport(report *models.MessageReport) error {
+	result, err := s.exec(`UPDATE message_reports SET status = ?, resolution = ?, resolved_by = ?, resolved_at = ? WHERE id = ?`,
+		report.Status, report.Resolution, report.ResolvedBy, s.nullableTime(report.ResolvedAt), report.ID)
+	return s.expectOneRow(result, err, "report "+report.ID)
+}
+
+// CreateBlock records that a user has blocked another. A user can block
+// another user once.
+func (s *DBStore) CreateBlock(block *models.UserBlock) error {
+	_, err := s.exec(`INSERT INTO user_blocks (blocker_id, blocked_id, created_at) VALUES (?, ?, ?)`,
+		block.BlockerID, block.BlockedID, s.dialect.TimeValue(block.CreatedAt))
+	return s.translateError(err)
+}
+
+// GetBlock retrieves a user's block of another user.
+func (s *DBStore) GetBlock(blockerID, blockedID string) (*models.UserBlock, error) {
+	var block models.UserBlock
+	err := s.queryRow(`SELECT blocker_id, blocked_id, created_at FROM user_blocks WHERE blocker_id = ? AND blocked_id = ?`, blockerID, blockedID).
+		Scan(&block.BlockerID, &block.BlockedID, &block.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("block of " + blockedID + " by " + blockerID)
+		}
+		return nil, s.translateError(err)
+	}
+	return &block, nil
+}
+
+// GetBlocksByUser retrieves the users a user has blocked, oldest first.
+func (s *DBStore) GetBlocksByUser(blockerID string) ([]*models.UserBlock, error) {
+	rows, err := s.query(`SELECT blocker_id, blocked_id, created_at FROM user_blocks WHERE blocker_id = ? ORDER BY created_at ASC, blocked_id ASC`, blockerID)
+	if err != nil {
+		return nil, s.translateError(err)
+	}
+	defer rows.Close()
+
+	var blocks []*models.UserBlock
+	for rows.Next() {
+		var block models.UserBlock
+		if err := rows.Scan(&block.BlockerID, &block.BlockedID, &block.CreatedAt); err != nil {
+			return nil, s.translateError(err)
+		}
+		blocks = append(blocks, &block)
+	}
+
+	return blocks, s.translateError(rows.Err())
+}
+
+// DeleteBlock lifts a user's block of another user.
+func (s *DBStore) DeleteBlock(blockerID, blockedID string) error {
+	result, err := s.exec(`DELETE FROM user_blocks WHERE blocker_id = ? AND blocked_id = ?`, blockerID, blockedID)
+	return s.expectOneRow(result, err, "block of "+blockedID+" by "+blockerID)
+}
+
+// nullableTime converts an optional time into the value bound for a nullable timestamp column.
+func (s *DBStore) nullableTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return s.dialect.TimeValue(*t)
+}
+
+// timePointer converts a scanned nullable timestamp into an optional time.
+func timePointer(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
 }
 
 // GetRoomsByUserID fetches all public rooms and private rooms the user is a member of.
+// Archived rooms are left out.
 func (s *DBStore) GetRoomsByUserID(userID string) ([]*models.ChatRoom, error) {
-	query := `
-		SELECT DISTINCT cr.id, cr.name, cr.owner_id, cr.room_type
+	return s.queryRooms(`
+		SELECT DISTINCT cr.id, cr.name, cr.owner_id, cr.room_type, cr.archived
 		FROM chat_rooms cr
 		LEFT JOIN room_members rm ON cr.id = rm.room_id
-		WHERE cr.room_type = 'public' OR (rm.user_id = ? AND rm.status = 'member')
-	`
-	if !s.config.IsSQLite() {
-		query = `
-			SELECT DISTINCT cr.id, cr.name, cr.owner_id, cr.room_type
-			FROM chat_rooms cr
-			LEFT JOIN room_members rm ON cr.id = rm.room_id
-			WHERE cr.room_type = 'public' OR (rm.user_id = $1 AND rm.status = 'member')
-		`
-	}
+		WHERE NOT cr.archived AND (cr.room_type = 'public' OR (rm.user_id = ? AND rm.status = 'member'))
+		ORDER BY cr.name ASC
+	`, userID)
+}
 
-	rows, err := s.db.Query(query, userID)
+// queryRooms runs a query selecting room columns and scans the results.
+func (s *DBStore) queryRooms(query string, args ...interface{}) ([]*models.ChatRoom, error) {
+	rows, err := s.query(query, args...)
 	if err != nil {
-		return nil, err
+		return nil, s.translateError(err)
 	}
 	defer rows.Close()
 
 	var rooms []*models.ChatRoom
 	for rows.Next() {
-		var room models.ChatRoom
-		if err := rows.Scan(&room.ID, &room.Name, &room.OwnerID, &room.RoomType); err != nil {
+		room, err := scanRoom(rows)
+		if err != nil {
 			return nil, err
 		}
-		rooms = append(rooms, &room)
+		rooms = append(rooms, room)
 	}
 
-	return rooms, rows.Err()
+	return rooms, s.translateError(rows.Err())
 }
 
 // SaveMessage saves a new message to the database.
 func (s *DBStore) SaveMessage(message *models.Message) error {
-	query := `INSERT INTO messages (id, room_id, sender_id, content, timestamp) VALUES (?, ?, ?, ?, ?)`
-	if !s.config.IsSQLite() {
-		query = `INSERT INTO messages (id, room_id, sender_id, content, timestamp) VALUES ($1, $2, $3, $4, $5)`
+	_, err := s.exec(`INSERT INTO messages (id, room_id, sender_id, content, timestamp) VALUES (?, ?, ?, ?, ?)`,
+		message.ID, message.RoomID, message.SenderID, message.Content, s.dialect.TimeValue(message.Timestamp))
+	return s.translateError(err)
+}
+
+// GetMessageByID retrieves a message by its ID.
+func (s *DBStore) GetMessageByID(id string) (*models.Message, error) {
+	var msg models.Message
+	err := s.queryRow(`SELECT id, room_id, sender_id, content, timestamp FROM messages WHERE id = ?`, id).
+		Scan(&msg.ID, &msg.RoomID, &msg.SenderID, &msg.Content, &msg.Timestamp)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("message " + id)
+		}
+		return nil, s.translateError(err)
 	}
+	return &msg, nil
+}
 
-	_, err := s.db.Exec(query, message.ID, message.RoomID, message.SenderID, message.Content, message.Timestamp)
-	return err
+// DeleteMessage deletes a message with its mentions.
+func (s *DBStore) DeleteMessage(id string) error {
+	result, err := s.exec(`DELETE FROM messages WHERE id = ?`, id)
+	return s.expectOneRow(result, err, "message "+id)
 }
 
 // GetMessagesByRoom retrieves all messages for a specific room.
 func (s *DBStore) GetMessagesByRoom(roomID string) ([]*models.Message, error) {
-	query := `SELECT id, room_id, sender_id, content, timestamp FROM messages WHERE room_id = ? ORDER BY timestamp ASC`
-	if !s.config.IsSQLite() {
-		query = `SELECT id, room_id, sender_id, content, timestamp FROM messages WHERE room_id = $1 ORDER BY timestamp ASC`
+	return s.queryMessages(`SELECT id, room_id, sender_id, content, timestamp FROM messages WHERE room_id = ? ORDER BY timestamp ASC`,
+		roomID)
+}
+
+// CountMessages returns the number of messages in a room.
+func (s *DBStore) CountMessages(roomID string) (int, error) {
+	var count int
+	if err := s.queryRow(`SELECT COUNT(*) FROM messages WHERE room_id = ?`, roomID).Scan(&count); err != nil {
+		return 0, s.translateError(err)
 	}
+	return count, nil
+}
+
+// GetMessagesSince retrieves messages for a specific room since a given time.
+func (s *DBStore) GetMessagesSince(roomID string, since time.Time) ([]*models.Message, error) {
+	return s.queryMessages(`SELECT id, room_id, sender_id, content, timestamp FROM messages WHERE room_id = ? AND timestamp > ? ORDER BY timestamp ASC`,
+		roomID, s.dialect.TimeValue(since))
+}
 
-	rows, err := s.db.Query(query, roomID)
+// GetRoomHistory retrieves the messages in a room after the cursor, oldest
+// first, leaving out messages from users that viewerID has blocked. If limit
+// is positive, at most limit messages are returned: the first ones after
+// the cursor if it is set, so that clients can page forward, and otherwise
+// the most recent ones.
+func (s *DBStore) GetRoomHistory(roomID, viewerID string, after models.MessageCursor, limit int) ([]*models.Message, error) {
+	query := `SELECT id, room_id, sender_id, content, timestamp FROM messages m WHERE room_id = ?
+		AND NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = ? AND b.blocked_id = m.sender_id)`
+	args := []interface{}{roomID, viewerID}
+	if after.ID == "" {
+		query += ` AND timestamp > ?`
+		args = append(args, s.dialect.TimeValue(after.Timestamp))
+	} else {
+		query += ` AND (timestamp > ? OR (timestamp = ? AND id > ?))`
+		args = append(args, s.dialect.TimeValue(after.Timestamp), s.dialect.TimeValue(after.Timestamp), after.ID)
+	}
+	if limit <= 0 || !after.IsZero() {
+		query += ` ORDER BY timestamp ASC, id ASC`
+		if limit > 0 {
+			query += ` LIMIT ?`
+			args = append(args, limit)
+		}
+		return s.queryMessages(query, args...)
+	}
+
+	// The most recent messages are read newest first, then put back in order
+	messages, err := s.queryMessages(query+` ORDER BY timestamp DESC, id DESC LIMIT ?`, append(args, limit)...)
 	if err != nil {
 		return nil, err
 	}
+	slices.Reverse(messages)
+	return messages, nil
+}
+
+// DeleteMessagesByRoom deletes every message in a room, with their mentions.
+func (s *DBStore) DeleteMessagesByRoom(roomID string) error {
+	_, err := s.exec(`DELETE FROM messages WHERE room_id = ?`, roomID)
+	return s.translateError(err)
+}
+
+// DeleteMessagesBySender deletes every message a user sent, with their mentions.
+func (s *DBStore) DeleteMessagesBySender(userID string) error {
+	_, err := s.exec(`DELETE FROM messages WHERE sender_id = ?`, userID)
+	return s.translateError(err)
+}
+
+// SaveMention records that a message mentioned a user.
+func (s *DBStore) SaveMention(mention *models.MessageMention) error {
+	_, err := s.exec(`INSERT INTO message_mentions (message_id, user_id) VALUES (?, ?)`,
+		mention.MessageID, mention.UserID)
+	return s.translateError(err)
+}
+
+// GetMentionsByMessage retrieves the users mentioned by a message.
+func (s *DBStore) GetMentionsByMessage(messageID string) ([]*models.MessageMention, error) {
+	rows, err := s.query(`SELECT message_id, user_id FROM message_mentions WHERE message_id = ? ORDER BY user_id ASC`, messageID)
+	if err != nil {
+		return nil, s.translateError(err)
+	}
 	defer rows.Close()
 
-	var messages []*models.Message
+	var mentions []*models.MessageMention
 	for rows.Next() {
-		var msg models.Message
-		if err := rows.Scan(&msg.ID, &msg.RoomID, &msg.SenderID, &msg.Content, &msg.Timestamp); err != nil {
+		var mention models.MessageMention
+		if err := rows.Scan(&mention.MessageID, &mention.UserID); err != nil {
 			return nil, err
 		}
-		messages = append(messages, &msg)
+		mentions = append(mentions, &mention)
 	}
 
-	return messages, rows.Err()
+	return mentions, s.translateError(rows.Err())
 }
 
-// GetMessagesSince retrieves messages for a specific room since a given time.
-func (s *DBStore) GetMessagesSince(roomID string, since time.Time) ([]*models.Message, error) {
-	query := `SELECT id, room_id, sender_id, content, timestamp FROM messages WHERE room_id = ? AND timestamp > ? ORDER BY timestamp ASC`
-	if !s.config.IsSQLite() {
-		query = `SELECT id, room_id, sender_id, content, timestamp FROM messages WHERE room_id = $1 AND timestamp > $2 ORDER BY timestamp ASC`
-	}
-
-	rows, err := s.db.Query(query, roomID, since)
+// queryMessages runs a query selecting message columns and scans the results.
+func (s *DBStore) queryMessages(query string, args ...interface{}) ([]*models.Message, error) {
+	rows, err := s.query(query, args...)
 	if err != nil {
-		return nil, err
+		return nil, s.translateError(err)
 	}
 	defer rows.Close()
 
@@ -150,5 +708,5 @@ func (s *DBStore) GetMessagesSince(roomID string, since time.Time) ([]*models.Me
 		messages = append(messages, &msg)
 	}
 
-	return messages, rows.Err()
+	return messages, s.translateError(rows.Err())
 }
@@ -0,0 +1,183 @@
+package store_test
+
+import (
+	"backend/internal/config"
+	"backend/internal/store"
+	"backend/internal/store/storetest"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestDBStoreSQLite(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.StoreInterface {
+		cfg := &config.DatabaseConfig{Type: "sqlite", SQLitePath: filepath.Join(t.TempDir(), "chatapp.db")}
+		s, err := store.NewDBStore(cfg)
+		if err != nil {
+			t.Fatalf("NewDBStore: %v", err)
+		}
+		if err := s.Migrate(); err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+		return s
+	})
+}
+
+// TestDBStorePostgres runs against the database described by the usual DB_*
+// variables when TEST_POSTGRES=1. Every test starts from an empty schema.
+func TestDBStorePostgres(t *testing.T) {
+	if os.Getenv("TEST_POSTGRES") != "1" {
+		t.Skip("set TEST_POSTGRES=1 and DB_* to run against PostgreSQL")
+	}
+
+	storetest.Run(t, func(t *testing.T) store.StoreInterface {
+		cfg, err := config.Load("")
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		cfg.Database.Type = "postgres"
+		s, err := store.NewDBStore(&cfg.Database)
+		if err != nil {
+			t.Fatalf("NewDBStore: %v", err)
+		}
+		migrator, err := s.Migrator()
+		if err != nil {
+			t.Fatalf("Migrator: %v", err)
+		}
+		if _, err := migrator.Down(1 << 20); err != nil {
+			t.Fatalf("Down: %v", err)
+		}
+		if _, err := migrator.Up(); err != nil {
+			t.Fatalf("Up: %v", err)
+		}
+		return s
+	})
+}
+
+func TestMigrationsRoundTrip(t *testing.T) {
+	cfg := &config.DatabaseConfig{Type: "sqlite", SQLitePath: filepath.Join(t.TempDir(), "chatapp.db")}
+	s, err := store.NewDBStore(cfg)
+	if err != nil {
+		t.Fatalf("NewDBStore: %v", err)
+	}
+	defer s.Close()
+
+	migrator, err := s.Migrator()
+	if err != nil {
+		t.Fatalf("Migrator: %v", err)
+	}
+
+	applied, err := migrator.Up()
+	if err != nil || applied == 0 {
+		t.Fatalf("Up = %d, %v; want >0 applied", applied, err)
+	}
+	if again, err := migrator.Up(); err != nil || again != 0 {
+		t.Fatalf("second Up = %d, %v; want 0 applied", again, err)
+	}
+
+	rolledBack, err := migrator.Down(applied)
+	if err != nil || rolledBack != applied {
+		t.Fatalf("Down = %d, %v; want %d", rolledBack, err, applied)
+	}
+	statuses, err := migrator.Status()
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	for _, st := range statuses {
+		if st.Applied {
+			t.Fatalf("migration %04d still applied after Down", st.Version)
+		}
+	}
+	if pending, err := s.PendingMigrations(context.Background()); err != nil || pending != len(statuses) {
+		t.Fatalf("PendingMigrations = %d, %v; want %d", pending, err, len(statuses))
+	}
+
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Up after Down: %v", err)
+	}
+}
+
+func TestMigrationStatusDoesNotLock(t *testing.T) {
+	cfg := &config.DatabaseConfig{Type: "sqlite", SQLitePath: filepath.Join(t.TempDir(), "chatapp.db")}
+	s, err := store.NewDBStore(cfg)
+	if err != nil {
+		t.Fatalf("NewDBStore: %v", err)
+	}
+	defer s.Close()
+	migrator, err := s.Migrator()
+	if err != nil {
+		t.Fatalf("Migrator: %v", err)
+	}
+
+	// Before the first migration nothing is applied, and nothing is created
+	statuses, err := migrator.Status()
+	if err != nil || len(statuses) == 0 || statuses[0].Applied {
+		t.Fatalf("Status of a new database = %+v, %v; want every migration pending", statuses, err)
+	}
+	if _, err := migrator.Pending(context.Background()); err == nil {
+		t.Fatal("Status created schema_migrations")
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	// Another connection holds the write lock, as a migration would
+	other, err := store.NewDBStore(cfg)
+	if err != nil {
+		t.Fatalf("NewDBStore: %v", err)
+	}
+	defer other.Close()
+	locked, release := make(chan struct{}), make(chan struct{})
+	go other.WithTx(func(tx store.StoreInterface) error {
+		close(locked)
+		<-release
+		return nil
+	})
+	<-locked
+	defer close(release)
+
+	start := time.Now()
+	statuses, err = migrator.Status()
+	if err != nil || !statuses[len(statuses)-1].Applied {
+		t.Fatalf("Status = %+v, %v; want every migration applied", statuses, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Status waited %s for the write lock", elapsed)
+	}
+}
+
+func TestRebind(t *testing.T) {
+	pg, _ := store.DialectFor("postgres")
+	got := pg.Rebind(`SELECT * FROM t WHERE a = ? AND b = '?' AND c = ?`)
+	want := `SELECT * FROM t WHERE a = $1 AND b = '?' AND c = $2`
+	if got != want {
+		t.Fatalf("Rebind = %q, want %q", got, want)
+	}
+
+	sqlite, _ := store.DialectFor("sqlite")
+	upsert := sqlite.Upsert("room_members", []string{"room_id", "user_id", "status"}, []string{"room_id", "user_id"}, []string{"status"})
+	if !strings.HasSuffix(upsert, "ON CONFLICT (room_id, user_id) DO UPDATE SET status = excluded.status") {
+		t.Fatalf("Upsert = %q", upsert)
+	}
+}
+
+func TestClassifyUnavailable(t *testing.T) {
+	pg, _ := store.DialectFor("postgres")
+	if kind, _ := pg.ClassifyError(&pq.Error{Code: "08006"}); kind != store.ErrorKindUnavailable {
+		t.Fatalf("postgres connection failure classified as %v", kind)
+	}
+	if kind, field := pg.ClassifyError(&pq.Error{Code: "23505", Detail: "Key (username)=(alice) already exists."}); kind != store.ErrorKindUniqueViolation || field != "username" {
+		t.Fatalf("postgres unique violation classified as %v on %q", kind, field)
+	}
+
+	sqlite, _ := store.DialectFor("sqlite")
+	if kind, _ := sqlite.ClassifyError(sqlite3.Error{Code: sqlite3.ErrBusy}); kind != store.ErrorKindUnavailable {
+		t.Fatalf("sqlite busy classified as %v", kind)
+	}
+}
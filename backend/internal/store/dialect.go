@@ -0,0 +1,222 @@
+package store
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrorKind classifies a driver error independently of the database in use.
+type ErrorKind int
+
+const (
+	// ErrorKindUnknown is any error the dialect does not recognise.
+	ErrorKindUnknown ErrorKind = iota
+	// ErrorKindUniqueViolation is a unique or primary key constraint failure.
+	ErrorKindUniqueViolation
+	// ErrorKindForeignKeyViolation is a foreign key constraint failure.
+	ErrorKindForeignKeyViolation
+	// ErrorKindUnavailable means the database could not be reached or is busy.
+	ErrorKindUnavailable
+)
+
+// Dialect hides the differences between the supported SQL databases so that
+// each store query is written once, using ? placeholders.
+type Dialect interface {
+	// Name is the dialect name, which is also its migrations directory.
+	Name() string
+	// DriverName is the database/sql driver to open.
+	DriverName() string
+	// Rebind rewrites ? placeholders into the dialect's bind syntax.
+	Rebind(query string) string
+	// Upsert builds an INSERT that updates updateColumns (or does nothing when
+	// there are none) if a row with the same conflictColumns already exists.
+	Upsert(table string, columns, conflictColumns, updateColumns []string) string
+	// TimestampType is the column type used for timestamps.
+	TimestampType() string
+	// TimeValue converts a time into the value bound for a timestamp column.
+	TimeValue(t time.Time) interface{}
+	// TableExists is a query counting the tables, in the schema in use,
+	// named by its one parameter.
+	TableExists() string
+	// MigrationLock is the statement that serialises migrations between
+	// replicas inside a transaction, or "" if Begin already holds the lock.
+	MigrationLock() string
+	// ClassifyError reports what kind of failure err is and, for constraint
+	// violations, the column involved when the driver exposes it.
+	ClassifyError(err error) (ErrorKind, string)
+}
+
+// DialectFor returns the dialect with the given name ("sqlite" or "postgres").
+func DialectFor(name string) (Dialect, bool) {
+	switch name {
+	case "sqlite":
+		return sqliteDialect{}, true
+	case "postgres":
+		return postgresDialect{}, true
+	}
+	return nil, false
+}
+
+// sqliteDialect implements Dialect for SQLite via mattn/go-sqlite3.
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string               { return "sqlite" }
+func (sqliteDialect) DriverName() string         { return "sqlite3" }
+func (sqliteDialect) Rebind(query string) string { return query }
+func (sqliteDialect) TimestampType() string      { return "DATETIME" }
+func (sqliteDialect) MigrationLock() string      { return "" }
+
+func (sqliteDialect) TableExists() string {
+	return "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+}
+
+// TimeValue stores timestamps in UTC so that SQLite's text comparison orders them correctly.
+func (sqliteDialect) TimeValue(t time.Time) interface{} { return t.UTC() }
+
+func (sqliteDialect) Upsert(table string, columns, conflictColumns, updateColumns []string) string {
+	return buildUpsert(table, columns, conflictColumns, updateColumns)
+}
+
+// sqliteConstraintColumn extracts the column from "UNIQUE constraint failed: users.username".
+var sqliteConstraintColumn = regexp.MustCompile(`constraint failed: \w+\.(\w+)`)
+
+func (sqliteDialect) ClassifyError(err error) (ErrorKind, string) {
+	if err == nil {
+		return ErrorKindUnknown, ""
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		column := ""
+		if m := sqliteConstraintColumn.FindStringSubmatch(sqliteErr.Error()); m != nil {
+			column = m[1]
+		}
+
+		switch sqliteErr.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+			return ErrorKindUniqueViolation, column
+		case sqlite3.ErrConstraintForeignKey:
+			return ErrorKindForeignKeyViolation, column
+		}
+		switch sqliteErr.Code {
+		case sqlite3.ErrBusy, sqlite3.ErrLocked, sqlite3.ErrCantOpen, sqlite3.ErrIoErr:
+			return ErrorKindUnavailable, ""
+		}
+		return ErrorKindUnknown, ""
+	}
+
+	return classifyConnectionError(err), ""
+}
+
+// postgresDialect implements Dialect for PostgreSQL via lib/pq.
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string          { return "postgres" }
+func (postgresDialect) DriverName() string    { return "postgres" }
+func (postgresDialect) TimestampType() string { return "TIMESTAMP WITH TIME ZONE" }
+
+func (postgresDialect) TimeValue(t time.Time) interface{} { return t.UTC() }
+
+func (postgresDialect) TableExists() string {
+	return "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?"
+}
+
+// migrationLockID is the key of the advisory lock taken while migrating.
+// The value is arbitrary but must never change.
+const migrationLockID = 7238461902
+
+func (postgresDialect) MigrationLock() string {
+	return "SELECT pg_advisory_xact_lock(" + strconv.Itoa(migrationLockID) + ")"
+}
+
+// Rebind rewrites ? placeholders as $1, $2, ... Question marks inside
+// single-quoted string literals are left alone.
+func (postgresDialect) Rebind(query string) string {
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	inString := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inString = !inString
+		case r == '?' && !inString:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (postgresDialect) Upsert(table string, columns, conflictColumns, updateColumns []string) string {
+	return buildUpsert(table, columns, conflictColumns, updateColumns)
+}
+
+// postgresKeyColumn extracts the column from "Key (username)=(alice) already exists."
+var postgresKeyColumn = regexp.MustCompile(`^Key \(([^,)]+)`)
+
+func (postgresDialect) ClassifyError(err error) (ErrorKind, string) {
+	if err == nil {
+		return ErrorKindUnknown, ""
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		column := pqErr.Column
+		if column == "" {
+			if m := postgresKeyColumn.FindStringSubmatch(pqErr.Detail); m != nil {
+				column = m[1]
+			}
+		}
+
+		switch {
+		case pqErr.Code == "23505":
+			return ErrorKindUniqueViolation, column
+		case pqErr.Code == "23503":
+			return ErrorKindForeignKeyViolation, column
+		case pqErr.Code.Class() == "08", pqErr.Code.Class() == "53", pqErr.Code.Class() == "57":
+			// Connection exceptions, insufficient resources, operator intervention
+			return ErrorKindUnavailable, ""
+		}
+		return ErrorKindUnknown, ""
+	}
+
+	return classifyConnectionError(err), ""
+}
+
+// buildUpsert renders INSERT ... ON CONFLICT, which SQLite and PostgreSQL share.
+func buildUpsert(table string, columns, conflictColumns, updateColumns []string) string {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	query := "INSERT INTO " + table + " (" + strings.Join(columns, ", ") + ") VALUES (" + placeholders + ")" +
+		" ON CONFLICT (" + strings.Join(conflictColumns, ", ") + ")"
+
+	if len(updateColumns) == 0 {
+		return query + " DO NOTHING"
+	}
+
+	assignments := make([]string, len(updateColumns))
+	for i, column := range updateColumns {
+		assignments[i] = column + " = excluded." + column
+	}
+	return query + " DO UPDATE SET " + strings.Join(assignments, ", ")
+}
+
+// classifyConnectionError recognises driver-independent connectivity failures.
+func classifyConnectionError(err error) ErrorKind {
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr) {
+		return ErrorKindUnavailable
+	}
+	return ErrorKindUnknown
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by every StoreInterface implementation. Callers should test
+// for them with errors.Is rather than inspecting driver error strings.
+var (
+	// ErrNotFound means the requested record, or a record it references, does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict means a record with the same unique value already exists.
+	// The concrete error is a *ConflictError naming the field.
+	ErrConflict = errors.New("conflict")
+	// ErrUnavailable means the database could not be reached or is overloaded.
+	ErrUnavailable = errors.New("store unavailable")
+	// ErrInUse means a record cannot be deleted because other records still reference it.
+	ErrInUse = errors.New("record is still in use")
+)
+
+// ConflictError reports which unique field caused a conflict.
+type ConflictError struct {
+	Field string
+}
+
+func (e *ConflictError) Error() string {
+	if e.Field == "" {
+		return "record already exists"
+	}
+	return e.Field + " already exists"
+}
+
+// Is makes errors.Is(err, ErrConflict) match any ConflictError.
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// ConflictField returns the conflicting field if err is a conflict, or "".
+func ConflictField(err error) string {
+	var conflict *ConflictError
+	if errors.As(err, &conflict) {
+		return conflict.Field
+	}
+	return ""
+}
+
+// notFound returns an ErrNotFound describing what was missing.
+func notFound(what string) error {
+	return fmt.Errorf("%s: %w", what, ErrNotFound)
+}
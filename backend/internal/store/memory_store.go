@@ -0,0 +1,1021 @@
+package store
+
+import (
+	"backend/internal/models"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore implements StoreInterface entirely in memory. It is meant for
+// unit tests and demo mode; all data is lost when the process exits.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data *memoryData
+	inTx bool
+	undo []func() // in a transaction, how to reverse each change, oldest first
+}
+
+// memoryData holds the records of a MemoryStore. Stored records are never
+// modified in place: changes replace them, through setEntry, deleteEntry
+// and setMessages, so that a transaction can put the old ones back.
+type memoryData struct {
+	users         map[string]*models.User // by ID
+	userIDsByName map[string]string
+
+	rooms         map[string]*models.ChatRoom // by ID
+	roomIDsByName map[string]string
+
+	members map[string]map[string]*models.RoomMember // by room ID, then user ID
+
+	messages   []*models.Message // in insertion order
+	messageIDs map[string]bool
+
+	mentions map[string][]*models.MessageMention // by message ID
+
+	bans          map[string]map[string]*models.RoomBan // by room ID, then user ID
+	moderationLog map[string][]*models.ModerationAction // by room ID, in insertion order
+	moderationIDs map[string]bool
+
+	heldMessages map[string]*models.HeldMessage // by ID
+
+	reports map[string]*models.MessageReport // by ID
+
+	blocks map[string]map[string]*models.UserBlock // by blocker ID, then blocked ID
+}
+
+// Ensure MemoryStore implements StoreInterface
+var _ StoreInterface = (*MemoryStore)(nil)
+
+// NewMemoryStore creates a new, empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		data: &memoryData{
+			users:         make(map[string]*models.User),
+			userIDsByName: make(map[string]string),
+			rooms:         make(map[string]*models.ChatRoom),
+			roomIDsByName: make(map[string]string),
+			members:       make(map[string]map[string]*models.RoomMember),
+			messageIDs:    make(map[string]bool),
+			mentions:      make(map[string][]*models.MessageMention),
+			bans:          make(map[string]map[string]*models.RoomBan),
+			moderationLog: make(map[string][]*models.ModerationAction),
+			moderationIDs: make(map[string]bool),
+			heldMessages:  make(map[string]*models.HeldMessage),
+			reports:       make(map[string]*models.MessageReport),
+			blocks:        make(map[string]map[string]*models.UserBlock),
+		},
+	}
+}
+
+// Migrate is a no-op; the in-memory store has no schema.
+func (s *MemoryStore) Migrate() error {
+	return nil
+}
+
+// Ping always succeeds; there is no database to reach.
+func (s *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// PendingMigrations always returns 0; the in-memory store has no schema.
+func (s *MemoryStore) PendingMigrations(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+// Close is a no-op; there are no resources to release.
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// WithTx runs fn against the store's data while other callers wait. Each
+// change fn makes is logged with how to reverse it, and if fn fails or
+// panics the log is replayed backwards, so a transaction costs as much as
+// its own changes rather than a copy of the store.
+func (s *MemoryStore) WithTx(fn func(tx StoreInterface) error) error {
+	if s.inTx {
+		// Already in a transaction; join it
+		return fn(s)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	txStore := &MemoryStore{data: s.data, inTx: true}
+	committed := false
+	defer func() {
+		if !committed {
+			txStore.rollback()
+		}
+	}()
+	if err := fn(txStore); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+// rollback reverses the transaction's changes, newest first.
+func (s *MemoryStore) rollback() {
+	for i := len(s.undo) - 1; i >= 0; i-- {
+		s.undo[i]()
+	}
+	s.undo = nil
+}
+
+// setEntry sets m[key] to value, logging how to undo it in a transaction.
+func setEntry[K comparable, V any](s *MemoryStore, m map[K]V, key K, value V) {
+	if s.inTx {
+		old, existed := m[key]
+		s.undo = append(s.undo, func() {
+			if existed {
+				m[key] = old
+			} else {
+				delete(m, key)
+			}
+		})
+	}
+	m[key] = value
+}
+
+// deleteEntry deletes m[key], logging how to undo it in a transaction.
+func deleteEntry[K comparable, V any](s *MemoryStore, m map[K]V, key K) {
+	old, existed := m[key]
+	if !existed {
+		return
+	}
+	if s.inTx {
+		s.undo = append(s.undo, func() { m[key] = old })
+	}
+	delete(m, key)
+}
+
+// setMessages replaces the list of messages, logging how to undo it in a
+// transaction. Undoing an append is safe: the old list ends before the
+// element it added.
+func (s *MemoryStore) setMessages(messages []*models.Message) {
+	if s.inTx {
+		old := s.data.messages
+		s.undo = append(s.undo, func() { s.data.messages = old })
+	}
+	s.data.messages = messages
+}
+
+// WithContext returns the store itself: in-memory operations are not traced.
+func (s *MemoryStore) WithContext(ctx context.Context) StoreInterface {
+	return s
+}
+
+// CreateUser stores a new user. Usernames must be unique.
+func (s *MemoryStore) CreateUser(user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.users[user.ID]; exists {
+		return &ConflictError{Field: "id"}
+	}
+	if _, exists := s.data.userIDsByName[user.Username]; exists {
+		return &ConflictError{Field: "username"}
+	}
+
+	stored := *user
+	setEntry(s, s.data.users, user.ID, &stored)
+	setEntry(s, s.data.userIDsByName, user.Username, user.ID)
+	return nil
+}
+
+// GetUserByID retrieves a user by their ID.
+func (s *MemoryStore) GetUserByID(id string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.data.users[id]
+	if !ok {
+		return nil, notFound("user " + id)
+	}
+	user := *stored
+	return &user, nil
+}
+
+// GetUserByUsername retrieves a user by their username.
+func (s *MemoryStore) GetUserByUsername(username string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.data.userIDsByName[username]
+	if !ok {
+		return nil, notFound("user " + username)
+	}
+	user := *s.data.users[id]
+	return &user, nil
+}
+
+// ListUsers returns every user, ordered by username.
+func (s *MemoryStore) ListUsers() ([]*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var users []*models.User
+	for _, stored := range s.data.users {
+		user := *stored
+		users = append(users, &user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users, nil
+}
+
+// UpdateUser changes the password, admin flag and disabled flag of an existing user.
+func (s *MemoryStore) UpdateUser(user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.data.users[user.ID]
+	if !ok {
+		return notFound("user " + user.ID)
+	}
+	updated := *stored
+	updated.Password = user.Password
+	updated.IsAdmin = user.IsAdmin
+	updated.Disabled = user.Disabled
+	setEntry(s, s.data.users, user.ID, &updated)
+	return nil
+}
+
+// DeleteUser deletes a user. Their memberships, bans, held messages, filed reports, blocks and mentions go with them, but
+// the user's messages and rooms must be deleted first.
+func (s *MemoryStore) DeleteUser(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.data.users[id]
+	if !ok {
+		return notFound("user " + id)
+	}
+	for _, room := range s.data.rooms {
+		if room.OwnerID == id {
+			return fmt.Errorf("user %s still owns room %s: %w", id, room.ID, ErrInUse)
+		}
+	}
+	for _, m := range s.data.messages {
+		if m.SenderID == id {
+			return fmt.Errorf("user %s still has messages: %w", id, ErrInUse)
+		}
+	}
+
+	deleteEntry(s, s.data.users, id)
+	deleteEntry(s, s.data.userIDsByName, stored.Username)
+	for roomID := range s.data.members {
+		deleteEntry(s, s.data.members[roomID], id)
+	}
+	for roomID := range s.data.bans {
+		deleteEntry(s, s.data.bans[roomID], id)
+	}
+	for heldID, held := range s.data.heldMessages {
+		if held.SenderID == id {
+			deleteEntry(s, s.data.heldMessages, heldID)
+		}
+	}
+	for reportID, report := range s.data.reports {
+		if report.ReporterID == id {
+			deleteEntry(s, s.data.reports, reportID)
+		}
+	}
+	deleteEntry(s, s.data.blocks, id)
+	for blockerID := range s.data.blocks {
+		deleteEntry(s, s.data.blocks[blockerID], id)
+	}
+	for messageID, mentions := range s.data.mentions {
+		var kept []*models.MessageMention
+		for _, mention := range mentions {
+			if mention.UserID != id {
+				kept = append(kept, mention)
+			}
+		}
+		if len(kept) < len(mentions) {
+			setEntry(s, s.data.mentions, messageID, kept)
+		}
+	}
+	return nil
+}
+
+// CreateRoom stores a new chat room. Room names must be unique and the owner must exist.
+func (s *MemoryStore) CreateRoom(room *models.ChatRoom) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.rooms[room.ID]; exists {
+		return &ConflictError{Field: "id"}
+	}
+	if _, exists := s.data.roomIDsByName[room.Name]; exists {
+		return &ConflictError{Field: "name"}
+	}
+	if _, exists := s.data.users[room.OwnerID]; !exists {
+		return notFound("room owner " + room.OwnerID)
+	}
+
+	stored := *room
+	setEntry(s, s.data.rooms, room.ID, &stored)
+	setEntry(s, s.data.roomIDsByName, room.Name, room.ID)
+	return nil
+}
+
+// GetRoomByID retrieves a chat room by its ID.
+func (s *MemoryStore) GetRoomByID(roomID string) (*models.ChatRoom, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.data.rooms[roomID]
+	if !ok {
+		return nil, notFound("room " + roomID)
+	}
+	room := *stored
+	return &room, nil
+}
+
+// ListRooms returns every room, including private and archived ones, ordered by name.
+func (s *MemoryStore) ListRooms() ([]*models.ChatRoom, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var rooms []*models.ChatRoom
+	for _, stored := range s.data.rooms {
+		room := *stored
+		rooms = append(rooms, &room)
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].Name < rooms[j].Name })
+	return rooms, nil
+}
+
+// UpdateRoom changes the name, type and archived flag of an existing room.
+func (s *MemoryStore) UpdateRoom(room *models.ChatRoom) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.data.rooms[room.ID]
+	if !ok {
+		return notFound("room " + room.ID)
+	}
+	if id, exists := s.data.roomIDsByName[room.Name]; exists && id != room.ID {
+		return &ConflictError{Field: "name"}
+	}
+
+	updated := *stored
+	updated.Name = room.Name
+	updated.RoomType = room.RoomType
+	updated.Archived = room.Archived
+	deleteEntry(s, s.data.roomIDsByName, stored.Name)
+	setEntry(s, s.data.rooms, room.ID, &updated)
+	setEntry(s, s.data.roomIDsByName, room.Name, room.ID)
+	return nil
+}
+
+// DeleteRoom deletes a room. Its memberships, bans, held messages, reports and moderation log go with it,
+// but the room's messages must be deleted first.
+func (s *MemoryStore) DeleteRoom(roomID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.data.rooms[roomID]
+	if !ok {
+		return notFound("room " + roomID)
+	}
+	for _, m := range s.data.messages {
+		if m.RoomID == roomID {
+			return fmt.Errorf("room %s still has messages: %w", roomID, ErrInUse)
+		}
+	}
+
+	deleteEntry(s, s.data.rooms, roomID)
+	deleteEntry(s, s.data.roomIDsByName, stored.Name)
+	deleteEntry(s, s.data.members, roomID)
+	deleteEntry(s, s.data.bans, roomID)
+	for _, action := range s.data.moderationLog[roomID] {
+		deleteEntry(s, s.data.moderationIDs, action.ID)
+	}
+	deleteEntry(s, s.data.moderationLog, roomID)
+	for heldID, held := range s.data.heldMessages {
+		if held.RoomID == roomID {
+			deleteEntry(s, s.data.heldMessages, heldID)
+		}
+	}
+	for reportID, report := range s.data.reports {
+		if report.RoomID == roomID {
+			deleteEntry(s, s.data.reports, reportID)
+		}
+	}
+	return nil
+}
+
+// AddRoomMember adds a user to a room. Each user can be added to a room once.
+func (s *MemoryStore) AddRoomMember(member *models.RoomMember) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.rooms[member.RoomID]; !exists {
+		return notFound("room " + member.RoomID)
+	}
+	if _, exists := s.data.users[member.UserID]; !exists {
+		return notFound("user " + member.UserID)
+	}
+
+	roomMembers, ok := s.data.members[member.RoomID]
+	if !ok {
+		roomMembers = make(map[string]*models.RoomMember)
+		setEntry(s, s.data.members, member.RoomID, roomMembers)
+	}
+	if _, exists := roomMembers[member.UserID]; exists {
+		return &ConflictError{Field: "room_id"}
+	}
+
+	setEntry(s, roomMembers, member.UserID, copyMember(member))
+	return nil
+}
+
+// GetRoomMember retrieves a user's membership in a room.
+func (s *MemoryStore) GetRoomMember(roomID, userID string) (*models.RoomMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.data.members[roomID][userID]
+	if !ok {
+		return nil, notFound("membership of " + userID + " in room " + roomID)
+	}
+	return copyMember(stored), nil
+}
+
+// GetRoomMembers retrieves every membership in a room, ordered by user ID.
+func (s *MemoryStore) GetRoomMembers(roomID string) ([]*models.RoomMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var members []*models.RoomMember
+	for _, member := range s.data.members[roomID] {
+		members = append(members, copyMember(member))
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].UserID < members[j].UserID
+	})
+	return members, nil
+}
+
+// UpdateRoomMember changes the status, role and mute of an existing membership.
+func (s *MemoryStore) UpdateRoomMember(member *models.RoomMember) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.data.members[member.RoomID][member.UserID]; !ok {
+		return notFound("membership of " + member.UserID + " in room " + member.RoomID)
+	}
+	setEntry(s, s.data.members[member.RoomID], member.UserID, copyMember(member))
+	return nil
+}
+
+// RemoveRoomMember deletes a user's membership in a room.
+func (s *MemoryStore) RemoveRoomMember(roomID, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.data.members[roomID][userID]; !ok {
+		return notFound("membership of " + userID + " in room " + roomID)
+	}
+	deleteEntry(s, s.data.members[roomID], userID)
+	return nil
+}
+
+// copyMember returns a copy of member that shares no memory with it.
+func copyMember(member *models.RoomMember) *models.RoomMember {
+	c := *member
+	c.MutedUntil = copyTime(member.MutedUntil)
+	return &c
+}
+
+// copyTime returns a copy of an optional time.
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
+
+// CreateBan bans a user from a room. A user can be banned from a room once.
+func (s *MemoryStore) CreateBan(ban *models.RoomBan) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.rooms[ban.RoomID]; !exists {
+		return notFound("room " + ban.RoomID)
+	}
+	if _, exists := s.data.users[ban.UserID]; !exists {
+		return notFound("user " + ban.UserID)
+	}
+
+	roomBans, ok := s.data.bans[ban.RoomID]
+	if !ok {
+		roomBans = make(map[string]*models.RoomBan)
+		setEntry(s, s.data.bans, ban.RoomID, roomBans)
+	}
+	if _, exists := roomBans[ban.UserID]; exists {
+		return &ConflictError{Field: "room_id"}
+	}
+
+	stored := *ban
+	setEntry(s, roomBans, ban.UserID, &stored)
+	return nil
+}
+
+// GetBan retrieves a user's ban from a room.
+func (s *MemoryStore) GetBan(roomID, userID string) (*models.RoomBan, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.data.bans[roomID][userID]
+	if !ok {
+		return nil, notFound("ban of " + userID + " from room " + roomID)
+	}
+	ban := *stored
+	return &ban, nil
+}
+
+// DeleteBan lifts a user's ban from a room.
+func (s *MemoryStore) DeleteBan(roomID, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.data.bans[roomID][userID]; !ok {
+		return notFound("ban of " + userID + " from room " + roomID)
+	}
+	deleteEntry(s, s.data.bans[roomID], userID)
+	return nil
+}
+
+// SaveModerationAction appends an entry to a room's moderation log.
+func (s *MemoryStore) SaveModerationAction(action *models.ModerationAction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data.moderationIDs[action.ID] {
+		return &ConflictError{Field: "id"}
+	}
+	if _, exists := s.data.rooms[action.RoomID]; !exists {
+		return notFound("room " + action.RoomID)
+	}
+
+	stored := *action
+	stored.ExpiresAt = copyTime(action.ExpiresAt)
+	setEntry(s, s.data.moderationLog, action.RoomID, append(s.data.moderationLog[action.RoomID], &stored))
+	setEntry(s, s.data.moderationIDs, action.ID, true)
+	return nil
+}
+
+// GetModerationLog retrieves a room's moderation log, newest first.
+func (s *MemoryStore) GetModerationLog(roomID string) ([]*models.ModerationAction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var actions []*models.ModerationAction
+	for _, stored := range s.data.moderationLog[roomID] {
+		action := *stored
+		action.ExpiresAt = copyTime(stored.ExpiresAt)
+		actions = append(actions, &action)
+	}
+	sort.SliceStable(actions, func(i, j int) bool {
+		if !actions[i].CreatedAt.Equal(actions[j].CreatedAt) {
+			return actions[i].CreatedAt.After(actions[j].CreatedAt)
+		}
+		return actions[i].ID < actions[j].ID
+	})
+	return actions, nil
+}
+
+// SaveHeldMessage adds a message to its room's review queue. The room and sender must exist.
+func (s *MemoryStore) SaveHeldMessage(held *models.HeldMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.heldMessages[held.ID]; exists {
+		return &ConflictError{Field: "id"}
+	}
+	if _, exists := s.data.rooms[held.RoomID]; !exists {
+		return notFound("room " + held.RoomID)
+	}
+	if _, exists := s.data.users[held.SenderID]; !exists {
+		return notFound("sender " + held.SenderID)
+	}
+
+	// Fields that DBStore does not persist are dropped
+	stored := *held
+	stored.SenderUsername = ""
+	setEntry(s, s.data.heldMessages, held.ID, &stored)
+	return nil
+}
+
+// GetHeldMessage retrieves a held message by its ID.
+func (s *MemoryStore) GetHeldMessage(id string) (*models.HeldMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.data.heldMessages[id]
+	if !ok {
+		return nil, notFound("held message " + id)
+	}
+	held := *stored
+	return &held, nil
+}
+
+// GetHeldMessagesByRoom retrieves a room's review queue, oldest first.
+func (s *MemoryStore) GetHeldMessagesByRoom(roomID string) ([]*models.HeldMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var queue []*models.HeldMessage
+	for _, stored := range s.data.heldMessages {
+		if stored.RoomID == roomID {
+			held := *stored
+			queue = append(queue, &held)
+		}
+	}
+	sort.Slice(queue, func(i, j int) bool {
+		if !queue[i].CreatedAt.Equal(queue[j].CreatedAt) {
+			return queue[i].CreatedAt.Before(queue[j].CreatedAt)
+		}
+		return queue[i].ID < queue[j].ID
+	})
+	return queue, nil
+}
+
+// DeleteHeldMessage removes a message from the review queue.
+func (s *MemoryStore) DeleteHeldMessage(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.data.heldMessages[id]; !ok {
+		return notFound("held message " + id)
+	}
+	deleteEntry(s, s.data.heldMessages, id)
+	return nil
+}
+
+// copyReport returns a copy of report that shares no pointers with it.
+func copyReport(report *models.MessageReport) *models.MessageReport {
+	c := *report
+	c.ResolvedAt = copyTime(report.ResolvedAt)
+	return &c
+}
+
+// CreateReport stores a new report. A user can report a message once.
+func (s *MemoryStore) CreateReport(report *models.MessageReport) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.reports[report.ID]; exists {
+		return &ConflictError{Field: "id"}
+	}
+	if _, exists := s.data.rooms[report.RoomID]; !exists {
+		return notFound("room " + report.RoomID)
+	}
+	if _, exists := s.data.users[report.ReporterID]; !exists {
+		return notFound("reporter " + report.ReporterID)
+	}
+	for _, existing := range s.data.reports {
+		if existing.MessageID == report.MessageID && existing.ReporterID == report.ReporterID {
+			return &ConflictError{Field: "message_id"}
+		}
+	}
+
+	// Fields that DBStore does not persist are dropped
+	stored := copyReport(report)
+	stored.ReporterUsername = ""
+	stored.SenderUsername = ""
+	setEntry(s, s.data.reports, report.ID, stored)
+	return nil
+}
+
+// GetReport retrieves a report by its ID.
+func (s *MemoryStore) GetReport(id string) (*models.MessageReport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.data.reports[id]
+	if !ok {
+		return nil, notFound("report " + id)
+	}
+	return copyReport(stored), nil
+}
+
+// ListReports retrieves reports oldest first. An empty roomID or status matches every room or status.
+func (s *MemoryStore) ListReports(roomID, status string) ([]*models.MessageReport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var reports []*models.MessageReport
+	for _, stored := range s.data.reports {
+		if (roomID == "" || stored.RoomID == roomID) && (status == "" || stored.Status == status) {
+			reports = append(reports, copyReport(stored))
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		if !reports[i].CreatedAt.Equal(reports[j].CreatedAt) {
+			return reports[i].CreatedAt.Before(reports[j].CreatedAt)
+		}
+		return reports[i].ID < reports[j].ID
+	})
+	return reports, nil
+}
+
+// UpdateReport changes the status and resolution of an existing report.
+func (s *MemoryStore) UpdateReport(report *models.MessageReport) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.data.reports[report.ID]
+	if !ok {
+		return notFound("report " + report.ID)
+	}
+
+	updated := copyReport(stored)
+	updated.Status = report.Status
+	updated.Resolution = report.Resolution
+	updated.ResolvedBy = report.ResolvedBy
+	updated.ResolvedAt = copyTime(report.ResolvedAt)
+	setEntry(s, s.data.reports, report.ID, updated)
+	return nil
+}
+
+// CreateBlock records that a user has blocked another. A user can block
+// another user once.
+func (s *MemoryStore) CreateBlock(block *models.UserBlock) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.users[block.BlockerID]; !exists {
+		return notFound("user " + block.BlockerID)
+	}
+	if _, exists := s.data.users[block.BlockedID]; !exists {
+		return notFound("user " + block.BlockedID)
+	}
+
+	blocks, ok := s.data.blocks[block.BlockerID]
+	if !ok {
+		blocks = make(map[string]*models.UserBlock)
+		setEntry(s, s.data.blocks, block.BlockerID, blocks)
+	}
+	if _, exists := blocks[block.BlockedID]; exists {
+		return &ConflictError{Field: "blocker_id"}
+	}
+
+	stored := *block
+	stored.BlockedUsername = ""
+	setEntry(s, blocks, block.BlockedID, &stored)
+	return nil
+}
+
+// GetBlock retrieves a user's block of another user.
+func (s *MemoryStore) GetBlock(blockerID, blockedID string) (*models.UserBlock, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.data.blocks[blockerID][blockedID]
+	if !ok {
+		return nil, notFound("block of " + blockedID + " by " + blockerID)
+	}
+	block := *stored
+	return &block, nil
+}
+
+// GetBlocksByUser retrieves the users a user has blocked, oldest first.
+func (s *MemoryStore) GetBlocksByUser(blockerID string) ([]*models.UserBlock, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var blocks []*models.UserBlock
+	for _, stored := range s.data.blocks[blockerID] {
+		block := *stored
+		blocks = append(blocks, &block)
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		if !blocks[i].CreatedAt.Equal(blocks[j].CreatedAt) {
+			return blocks[i].CreatedAt.Before(blocks[j].CreatedAt)
+		}
+		return blocks[i].BlockedID < blocks[j].BlockedID
+	})
+	return blocks, nil
+}
+
+// DeleteBlock lifts a user's block of another user.
+func (s *MemoryStore) DeleteBlock(blockerID, blockedID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.data.blocks[blockerID][blockedID]; !ok {
+		return notFound("block of " + blockedID + " by " + blockerID)
+	}
+	deleteEntry(s, s.data.blocks[blockerID], blockedID)
+	return nil
+}
+
+// GetRoomsByUserID returns all public rooms and private rooms the user is a member of, ordered by name.
+// Archived rooms are left out.
+func (s *MemoryStore) GetRoomsByUserID(userID string) ([]*models.ChatRoom, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var rooms []*models.ChatRoom
+	for _, room := range s.data.rooms {
+		if room.Archived {
+			continue
+		}
+		visible := room.RoomType == "public"
+		if m, ok := s.data.members[room.ID][userID]; ok && m.Status == "member" {
+			visible = true
+		}
+		if visible {
+			r := *room
+			rooms = append(rooms, &r)
+		}
+	}
+
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].Name < rooms[j].Name })
+	return rooms, nil
+}
+
+// SaveMessage stores a new message. The room and sender must exist.
+func (s *MemoryStore) SaveMessage(message *models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data.messageIDs[message.ID] {
+		return &ConflictError{Field: "id"}
+	}
+	if _, exists := s.data.rooms[message.RoomID]; !exists {
+		return notFound("room " + message.RoomID)
+	}
+	if _, exists := s.data.users[message.SenderID]; !exists {
+		return notFound("sender " + message.SenderID)
+	}
+
+	// Fields that DBStore does not persist are dropped
+	stored := *message
+	stored.SenderUsername = ""
+	stored.Mentions = nil
+	s.setMessages(append(s.data.messages, &stored))
+	setEntry(s, s.data.messageIDs, message.ID, true)
+	return nil
+}
+
+// GetMessageByID retrieves a message by its ID.
+func (s *MemoryStore) GetMessageByID(id string) (*models.Message, error) {
+	messages := s.filterMessages(func(m *models.Message) bool { return m.ID == id })
+	if len(messages) == 0 {
+		return nil, notFound("message " + id)
+	}
+	return messages[0], nil
+}
+
+// DeleteMessage deletes a message with its mentions.
+func (s *MemoryStore) DeleteMessage(id string) error {
+	if s.deleteMessages(func(m *models.Message) bool { return m.ID == id }) == 0 {
+		return notFound("message " + id)
+	}
+	return nil
+}
+
+// GetMessagesByRoom retrieves all messages for a room, oldest first.
+func (s *MemoryStore) GetMessagesByRoom(roomID string) ([]*models.Message, error) {
+	return s.filterMessages(func(m *models.Message) bool {
+		return m.RoomID == roomID
+	}), nil
+}
+
+// CountMessages returns the number of messages in a room.
+func (s *MemoryStore) CountMessages(roomID string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, m := range s.data.messages {
+		if m.RoomID == roomID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetMessagesSince retrieves messages for a room sent after since, oldest first.
+func (s *MemoryStore) GetMessagesSince(roomID string, since time.Time) ([]*models.Message, error) {
+	return s.filterMessages(func(m *models.Message) bool {
+		return m.RoomID == roomID && m.Timestamp.After(since)
+	}), nil
+}
+
+// GetRoomHistory retrieves the messages in a room after the cursor, oldest
+// first, leaving out messages from users that viewerID has blocked. If limit
+// is positive, at most limit messages are returned: the first ones after
+// the cursor if it is set, and otherwise the most recent ones.
+func (s *MemoryStore) GetRoomHistory(roomID, viewerID string, after models.MessageCursor, limit int) ([]*models.Message, error) {
+	messages := s.filterMessages(func(m *models.Message) bool {
+		return m.RoomID == roomID && after.Precedes(models.MessageCursor{Timestamp: m.Timestamp, ID: m.ID}) &&
+			s.data.blocks[viewerID][m.SenderID] == nil
+	})
+	if limit > 0 && limit < len(messages) {
+		if after.IsZero() {
+			messages = messages[len(messages)-limit:]
+		} else {
+			messages = messages[:limit]
+		}
+	}
+	return messages, nil
+}
+
+// DeleteMessagesByRoom deletes every message in a room, with their mentions.
+func (s *MemoryStore) DeleteMessagesByRoom(roomID string) error {
+	s.deleteMessages(func(m *models.Message) bool { return m.RoomID == roomID })
+	return nil
+}
+
+// DeleteMessagesBySender deletes every message a user sent, with their mentions.
+func (s *MemoryStore) DeleteMessagesBySender(userID string) error {
+	s.deleteMessages(func(m *models.Message) bool { return m.SenderID == userID })
+	return nil
+}
+
+// deleteMessages removes the matching messages and their mentions, and returns
+// how many messages were removed.
+func (s *MemoryStore) deleteMessages(match func(*models.Message) bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var kept []*models.Message
+	for _, m := range s.data.messages {
+		if !match(m) {
+			kept = append(kept, m)
+			continue
+		}
+		deleteEntry(s, s.data.messageIDs, m.ID)
+		deleteEntry(s, s.data.mentions, m.ID)
+	}
+	deleted := len(s.data.messages) - len(kept)
+	s.setMessages(kept)
+	return deleted
+}
+
+// SaveMention records that a message mentioned a user.
+func (s *MemoryStore) SaveMention(mention *models.MessageMention) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.data.messageIDs[mention.MessageID] {
+		return notFound("message " + mention.MessageID)
+	}
+	if _, exists := s.data.users[mention.UserID]; !exists {
+		return notFound("user " + mention.UserID)
+	}
+	for _, existing := range s.data.mentions[mention.MessageID] {
+		if existing.UserID == mention.UserID {
+			return &ConflictError{Field: "message_id"}
+		}
+	}
+
+	stored := *mention
+	setEntry(s, s.data.mentions, mention.MessageID, append(s.data.mentions[mention.MessageID], &stored))
+	return nil
+}
+
+// GetMentionsByMessage retrieves the users mentioned by a message, ordered by user ID.
+func (s *MemoryStore) GetMentionsByMessage(messageID string) ([]*models.MessageMention, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var mentions []*models.MessageMention
+	for _, m := range s.data.mentions[messageID] {
+		mention := *m
+		mentions = append(mentions, &mention)
+	}
+	sort.Slice(mentions, func(i, j int) bool { return mentions[i].UserID < mentions[j].UserID })
+	return mentions, nil
+}
+
+// filterMessages returns copies of the matching messages sorted by timestamp.
+func (s *MemoryStore) filterMessages(match func(*models.Message) bool) []*models.Message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var messages []*models.Message
+	for _, m := range s.data.messages {
+		if match(m) {
+			msg := *m
+			messages = append(messages, &msg)
+		}
+	}
+
+	// Messages sent at the same time are ordered by ID, as in the database
+	sort.Slice(messages, func(i, j int) bool {
+		if !messages[i].Timestamp.Equal(messages[j].Timestamp) {
+			return messages[i].Timestamp.Before(messages[j].Timestamp)
+		}
+		return messages[i].ID < messages[j].ID
+	})
+	return messages
+}
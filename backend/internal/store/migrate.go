@@ -0,0 +1,323 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the numbered migration scripts for every supported database.
+// Each dialect has its own directory containing NNNN_name.up.sql and NNNN_name.down.sql pairs.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Migration is a single numbered schema change with its rollback script.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus describes whether a migration has been applied to the database.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator applies and rolls back the versioned schema migrations.
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+// NewMigrator creates a Migrator for the given database, loading the embedded
+// migrations for the matching dialect.
+func NewMigrator(db *sql.DB, dialect Dialect) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles, path.Join("migrations", dialect.Name()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// loadMigrations reads and pairs the up/down scripts found in dir, sorted by version.
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations directory %s: %w", dir, err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(fileName, ".sql") {
+			continue
+		}
+
+		// File names look like 0001_initial_schema.up.sql
+		base := strings.TrimSuffix(fileName, ".sql")
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s must end in .up.sql or .down.sql", fileName)
+		}
+		base = strings.TrimSuffix(base, "."+direction)
+
+		versionPart, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s must be named NNNN_description", fileName)
+		}
+		version, err := strconv.Atoi(versionPart)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s has an invalid version number", fileName)
+		}
+
+		contents, err := fs.ReadFile(fsys, path.Join(dir, fileName))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", fileName, err)
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration version %d is used by both %q and %q", version, m.Name, name)
+		}
+
+		if direction == "up" {
+			m.Up = string(contents)
+		} else {
+			m.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up script", m.Version, m.Name)
+		}
+		if m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no down script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Status reports every known migration and whether it has been applied.
+// Like Pending, it only reads schema_migrations and does not take the
+// migration lock, so it neither waits for nor blocks a migration running
+// elsewhere. Before the first migration the table does not exist yet, and
+// nothing has been applied.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	ctx := context.Background()
+	var tables int
+	if err := m.db.QueryRowContext(ctx, m.dialect.Rebind(m.dialect.TableExists()), "schema_migrations").Scan(&tables); err != nil {
+		return nil, fmt.Errorf("failed to look for schema_migrations: %w", err)
+	}
+	applied := make(map[int]time.Time)
+	if tables > 0 {
+		var err error
+		if applied, err = m.appliedVersions(ctx, m.db); err != nil {
+			return nil, err
+		}
+	}
+
+	var statuses []MigrationStatus
+	for _, migration := range m.migrations {
+		appliedAt, ok := applied[migration.Version]
+		statuses = append(statuses, MigrationStatus{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			Applied:   ok,
+			AppliedAt: appliedAt,
+		})
+	}
+	return statuses, nil
+}
+
+// Pending returns the migrations that have not been applied, in order.
+// It reads schema_migrations without taking the migration lock, so a
+// migration running elsewhere is not waited for.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	rows, err := m.db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if !applied[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies all pending migrations in order. It returns the number applied.
+func (m *Migrator) Up() (int, error) {
+	count := 0
+	for {
+		applied, err := m.step(true)
+		if err != nil {
+			return count, err
+		}
+		if !applied {
+			return count, nil
+		}
+		count++
+	}
+}
+
+// Down rolls back the most recently applied migrations. It returns the number rolled back.
+func (m *Migrator) Down(steps int) (int, error) {
+	count := 0
+	for count < steps {
+		rolledBack, err := m.step(false)
+		if err != nil {
+			return count, err
+		}
+		if !rolledBack {
+			break
+		}
+		count++
+	}
+	return count, nil
+}
+
+// step applies the next pending migration (up) or rolls back the latest applied
+// one (down) inside a single locked transaction. The applied set is read after
+// the lock is taken, so a replica that lost the race simply finds nothing to do.
+func (m *Migrator) step(up bool) (bool, error) {
+	done := false
+	err := m.withLock(func(tx *sql.Tx) error {
+		applied, err := m.appliedVersions(context.Background(), tx)
+		if err != nil {
+			return err
+		}
+
+		if up {
+			for _, migration := range m.migrations {
+				if _, ok := applied[migration.Version]; ok {
+					continue
+				}
+				slog.Info("applying migration", "version", migration.Version, "name", migration.Name)
+				if _, err := tx.Exec(migration.Up); err != nil {
+					return fmt.Errorf("migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+				}
+				if _, err := tx.Exec(m.dialect.Rebind(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`),
+					migration.Version, migration.Name, m.dialect.TimeValue(time.Now())); err != nil {
+					return fmt.Errorf("failed to record migration %04d: %w", migration.Version, err)
+				}
+				done = true
+				return nil
+			}
+			return nil
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			slog.Info("rolling back migration", "version", migration.Version, "name", migration.Name)
+			if _, err := tx.Exec(migration.Down); err != nil {
+				return fmt.Errorf("rollback of %04d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			if _, err := tx.Exec(m.dialect.Rebind(`DELETE FROM schema_migrations WHERE version = ?`), migration.Version); err != nil {
+				return fmt.Errorf("failed to remove migration record %04d: %w", migration.Version, err)
+			}
+			done = true
+			return nil
+		}
+		return nil
+	})
+	return done, err
+}
+
+// withLock runs fn in a transaction that holds the migration lock and guarantees
+// the schema_migrations table exists.
+func (m *Migrator) withLock(fn func(tx *sql.Tx) error) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin migration transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// SQLite connections are opened with _txlock=immediate, so Begin already holds
+	// the database write lock. PostgreSQL needs an explicit advisory lock.
+	if lock := m.dialect.MigrationLock(); lock != "" {
+		if _, err := tx.Exec(lock); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at ` + m.dialect.TimestampType() + ` NOT NULL
+)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// appliedVersions returns the applied migration versions and when they were applied.
+func (m *Migrator) appliedVersions(ctx context.Context, q querier) (map[int]time.Time, error) {
+	rows, err := q.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS room_moderation_log;
+DROP TABLE IF EXISTS room_bans;
+ALTER TABLE room_members DROP COLUMN IF EXISTS muted_until;
+ALTER TABLE room_members DROP COLUMN IF EXISTS role;
@@ -0,0 +1,36 @@
+ALTER TABLE room_members ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'member'; -- can be 'owner', 'moderator' or 'member'
+ALTER TABLE room_members ADD COLUMN IF NOT EXISTS muted_until TIMESTAMP WITH TIME ZONE;
+
+-- Existing room owners get the owner role
+UPDATE room_members SET role = 'owner'
+WHERE EXISTS (
+    SELECT 1 FROM chat_rooms cr
+    WHERE cr.id = room_members.room_id AND cr.owner_id = room_members.user_id
+);
+
+CREATE TABLE IF NOT EXISTS room_bans (
+    room_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    banned_by TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (room_id, user_id),
+    FOREIGN KEY (room_id) REFERENCES chat_rooms(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- The log keeps actor and target IDs without foreign keys so that entries
+-- survive the users they refer to.
+CREATE TABLE IF NOT EXISTS room_moderation_log (
+    id TEXT PRIMARY KEY,
+    room_id TEXT NOT NULL,
+    actor_id TEXT NOT NULL,
+    target_id TEXT NOT NULL,
+    action TEXT NOT NULL, -- mute, unmute, kick, ban, unban, promote or demote
+    reason TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    FOREIGN KEY (room_id) REFERENCES chat_rooms(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_room_moderation_log_room ON room_moderation_log(room_id, created_at);
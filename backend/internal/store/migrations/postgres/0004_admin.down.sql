@@ -0,0 +1,3 @@
+ALTER TABLE chat_rooms DROP COLUMN IF EXISTS archived;
+ALTER TABLE users DROP COLUMN IF EXISTS disabled;
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
@@ -0,0 +1,2 @@
+ALTER TABLE room_moderation_log DROP COLUMN IF EXISTS report_id;
+DROP TABLE IF EXISTS message_reports;
@@ -0,0 +1,26 @@
+-- Reports keep a snapshot of the message, and its sender's ID without a foreign
+-- key, so that they survive the message being edited or deleted.
+CREATE TABLE IF NOT EXISTS message_reports (
+    id TEXT PRIMARY KEY,
+    message_id TEXT NOT NULL,
+    room_id TEXT NOT NULL,
+    reporter_id TEXT NOT NULL,
+    sender_id TEXT NOT NULL,
+    category TEXT NOT NULL, -- spam, harassment, hate, sexual, violence or other
+    details TEXT NOT NULL DEFAULT '',
+    content TEXT NOT NULL,
+    sent_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    status TEXT NOT NULL DEFAULT 'open', -- open, resolved or dismissed
+    resolution TEXT NOT NULL DEFAULT '', -- the action taken: dismiss, delete_message, mute or ban
+    resolved_by TEXT NOT NULL DEFAULT '',
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    UNIQUE (message_id, reporter_id),
+    FOREIGN KEY (room_id) REFERENCES chat_rooms(id) ON DELETE CASCADE,
+    FOREIGN KEY (reporter_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_reports_room ON message_reports(room_id, status, created_at);
+
+-- Moderation actions taken in response to a report are linked to it
+ALTER TABLE room_moderation_log ADD COLUMN IF NOT EXISTS report_id TEXT NOT NULL DEFAULT '';
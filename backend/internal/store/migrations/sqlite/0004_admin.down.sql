@@ -0,0 +1,3 @@
+ALTER TABLE chat_rooms DROP COLUMN archived;
+ALTER TABLE users DROP COLUMN disabled;
+ALTER TABLE users DROP COLUMN is_admin;
@@ -0,0 +1,2 @@
+ALTER TABLE room_moderation_log DROP COLUMN report_id;
+DROP TABLE IF EXISTS message_reports;
@@ -2,7 +2,7 @@ package store
 
 import (
 	"backend/internal/config"
-	"log"
+	"log/slog"
 )
 
 // Store is kept for backward compatibility
@@ -15,10 +15,11 @@ type Store struct {
 // New creates a new Store for backward compatibility
 // It uses the new DBStore implementation with PostgreSQL
 func New(dataSourceName string) (*Store, error) {
-	log.Printf("Store.New: Creating a new store with PostgreSQL using path: %s", dataSourceName)
+	slog.Debug("Store.New: creating a PostgreSQL store; the data source name is ignored")
 
 	// Create a default config that uses PostgreSQL
 	cfg := &config.DatabaseConfig{
+		Type:     "postgres",
 		Host:     "postgres",
 		Port:     "5432",
 		User:     "postgres",
@@ -39,6 +40,5 @@ func New(dataSourceName string) (*Store, error) {
 
 // Migrate delegates to the embedded DBStore's Migrate method
 func (s *Store) Migrate() error {
-	log.Println("Store.Migrate: Delegating to DBStore.Migrate")
 	return s.DBStore.Migrate()
 }
@@ -1,7 +1,10 @@
 package store
 
 import (
+	"backend/internal/config"
 	"backend/internal/models"
+	"context"
+	"log/slog"
 	"time"
 )
 
@@ -11,17 +14,86 @@ type StoreInterface interface {
 	Migrate() error
 	Close() error
 
+	// Ping checks that the database can be reached.
+	Ping(ctx context.Context) error
+
+	// PendingMigrations returns how many known schema migrations have not
+	// been applied. It takes no lock, so it is cheap enough for probes.
+	PendingMigrations(ctx context.Context) (int, error)
+
+	// WithTx runs fn against a store whose operations all belong to one
+	// transaction. The transaction commits if fn returns nil and rolls back
+	// if it returns an error or panics. Calling WithTx on the store passed to
+	// fn joins the existing transaction.
+	WithTx(fn func(tx StoreInterface) error) error
+
+	// WithContext returns a view of the store whose operations run with
+	// ctx, so that they are traced as part of the caller's work. The view
+	// shares the store's data and any transaction it belongs to.
+	WithContext(ctx context.Context) StoreInterface
+
 	// User methods
 	CreateUser(user *models.User) error
+	GetUserByID(id string) (*models.User, error)
 	GetUserByUsername(username string) (*models.User, error)
+	ListUsers() ([]*models.User, error)
+	UpdateUser(user *models.User) error
+	DeleteUser(id string) error
 
 	// Room methods
 	CreateRoom(room *models.ChatRoom) error
+	GetRoomByID(roomID string) (*models.ChatRoom, error)
 	GetRoomsByUserID(userID string) ([]*models.ChatRoom, error)
+	ListRooms() ([]*models.ChatRoom, error)
+	UpdateRoom(room *models.ChatRoom) error
+	DeleteRoom(roomID string) error
 	AddRoomMember(member *models.RoomMember) error
+	GetRoomMember(roomID, userID string) (*models.RoomMember, error)
+	GetRoomMembers(roomID string) ([]*models.RoomMember, error)
+	UpdateRoomMember(member *models.RoomMember) error
+	RemoveRoomMember(roomID, userID string) error
+
+	// Moderation methods
+	CreateBan(ban *models.RoomBan) error
+	GetBan(roomID, userID string) (*models.RoomBan, error)
+	DeleteBan(roomID, userID string) error
+	SaveModerationAction(action *models.ModerationAction) error
+	GetModerationLog(roomID string) ([]*models.ModerationAction, error)
+	SaveHeldMessage(held *models.HeldMessage) error
+	GetHeldMessage(id string) (*models.HeldMessage, error)
+	GetHeldMessagesByRoom(roomID string) ([]*models.HeldMessage, error)
+	DeleteHeldMessage(id string) error
+	CreateReport(report *models.MessageReport) error
+	GetReport(id string) (*models.MessageReport, error)
+	ListReports(roomID, status string) ([]*models.MessageReport, error)
+	UpdateReport(report *models.MessageReport) error
+
+	// Block methods
+	CreateBlock(block *models.UserBlock) error
+	GetBlock(blockerID, blockedID string) (*models.UserBlock, error)
+	GetBlocksByUser(blockerID string) ([]*models.UserBlock, error)
+	DeleteBlock(blockerID, blockedID string) error
 
 	// Message methods
 	SaveMessage(message *models.Message) error
+	GetMessageByID(id string) (*models.Message, error)
+	DeleteMessage(id string) error
 	GetMessagesByRoom(roomID string) ([]*models.Message, error)
+	CountMessages(roomID string) (int, error)
 	GetMessagesSince(roomID string, since time.Time) ([]*models.Message, error)
+	GetRoomHistory(roomID, viewerID string, after models.MessageCursor, limit int) ([]*models.Message, error)
+	DeleteMessagesByRoom(roomID string) error
+	DeleteMessagesBySender(userID string) error
+	SaveMention(mention *models.MessageMention) error
+	GetMentionsByMessage(messageID string) ([]*models.MessageMention, error)
+}
+
+// Open creates the store selected by the configuration: an in-memory store
+// for demo mode, or a DBStore for SQLite and PostgreSQL.
+func Open(cfg *config.DatabaseConfig) (StoreInterface, error) {
+	if cfg.IsMemory() {
+		slog.Warn("using in-memory store; data will not be persisted")
+		return NewMemoryStore(), nil
+	}
+	return NewDBStore(cfg)
 }
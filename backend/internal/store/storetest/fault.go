@@ -0,0 +1,125 @@
+package storetest
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"errors"
+)
+
+// ErrInjected is the error returned by a FaultStore for a failing method.
+var ErrInjected = errors.New("injected failure")
+
+// FaultStore wraps a store and makes chosen write methods fail, so tests can
+// check that multi-step operations roll back when a later step fails.
+type FaultStore struct {
+	store.StoreInterface
+
+	// FailOn lists the method names that return ErrInjected, e.g. "AddRoomMember".
+	FailOn map[string]bool
+}
+
+// NewFaultStore wraps s, failing every method named in failOn.
+func NewFaultStore(s store.StoreInterface, failOn ...string) *FaultStore {
+	f := &FaultStore{StoreInterface: s, FailOn: make(map[string]bool)}
+	for _, name := range failOn {
+		f.FailOn[name] = true
+	}
+	return f
+}
+
+// WithTx keeps the transaction wrapped so injected failures still apply inside it.
+func (f *FaultStore) WithTx(fn func(tx store.StoreInterface) error) error {
+	return f.StoreInterface.WithTx(func(tx store.StoreInterface) error {
+		return fn(&FaultStore{StoreInterface: tx, FailOn: f.FailOn})
+	})
+}
+
+// WithContext keeps the view wrapped so injected failures still apply to it.
+func (f *FaultStore) WithContext(ctx context.Context) store.StoreInterface {
+	return &FaultStore{StoreInterface: f.StoreInterface.WithContext(ctx), FailOn: f.FailOn}
+}
+
+func (f *FaultStore) fail(method string) error {
+	if f.FailOn[method] {
+		return ErrInjected
+	}
+	return nil
+}
+
+func (f *FaultStore) CreateRoom(room *models.ChatRoom) error {
+	if err := f.fail("CreateRoom"); err != nil {
+		return err
+	}
+	return f.StoreInterface.CreateRoom(room)
+}
+
+func (f *FaultStore) AddRoomMember(member *models.RoomMember) error {
+	if err := f.fail("AddRoomMember"); err != nil {
+		return err
+	}
+	return f.StoreInterface.AddRoomMember(member)
+}
+
+func (f *FaultStore) UpdateRoomMember(member *models.RoomMember) error {
+	if err := f.fail("UpdateRoomMember"); err != nil {
+		return err
+	}
+	return f.StoreInterface.UpdateRoomMember(member)
+}
+
+func (f *FaultStore) RemoveRoomMember(roomID, userID string) error {
+	if err := f.fail("RemoveRoomMember"); err != nil {
+		return err
+	}
+	return f.StoreInterface.RemoveRoomMember(roomID, userID)
+}
+
+func (f *FaultStore) SaveMessage(message *models.Message) error {
+	if err := f.fail("SaveMessage"); err != nil {
+		return err
+	}
+	return f.StoreInterface.SaveMessage(message)
+}
+
+func (f *FaultStore) SaveMention(mention *models.MessageMention) error {
+	if err := f.fail("SaveMention"); err != nil {
+		return err
+	}
+	return f.StoreInterface.SaveMention(mention)
+}
+
+func (f *FaultStore) CreateBan(ban *models.RoomBan) error {
+	if err := f.fail("CreateBan"); err != nil {
+		return err
+	}
+	return f.StoreInterface.CreateBan(ban)
+}
+
+func (f *FaultStore) DeleteBan(roomID, userID string) error {
+	if err := f.fail("DeleteBan"); err != nil {
+		return err
+	}
+	return f.StoreInterface.DeleteBan(roomID, userID)
+}
+
+func (f *FaultStore) SaveModerationAction(action *models.ModerationAction) error {
+	if err := f.fail("SaveModerationAction"); err != nil {
+		return err
+	}
+	return f.StoreInterface.SaveModerationAction(action)
+}
+
+func (f *FaultStore) DeleteUser(id string) error {
+	if err := f.fail("DeleteUser"); err != nil {
+		return err
+	}
+	return f.StoreInterface.DeleteUser(id)
+}
+
+func (f *FaultStore) DeleteRoom(roomID string) error {
+	if err := f.fail("DeleteRoom"); err != nil {
+		return err
+	}
+	return f.StoreInterface.DeleteRoom(roomID)
+}
@@ -0,0 +1,1148 @@
+// Package storetest provides a conformance suite that every
+// store.StoreInterface implementation must pass.
+package storetest
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Factory returns a new, empty and migrated store. The suite closes it.
+type Factory func(t *testing.T) store.StoreInterface
+
+// Run executes the conformance suite against stores created by newStore.
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s store.StoreInterface)
+	}{
+		{"CreateAndGetUser", testCreateAndGetUser},
+		{"DuplicateUsername", testDuplicateUsername},
+		{"UnknownUser", testUnknownUser},
+		{"DuplicateUserID", testDuplicateUserID},
+		{"ReturnedUserIsCopy", testReturnedUserIsCopy},
+		{"DuplicateRoomName", testDuplicateRoomName},
+		{"RoomOwnerMustExist", testRoomOwnerMustExist},
+		{"RoomVisibility", testRoomVisibility},
+		{"RoomsOrderedByName", testRoomsOrderedByName},
+		{"DuplicateMembership", testDuplicateMembership},
+		{"MembershipRequiresRoomAndUser", testMembershipRequiresRoomAndUser},
+		{"MessagesOrderedByTimestamp", testMessagesOrdered},
+		{"MessagesSince", testMessagesSince},
+		{"EmptyRoomHasNoMessages", testEmptyRoomHasNoMessages},
+		{"MessageRequiresRoomAndSender", testMessageRequiresRoomAndSender},
+		{"DuplicateMessageID", testDuplicateMessageID},
+		{"GetByID", testGetByID},
+		{"UpdateAndRemoveMember", testUpdateAndRemoveMember},
+		{"ListMembersAndCountMessages", testListMembersAndCountMessages},
+		{"Mentions", testMentions},
+		{"MemberRoleAndMute", testMemberRoleAndMute},
+		{"Bans", testBans},
+		{"ModerationLog", testModerationLog},
+		{"HeldMessages", testHeldMessages},
+		{"Reports", testReports},
+		{"GetAndDeleteMessage", testGetAndDeleteMessage},
+		{"Blocks", testBlocks},
+		{"RoomHistoryHidesBlockedSenders", testRoomHistory},
+		{"ListAndUpdateUsers", testListAndUpdateUsers},
+		{"DeleteUser", testDeleteUser},
+		{"ListAndUpdateRooms", testListAndUpdateRooms},
+		{"DeleteRoom", testDeleteRoom},
+		{"TxCommit", testTxCommit},
+		{"TxRollback", testTxRollback},
+		{"TxRollbackOnPanic", testTxRollbackOnPanic},
+		{"TxRollbackRestoresChanges", testTxRollbackRestoresChanges},
+		{"WithContextSharesData", testWithContext},
+		{"PingAndMigrations", testPingAndMigrations},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newStore(t)
+			t.Cleanup(func() { s.Close() })
+			tc.fn(t, s)
+		})
+	}
+}
+
+// mustCreateUser inserts a user with a random ID and fails the test on error.
+func mustCreateUser(t *testing.T, s store.StoreInterface, username string) *models.User {
+	t.Helper()
+	user := &models.User{ID: uuid.NewString(), Username: username, Password: "hash"}
+	if err := s.CreateUser(user); err != nil {
+		t.Fatalf("CreateUser(%q): %v", username, err)
+	}
+	return user
+}
+
+// mustCreateRoom inserts a room owned by owner and fails the test on error.
+func mustCreateRoom(t *testing.T, s store.StoreInterface, name string, owner *models.User, roomType string) *models.ChatRoom {
+	t.Helper()
+	room := &models.ChatRoom{ID: uuid.NewString(), Name: name, OwnerID: owner.ID, RoomType: roomType}
+	if err := s.CreateRoom(room); err != nil {
+		t.Fatalf("CreateRoom(%q): %v", name, err)
+	}
+	return room
+}
+
+// mustSaveMessage inserts a message sent at ts and fails the test on error.
+func mustSaveMessage(t *testing.T, s store.StoreInterface, room *models.ChatRoom, sender *models.User, content string, ts time.Time) *models.Message {
+	t.Helper()
+	msg := &models.Message{ID: uuid.NewString(), RoomID: room.ID, SenderID: sender.ID, Content: content, Timestamp: ts}
+	if err := s.SaveMessage(msg); err != nil {
+		t.Fatalf("SaveMessage(%q): %v", content, err)
+	}
+	return msg
+}
+
+func testCreateAndGetUser(t *testing.T, s store.StoreInterface) {
+	created := mustCreateUser(t, s, "alice")
+
+	got, err := s.GetUserByUsername("alice")
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	if got.ID != created.ID || got.Username != "alice" || got.Password != "hash" {
+		t.Fatalf("GetUserByUsername = %+v, want %+v", got, created)
+	}
+}
+
+func testDuplicateUsername(t *testing.T, s store.StoreInterface) {
+	mustCreateUser(t, s, "alice")
+
+	err := s.CreateUser(&models.User{ID: uuid.NewString(), Username: "alice", Password: "other"})
+	assertConflict(t, err, "username")
+}
+
+func testUnknownUser(t *testing.T, s store.StoreInterface) {
+	user, err := s.GetUserByUsername("nobody")
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("GetUserByUsername(unknown) = %+v, %v; want ErrNotFound", user, err)
+	}
+}
+
+func testDuplicateUserID(t *testing.T, s store.StoreInterface) {
+	alice := mustCreateUser(t, s, "alice")
+
+	err := s.CreateUser(&models.User{ID: alice.ID, Username: "bob", Password: "hash"})
+	assertConflict(t, err, "id")
+	if _, err := s.GetUserByUsername("bob"); err == nil {
+		t.Fatal("failed CreateUser left user bob behind")
+	}
+}
+
+func testReturnedUserIsCopy(t *testing.T, s store.StoreInterface) {
+	mustCreateUser(t, s, "alice")
+
+	got, err := s.GetUserByUsername("alice")
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	got.Password = "changed"
+
+	again, err := s.GetUserByUsername("alice")
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	if again.Password != "hash" {
+		t.Fatal("modifying a returned user changed the stored user")
+	}
+}
+
+func testDuplicateRoomName(t *testing.T, s store.StoreInterface) {
+	owner := mustCreateUser(t, s, "owner")
+	mustCreateRoom(t, s, "lobby", owner, "public")
+
+	err := s.CreateRoom(&models.ChatRoom{ID: uuid.NewString(), Name: "lobby", OwnerID: owner.ID, RoomType: "public"})
+	assertConflict(t, err, "name")
+}
+
+func testRoomOwnerMustExist(t *testing.T, s store.StoreInterface) {
+	err := s.CreateRoom(&models.ChatRoom{ID: uuid.NewString(), Name: "orphan", OwnerID: uuid.NewString(), RoomType: "public"})
+	assertNotFound(t, err)
+}
+
+func testRoomVisibility(t *testing.T, s store.StoreInterface) {
+	owner := mustCreateUser(t, s, "owner")
+	member := mustCreateUser(t, s, "member")
+	outsider := mustCreateUser(t, s, "outsider")
+
+	public := mustCreateRoom(t, s, "lobby", owner, "public")
+	private := mustCreateRoom(t, s, "secret", owner, "private")
+	for _, m := range []*models.RoomMember{
+		{RoomID: private.ID, UserID: owner.ID, Status: "member"},
+		{RoomID: private.ID, UserID: member.ID, Status: "member"},
+	} {
+		if err := s.AddRoomMember(m); err != nil {
+			t.Fatalf("AddRoomMember: %v", err)
+		}
+	}
+
+	assertRooms := func(user *models.User, want ...string) {
+		t.Helper()
+		rooms, err := s.GetRoomsByUserID(user.ID)
+		if err != nil {
+			t.Fatalf("GetRoomsByUserID(%s): %v", user.Username, err)
+		}
+		got := make(map[string]bool)
+		for _, r := range rooms {
+			if got[r.ID] {
+				t.Fatalf("GetRoomsByUserID(%s) returned room %s twice", user.Username, r.Name)
+			}
+			got[r.ID] = true
+		}
+		if len(got) != len(want) {
+			t.Fatalf("GetRoomsByUserID(%s) returned %d rooms, want %d", user.Username, len(got), len(want))
+		}
+		for _, id := range want {
+			if !got[id] {
+				t.Fatalf("GetRoomsByUserID(%s) missing room %s", user.Username, id)
+			}
+		}
+	}
+
+	assertRooms(member, public.ID, private.ID)
+	assertRooms(outsider, public.ID)
+}
+
+func testRoomsOrderedByName(t *testing.T, s store.StoreInterface) {
+	owner := mustCreateUser(t, s, "owner")
+	for _, name := range []string{"charlie", "alpha", "bravo"} {
+		mustCreateRoom(t, s, name, owner, "public")
+	}
+
+	rooms, err := s.GetRoomsByUserID(owner.ID)
+	if err != nil {
+		t.Fatalf("GetRoomsByUserID: %v", err)
+	}
+	var names []string
+	for _, r := range rooms {
+		names = append(names, r.Name)
+	}
+	if len(names) != 3 || names[0] != "alpha" || names[1] != "bravo" || names[2] != "charlie" {
+		t.Fatalf("rooms = %v, want [alpha bravo charlie]", names)
+	}
+}
+
+func testDuplicateMembership(t *testing.T, s store.StoreInterface) {
+	owner := mustCreateUser(t, s, "owner")
+	room := mustCreateRoom(t, s, "secret", owner, "private")
+
+	member := &models.RoomMember{RoomID: room.ID, UserID: owner.ID, Status: "member"}
+	if err := s.AddRoomMember(member); err != nil {
+		t.Fatalf("AddRoomMember: %v", err)
+	}
+	assertConflict(t, s.AddRoomMember(member), "room_id")
+}
+
+func testMembershipRequiresRoomAndUser(t *testing.T, s store.StoreInterface) {
+	owner := mustCreateUser(t, s, "owner")
+	room := mustCreateRoom(t, s, "secret", owner, "private")
+
+	assertNotFound(t, s.AddRoomMember(&models.RoomMember{RoomID: uuid.NewString(), UserID: owner.ID, Status: "member"}))
+	assertNotFound(t, s.AddRoomMember(&models.RoomMember{RoomID: room.ID, UserID: uuid.NewString(), Status: "member"}))
+
+	// A pending member must not see the private room
+	pending := mustCreateUser(t, s, "pending")
+	if err := s.AddRoomMember(&models.RoomMember{RoomID: room.ID, UserID: pending.ID, Status: "pending"}); err != nil {
+		t.Fatalf("AddRoomMember: %v", err)
+	}
+	rooms, err := s.GetRoomsByUserID(pending.ID)
+	if err != nil {
+		t.Fatalf("GetRoomsByUserID: %v", err)
+	}
+	if len(rooms) != 0 {
+		t.Fatalf("pending member sees %d rooms, want 0", len(rooms))
+	}
+}
+
+func testMessagesOrdered(t *testing.T, s store.StoreInterface) {
+	user := mustCreateUser(t, s, "alice")
+	room := mustCreateRoom(t, s, "lobby", user, "public")
+	other := mustCreateRoom(t, s, "other", user, "public")
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	// Saved out of order on purpose
+	mustSaveMessage(t, s, room, user, "second", base.Add(2*time.Second))
+	mustSaveMessage(t, s, room, user, "first", base.Add(time.Second))
+	mustSaveMessage(t, s, other, user, "elsewhere", base)
+	mustSaveMessage(t, s, room, user, "third", base.Add(3*time.Second))
+
+	messages, err := s.GetMessagesByRoom(room.ID)
+	if err != nil {
+		t.Fatalf("GetMessagesByRoom: %v", err)
+	}
+	assertContents(t, messages, "first", "second", "third")
+	if !messages[0].Timestamp.Equal(base.Add(time.Second)) {
+		t.Fatalf("timestamp = %v, want %v", messages[0].Timestamp, base.Add(time.Second))
+	}
+}
+
+func testMessagesSince(t *testing.T, s store.StoreInterface) {
+	user := mustCreateUser(t, s, "alice")
+	room := mustCreateRoom(t, s, "lobby", user, "public")
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	mustSaveMessage(t, s, room, user, "old", base)
+	mustSaveMessage(t, s, room, user, "boundary", base.Add(time.Second))
+	mustSaveMessage(t, s, room, user, "new", base.Add(2*time.Second))
+
+	messages, err := s.GetMessagesSince(room.ID, base.Add(time.Second))
+	if err != nil {
+		t.Fatalf("GetMessagesSince: %v", err)
+	}
+	assertContents(t, messages, "new")
+}
+
+func testEmptyRoomHasNoMessages(t *testing.T, s store.StoreInterface) {
+	user := mustCreateUser(t, s, "alice")
+	room := mustCreateRoom(t, s, "lobby", user, "public")
+
+	messages, err := s.GetMessagesByRoom(room.ID)
+	if err != nil {
+		t.Fatalf("GetMessagesByRoom: %v", err)
+	}
+	if len(messages) != 0 {
+		t.Fatalf("got %d messages, want 0", len(messages))
+	}
+}
+
+func testMessageRequiresRoomAndSender(t *testing.T, s store.StoreInterface) {
+	user := mustCreateUser(t, s, "alice")
+	room := mustCreateRoom(t, s, "lobby", user, "public")
+
+	err := s.SaveMessage(&models.Message{ID: uuid.NewString(), RoomID: uuid.NewString(), SenderID: user.ID, Content: "hi", Timestamp: time.Now()})
+	assertNotFound(t, err)
+	err = s.SaveMessage(&models.Message{ID: uuid.NewString(), RoomID: room.ID, SenderID: uuid.NewString(), Content: "hi", Timestamp: time.Now()})
+	assertNotFound(t, err)
+}
+
+func testDuplicateMessageID(t *testing.T, s store.StoreInterface) {
+	user := mustCreateUser(t, s, "alice")
+	room := mustCreateRoom(t, s, "lobby", user, "public")
+	msg := mustSaveMessage(t, s, room, user, "hello", time.Now())
+
+	assertConflict(t, s.SaveMessage(msg), "id")
+}
+
+func testGetByID(t *testing.T, s store.StoreInterface) {
+	user := mustCreateUser(t, s, "alice")
+	room := mustCreateRoom(t, s, "lobby", user, "private")
+
+	gotUser, err := s.GetUserByID(user.ID)
+	if err != nil || gotUser.Username != "alice" {
+		t.Fatalf("GetUserByID = %+v, %v", gotUser, err)
+	}
+	gotRoom, err := s.GetRoomByID(room.ID)
+	if err != nil || gotRoom.Name != "lobby" || gotRoom.OwnerID != user.ID || gotRoom.RoomType != "private" {
+		t.Fatalf("GetRoomByID = %+v, %v", gotRoom, err)
+	}
+
+	_, err = s.GetUserByID(uuid.NewString())
+	assertNotFound(t, err)
+	_, err = s.GetRoomByID(uuid.NewString())
+	assertNotFound(t, err)
+}
+
+func testUpdateAndRemoveMember(t *testing.T, s store.StoreInterface) {
+	owner := mustCreateUser(t, s, "owner")
+	room := mustCreateRoom(t, s, "secret", owner, "private")
+
+	_, err := s.GetRoomMember(room.ID, owner.ID)
+	assertNotFound(t, err)
+	assertNotFound(t, s.UpdateRoomMember(&models.RoomMember{RoomID: room.ID, UserID: owner.ID, Status: "member"}))
+	assertNotFound(t, s.RemoveRoomMember(room.ID, owner.ID))
+
+	if err := s.AddRoomMember(&models.RoomMember{RoomID: room.ID, UserID: owner.ID, Status: "pending"}); err != nil {
+		t.Fatalf("AddRoomMember: %v", err)
+	}
+	if err := s.UpdateRoomMember(&models.RoomMember{RoomID: room.ID, UserID: owner.ID, Status: "member"}); err != nil {
+		t.Fatalf("UpdateRoomMember: %v", err)
+	}
+	member, err := s.GetRoomMember(room.ID, owner.ID)
+	if err != nil || member.Status != "member" {
+		t.Fatalf("GetRoomMember = %+v, %v; want status member", member, err)
+	}
+
+	if err := s.RemoveRoomMember(room.ID, owner.ID); err != nil {
+		t.Fatalf("RemoveRoomMember: %v", err)
+	}
+	_, err = s.GetRoomMember(room.ID, owner.ID)
+	assertNotFound(t, err)
+}
+
+func testListMembersAndCountMessages(t *testing.T, s store.StoreInterface) {
+	owner := mustCreateUser(t, s, "owner")
+	guest := mustCreateUser(t, s, "guest")
+	room := mustCreateRoom(t, s, "lobby", owner, "public")
+	empty := mustCreateRoom(t, s, "empty", owner, "public")
+
+	for _, user := range []*models.User{owner, guest} {
+		if err := s.AddRoomMember(&models.RoomMember{RoomID: room.ID, UserID: user.ID, Status: "member", Role: "member"}); err != nil {
+			t.Fatalf("AddRoomMember: %v", err)
+		}
+	}
+	members, err := s.GetRoomMembers(room.ID)
+	if err != nil || len(members) != 2 {
+		t.Fatalf("GetRoomMembers = %d members, %v; want 2", len(members), err)
+	}
+	if members[0].UserID > members[1].UserID {
+		t.Errorf("members not ordered by user ID: %s, %s", members[0].UserID, members[1].UserID)
+	}
+	if members, err := s.GetRoomMembers(empty.ID); err != nil || len(members) != 0 {
+		t.Errorf("GetRoomMembers(empty) = %v, %v; want none", members, err)
+	}
+
+	now := time.Now()
+	mustSaveMessage(t, s, room, owner, "one", now)
+	mustSaveMessage(t, s, room, guest, "two", now.Add(time.Second))
+	if count, err := s.CountMessages(room.ID); err != nil || count != 2 {
+		t.Errorf("CountMessages = %d, %v; want 2", count, err)
+	}
+	if count, err := s.CountMessages(empty.ID); err != nil || count != 0 {
+		t.Errorf("CountMessages(empty) = %d, %v; want 0", count, err)
+	}
+}
+
+func testMentions(t *testing.T, s store.StoreInterface) {
+	alice := mustCreateUser(t, s, "alice")
+	bob := mustCreateUser(t, s, "bob")
+	room := mustCreateRoom(t, s, "lobby", alice, "public")
+	msg := mustSaveMessage(t, s, room, alice, "hi @bob", time.Now())
+
+	if err := s.SaveMention(&models.MessageMention{MessageID: msg.ID, UserID: bob.ID}); err != nil {
+		t.Fatalf("SaveMention: %v", err)
+	}
+	assertConflict(t, s.SaveMention(&models.MessageMention{MessageID: msg.ID, UserID: bob.ID}), "message_id")
+	assertNotFound(t, s.SaveMention(&models.MessageMention{MessageID: uuid.NewString(), UserID: bob.ID}))
+
+	mentions, err := s.GetMentionsByMessage(msg.ID)
+	if err != nil {
+		t.Fatalf("GetMentionsByMessage: %v", err)
+	}
+	if len(mentions) != 1 || mentions[0].UserID != bob.ID {
+		t.Fatalf("mentions = %+v, want bob", mentions)
+	}
+}
+
+func testMemberRoleAndMute(t *testing.T, s store.StoreInterface) {
+	owner := mustCreateUser(t, s, "owner")
+	room := mustCreateRoom(t, s, "lobby", owner, "public")
+
+	member := &models.RoomMember{RoomID: room.ID, UserID: owner.ID, Status: "member", Role: "owner"}
+	if err := s.AddRoomMember(member); err != nil {
+		t.Fatalf("AddRoomMember: %v", err)
+	}
+	got, err := s.GetRoomMember(room.ID, owner.ID)
+	if err != nil || got.Role != "owner" || got.MutedUntil != nil {
+		t.Fatalf("GetRoomMember = %+v, %v; want owner, not muted", got, err)
+	}
+
+	mutedUntil := time.Now().Add(time.Hour).Truncate(time.Second)
+	member.Role = "moderator"
+	member.MutedUntil = &mutedUntil
+	if err := s.UpdateRoomMember(member); err != nil {
+		t.Fatalf("UpdateRoomMember: %v", err)
+	}
+	got, err = s.GetRoomMember(room.ID, owner.ID)
+	if err != nil || got.Role != "moderator" || got.MutedUntil == nil || !got.MutedUntil.Equal(mutedUntil) {
+		t.Fatalf("GetRoomMember = %+v, %v; want moderator muted until %v", got, err, mutedUntil)
+	}
+
+	member.MutedUntil = nil
+	if err := s.UpdateRoomMember(member); err != nil {
+		t.Fatalf("UpdateRoomMember: %v", err)
+	}
+	got, err = s.GetRoomMember(room.ID, owner.ID)
+	if err != nil || got.MutedUntil != nil {
+		t.Fatalf("GetRoomMember = %+v, %v; want mute cleared", got, err)
+	}
+}
+
+func testBans(t *testing.T, s store.StoreInterface) {
+	owner := mustCreateUser(t, s, "owner")
+	troll := mustCreateUser(t, s, "troll")
+	room := mustCreateRoom(t, s, "lobby", owner, "public")
+
+	_, err := s.GetBan(room.ID, troll.ID)
+	assertNotFound(t, err)
+	assertNotFound(t, s.DeleteBan(room.ID, troll.ID))
+
+	ban := &models.RoomBan{RoomID: room.ID, UserID: troll.ID, BannedBy: owner.ID, Reason: "spam", CreatedAt: time.Now()}
+	if err := s.CreateBan(ban); err != nil {
+		t.Fatalf("CreateBan: %v", err)
+	}
+	assertConflict(t, s.CreateBan(ban), "room_id")
+	assertNotFound(t, s.CreateBan(&models.RoomBan{RoomID: uuid.NewString(), UserID: troll.ID, BannedBy: owner.ID, CreatedAt: time.Now()}))
+
+	got, err := s.GetBan(room.ID, troll.ID)
+	if err != nil || got.BannedBy != owner.ID || got.Reason != "spam" {
+		t.Fatalf("GetBan = %+v, %v", got, err)
+	}
+
+	if err := s.DeleteBan(room.ID, troll.ID); err != nil {
+		t.Fatalf("DeleteBan: %v", err)
+	}
+	_, err = s.GetBan(room.ID, troll.ID)
+	assertNotFound(t, err)
+}
+
+func testModerationLog(t *testing.T, s store.StoreInterface) {
+	owner := mustCreateUser(t, s, "owner")
+	troll := mustCreateUser(t, s, "troll")
+	room := mustCreateRoom(t, s, "lobby", owner, "public")
+	other := mustCreateRoom(t, s, "other", owner, "public")
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	expiresAt := base.Add(10 * time.Minute)
+	entries := []*models.ModerationAction{
+		{ID: uuid.NewString(), RoomID: room.ID, ActorID: owner.ID, TargetID: troll.ID, Action: "mute", ExpiresAt: &expiresAt, CreatedAt: base},
+		{ID: uuid.NewString(), RoomID: room.ID, ActorID: owner.ID, TargetID: troll.ID, Action: "ban", Reason: "spam", ReportID: "report-1", CreatedAt: base.Add(time.Minute)},
+		{ID: uuid.NewString(), RoomID: other.ID, ActorID: owner.ID, TargetID: troll.ID, Action: "kick", CreatedAt: base},
+	}
+	for _, entry := range entries {
+		if err := s.SaveModerationAction(entry); err != nil {
+			t.Fatalf("SaveModerationAction: %v", err)
+		}
+	}
+	assertConflict(t, s.SaveModerationAction(entries[0]), "id")
+
+	log, err := s.GetModerationLog(room.ID)
+	if err != nil {
+		t.Fatalf("GetModerationLog: %v", err)
+	}
+	if len(log) != 2 || log[0].Action != "ban" || log[1].Action != "mute" {
+		t.Fatalf("log = %+v, want ban then mute", log)
+	}
+	if log[0].Reason != "spam" || log[0].ExpiresAt != nil || log[0].ReportID != "report-1" {
+		t.Fatalf("ban entry = %+v", log[0])
+	}
+	if log[1].ExpiresAt == nil || !log[1].ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("mute entry expires at %v, want %v", log[1].ExpiresAt, expiresAt)
+	}
+}
+
+func testHeldMessages(t *testing.T, s store.StoreInterface) {
+	owner := mustCreateUser(t, s, "owner")
+	troll := mustCreateUser(t, s, "troll")
+	room := mustCreateRoom(t, s, "lobby", owner, "public")
+	other := mustCreateRoom(t, s, "other", owner, "public")
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	held := []*models.HeldMessage{
+		{ID: uuid.NewString(), RoomID: room.ID, SenderID: troll.ID, Content: "second", Reason: "spam", CreatedAt: base.Add(time.Minute)},
+		{ID: uuid.NewString(), RoomID: room.ID, SenderID: troll.ID, Content: "first", CreatedAt: base},
+		{ID: uuid.NewString(), RoomID: other.ID, SenderID: troll.ID, Content: "elsewhere", CreatedAt: base},
+	}
+	for _, h := range held {
+		if err := s.SaveHeldMessage(h); err != nil {
+			t.Fatalf("SaveHeldMessage: %v", err)
+		}
+	}
+	assertConflict(t, s.SaveHeldMessage(held[0]), "id")
+	assertNotFound(t, s.SaveHeldMessage(&models.HeldMessage{ID: uuid.NewString(), RoomID: uuid.NewString(), SenderID: troll.ID, CreatedAt: base}))
+
+	got, err := s.GetHeldMessage(held[0].ID)
+	if err != nil || got.Content != "second" || got.Reason != "spam" || !got.CreatedAt.Equal(base.Add(time.Minute)) {
+		t.Fatalf("GetHeldMessage = %+v, %v", got, err)
+	}
+
+	queue, err := s.GetHeldMessagesByRoom(room.ID)
+	if err != nil || len(queue) != 2 || queue[0].Content != "first" || queue[1].Content != "second" {
+		t.Fatalf("GetHeldMessagesByRoom = %+v, %v; want first, second", queue, err)
+	}
+
+	if err := s.DeleteHeldMessage(held[1].ID); err != nil {
+		t.Fatalf("DeleteHeldMessage: %v", err)
+	}
+	assertNotFound(t, s.DeleteHeldMessage(held[1].ID))
+	_, err = s.GetHeldMessage(held[1].ID)
+	assertNotFound(t, err)
+
+	// Held messages go with their room and their sender
+	if err := s.DeleteRoom(other.ID); err != nil {
+		t.Fatalf("DeleteRoom: %v", err)
+	}
+	_, err = s.GetHeldMessage(held[2].ID)
+	assertNotFound(t, err)
+	if err := s.DeleteUser(troll.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	_, err = s.GetHeldMessage(held[0].ID)
+	assertNotFound(t, err)
+}
+
+func testReports(t *testing.T, s store.StoreInterface) {
+	owner := mustCreateUser(t, s, "owner")
+	alice := mustCreateUser(t, s, "alice")
+	troll := mustCreateUser(t, s, "troll")
+	room := mustCreateRoom(t, s, "lobby", owner, "public")
+	other := mustCreateRoom(t, s, "other", owner, "public")
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	msg := mustSaveMessage(t, s, room, troll, "buy now", base)
+	newReport := func(reporter *models.User, r *models.ChatRoom, createdAt time.Time) *models.MessageReport {
+		return &models.MessageReport{
+			ID: uuid.NewString(), MessageID: msg.ID, RoomID: r.ID, ReporterID: reporter.ID, SenderID: troll.ID,
+			Category: "spam", Content: msg.Content, SentAt: msg.Timestamp, Status: "open", CreatedAt: createdAt,
+		}
+	}
+	reports := []*models.MessageReport{
+		newReport(alice, room, base.Add(2*time.Minute)),
+		newReport(owner, room, base.Add(time.Minute)),
+		newReport(alice, other, base),
+	}
+	reports[0].Details = "ads"
+	for _, r := range reports[:2] {
+		if err := s.CreateReport(r); err != nil {
+			t.Fatalf("CreateReport: %v", err)
+		}
+	}
+	// The same user cannot report the same message twice
+	assertConflict(t, s.CreateReport(reports[2]), "message_id")
+	reports[2].MessageID = uuid.NewString()
+	if err := s.CreateReport(reports[2]); err != nil {
+		t.Fatalf("CreateReport: %v", err)
+	}
+
+	got, err := s.GetReport(reports[0].ID)
+	if err != nil || got.Details != "ads" || got.Content != "buy now" || !got.SentAt.Equal(base) || got.ResolvedAt != nil {
+		t.Fatalf("GetReport = %+v, %v", got, err)
+	}
+
+	resolvedAt := base.Add(time.Hour)
+	got.Status = "resolved"
+	got.Resolution = "ban"
+	got.ResolvedBy = owner.ID
+	got.ResolvedAt = &resolvedAt
+	if err := s.UpdateReport(got); err != nil {
+		t.Fatalf("UpdateReport: %v", err)
+	}
+	assertNotFound(t, s.UpdateReport(&models.MessageReport{ID: uuid.NewString()}))
+
+	open, err := s.ListReports(room.ID, "open")
+	if err != nil || len(open) != 1 || open[0].ID != reports[1].ID {
+		t.Fatalf("ListReports(room, open) = %+v, %v; want the owner's report", open, err)
+	}
+	all, err := s.ListReports("", "")
+	if err != nil || len(all) != 3 || all[0].ID != reports[2].ID || all[2].ID != reports[0].ID {
+		t.Fatalf("ListReports = %+v, %v; want all three, oldest first", all, err)
+	}
+	if all[2].Status != "resolved" || all[2].ResolvedBy != owner.ID || all[2].ResolvedAt == nil || !all[2].ResolvedAt.Equal(resolvedAt) {
+		t.Fatalf("resolved report = %+v", all[2])
+	}
+
+	// Reports survive the message, but not the room or the reporter
+	if err := s.DeleteMessage(msg.ID); err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+	if _, err := s.GetReport(reports[1].ID); err != nil {
+		t.Fatalf("GetReport after DeleteMessage: %v", err)
+	}
+	if err := s.DeleteRoom(other.ID); err != nil {
+		t.Fatalf("DeleteRoom: %v", err)
+	}
+	_, err = s.GetReport(reports[2].ID)
+	assertNotFound(t, err)
+	if err := s.DeleteUser(alice.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	_, err = s.GetReport(reports[0].ID)
+	assertNotFound(t, err)
+}
+
+func testGetAndDeleteMessage(t *testing.T, s store.StoreInterface) {
+	owner := mustCreateUser(t, s, "owner")
+	room := mustCreateRoom(t, s, "lobby", owner, "public")
+	ts := time.Now().Add(-time.Minute).Truncate(time.Second)
+	msg := mustSaveMessage(t, s, room, owner, "hi @owner", ts)
+	mustSaveMessage(t, s, room, owner, "still here", ts.Add(time.Second))
+	if err := s.SaveMention(&models.MessageMention{MessageID: msg.ID, UserID: owner.ID}); err != nil {
+		t.Fatalf("SaveMention: %v", err)
+	}
+
+	got, err := s.GetMessageByID(msg.ID)
+	if err != nil || got.Content != "hi @owner" || got.RoomID != room.ID || !got.Timestamp.Equal(ts) {
+		t.Fatalf("GetMessageByID = %+v, %v", got, err)
+	}
+	_, err = s.GetMessageByID(uuid.NewString())
+	assertNotFound(t, err)
+
+	if err := s.DeleteMessage(msg.ID); err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+	assertNotFound(t, s.DeleteMessage(msg.ID))
+	_, err = s.GetMessageByID(msg.ID)
+	assertNotFound(t, err)
+	if mentions, err := s.GetMentionsByMessage(msg.ID); err != nil || len(mentions) != 0 {
+		t.Fatalf("mentions after DeleteMessage = %+v, %v; want none", mentions, err)
+	}
+	messages, err := s.GetMessagesByRoom(room.ID)
+	if err != nil {
+		t.Fatalf("GetMessagesByRoom: %v", err)
+	}
+	assertContents(t, messages, "still here")
+}
+
+func testBlocks(t *testing.T, s store.StoreInterface) {
+	alice := mustCreateUser(t, s, "alice")
+	bob := mustCreateUser(t, s, "bob")
+	carol := mustCreateUser(t, s, "carol")
+
+	_, err := s.GetBlock(alice.ID, bob.ID)
+	assertNotFound(t, err)
+	assertNotFound(t, s.DeleteBlock(alice.ID, bob.ID))
+
+	base := time.Now().Add(-time.Minute)
+	for i, blocked := range []*models.User{carol, bob} {
+		if err := s.CreateBlock(&models.UserBlock{BlockerID: alice.ID, BlockedID: blocked.ID, CreatedAt: base.Add(time.Duration(i) * time.Second)}); err != nil {
+			t.Fatalf("CreateBlock(%s): %v", blocked.Username, err)
+		}
+	}
+	assertConflict(t, s.CreateBlock(&models.UserBlock{BlockerID: alice.ID, BlockedID: bob.ID, CreatedAt: time.Now()}), "blocker_id")
+	assertNotFound(t, s.CreateBlock(&models.UserBlock{BlockerID: alice.ID, BlockedID: uuid.NewString(), CreatedAt: time.Now()}))
+
+	// Blocks are one-way
+	_, err = s.GetBlock(bob.ID, alice.ID)
+	assertNotFound(t, err)
+	if got, err := s.GetBlock(alice.ID, bob.ID); err != nil || got.BlockedID != bob.ID {
+		t.Fatalf("GetBlock = %+v, %v", got, err)
+	}
+	blocks, err := s.GetBlocksByUser(alice.ID)
+	if err != nil || len(blocks) != 2 || blocks[0].BlockedID != carol.ID || blocks[1].BlockedID != bob.ID {
+		t.Fatalf("GetBlocksByUser = %+v, %v; want carol then bob", blocks, err)
+	}
+
+	if err := s.DeleteBlock(alice.ID, carol.ID); err != nil {
+		t.Fatalf("DeleteBlock: %v", err)
+	}
+	_, err = s.GetBlock(alice.ID, carol.ID)
+	assertNotFound(t, err)
+
+	// Deleting either user removes the block
+	if err := s.DeleteUser(bob.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if blocks, err := s.GetBlocksByUser(alice.ID); err != nil || len(blocks) != 0 {
+		t.Fatalf("GetBlocksByUser after DeleteUser = %+v, %v; want none", blocks, err)
+	}
+}
+
+func testRoomHistory(t *testing.T, s store.StoreInterface) {
+	alice := mustCreateUser(t, s, "alice")
+	bob := mustCreateUser(t, s, "bob")
+	troll := mustCreateUser(t, s, "troll")
+	room := mustCreateRoom(t, s, "lobby", alice, "public")
+
+	base := time.Now().Add(-time.Hour)
+	mustSaveMessage(t, s, room, alice, "one", base.Add(1*time.Second))
+	mustSaveMessage(t, s, room, troll, "two", base.Add(2*time.Second))
+	mustSaveMessage(t, s, room, bob, "three", base.Add(3*time.Second))
+
+	if err := s.CreateBlock(&models.UserBlock{BlockerID: alice.ID, BlockedID: troll.ID, CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateBlock: %v", err)
+	}
+
+	messages, err := s.GetRoomHistory(room.ID, alice.ID, models.MessageCursor{}, 0)
+	if err != nil {
+		t.Fatalf("GetRoomHistory: %v", err)
+	}
+	assertContents(t, messages, "one", "three")
+
+	messages, err = s.GetRoomHistory(room.ID, alice.ID, models.MessageCursor{Timestamp: base.Add(2 * time.Second)}, 0)
+	if err != nil {
+		t.Fatalf("GetRoomHistory since: %v", err)
+	}
+	assertContents(t, messages, "three")
+
+	// Other users still see everything
+	messages, err = s.GetRoomHistory(room.ID, bob.ID, models.MessageCursor{}, 0)
+	if err != nil {
+		t.Fatalf("GetRoomHistory: %v", err)
+	}
+	assertContents(t, messages, "one", "two", "three")
+
+	// Without since, a limit keeps the most recent messages, in order
+	mustSaveMessage(t, s, room, bob, "four", base.Add(4*time.Second))
+	mustSaveMessage(t, s, room, bob, "five", base.Add(5*time.Second))
+	messages, err = s.GetRoomHistory(room.ID, bob.ID, models.MessageCursor{}, 2)
+	if err != nil {
+		t.Fatalf("GetRoomHistory limit: %v", err)
+	}
+	assertContents(t, messages, "four", "five")
+
+	// With since, it keeps the first messages after since, so that clients
+	// can page forward from the last one they have
+	messages, err = s.GetRoomHistory(room.ID, bob.ID, models.MessageCursor{Timestamp: base.Add(1 * time.Second)}, 2)
+	if err != nil {
+		t.Fatalf("GetRoomHistory since with limit: %v", err)
+	}
+	assertContents(t, messages, "two", "three")
+	messages, err = s.GetRoomHistory(room.ID, bob.ID, cursor(messages[1]), 2)
+	if err != nil {
+		t.Fatalf("GetRoomHistory next page: %v", err)
+	}
+	assertContents(t, messages, "four", "five")
+
+	// Messages sent at the same time are paged through in ID order, without
+	// skipping any at a page boundary
+	same := base.Add(6 * time.Second)
+	var saved []*models.Message
+	for _, content := range []string{"six", "seven", "eight"} {
+		saved = append(saved, mustSaveMessage(t, s, room, bob, content, same))
+	}
+	sort.Slice(saved, func(i, j int) bool { return saved[i].ID < saved[j].ID })
+	messages, err = s.GetRoomHistory(room.ID, bob.ID, cursor(messages[1]), 2)
+	if err != nil {
+		t.Fatalf("GetRoomHistory same timestamp: %v", err)
+	}
+	assertContents(t, messages, saved[0].Content, saved[1].Content)
+	messages, err = s.GetRoomHistory(room.ID, bob.ID, cursor(messages[1]), 2)
+	if err != nil {
+		t.Fatalf("GetRoomHistory same timestamp, next page: %v", err)
+	}
+	assertContents(t, messages, saved[2].Content)
+}
+
+// cursor returns the history position of a message.
+func cursor(message *models.Message) models.MessageCursor {
+	return models.MessageCursor{Timestamp: message.Timestamp, ID: message.ID}
+}
+
+func testListAndUpdateUsers(t *testing.T, s store.StoreInterface) {
+	bob := mustCreateUser(t, s, "bob")
+	mustCreateUser(t, s, "alice")
+
+	users, err := s.ListUsers()
+	if err != nil || len(users) != 2 || users[0].Username != "alice" || users[1].Username != "bob" {
+		t.Fatalf("ListUsers = %+v, %v; want alice, bob", users, err)
+	}
+	if users[1].IsAdmin || users[1].Disabled {
+		t.Fatalf("new user = %+v, want not admin and not disabled", users[1])
+	}
+
+	bob.IsAdmin = true
+	bob.Disabled = true
+	bob.Password = "new-hash"
+	if err := s.UpdateUser(bob); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	got, err := s.GetUserByUsername("bob")
+	if err != nil || !got.IsAdmin || !got.Disabled || got.Password != "new-hash" {
+		t.Fatalf("GetUserByUsername = %+v, %v; want updated user", got, err)
+	}
+
+	assertNotFound(t, s.UpdateUser(&models.User{ID: uuid.NewString(), Username: "ghost"}))
+}
+
+func testDeleteUser(t *testing.T, s store.StoreInterface) {
+	owner := mustCreateUser(t, s, "owner")
+	bob := mustCreateUser(t, s, "bob")
+	room := mustCreateRoom(t, s, "lobby", owner, "public")
+	if err := s.AddRoomMember(&models.RoomMember{RoomID: room.ID, UserID: bob.ID, Status: "member", Role: "member"}); err != nil {
+		t.Fatalf("AddRoomMember: %v", err)
+	}
+	msg := mustSaveMessage(t, s, room, owner, "hi @bob", time.Now())
+	if err := s.SaveMention(&models.MessageMention{MessageID: msg.ID, UserID: bob.ID}); err != nil {
+		t.Fatalf("SaveMention: %v", err)
+	}
+	mustSaveMessage(t, s, room, bob, "hello", time.Now())
+
+	// Users with messages or rooms cannot be deleted
+	if err := s.DeleteUser(bob.ID); !errors.Is(err, store.ErrInUse) {
+		t.Fatalf("DeleteUser with messages = %v, want ErrInUse", err)
+	}
+	if err := s.DeleteUser(owner.ID); !errors.Is(err, store.ErrInUse) {
+		t.Fatalf("DeleteUser owning a room = %v, want ErrInUse", err)
+	}
+
+	if err := s.DeleteMessagesBySender(bob.ID); err != nil {
+		t.Fatalf("DeleteMessagesBySender: %v", err)
+	}
+	if err := s.DeleteUser(bob.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	assertNotFound(t, s.DeleteUser(bob.ID))
+
+	_, err := s.GetUserByUsername("bob")
+	assertNotFound(t, err)
+	_, err = s.GetRoomMember(room.ID, bob.ID)
+	assertNotFound(t, err)
+	if mentions, err := s.GetMentionsByMessage(msg.ID); err != nil || len(mentions) != 0 {
+		t.Fatalf("mentions after DeleteUser = %+v, %v; want none", mentions, err)
+	}
+	messages, err := s.GetMessagesByRoom(room.ID)
+	if err != nil {
+		t.Fatalf("GetMessagesByRoom: %v", err)
+	}
+	assertContents(t, messages, "hi @bob")
+
+	// The username is free again
+	mustCreateUser(t, s, "bob")
+}
+
+func testListAndUpdateRooms(t *testing.T, s store.StoreInterface) {
+	owner := mustCreateUser(t, s, "owner")
+	lobby := mustCreateRoom(t, s, "lobby", owner, "public")
+	mustCreateRoom(t, s, "attic", owner, "private")
+
+	rooms, err := s.ListRooms()
+	if err != nil || len(rooms) != 2 || rooms[0].Name != "attic" || rooms[1].Name != "lobby" {
+		t.Fatalf("ListRooms = %+v, %v; want attic, lobby", rooms, err)
+	}
+
+	lobby.Archived = true
+	if err := s.UpdateRoom(lobby); err != nil {
+		t.Fatalf("UpdateRoom: %v", err)
+	}
+	got, err := s.GetRoomByID(lobby.ID)
+	if err != nil || !got.Archived {
+		t.Fatalf("GetRoomByID = %+v, %v; want archived", got, err)
+	}
+
+	// Archived rooms are hidden from room lists but not from ListRooms
+	visible, err := s.GetRoomsByUserID(owner.ID)
+	if err != nil || len(visible) != 0 {
+		t.Fatalf("GetRoomsByUserID = %+v, %v; want no rooms", visible, err)
+	}
+	if rooms, err := s.ListRooms(); err != nil || len(rooms) != 2 {
+		t.Fatalf("ListRooms = %+v, %v; want 2 rooms", rooms, err)
+	}
+
+	lobby.Name = "attic"
+	assertConflict(t, s.UpdateRoom(lobby), "name")
+	assertNotFound(t, s.UpdateRoom(&models.ChatRoom{ID: uuid.NewString(), Name: "ghost", RoomType: "public"}))
+}
+
+func testDeleteRoom(t *testing.T, s store.StoreInterface) {
+	owner := mustCreateUser(t, s, "owner")
+	room := mustCreateRoom(t, s, "lobby", owner, "public")
+	other := mustCreateRoom(t, s, "other", owner, "public")
+	if err := s.AddRoomMember(&models.RoomMember{RoomID: room.ID, UserID: owner.ID, Status: "member", Role: "owner"}); err != nil {
+		t.Fatalf("AddRoomMember: %v", err)
+	}
+	msg := mustSaveMessage(t, s, room, owner, "hi @owner", time.Now())
+	if err := s.SaveMention(&models.MessageMention{MessageID: msg.ID, UserID: owner.ID}); err != nil {
+		t.Fatalf("SaveMention: %v", err)
+	}
+	mustSaveMessage(t, s, other, owner, "elsewhere", time.Now())
+
+	if err := s.DeleteRoom(room.ID); !errors.Is(err, store.ErrInUse) {
+		t.Fatalf("DeleteRoom with messages = %v, want ErrInUse", err)
+	}
+
+	if err := s.DeleteMessagesByRoom(room.ID); err != nil {
+		t.Fatalf("DeleteMessagesByRoom: %v", err)
+	}
+	if err := s.DeleteRoom(room.ID); err != nil {
+		t.Fatalf("DeleteRoom: %v", err)
+	}
+	assertNotFound(t, s.DeleteRoom(room.ID))
+
+	_, err := s.GetRoomByID(room.ID)
+	assertNotFound(t, err)
+	_, err = s.GetRoomMember(room.ID, owner.ID)
+	assertNotFound(t, err)
+	if mentions, err := s.GetMentionsByMessage(msg.ID); err != nil || len(mentions) != 0 {
+		t.Fatalf("mentions after DeleteRoom = %+v, %v; want none", mentions, err)
+	}
+	messages, err := s.GetMessagesByRoom(other.ID)
+	if err != nil {
+		t.Fatalf("GetMessagesByRoom: %v", err)
+	}
+	assertContents(t, messages, "elsewhere")
+
+	// The name is free again
+	mustCreateRoom(t, s, "lobby", owner, "public")
+}
+
+func testTxCommit(t *testing.T, s store.StoreInterface) {
+	err := s.WithTx(func(tx store.StoreInterface) error {
+		owner := mustCreateUser(t, tx, "owner")
+		room := mustCreateRoom(t, tx, "lobby", owner, "public")
+		// Nested WithTx joins the outer transaction
+		return tx.WithTx(func(inner store.StoreInterface) error {
+			return inner.AddRoomMember(&models.RoomMember{RoomID: room.ID, UserID: owner.ID, Status: "member"})
+		})
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+
+	owner, err := s.GetUserByUsername("owner")
+	if err != nil {
+		t.Fatalf("user not committed: %v", err)
+	}
+	rooms, err := s.GetRoomsByUserID(owner.ID)
+	if err != nil || len(rooms) != 1 {
+		t.Fatalf("rooms = %v, %v; want 1 committed room", rooms, err)
+	}
+	if _, err := s.GetRoomMember(rooms[0].ID, owner.ID); err != nil {
+		t.Fatalf("membership not committed: %v", err)
+	}
+}
+
+func testTxRollback(t *testing.T, s store.StoreInterface) {
+	owner := mustCreateUser(t, s, "owner")
+
+	var roomID string
+	err := s.WithTx(func(tx store.StoreInterface) error {
+		room := mustCreateRoom(t, tx, "lobby", owner, "public")
+		roomID = room.ID
+		// Fails: the owner cannot be added twice
+		if err := tx.AddRoomMember(&models.RoomMember{RoomID: room.ID, UserID: owner.ID, Status: "member"}); err != nil {
+			return err
+		}
+		return tx.AddRoomMember(&models.RoomMember{RoomID: room.ID, UserID: owner.ID, Status: "member"})
+	})
+	assertConflict(t, err, "room_id")
+
+	_, err = s.GetRoomByID(roomID)
+	assertNotFound(t, err)
+	_, err = s.GetRoomMember(roomID, owner.ID)
+	assertNotFound(t, err)
+
+	// The store is still usable and the name is free again
+	mustCreateRoom(t, s, "lobby", owner, "public")
+}
+
+func testTxRollbackOnPanic(t *testing.T, s store.StoreInterface) {
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("WithTx swallowed the panic")
+			}
+		}()
+		s.WithTx(func(tx store.StoreInterface) error {
+			mustCreateUser(t, tx, "ghost")
+			panic("boom")
+		})
+	}()
+
+	_, err := s.GetUserByUsername("ghost")
+	assertNotFound(t, err)
+}
+
+func testTxRollbackRestoresChanges(t *testing.T, s store.StoreInterface) {
+	owner := mustCreateUser(t, s, "owner")
+	bob := mustCreateUser(t, s, "bob")
+	room := mustCreateRoom(t, s, "lobby", owner, "public")
+	if err := s.AddRoomMember(&models.RoomMember{RoomID: room.ID, UserID: bob.ID, Status: "member", Role: "member"}); err != nil {
+		t.Fatalf("AddRoomMember: %v", err)
+	}
+	base := time.Now().Add(-time.Hour)
+	kept := mustSaveMessage(t, s, room, bob, "kept", base)
+
+	// Every kind of change is undone: updates, deletions and additions
+	errFailed := errors.New("failed")
+	err := s.WithTx(func(tx store.StoreInterface) error {
+		renamed := *room
+		renamed.Name = "renamed"
+		if err := tx.UpdateRoom(&renamed); err != nil {
+			return err
+		}
+		if err := tx.RemoveRoomMember(room.ID, bob.ID); err != nil {
+			return err
+		}
+		if err := tx.DeleteMessage(kept.ID); err != nil {
+			return err
+		}
+		mustSaveMessage(t, tx, room, owner, "added", base.Add(time.Second))
+		return errFailed
+	})
+	if !errors.Is(err, errFailed) {
+		t.Fatalf("WithTx = %v, want the function's error", err)
+	}
+
+	if got, err := s.GetRoomByID(room.ID); err != nil || got.Name != "lobby" {
+		t.Errorf("GetRoomByID = %+v, %v; want the room under its old name", got, err)
+	}
+	if _, err := s.GetRoomMember(room.ID, bob.ID); err != nil {
+		t.Errorf("GetRoomMember(bob): %v", err)
+	}
+	messages, err := s.GetMessagesByRoom(room.ID)
+	if err != nil {
+		t.Fatalf("GetMessagesByRoom: %v", err)
+	}
+	assertContents(t, messages, "kept")
+
+	// The new name was given back
+	mustCreateRoom(t, s, "renamed", owner, "public")
+}
+
+func testWithContext(t *testing.T, s store.StoreInterface) {
+	ctx, cancel := context.WithCancel(context.Background())
+	view := s.WithContext(ctx)
+	owner := mustCreateUser(t, view, "owner")
+	if _, err := s.GetUserByID(owner.ID); err != nil {
+		t.Fatalf("user created through the view not visible in the store: %v", err)
+	}
+
+	// Cancelling the caller's context does not stop the view's operations
+	cancel()
+	room := mustCreateRoom(t, view, "lobby", owner, "public")
+
+	// A view of a transaction belongs to the transaction
+	err := s.WithTx(func(tx store.StoreInterface) error {
+		return tx.WithContext(context.Background()).AddRoomMember(&models.RoomMember{RoomID: room.ID, UserID: owner.ID, Status: "member"})
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+	if _, err := s.GetRoomMember(room.ID, owner.ID); err != nil {
+		t.Fatalf("membership added through a transaction view not committed: %v", err)
+	}
+}
+
+func testPingAndMigrations(t *testing.T, s store.StoreInterface) {
+	ctx := context.Background()
+	if err := s.Ping(ctx); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	pending, err := s.PendingMigrations(ctx)
+	if err != nil {
+		t.Fatalf("PendingMigrations: %v", err)
+	}
+	if pending != 0 {
+		t.Fatalf("PendingMigrations = %d after migrating, want 0", pending)
+	}
+}
+
+// assertConflict checks that err is a store.ErrConflict on field.
+func assertConflict(t *testing.T, err error, field string) {
+	t.Helper()
+	if !errors.Is(err, store.ErrConflict) {
+		t.Fatalf("err = %v, want ErrConflict", err)
+	}
+	if got := store.ConflictField(err); got != field {
+		t.Fatalf("conflict field = %q, want %q", got, field)
+	}
+}
+
+// assertNotFound checks that err is a store.ErrNotFound.
+func assertNotFound(t *testing.T, err error) {
+	t.Helper()
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+}
+
+// assertContents checks that messages have exactly the given contents in order.
+func assertContents(t *testing.T, messages []*models.Message, want ...string) {
+	t.Helper()
+	if len(messages) != len(want) {
+		t.Fatalf("got %d messages, want %d", len(messages), len(want))
+	}
+	for i, msg := range messages {
+		if msg.Content != want[i] {
+			t.Fatalf("message %d = %q, want %q", i, msg.Content, want[i])
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Package tracing sets up OpenTelemetry tracing for the server. Spans are
+// started with the OpenTelemetry API, from the global tracer provider that
+// Setup installs, and trace context is propagated over HTTP with the W3C
+// traceparent header, so traces join up with those of other services.
+package tracing
+
+import (
+	"backend/internal/config"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer of the server's own spans.
+const instrumentationName = "backend"
+
+// Setup installs the tracer provider described by the configuration and
+// the W3C trace context propagator. The returned function exports the
+// spans that are still queued and stops the provider; it must be called
+// before the process exits. When tracing is off, spans are not recorded and
+// the function does nothing.
+func Setup(ctx context.Context, cfg *config.TracingConfig) (shutdown func(context.Context) error, err error) {
+	return setup(ctx, cfg, os.Stdout)
+}
+
+// setup is Setup with the stdout exporter writing to stdout.
+func setup(ctx context.Context, cfg *config.TracingConfig, stdout io.Writer) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch strings.ToLower(cfg.Exporter) {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx,
+			otlptracehttp.WithEndpointURL(strings.TrimSuffix(cfg.OTLPEndpoint, "/")+"/v1/traces"),
+			otlptracehttp.WithHeaders(cfg.OTLPHeaders))
+	case "stdout", "console":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(stdout))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q: use none, otlp or stdout", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", cfg.Exporter, err)
+	}
+
+	// Spans whose parent was sampled are always sampled, and those whose
+	// parent was not never are, so traces are kept or dropped whole
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(cfg.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start begins a span with the server's tracer as a child of ctx's current
+// span, or of the remote parent extracted into ctx, and returns a context
+// in which it is current. The caller must End the span.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// RecordError records err on span and marks the span as failed. A nil err
+// is ignored.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
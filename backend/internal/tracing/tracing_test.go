@@ -0,0 +1,148 @@
+package tracing
+
+import (
+	"backend/internal/config"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// setupForTest calls setup and restores the global tracer provider when the
+// test ends.
+func setupForTest(t *testing.T, cfg config.TracingConfig, stdout io.Writer) func(context.Context) error {
+	t.Helper()
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	shutdown, err := setup(context.Background(), &cfg, stdout)
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	return shutdown
+}
+
+func TestSetupStdout(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := config.Default().Tracing
+	cfg.Exporter = "stdout"
+	cfg.ServiceName = "chat-test"
+	shutdown := setupForTest(t, cfg, &buf)
+
+	_, span := Start(context.Background(), "one")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	var got struct {
+		Name     string
+		Resource []struct {
+			Key   string
+			Value struct{ Value any }
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid span JSON %s: %v", buf.String(), err)
+	}
+	if got.Name != "one" || len(got.Resource) != 1 || got.Resource[0].Key != "service.name" || got.Resource[0].Value.Value != "chat-test" {
+		t.Errorf("span = %+v", got)
+	}
+}
+
+func TestSetupOTLP(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if len(body) > 0 {
+			requests <- r
+		}
+	}))
+	defer srv.Close()
+
+	cfg := config.Default().Tracing
+	cfg.Exporter = "otlp"
+	cfg.OTLPEndpoint = srv.URL + "/"
+	cfg.OTLPHeaders = map[string]string{"Authorization": "Bearer x"}
+	shutdown := setupForTest(t, cfg, io.Discard)
+
+	_, span := Start(context.Background(), "db.query")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	select {
+	case r := <-requests:
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Authorization") != "Bearer x" {
+			t.Errorf("export went to %s with Authorization %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+	default:
+		t.Fatal("no spans were exported")
+	}
+}
+
+func TestSetupSamplesWholeTraces(t *testing.T) {
+	cfg := config.Default().Tracing
+	cfg.Exporter = "stdout"
+	cfg.SampleRatio = 0
+	shutdown := setupForTest(t, cfg, io.Discard)
+	defer shutdown(context.Background())
+
+	if _, span := Start(context.Background(), "new"); span.SpanContext().IsSampled() {
+		t.Error("new trace was sampled with a ratio of 0")
+	}
+
+	// A sampled caller decides for the whole trace
+	header := http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(header))
+	_, span := Start(ctx, "joined")
+	if !span.SpanContext().IsSampled() || span.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("span %v did not join the sampled caller's trace", span.SpanContext())
+	}
+}
+
+func TestSetupDisabled(t *testing.T) {
+	shutdown := setupForTest(t, config.Default().Tracing, io.Discard)
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown: %v", err)
+	}
+	if _, span := Start(context.Background(), "anything"); span.IsRecording() {
+		t.Error("span is recorded with tracing off")
+	}
+
+	cfg := config.Default().Tracing
+	cfg.Exporter = "zipkin"
+	if _, err := setup(context.Background(), &cfg, io.Discard); err == nil {
+		t.Error("setup accepted an unknown exporter")
+	}
+}
+
+func TestRecordError(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	_, failed := tracer.Start(context.Background(), "failed")
+	RecordError(failed, errors.New("boom"))
+	failed.End()
+	_, succeeded := tracer.Start(context.Background(), "succeeded")
+	RecordError(succeeded, nil)
+	succeeded.End()
+
+	spans := recorder.Ended()
+	if status := spans[0].Status(); status.Code != codes.Error || status.Description != "boom" || len(spans[0].Events()) != 1 {
+		t.Errorf("failed span: status %+v, %d events", status, len(spans[0].Events()))
+	}
+	if status := spans[1].Status(); status.Code != codes.Unset || len(spans[1].Events()) != 0 {
+		t.Errorf("succeeded span: status %+v, %d events", status, len(spans[1].Events()))
+	}
+}
@@ -0,0 +1,272 @@
+// Package chatclient is a Go client for the chat server's REST and WebSocket
+// APIs, for bots, command-line tools and integration tests.
+//
+// A Client logs in and calls the REST API; Connect opens a Session, which
+// keeps a room's WebSocket connection alive and delivers its events to
+// typed callbacks.
+package chatclient
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultTimeout bounds REST requests made with the default HTTP client.
+const defaultTimeout = 15 * time.Second
+
+// APIError is an error response from the server.
+type APIError struct {
+	Status  int    // HTTP status code
+	Code    string // machine readable code, such as "conflict"
+	Message string // human readable description
+	Field   string // the offending field, when known
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("chatclient: %s (%d)", e.Message, e.Status)
+}
+
+// IsStatus reports whether err is an error response with the given HTTP status.
+func IsStatus(err error, status int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Status == status
+}
+
+// Client calls the REST API as one user. After Login it remembers the
+// credentials, and logs in again when the server reports that the token has
+// expired. Its methods are safe for concurrent use.
+type Client struct {
+	baseURL *url.URL
+	http    *http.Client
+
+	mu       sync.Mutex
+	token    string
+	user     models.User
+	username string
+	password string
+}
+
+// New creates a Client for the server at baseURL, such as
+// "https://chat.example.com". If httpClient is nil, a client with a 15
+// second timeout is used.
+func New(baseURL string, httpClient *http.Client) (*Client, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("chatclient: invalid server URL: %w", err)
+	}
+	if (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("chatclient: server URL must start with http:// or https://, got %q", baseURL)
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/")
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultTimeout}
+	}
+	return &Client{baseURL: base, http: httpClient}, nil
+}
+
+// Register creates an account. It does not log in.
+func (c *Client) Register(ctx context.Context, username, password string) (*models.User, error) {
+	var user models.User
+	body := map[string]string{"username": username, "password": password}
+	if err := c.do(ctx, http.MethodPost, "/api/register", body, &user, false); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Login exchanges a username and password for a token, which later requests
+// and sessions use.
+func (c *Client) Login(ctx context.Context, username, password string) (*models.User, error) {
+	var response struct {
+		Token string `json:"token"`
+		User  struct {
+			ID       string `json:"id"`
+			Username string `json:"username"`
+		} `json:"user"`
+	}
+	body := map[string]string{"username": username, "password": password}
+	if err := c.do(ctx, http.MethodPost, "/api/login", body, &response, false); err != nil {
+		return nil, err
+	}
+
+	user := models.User{ID: response.User.ID, Username: response.User.Username}
+	c.mu.Lock()
+	c.token, c.user = response.Token, user
+	c.username, c.password = username, password
+	c.mu.Unlock()
+	return &user, nil
+}
+
+// SetToken makes the client use a token obtained elsewhere. It cannot be
+// renewed when it expires.
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+	c.username, c.password = "", ""
+}
+
+// Token returns the current token, or "" before Login.
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+// User returns the user that last logged in.
+func (c *Client) User() models.User {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.user
+}
+
+// relogin logs in again with the remembered credentials. It reports false
+// if there are none.
+func (c *Client) relogin(ctx context.Context) (bool, error) {
+	c.mu.Lock()
+	username, password := c.username, c.password
+	c.mu.Unlock()
+	if username == "" {
+		return false, nil
+	}
+	_, err := c.Login(ctx, username, password)
+	return true, err
+}
+
+// Rooms lists the public rooms and the private rooms the user belongs to.
+func (c *Client) Rooms(ctx context.Context) ([]models.ChatRoom, error) {
+	var response struct {
+		Rooms []models.ChatRoom `json:"rooms"`
+	}
+	err := c.do(ctx, http.MethodGet, "/api/rooms", nil, &response, true)
+	return response.Rooms, err
+}
+
+// CreateRoom creates a public room owned by the user.
+func (c *Client) CreateRoom(ctx context.Context, name string) (*models.ChatRoom, error) {
+	var room models.ChatRoom
+	if err := c.do(ctx, http.MethodPost, "/api/rooms/create", map[string]string{"name": name}, &room, true); err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// JoinRoom joins a public room, or asks to join a private one; the returned
+// membership's Status tells which. Joining twice is not an error.
+func (c *Client) JoinRoom(ctx context.Context, roomID string) (*models.RoomMember, error) {
+	var member models.RoomMember
+	if err := c.do(ctx, http.MethodPost, roomPath(roomID, "join"), nil, &member, true); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// LeaveRoom gives up the user's membership of a room.
+func (c *Client) LeaveRoom(ctx context.Context, roomID string) error {
+	return c.do(ctx, http.MethodPost, roomPath(roomID, "leave"), nil, nil, true)
+}
+
+// InviteMember adds another user to a room the user belongs to.
+func (c *Client) InviteMember(ctx context.Context, roomID, username string) (*models.RoomMember, error) {
+	var member models.RoomMember
+	if err := c.do(ctx, http.MethodPost, roomPath(roomID, "invite"), map[string]string{"username": username}, &member, true); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// Messages returns a room's most recent messages, oldest first. If after
+// is not zero, the first messages after it are returned instead, so that
+// passing the Cursor of the last message returned pages forward. limit caps
+// how many; zero leaves it to the server.
+func (c *Client) Messages(ctx context.Context, roomID string, after models.MessageCursor, limit int) ([]models.MessageDTO, error) {
+	query := url.Values{}
+	if !after.IsZero() {
+		query.Set("since", after.Timestamp.Format(time.RFC3339Nano))
+	}
+	if after.ID != "" {
+		query.Set("since_id", after.ID)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	path := roomPath(roomID, "messages")
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var response struct {
+		Messages []models.MessageDTO `json:"messages"`
+	}
+	err := c.do(ctx, http.MethodGet, path, nil, &response, true)
+	return response.Messages, err
+}
+
+// roomPath returns the path of an action on a room.
+func roomPath(roomID, action string) string {
+	return "/api/rooms/" + url.PathEscape(roomID) + "/" + action
+}
+
+// do sends a request with an optional JSON body and decodes the JSON
+// response into out. Authenticated requests refused with 401 are retried
+// once after logging in again.
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}, auth bool) error {
+	err := c.send(ctx, method, path, body, out, auth)
+	if auth && IsStatus(err, http.StatusUnauthorized) {
+		if ok, loginErr := c.relogin(ctx); loginErr != nil {
+			return loginErr
+		} else if ok {
+			err = c.send(ctx, method, path, body, out, auth)
+		}
+	}
+	return err
+}
+
+// send sends one request.
+func (c *Client) send(ctx context.Context, method, path string, body, out interface{}, auth bool) error {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL.String()+path, &payload)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if auth {
+		req.Header.Set("Authorization", "Bearer "+c.Token())
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var response apierror.Response
+		if json.NewDecoder(resp.Body).Decode(&response) != nil || response.Message == "" {
+			response.Message = http.StatusText(resp.StatusCode)
+		}
+		return &APIError{Status: resp.StatusCode, Code: response.Error, Message: response.Message, Field: response.Field}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,644 @@
+package chatclient
+
+import (
+	"backend/internal/config"
+	"backend/internal/hub"
+	"backend/internal/models"
+	"backend/internal/protocol"
+	"backend/internal/server"
+	"backend/internal/services"
+	"backend/internal/store"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testServer is the whole server running in-process on a memory store.
+type testServer struct {
+	URL   string
+	store store.StoreInterface
+	hub   *hub.Hub
+}
+
+// newTestServer starts a server built the same way as cmd/server.
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	dbStore := store.NewMemoryStore()
+	app, err := server.New(config.Default(), dbStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(app.Handler)
+	t.Cleanup(srv.Close)
+	return &testServer{URL: srv.URL, store: dbStore, hub: app.Hub}
+}
+
+// newUser registers and logs in a user, returning its client.
+func newUser(t *testing.T, url, username string) *Client {
+	t.Helper()
+	ctx := context.Background()
+	c, err := New(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Register(ctx, username, "password-"+username); err != nil {
+		t.Fatalf("Register %s: %v", username, err)
+	}
+	if _, err := c.Login(ctx, username, "password-"+username); err != nil {
+		t.Fatalf("Login %s: %v", username, err)
+	}
+	return c
+}
+
+// recorder collects a session's events for a test to wait on.
+type recorder struct {
+	mu       sync.Mutex
+	messages []models.MessageDTO
+	states   []State
+	errs     []error // passed with each state
+	changed  chan struct{}
+}
+
+func newRecorder() *recorder {
+	return &recorder{changed: make(chan struct{}, 1)}
+}
+
+// handlers returns Handlers that record into r.
+func (r *recorder) handlers() Handlers {
+	return Handlers{
+		Message: func(m models.MessageDTO) {
+			r.mu.Lock()
+			r.messages = append(r.messages, m)
+			r.mu.Unlock()
+			r.signal()
+		},
+		StateChange: func(state State, err error) {
+			r.mu.Lock()
+			r.states = append(r.states, state)
+			r.errs = append(r.errs, err)
+			r.mu.Unlock()
+			r.signal()
+		},
+	}
+}
+
+func (r *recorder) signal() {
+	select {
+	case r.changed <- struct{}{}:
+	default:
+	}
+}
+
+// waitFor waits until cond holds for the recorded events.
+func (r *recorder) waitFor(t *testing.T, what string, cond func(messages []models.MessageDTO, states []State) bool) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		r.mu.Lock()
+		ok := cond(r.messages, r.states)
+		r.mu.Unlock()
+		if ok {
+			return
+		}
+		select {
+		case <-r.changed:
+		case <-timeout:
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			t.Fatalf("timed out waiting for %s; messages %+v, states %v", what, r.messages, r.states)
+		}
+	}
+}
+
+func TestREST(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	alice := newUser(t, srv.URL, "alice")
+	bob := newUser(t, srv.URL, "bob")
+
+	if alice.User().Username != "alice" || alice.Token() == "" {
+		t.Fatalf("after login: user %+v, token %q", alice.User(), alice.Token())
+	}
+	if _, err := alice.Register(ctx, "alice", "another"); !IsStatus(err, http.StatusConflict) {
+		t.Errorf("registering a taken name: %v, want 409", err)
+	}
+	if _, err := alice.Login(ctx, "alice", "wrong"); !IsStatus(err, http.StatusUnauthorized) {
+		t.Errorf("login with a wrong password: %v, want 401", err)
+	}
+
+	room, err := alice.CreateRoom(ctx, "lobby")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	var apiErr *APIError
+	if _, err := bob.CreateRoom(ctx, "lobby"); !errors.As(err, &apiErr) || apiErr.Status != http.StatusConflict || apiErr.Field != "name" {
+		t.Errorf("creating a duplicate room: %v, want a 409 naming the field", err)
+	}
+
+	rooms, err := bob.Rooms(ctx)
+	if err != nil || len(rooms) != 1 || rooms[0].ID != room.ID {
+		t.Fatalf("Rooms = %+v, %v; want lobby", rooms, err)
+	}
+	member, err := bob.JoinRoom(ctx, room.ID)
+	if err != nil || member.Status != services.MemberStatusMember {
+		t.Fatalf("JoinRoom = %+v, %v", member, err)
+	}
+	if err := bob.LeaveRoom(ctx, room.ID); err != nil {
+		t.Fatalf("LeaveRoom: %v", err)
+	}
+	if member, err := alice.InviteMember(ctx, room.ID, "bob"); err != nil || member.UserID != bob.User().ID {
+		t.Fatalf("InviteMember = %+v, %v", member, err)
+	}
+
+	messages, err := bob.Messages(ctx, room.ID, models.MessageCursor{}, 10)
+	if err != nil || len(messages) != 0 {
+		t.Errorf("Messages = %+v, %v; want none", messages, err)
+	}
+	if _, err := bob.Messages(ctx, "no-such-room", models.MessageCursor{}, 0); !IsStatus(err, http.StatusNotFound) {
+		t.Errorf("Messages of a missing room: %v, want 404", err)
+	}
+
+	// A token that no longer works is replaced by logging in again
+	bob.mu.Lock()
+	bob.token = "expired"
+	bob.mu.Unlock()
+	if _, err := bob.Rooms(ctx); err != nil {
+		t.Errorf("Rooms with an expired token: %v", err)
+	}
+}
+
+func TestSessionSendAndReceive(t *testing.T) {
+	for _, subprotocol := range []string{"", protocol.JSON, protocol.MessagePack} {
+		t.Run("subprotocol="+subprotocol, func(t *testing.T) {
+			testSessionSendAndReceive(t, subprotocol)
+		})
+	}
+}
+
+// testSessionSendAndReceive runs TestSessionSendAndReceive with the
+// sessions asking for subprotocol.
+func testSessionSendAndReceive(t *testing.T, subprotocol string) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	alice := newUser(t, srv.URL, "alice")
+	bob := newUser(t, srv.URL, "bob")
+	room, err := alice.CreateRoom(ctx, "lobby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bob.JoinRoom(ctx, room.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Bob sees the earlier message as history, then the new one live
+	if _, err := alice.Connect(ctx, "no-such-room", Handlers{}, nil); !IsStatus(err, http.StatusNotFound) {
+		t.Errorf("connecting to a missing room: %v, want 404", err)
+	}
+	aliceSession, err := alice.Connect(ctx, room.ID, Handlers{}, &SessionOptions{Subprotocol: subprotocol})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer aliceSession.Close()
+	first, err := aliceSession.Send(ctx, "first")
+	if err != nil || first.ID == "" || first.Timestamp.IsZero() {
+		t.Fatalf("Send = %+v, %v; want an ack", first, err)
+	}
+
+	bobEvents := newRecorder()
+	bobSession, err := bob.Connect(ctx, room.ID, bobEvents.handlers(), &SessionOptions{History: 10, Subprotocol: subprotocol})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer bobSession.Close()
+	second, err := aliceSession.Send(ctx, "second\n{\"line\": 2}")
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	bobEvents.waitFor(t, "both messages", func(messages []models.MessageDTO, _ []State) bool {
+		return len(messages) == 2
+	})
+	if got := bobEvents.messages; got[0].ID != first.ID || got[1].ID != second.ID || got[1].Sender != "alice" || got[1].Content != "second\n{\"line\": 2}" {
+		t.Errorf("bob received %+v", got)
+	}
+
+	// A refused message answers Send with the server's error
+	archived, err := srv.store.GetRoomByID(room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archived.Archived = true
+	if err := srv.store.UpdateRoom(archived); err != nil {
+		t.Fatal(err)
+	}
+	var sendErr *SendError
+	if _, err := aliceSession.Send(ctx, "too late"); !errors.As(err, &sendErr) || sendErr.Event.Code != models.ErrorCodeRoomArchived {
+		t.Errorf("Send to an archived room: %v, want a room_archived SendError", err)
+	}
+}
+
+func TestSessionResumesAfterReconnect(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	alice := newUser(t, srv.URL, "alice")
+	room, err := alice.CreateRoom(ctx, "lobby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliceSession, err := alice.Connect(ctx, room.ID, Handlers{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer aliceSession.Close()
+
+	// Bob connects through a proxy that can cut his connection
+	proxy := newProxy(t, srv.URL)
+	bob := newUser(t, proxy.URL, "bob")
+	if _, err := bob.JoinRoom(ctx, room.ID); err != nil {
+		t.Fatal(err)
+	}
+	bobEvents := newRecorder()
+	bobSession, err := bob.Connect(ctx, room.ID, bobEvents.handlers(), &SessionOptions{MinBackoff: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bobSession.Close()
+
+	if _, err := aliceSession.Send(ctx, "before"); err != nil {
+		t.Fatal(err)
+	}
+	bobEvents.waitFor(t, "the first message", func(messages []models.MessageDTO, _ []State) bool { return len(messages) == 1 })
+
+	// Messages sent while bob is away are fetched when he is back
+	proxy.pause()
+	bobEvents.waitFor(t, "the connection to drop", func(_ []models.MessageDTO, states []State) bool {
+		return len(states) > 0 && states[len(states)-1] == StateReconnecting
+	})
+	for _, content := range []string{"missed 1", "missed 2"} {
+		if _, err := aliceSession.Send(ctx, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	proxy.resume()
+	bobEvents.waitFor(t, "the missed messages", func(messages []models.MessageDTO, _ []State) bool { return len(messages) >= 3 })
+
+	// Bob can send again once reconnected
+	if _, err := bobSession.Send(ctx, "back"); err != nil {
+		t.Fatalf("Send after reconnecting: %v", err)
+	}
+	bobEvents.waitFor(t, "his own message", func(messages []models.MessageDTO, _ []State) bool { return len(messages) >= 4 })
+
+	var contents []string
+	for _, m := range bobEvents.messages {
+		contents = append(contents, m.Content)
+	}
+	want := []string{"before", "missed 1", "missed 2", "back"}
+	if len(contents) != len(want) {
+		t.Fatalf("bob received %q, want %q", contents, want)
+	}
+	for i := range want {
+		if contents[i] != want[i] {
+			t.Fatalf("bob received %q, want %q", contents, want)
+		}
+	}
+}
+
+func TestSessionPagesThroughMissedMessages(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	alice := newUser(t, srv.URL, "alice")
+	room, err := alice.CreateRoom(ctx, "lobby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliceSession, err := alice.Connect(ctx, room.ID, Handlers{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer aliceSession.Close()
+
+	proxy := newProxy(t, srv.URL)
+	bob := newUser(t, proxy.URL, "bob")
+	if _, err := bob.JoinRoom(ctx, room.ID); err != nil {
+		t.Fatal(err)
+	}
+	bobEvents := newRecorder()
+	bobSession, err := bob.Connect(ctx, room.ID, bobEvents.handlers(), &SessionOptions{MinBackoff: 200 * time.Millisecond, ResumeLimit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bobSession.Close()
+	before, err := aliceSession.Send(ctx, "before")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobEvents.waitFor(t, "the first message", func(messages []models.MessageDTO, _ []State) bool { return len(messages) == 1 })
+
+	// save stores a message directly, as if sent while bob was away
+	user, err := srv.store.GetUserByUsername("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	save := func(id, content string, timestamp time.Time) {
+		t.Helper()
+		message := &models.Message{ID: id, RoomID: room.ID, SenderID: user.ID, Content: content, Timestamp: timestamp}
+		if err := srv.store.SaveMessage(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// More than ResumeLimit messages are missed, the first with the same
+	// timestamp as the last one bob received
+	proxy.pause()
+	bobEvents.waitFor(t, "the connection to drop", func(_ []models.MessageDTO, states []State) bool {
+		return len(states) > 0 && states[len(states)-1] == StateReconnecting
+	})
+	want := []string{"before", "same time"}
+	// Messages sharing a timestamp are ordered by ID, so this one sorts after
+	save(before.ID+"-same", "same time", before.Timestamp)
+	for i := 1; i <= 7; i++ {
+		content := "missed " + strconv.Itoa(i)
+		save(services.GenerateUUID(), content, before.Timestamp.Add(time.Duration(i)*time.Second))
+		want = append(want, content)
+	}
+	proxy.resume()
+	bobEvents.waitFor(t, "the missed messages", func(messages []models.MessageDTO, states []State) bool {
+		return len(messages) >= len(want) && states[len(states)-1] == StateConnected
+	})
+
+	bobEvents.mu.Lock()
+	defer bobEvents.mu.Unlock()
+	var contents []string
+	for _, m := range bobEvents.messages {
+		contents = append(contents, m.Content)
+	}
+	if strings.Join(contents, ",") != strings.Join(want, ",") {
+		t.Fatalf("bob received %q, want %q", contents, want)
+	}
+	if n := len(bobEvents.states); bobEvents.states[n-1] != StateConnected || bobEvents.errs[n-1] != nil {
+		t.Errorf("reconnected with %v, %v; want connected without error", bobEvents.states[n-1], bobEvents.errs[n-1])
+	}
+}
+
+func TestSessionPagesThroughMessagesSharingATimestamp(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	proxy := newProxy(t, srv.URL)
+	alice := newUser(t, proxy.URL, "alice")
+	room, err := alice.CreateRoom(ctx, "lobby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := srv.store.GetUserByUsername("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliceEvents := newRecorder()
+	aliceSession, err := alice.Connect(ctx, room.ID, aliceEvents.handlers(), &SessionOptions{MinBackoff: 200 * time.Millisecond, ResumeLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer aliceSession.Close()
+
+	// Five missed messages share a timestamp, and a page holds two
+	proxy.pause()
+	aliceEvents.waitFor(t, "the connection to drop", func(_ []models.MessageDTO, states []State) bool {
+		return len(states) > 0 && states[len(states)-1] == StateReconnecting
+	})
+	timestamp := time.Now().UTC().Truncate(time.Microsecond)
+	var want []string
+	for _, content := range []string{"one", "two", "three", "four", "five"} {
+		message := &models.Message{ID: services.GenerateUUID(), RoomID: room.ID, SenderID: user.ID, Content: content, Timestamp: timestamp}
+		if err := srv.store.SaveMessage(message); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, content)
+	}
+	proxy.resume()
+	aliceEvents.waitFor(t, "the missed messages", func(messages []models.MessageDTO, states []State) bool {
+		return len(messages) >= len(want) && states[len(states)-1] == StateConnected
+	})
+
+	aliceEvents.mu.Lock()
+	defer aliceEvents.mu.Unlock()
+	if err := aliceEvents.errs[len(aliceEvents.errs)-1]; err != nil {
+		t.Errorf("reconnected with %v, want no error", err)
+	}
+	var got []string
+	for _, m := range aliceEvents.messages {
+		got = append(got, m.Content)
+	}
+	slices.Sort(got)
+	slices.Sort(want)
+	if len(aliceEvents.messages) != len(want) || !slices.Equal(got, want) {
+		t.Errorf("received %q, want each of %q once", got, want)
+	}
+}
+
+func TestSessionEndsWhenKicked(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	alice := newUser(t, srv.URL, "alice")
+	room, err := alice.CreateRoom(ctx, "lobby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := newRecorder()
+	session, err := alice.Connect(ctx, room.ID, events.handlers(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events.waitFor(t, "the connection", func(_ []models.MessageDTO, states []State) bool { return len(states) == 1 })
+
+	srv.hub.DisconnectUser(room.ID, alice.User().ID, "You have been removed from this room")
+	select {
+	case <-session.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the session did not end")
+	}
+	var closeErr *websocket.CloseError
+	if err := session.Err(); !errors.As(err, &closeErr) || closeErr.Code != websocket.ClosePolicyViolation {
+		t.Errorf("Err = %v, want a policy violation", err)
+	}
+	if _, err := session.Send(ctx, "hello?"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Send after the session ended: %v, want ErrClosed", err)
+	}
+	if states := events.states; states[len(states)-1] != StateClosed {
+		t.Errorf("states = %v, want to end closed", states)
+	}
+}
+
+// proxy forwards TCP connections to a server, and can cut them and refuse
+// new ones to simulate a network outage.
+type proxy struct {
+	URL      string
+	listener net.Listener
+	target   string
+
+	mu     sync.Mutex
+	paused bool
+	conns  []net.Conn
+}
+
+// newProxy starts a proxy in front of the server at serverURL.
+func newProxy(t *testing.T, serverURL string) *proxy {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &proxy{URL: "http://" + listener.Addr().String(), listener: listener, target: serverURL[len("http://"):]}
+	t.Cleanup(func() {
+		listener.Close()
+		p.pause()
+	})
+	go p.serve()
+	return p
+}
+
+func (p *proxy) serve() {
+	for {
+		client, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		p.mu.Lock()
+		paused := p.paused
+		p.mu.Unlock()
+		if paused {
+			client.Close()
+			continue
+		}
+		server, err := net.Dial("tcp", p.target)
+		if err != nil {
+			client.Close()
+			continue
+		}
+		p.mu.Lock()
+		p.conns = append(p.conns, client, server)
+		p.mu.Unlock()
+		go func() { io.Copy(server, client); server.Close() }()
+		go func() { io.Copy(client, server); client.Close() }()
+	}
+}
+
+// pause cuts every connection and refuses new ones until resume.
+func (p *proxy) pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.paused = true
+	for _, conn := range p.conns {
+		conn.Close()
+	}
+	p.conns = nil
+}
+
+// resume accepts connections again.
+func (p *proxy) resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.paused = false
+}
+
+func TestHandleFrame(t *testing.T) {
+	var got []string
+	s := &Session{seen: make(map[string]bool), pending: make(map[string]*pendingSend)}
+	s.handlers = Handlers{
+		Message: func(m models.MessageDTO) { got = append(got, m.Sender+": "+m.Content) },
+		Error:   func(e models.ErrorEvent) { got = append(got, "error: "+e.Message) },
+	}
+	waiting := &pendingSend{ref: "r1", result: make(chan sendResult, 1)}
+	s.pending["r1"] = waiting
+
+	// Older servers batched queued events into one frame, one per line
+	frame := `{"type":"message","id":"1","sender":"alice","content":"hi","timestamp":"2024-05-01T10:00:00Z"}
+{"type":"message","id":"2","sender":"bob","content":"line one\nline two","timestamp":"2024-05-01T10:00:01Z"}
+{"type":"message","id":"1","sender":"alice","content":"hi","timestamp":"2024-05-01T10:00:00Z"}
+{"type":"error","code":"muted","message":"You are muted","ref":"r1"}
+{"type":"error","code":"rate_limited","message":"Too many messages"}`
+	codec, _ := protocol.Lookup(protocol.JSON)
+	s.handleFrame(codec, []byte(frame))
+
+	want := []string{"alice: hi", "bob: line one\nline two", "error: Too many messages"}
+	if len(got) != len(want) {
+		t.Fatalf("handled %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("handled %q, want %q", got, want)
+		}
+	}
+	if !s.last.Timestamp.Equal(time.Date(2024, 5, 1, 10, 0, 1, 0, time.UTC)) || s.last.ID != "2" {
+		t.Errorf("last = %+v, want the newest message's position", s.last)
+	}
+
+	var sendErr *SendError
+	if result := <-waiting.result; !errors.As(result.err, &sendErr) || sendErr.Event.Code != models.ErrorCodeMuted {
+		t.Errorf("the error with a ref answered Send with %+v", result)
+	}
+}
+
+func TestSubprotocolNegotiation(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	alice := newUser(t, srv.URL, "alice")
+	room, err := alice.CreateRoom(ctx, "lobby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/ws?room_id=" + room.ID + "&token=" + alice.Token()
+	dial := func(subprotocols ...string) (*websocket.Conn, *http.Response, error) {
+		dialer := websocket.Dialer{Subprotocols: subprotocols}
+		return dialer.DialContext(ctx, wsURL, nil)
+	}
+
+	if _, resp, err := dial("chat.v2.msgpack"); err == nil || resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("offering only unknown subprotocols: %v, want 400", err)
+	}
+	conn, _, err := dial("chat.v2.msgpack", protocol.MessagePack, protocol.JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn.Subprotocol() != protocol.MessagePack {
+		t.Errorf("server chose %q, want the client's first supported choice", conn.Subprotocol())
+	}
+	conn.Close()
+
+	// Without a subprotocol, every event is its own JSON text message, even
+	// when several are queued at once
+	conn, _, err = dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if conn.Subprotocol() != "" {
+		t.Errorf("server chose %q for a client that offered none", conn.Subprotocol())
+	}
+	for i := 0; i < 3; i++ {
+		if err := conn.WriteJSON(models.Frame{Content: "line one\nline two"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < 3; i++ {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var message models.MessageDTO
+		if err := json.Unmarshal(data, &message); messageType != websocket.TextMessage || err != nil || message.Content != "line one\nline two" {
+			t.Fatalf("message %d is %q (type %d): %v", i, data, messageType, err)
+		}
+	}
+}
@@ -0,0 +1,565 @@
+package chatclient
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/models"
+	"backend/internal/protocol"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// Defaults for SessionOptions
+const (
+	defaultMinBackoff  = 500 * time.Millisecond
+	defaultMaxBackoff  = 30 * time.Second
+	defaultResumeLimit = 200 // the most the history endpoint returns
+)
+
+// maxSeen bounds how many message IDs a session remembers to drop duplicates.
+const maxSeen = 1000
+
+// writeWait bounds how long writing one frame may take.
+const writeWait = 10 * time.Second
+
+var (
+	// ErrClosed is returned by Send once the session has ended.
+	ErrClosed = errors.New("chatclient: session closed")
+
+	// ErrConnectionLost is returned by Send when the connection dropped after
+	// the message was written but before the server acknowledged it. The
+	// message may or may not have been saved; if it was, it is delivered to
+	// the Message handler when the session resumes.
+	ErrConnectionLost = errors.New("chatclient: connection lost before the message was acknowledged")
+)
+
+// SendError is returned by Send when the server refuses a message, for
+// example because the sender is muted or sending too fast.
+type SendError struct {
+	Event models.ErrorEvent
+}
+
+func (e *SendError) Error() string {
+	return "chatclient: message refused: " + e.Event.Message
+}
+
+// State is the state of a session's connection.
+type State int
+
+const (
+	// StateConnected means the connection is open.
+	StateConnected State = iota + 1
+	// StateReconnecting means the connection dropped and is being reopened.
+	StateReconnecting
+	// StateClosed means the session has ended and will not reconnect.
+	StateClosed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// Handlers receives a session's events. Nil handlers are skipped. They are
+// called one at a time, from Connect and then from the session's own
+// goroutines, and should return quickly: the connection is not read while
+// they run. A handler that replies must call Send from another goroutine,
+// since the ack Send waits for cannot be read until the handler returns.
+type Handlers struct {
+	// Message receives each message once, including missed messages fetched
+	// after reconnecting.
+	Message func(models.MessageDTO)
+
+	// MessageDeleted receives deletions by moderators.
+	MessageDeleted func(models.MessageDeletedEvent)
+
+	// Error receives error events that do not answer a Send.
+	Error func(models.ErrorEvent)
+
+	// StateChange is told when the connection opens, drops or closes for
+	// good. err is the reason for StateReconnecting and StateClosed. With
+	// StateConnected it is set if missed messages could not be fetched.
+	StateChange func(state State, err error)
+}
+
+// SessionOptions tunes a session. The zero value uses the defaults.
+type SessionOptions struct {
+	// Dialer opens connections; websocket.DefaultDialer by default.
+	Dialer *websocket.Dialer
+
+	// MinBackoff and MaxBackoff bound the wait between reconnection
+	// attempts, which doubles after each failure. They default to 500ms and 30s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// History is how many of the room's earlier messages are delivered to
+	// the Message handler by Connect.
+	History int
+
+	// ResumeLimit is the most missed messages fetched at once after
+	// reconnecting, 200 by default. More are fetched a page at a time.
+	ResumeLimit int
+
+	// Subprotocol asks the server to encode frames as protocol.JSON or
+	// protocol.MessagePack. By default none is offered, and the server
+	// speaks JSON.
+	Subprotocol string
+}
+
+// Session is a WebSocket connection to one room that reconnects with
+// backoff when it drops. After reconnecting it fetches the messages it
+// missed, a page at a time, so the Message handler sees every message once
+// and in order. Messages are sent with Send, which waits for the server's
+// ack.
+type Session struct {
+	client   *Client
+	roomID   string
+	wsURL    string
+	handlers Handlers
+	opts     SessionOptions
+
+	// outgoing hands messages from Send to the open connection
+	outgoing chan *pendingSend
+	cancel   context.CancelFunc
+	done     chan struct{}
+	err      error // why the session ended, set before done is closed
+
+	mu      sync.Mutex
+	pending map[string]*pendingSend // by ref
+
+	// last is the position of the newest message delivered, and seen the IDs
+	// of the most recent ones, oldest first. Only one goroutine uses them at
+	// a time.
+	last     models.MessageCursor
+	seen     map[string]bool
+	seenList []string
+}
+
+// pendingSend is a message waiting for the server's answer.
+type pendingSend struct {
+	ref     string
+	content string
+	result  chan sendResult // buffered, receives one result
+	written bool            // guarded by Session.mu
+}
+
+// sendResult answers a pendingSend.
+type sendResult struct {
+	ack *models.AckEvent
+	err error
+}
+
+// Connect opens a session to a room. Every message sent to the room after
+// Connect is called is delivered to the Message handler, after the History
+// earlier ones. Connect fails if the room's messages cannot be read or the
+// first connection cannot be made; after that the session reconnects on its
+// own until Close is called or the server refuses it for good, such as
+// after a ban.
+func (c *Client) Connect(ctx context.Context, roomID string, handlers Handlers, opts *SessionOptions) (*Session, error) {
+	s := &Session{
+		client:   c,
+		roomID:   roomID,
+		handlers: handlers,
+		outgoing: make(chan *pendingSend),
+		done:     make(chan struct{}),
+		pending:  make(map[string]*pendingSend),
+		seen:     make(map[string]bool),
+	}
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.Dialer == nil {
+		s.opts.Dialer = websocket.DefaultDialer
+	}
+	if s.opts.MinBackoff <= 0 {
+		s.opts.MinBackoff = defaultMinBackoff
+	}
+	if s.opts.MaxBackoff < s.opts.MinBackoff {
+		s.opts.MaxBackoff = max(defaultMaxBackoff, s.opts.MinBackoff)
+	}
+	if s.opts.ResumeLimit <= 0 {
+		s.opts.ResumeLimit = defaultResumeLimit
+	}
+	if _, ok := protocol.Lookup(s.opts.Subprotocol); !ok {
+		return nil, fmt.Errorf("chatclient: unknown subprotocol %q", s.opts.Subprotocol)
+	}
+
+	wsURL := *c.baseURL
+	wsURL.Scheme = map[string]string{"http": "ws", "https": "wss"}[wsURL.Scheme]
+	wsURL.Path += "/api/ws"
+	s.wsURL = wsURL.String()
+
+	if err := s.start(ctx); err != nil {
+		return nil, err
+	}
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	runCtx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go s.run(runCtx, conn)
+	return s, nil
+}
+
+// RoomID returns the ID of the session's room.
+func (s *Session) RoomID() string {
+	return s.roomID
+}
+
+// Send sends a message to the room and waits until the server has saved it.
+// While the session is reconnecting, Send waits for the connection. A
+// refused message returns a *SendError.
+func (s *Session) Send(ctx context.Context, content string) (*models.AckEvent, error) {
+	p := &pendingSend{ref: uuid.NewString(), content: content, result: make(chan sendResult, 1)}
+	s.mu.Lock()
+	s.pending[p.ref] = p
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, p.ref)
+		s.mu.Unlock()
+	}()
+
+	select {
+	case s.outgoing <- p:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.done:
+		return nil, ErrClosed
+	}
+	select {
+	case result := <-p.result:
+		return result.ack, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.done:
+		return nil, ErrClosed
+	}
+}
+
+// Close ends the session and closes its connection.
+func (s *Session) Close() error {
+	s.cancel()
+	<-s.done
+	return nil
+}
+
+// Done is closed when the session has ended.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns why the session ended: ErrClosed after Close, or the server's
+// refusal. It returns nil while the session is running.
+func (s *Session) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// run serves connections until ctx is done or reconnecting is pointless.
+func (s *Session) run(ctx context.Context, conn *websocket.Conn) {
+	defer func() {
+		s.notify(StateClosed, s.err)
+		close(s.done)
+	}()
+
+	backoff := s.opts.MinBackoff
+	var err error
+	for {
+		if conn != nil {
+			s.notify(StateConnected, s.catchUp(ctx))
+			backoff = s.opts.MinBackoff
+			err = s.serve(ctx, conn)
+			s.failWritten(ErrConnectionLost)
+		}
+		if ctx.Err() != nil {
+			s.err = ErrClosed
+			return
+		}
+		if isFinal(err) {
+			s.err = err
+			return
+		}
+		s.notify(StateReconnecting, err)
+
+		// Jitter keeps clients from reconnecting in step after a restart
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff)))
+		select {
+		case <-ctx.Done():
+			s.err = ErrClosed
+			return
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, s.opts.MaxBackoff)
+		conn, err = s.dial(ctx)
+	}
+}
+
+// dial opens a connection, logging in again once if the token has expired.
+func (s *Session) dial(ctx context.Context) (*websocket.Conn, error) {
+	var header http.Header
+	if s.opts.Subprotocol != "" {
+		header = http.Header{"Sec-WebSocket-Protocol": {s.opts.Subprotocol}}
+	}
+	conn, resp, err := s.opts.Dialer.DialContext(ctx, s.url(), header)
+	if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+		if ok, loginErr := s.client.relogin(ctx); loginErr != nil {
+			return nil, loginErr
+		} else if ok {
+			conn, resp, err = s.opts.Dialer.DialContext(ctx, s.url(), header)
+		}
+	}
+	if err != nil && resp != nil {
+		// The server refused the upgrade with an ordinary HTTP response
+		apiErr := &APIError{Status: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+		var response apierror.Response
+		if json.NewDecoder(resp.Body).Decode(&response) == nil && response.Message != "" {
+			apiErr.Code, apiErr.Message = response.Error, response.Message
+		}
+		return nil, apiErr
+	}
+	return conn, err
+}
+
+// url returns the room's WebSocket URL with the current token.
+func (s *Session) url() string {
+	query := url.Values{"room_id": {s.roomID}, "token": {s.client.Token()}}
+	return s.wsURL + "?" + query.Encode()
+}
+
+// start delivers the History most recent messages and remembers the newest,
+// so that every message sent from now on is delivered even if it arrives
+// before the connection is open.
+func (s *Session) start(ctx context.Context) error {
+	messages, err := s.client.Messages(ctx, s.roomID, models.MessageCursor{}, max(s.opts.History, 1))
+	if err != nil {
+		return err
+	}
+	for i, message := range messages {
+		if i < len(messages)-s.opts.History {
+			s.remember(&message)
+		} else {
+			s.deliver(&message)
+		}
+	}
+	return nil
+}
+
+// catchUp delivers the messages sent since the last one delivered, which
+// the connection that has just opened did not receive. It pages forward
+// through the history from the last message of each page until a page is
+// not full.
+func (s *Session) catchUp(ctx context.Context) error {
+	after := s.last
+	if after.IsZero() {
+		// Every message is newer than the epoch, for rooms that were empty
+		after.Timestamp = time.Unix(0, 0)
+	}
+	for {
+		messages, err := s.client.Messages(ctx, s.roomID, after, s.opts.ResumeLimit)
+		if err != nil {
+			return err
+		}
+		for i := range messages {
+			s.deliver(&messages[i])
+		}
+		if len(messages) < s.opts.ResumeLimit {
+			return nil
+		}
+		after = messages[len(messages)-1].Cursor()
+	}
+}
+
+// serve relays frames in both directions until the connection fails or ctx
+// is done. It returns once the connection's reader has stopped.
+func (s *Session) serve(ctx context.Context, conn *websocket.Conn) error {
+	// The server names the subprotocol it chose, or none for JSON
+	codec, ok := protocol.Lookup(conn.Subprotocol())
+	if !ok {
+		conn.Close()
+		return fmt.Errorf("chatclient: server chose unknown subprotocol %q", conn.Subprotocol())
+	}
+
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			_, frame, err := conn.ReadMessage()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			s.handleFrame(codec, frame)
+		}
+	}()
+
+	// stop closes the connection and waits for the reader
+	stop := func(err error) error {
+		conn.Close()
+		<-readErr
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+			return stop(ctx.Err())
+
+		case err := <-readErr:
+			conn.Close()
+			return err
+
+		case p := <-s.outgoing:
+			s.mu.Lock()
+			_, waiting := s.pending[p.ref]
+			p.written = waiting
+			s.mu.Unlock()
+			if !waiting {
+				continue // Send has given up
+			}
+			message, err := codec.EncodeFrame(models.Frame{Content: p.content, Ref: p.ref})
+			if err != nil {
+				return stop(err)
+			}
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(codec.MessageType(), message); err != nil {
+				return stop(err)
+			}
+		}
+	}
+}
+
+// failWritten answers every message written to the connection that has not
+// been acknowledged with err.
+func (s *Session) failWritten(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.pending {
+		if p.written {
+			p.written = false
+			answer(p, sendResult{err: err})
+		}
+	}
+}
+
+// answer gives a pending message its result, unless it already has one.
+func answer(p *pendingSend, result sendResult) {
+	select {
+	case p.result <- result:
+	default:
+	}
+}
+
+// handleFrame handles the events in one frame. Binary frames may carry
+// several events, and so may JSON frames from older servers, one per line.
+func (s *Session) handleFrame(codec protocol.Codec, frame []byte) {
+	events, err := codec.DecodeEvents(frame)
+	if err != nil && s.handlers.Error != nil {
+		s.handlers.Error(models.ErrorEvent{Type: models.EventTypeError, Message: "unreadable event: " + err.Error()})
+	}
+	for _, event := range events {
+		s.handleEvent(event)
+	}
+}
+
+// handleEvent dispatches one event.
+func (s *Session) handleEvent(event any) {
+	switch event := event.(type) {
+	case models.AckEvent:
+		if p := s.waiting(event.Ref); p != nil {
+			answer(p, sendResult{ack: &event})
+		}
+	case models.ErrorEvent:
+		// Errors with a ref answer a Send
+		if event.Ref != "" {
+			if p := s.waiting(event.Ref); p != nil {
+				answer(p, sendResult{err: &SendError{Event: event}})
+			}
+		} else if s.handlers.Error != nil {
+			s.handlers.Error(event)
+		}
+	case models.MessageDTO:
+		s.deliver(&event)
+	case models.MessageDeletedEvent:
+		if s.handlers.MessageDeleted != nil {
+			s.handlers.MessageDeleted(event)
+		}
+	}
+}
+
+// waiting returns the message waiting for the answer with ref, if any.
+func (s *Session) waiting(ref string) *pendingSend {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending[ref]
+}
+
+// deliver passes a message to the Message handler unless it has been
+// delivered already.
+func (s *Session) deliver(message *models.MessageDTO) {
+	if !s.remember(message) {
+		return
+	}
+	if s.handlers.Message != nil {
+		s.handlers.Message(*message)
+	}
+}
+
+// remember records a message as delivered. It reports false if it already was.
+func (s *Session) remember(message *models.MessageDTO) bool {
+	if s.seen[message.ID] {
+		return false
+	}
+	s.seen[message.ID] = true
+	s.seenList = append(s.seenList, message.ID)
+	if len(s.seenList) > maxSeen {
+		delete(s.seen, s.seenList[0])
+		s.seenList = s.seenList[1:]
+	}
+	if s.last.Precedes(message.Cursor()) {
+		s.last = message.Cursor()
+	}
+	return true
+}
+
+// notify tells the StateChange handler about a change.
+func (s *Session) notify(state State, err error) {
+	if s.handlers.StateChange != nil {
+		s.handlers.StateChange(state, err)
+	}
+}
+
+// isFinal reports whether a connection error means reconnecting is
+// pointless. Kicks, bans, disabled accounts and deleted rooms close the
+// connection with a policy violation, and the upgrade is refused with a 4xx
+// status for rooms that do not exist or users who cannot log in.
+func isFinal(err error) bool {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		return closeErr.Code == websocket.ClosePolicyViolation
+	}
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Status >= 400 && apiErr.Status < 500
+}
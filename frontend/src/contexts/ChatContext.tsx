@@ -52,6 +52,20 @@ export const ChatProvider: React.FC<{ children: ReactNode }> = ({ children }) =>
       socket.onmessage = (event) => {
         try {
           const message = JSON.parse(event.data);
+          if (message.type === 'error') {
+            setState((prevState) => ({
+              ...prevState,
+              error: message.message,
+            }));
+            return;
+          }
+          if (message.type === 'message_deleted') {
+            setState((prevState) => ({
+              ...prevState,
+              messages: prevState.messages.filter((m) => m.id !== message.id),
+            }));
+            return;
+          }
           setState((prevState) => ({
             ...prevState,
             messages: [...prevState.messages, message],
@@ -71,6 +85,15 @@ export const ChatProvider: React.FC<{ children: ReactNode }> = ({ children }) =>
 
       socket.onclose = (event) => {
         console.log(`WebSocket connection closed: ${event.code} ${event.reason || ''}`);
+
+        // 1008 (policy violation) means the server removed us, e.g. a kick or ban
+        if (event.code === 1008) {
+          setState((prevState) => ({
+            ...prevState,
+            error: event.reason || 'You were disconnected from the room',
+          }));
+          return;
+        }
         
         // Attempt to reconnect after a delay if not a clean close
         if (!event.wasClean && state.currentRoom) {